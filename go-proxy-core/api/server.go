@@ -1,12 +1,18 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dualvpn/go-proxy-core/config"
 	"github.com/dualvpn/go-proxy-core/proxy"
@@ -29,20 +35,10 @@ func NewAPIServer(proxyCore *proxy.ProxyCore, port int) *APIServer {
 
 // Start 启动API服务器
 func (as *APIServer) Start() error {
-	mux := http.NewServeMux()
-
-	// 注册路由
-	mux.HandleFunc("/rules", as.handleRules)
-	mux.HandleFunc("/status", as.handleStatus)
-	mux.HandleFunc("/proxy-sources", as.handleProxySources)
-	mux.HandleFunc("/proxy-sources/", as.handleProxySource)
-	mux.HandleFunc("/stats", as.handleStats)
-	mux.HandleFunc("/protocols", as.handleProtocols)
-
 	addr := net.JoinHostPort("127.0.0.1", fmt.Sprintf("%d", as.port))
 	as.server = &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: as.routes(),
 	}
 
 	log.Printf("API server listening on %s", addr)
@@ -51,6 +47,21 @@ func (as *APIServer) Start() error {
 	return as.server.ListenAndServe()
 }
 
+// routes 注册API路由
+func (as *APIServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rules", as.handleRules)
+	mux.HandleFunc("/status", as.handleStatus)
+	mux.HandleFunc("/proxy-sources", as.handleProxySources)
+	mux.HandleFunc("/proxy-sources/", as.handleProxySource)
+	mux.HandleFunc("/stats", as.handleStats)
+	mux.HandleFunc("/protocols", as.handleProtocols)
+	mux.HandleFunc("/protocols/", as.handleProtocol)
+	mux.HandleFunc("/groups", as.handleGroups)
+	mux.HandleFunc("/groups/", as.handleGroup)
+	return mux
+}
+
 // handleRules 处理路由规则API
 func (as *APIServer) handleRules(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -136,6 +147,7 @@ func (as *APIServer) handleProxySources(w http.ResponseWriter, r *http.Request)
 					"server": proxyInfo.Server,
 					"port":   proxyInfo.Port,
 					"config": proxyInfo.Config,
+					"delay":  proxyInfo.DelayHistory(),
 				}
 				proxiesData[pid] = proxyData
 			}
@@ -196,8 +208,11 @@ func (as *APIServer) handleProxySources(w http.ResponseWriter, r *http.Request)
 			Proxies: make(map[string]*proxy.ProxyInfo),
 		}
 
-		// 添加代理源
-		as.proxyCore.AddProxySource(source)
+		// 添加代理源，外部内核类型的代理源同时启动内核进程
+		if err := as.proxyCore.AddProxySource(source); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		w.WriteHeader(http.StatusCreated)
 		w.Write([]byte("Proxy source added"))
@@ -232,9 +247,9 @@ func (as *APIServer) handleProxySource(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
 			// 获取代理源信息
-			// 构建代理列表数据
+			// 构建代理列表数据，代理列表可能被后台任务替换，使用副本
 			proxiesData := make(map[string]interface{})
-			for pid, proxyInfo := range source.Proxies {
+			for pid, proxyInfo := range as.proxyCore.GetProxySourceProxies(sourceId) {
 				proxyData := map[string]interface{}{
 					"id":     proxyInfo.ID,
 					"name":   proxyInfo.Name,
@@ -242,6 +257,7 @@ func (as *APIServer) handleProxySource(w http.ResponseWriter, r *http.Request) {
 					"server": proxyInfo.Server,
 					"port":   proxyInfo.Port,
 					"config": proxyInfo.Config,
+					"delay":  proxyInfo.DelayHistory(),
 				}
 				proxiesData[pid] = proxyData
 			}
@@ -272,7 +288,7 @@ func (as *APIServer) handleProxySource(w http.ResponseWriter, r *http.Request) {
 		case "GET":
 			// 获取代理源的所有代理
 			proxiesData := make(map[string]interface{})
-			for pid, proxyInfo := range source.Proxies {
+			for pid, proxyInfo := range as.proxyCore.GetProxySourceProxies(sourceId) {
 				proxyData := map[string]interface{}{
 					"id":     proxyInfo.ID,
 					"name":   proxyInfo.Name,
@@ -280,6 +296,7 @@ func (as *APIServer) handleProxySource(w http.ResponseWriter, r *http.Request) {
 					"server": proxyInfo.Server,
 					"port":   proxyInfo.Port,
 					"config": proxyInfo.Config,
+					"delay":  proxyInfo.DelayHistory(),
 				}
 				proxiesData[pid] = proxyData
 			}
@@ -458,7 +475,14 @@ func (as *APIServer) handleProxySource(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// 设置当前代理
-			as.proxyCore.SetCurrentProxy(sourceId, proxyInfo)
+			if err := as.proxyCore.SetCurrentProxy(sourceId, proxyInfo); err != nil {
+				status := http.StatusInternalServerError
+				if errors.Is(err, proxy.ErrProtocolNotImplemented) {
+					status = http.StatusNotImplemented
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
 
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("Current proxy set"))
@@ -468,10 +492,266 @@ func (as *APIServer) handleProxySource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 如果路径是 /proxy-sources/{id}/proxies/{pid}/delay
+	if len(parts) == 4 && parts[1] == "proxies" && parts[3] == "delay" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		proxyInfo := as.proxyCore.GetProxy(sourceId, parts[2])
+		if proxyInfo == nil {
+			http.Error(w, "Proxy not found", http.StatusNotFound)
+			return
+		}
+
+		testURL, timeout, err := parseDelayQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		record := as.proxyCore.TestProxyDelay(ctx, sourceId, proxyInfo, testURL)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"result":  record,
+			"history": proxyInfo.DelayHistory(),
+		})
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/proxies/{pid}/share-link，生成代理的分享链接
+	if len(parts) == 4 && parts[1] == "proxies" && parts[3] == "share-link" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		proxyInfo := as.proxyCore.GetProxy(sourceId, parts[2])
+		if proxyInfo == nil {
+			http.Error(w, "Proxy not found", http.StatusNotFound)
+			return
+		}
+
+		link, err := proxyInfo.ShareLink()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":   proxyInfo.ID,
+			"name": proxyInfo.Name,
+			"link": link,
+		})
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/import-links，导入分享链接
+	// 请求体可以是{"links": [...]}，也可以是每行一个链接的文本（整段可以是base64编码的）
+	if len(parts) == 2 && parts[1] == "import-links" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, 16<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		text := string(body)
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+			var requestData struct {
+				Links []string `json:"links"`
+			}
+			if err := json.Unmarshal(trimmed, &requestData); err != nil {
+				log.Printf("解析导入分享链接请求体失败: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			text = strings.Join(requestData.Links, "\n")
+		}
+
+		imported, errs, err := as.proxyCore.ImportShareLinks(sourceId, text)
+		errorsData := make([]string, 0, len(errs))
+		for _, e := range errs {
+			errorsData = append(errorsData, e.Error())
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":  err.Error(),
+				"errors": errorsData,
+			})
+			return
+		}
+
+		proxiesData := make([]map[string]interface{}, 0, len(imported))
+		for _, proxyInfo := range imported {
+			proxiesData = append(proxiesData, map[string]interface{}{
+				"id":     proxyInfo.ID,
+				"name":   proxyInfo.Name,
+				"type":   string(proxyInfo.Type),
+				"server": proxyInfo.Server,
+				"port":   proxyInfo.Port,
+				"config": proxyInfo.Config,
+			})
+		}
+		log.Printf("代理源 %s 导入了 %d 个代理，%d 个链接无法解析", sourceId, len(imported), len(errs))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"imported": proxiesData,
+			"errors":   errorsData,
+		})
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/failover
+	if len(parts) == 2 && parts[1] == "failover" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// 获取故障切换状态和最近的切换事件
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(as.proxyCore.GetFailoverStatus(sourceId))
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/core，获取外部内核的状态和日志
+	if len(parts) == 2 && parts[1] == "core" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status, ok := as.proxyCore.GetExternalCoreStatus(sourceId)
+		if !ok {
+			http.Error(w, "Proxy source has no external core", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/core/restart，重启外部内核
+	if len(parts) == 3 && parts[1] == "core" && parts[2] == "restart" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := as.proxyCore.GetExternalCoreStatus(sourceId); !ok {
+			http.Error(w, "Proxy source has no external core", http.StatusNotFound)
+			return
+		}
+		if err := as.proxyCore.RestartExternalCore(sourceId); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("External core restarting"))
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/subscription，获取订阅状态
+	if len(parts) == 2 && parts[1] == "subscription" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status, ok := as.proxyCore.GetSubscriptionStatus(sourceId)
+		if !ok {
+			http.Error(w, "Proxy source has no subscription", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/subscription/refresh，立即更新订阅
+	if len(parts) == 3 && parts[1] == "subscription" && parts[2] == "refresh" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if _, ok := as.proxyCore.GetSubscriptionStatus(sourceId); !ok {
+			http.Error(w, "Proxy source has no subscription", http.StatusNotFound)
+			return
+		}
+		status, err := as.proxyCore.RefreshSubscription(r.Context(), sourceId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	// 如果路径是 /proxy-sources/{id}/delay，测试代理源的所有代理
+	if len(parts) == 2 && parts[1] == "delay" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		testURL, timeout, err := parseDelayQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := as.proxyCore.TestProxySourceDelay(r.Context(), sourceId, testURL, timeout)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"delays": results})
+		return
+	}
+
 	// 其他路径
 	http.Error(w, "Not found", http.StatusNotFound)
 }
 
+// parseDelayQuery 读取延迟测试的url和timeout（毫秒）参数
+func parseDelayQuery(r *http.Request) (string, time.Duration, error) {
+	query := r.URL.Query()
+	testURL := query.Get("url")
+	if testURL == "" {
+		testURL = proxy.DefaultTestURL
+	}
+
+	timeout := proxy.DefaultTestTimeout
+	if value := query.Get("timeout"); value != "" {
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms <= 0 {
+			return "", 0, fmt.Errorf("invalid timeout: %s", value)
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	return testURL, timeout, nil
+}
+
 // handleStats 处理统计信息API
 func (as *APIServer) handleStats(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -606,6 +886,10 @@ func (as *APIServer) handleProtocols(w http.ResponseWriter, r *http.Request) {
 
 		// 创建协议
 		_, err := as.proxyCore.GetProtocolManager().CreateProtocol(proxy.ProtocolType(protocolType), protocolName, config)
+		if errors.Is(err, proxy.ErrProtocolNotImplemented) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -618,6 +902,184 @@ func (as *APIServer) handleProtocols(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleProtocol 处理协议类型相关的API
+func (as *APIServer) handleProtocol(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/protocols/")
+	parts := strings.Split(path, "/")
+
+	// 如果路径是 /protocols/capabilities
+	if len(parts) == 1 && parts[0] == "capabilities" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		response := map[string]interface{}{
+			"capabilities": as.proxyCore.GetProtocolManager().Capabilities(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// 如果路径是 /protocols/{type}/schema
+	if len(parts) == 2 && parts[1] == "schema" {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		schema, err := as.proxyCore.GetProtocolManager().Schema(proxy.ProtocolType(parts[0]))
+		if errors.Is(err, proxy.ErrProtocolNotImplemented) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		json.NewEncoder(w).Encode(schema)
+		return
+	}
+
+	http.Error(w, "Not found", http.StatusNotFound)
+}
+
+// handleGroups 处理代理组列表API
+func (as *APIServer) handleGroups(w http.ResponseWriter, r *http.Request) {
+	pm := as.proxyCore.GetProtocolManager()
+
+	switch r.Method {
+	case "GET":
+		// 获取所有代理组
+		groupsData := make(map[string]interface{})
+		for name, group := range pm.GetGroups() {
+			groupsData[name] = group.Info()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"groups": groupsData})
+	case "POST":
+		// 添加或替换代理组
+		var requestData map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		groupName, ok := requestData["name"].(string)
+		if !ok || groupName == "" {
+			http.Error(w, "Missing group name", http.StatusBadRequest)
+			return
+		}
+
+		groupType, ok := requestData["type"].(string)
+		if !ok || !proxy.IsGroupType(proxy.ProtocolType(groupType)) {
+			http.Error(w, "Invalid group type", http.StatusBadRequest)
+			return
+		}
+
+		config := make(map[string]interface{})
+		for k, v := range requestData {
+			if k != "type" {
+				config[k] = v
+			}
+		}
+
+		// 替换同名代理组时，旧代理组在已有连接结束后由协议管理器关闭
+		group, err := pm.CreateProtocol(proxy.ProtocolType(groupType), groupName, config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(group.(*proxy.ProxyGroup).Info())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleGroup 处理单个代理组API
+func (as *APIServer) handleGroup(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/groups/")
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] == "" {
+		http.Error(w, "Invalid group name", http.StatusBadRequest)
+		return
+	}
+
+	pm := as.proxyCore.GetProtocolManager()
+	groupName := parts[0]
+	group := pm.GetGroup(groupName)
+	if group == nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
+	// 如果路径是 /groups/{name}
+	if len(parts) == 1 {
+		switch r.Method {
+		case "GET":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(group.Info())
+		case "DELETE":
+			pm.RemoveProtocol(groupName)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// 如果路径是 /groups/{name}/selected
+	if len(parts) == 2 && parts[1] == "selected" {
+		switch r.Method {
+		case "PUT":
+			// 选择select组使用的成员
+			var requestData map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			member, ok := requestData["name"].(string)
+			if !ok {
+				http.Error(w, "Missing member name", http.StatusBadRequest)
+				return
+			}
+
+			if err := group.Select(member); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(group.Info())
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// 如果路径是 /groups/{name}/healthcheck
+	if len(parts) == 2 && parts[1] == "healthcheck" {
+		switch r.Method {
+		case "POST":
+			// 立即检查所有成员并返回结果
+			group.HealthCheck(r.Context())
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(group.Info())
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	http.Error(w, "Not found", http.StatusNotFound)
+}
+
 // formatSpeed 将字节速率格式化为人类可读的字符串
 func formatSpeed(bytesPerSecond uint64) string {
 	if bytesPerSecond < 1024 {
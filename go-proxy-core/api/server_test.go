@@ -0,0 +1,210 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+	"github.com/dualvpn/go-proxy-core/proxy"
+)
+
+// newTestAPI 创建使用默认协议的核心和API路由
+func newTestAPI(t *testing.T) (*proxy.ProxyCore, http.Handler) {
+	t.Helper()
+	pc := proxy.NewProxyCore(&config.Config{})
+	return pc, NewAPIServer(pc, 0).routes()
+}
+
+// request 发送API请求，body不为nil时编码为JSON
+func request(t *testing.T, handler http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, &reader))
+	return recorder
+}
+
+// decodeGroup 解析返回的代理组信息
+func decodeGroup(t *testing.T, recorder *httptest.ResponseRecorder, wantStatus int) proxy.GroupInfo {
+	t.Helper()
+	if recorder.Code != wantStatus {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, wantStatus, recorder.Body)
+	}
+	var info proxy.GroupInfo
+	if err := json.NewDecoder(recorder.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestGroupsAPI(t *testing.T) {
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer probe.Close()
+	pc, handler := newTestAPI(t)
+	defer pc.GetProtocolManager().RemoveProtocol("manual")
+
+	info := decodeGroup(t, request(t, handler, "POST", "/groups", map[string]interface{}{
+		"name":     "manual",
+		"type":     "select",
+		"proxies":  []string{"direct", "socks5"},
+		"url":      probe.URL,
+		"interval": 0,
+	}), http.StatusCreated)
+	if info.Name != "manual" || info.Type != proxy.ProtocolSelect || info.Now != "direct" || len(info.Members) != 2 {
+		t.Fatalf("created group = %+v", info)
+	}
+	decodeGroup(t, request(t, handler, "POST", "/groups", map[string]interface{}{
+		"name": "outer", "type": "fallback", "proxies": "manual", "url": probe.URL, "interval": 0,
+	}), http.StatusCreated)
+
+	for _, tc := range []struct {
+		name string
+		body map[string]interface{}
+	}{
+		{"missing name", map[string]interface{}{"type": "select", "proxies": "direct"}},
+		{"invalid type", map[string]interface{}{"name": "g", "type": "socks5", "proxies": "direct"}},
+		{"no members", map[string]interface{}{"name": "g", "type": "select"}},
+		{"loop", map[string]interface{}{"name": "manual", "type": "select", "proxies": "direct,outer"}},
+	} {
+		if recorder := request(t, handler, "POST", "/groups", tc.body); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tc.name, recorder.Code)
+		}
+	}
+
+	recorder := request(t, handler, "GET", "/groups", nil)
+	var list struct {
+		Groups map[string]proxy.GroupInfo `json:"groups"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Groups) != 2 || list.Groups["manual"].Now != "direct" || list.Groups["outer"].Type != proxy.ProtocolFallback {
+		t.Fatalf("groups = %+v", list.Groups)
+	}
+
+	info = decodeGroup(t, request(t, handler, "PUT", "/groups/manual/selected", map[string]string{"name": "socks5"}), http.StatusOK)
+	if info.Now != "socks5" {
+		t.Fatalf("now = %s after selecting socks5", info.Now)
+	}
+	if recorder := request(t, handler, "PUT", "/groups/manual/selected", map[string]string{"name": "missing"}); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("selecting an unknown member: status = %d", recorder.Code)
+	}
+	if recorder := request(t, handler, "PUT", "/groups/outer/selected", map[string]string{"name": "manual"}); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("selecting in a fallback group: status = %d", recorder.Code)
+	}
+
+	// 直连成员可以访问探测地址
+	info = decodeGroup(t, request(t, handler, "POST", "/groups/manual/healthcheck", nil), http.StatusOK)
+	if !info.Members[0].Alive || info.Members[0].LastCheck == nil {
+		t.Fatalf("direct member after health check = %+v", info.Members[0])
+	}
+
+	if recorder := request(t, handler, "GET", "/groups/missing", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("missing group: status = %d", recorder.Code)
+	}
+	if recorder := request(t, handler, "GET", "/groups/direct", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("non-group protocol: status = %d", recorder.Code)
+	}
+	if recorder := request(t, handler, "DELETE", "/groups/outer", nil); recorder.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d", recorder.Code)
+	}
+	if recorder := request(t, handler, "GET", "/groups/outer", nil); recorder.Code != http.StatusNotFound {
+		t.Fatalf("deleted group: status = %d", recorder.Code)
+	}
+}
+
+func TestDelayAPI(t *testing.T) {
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer probe.Close()
+	pc, handler := newTestAPI(t)
+	if err := pc.AddProxySource(&proxy.ProxySource{
+		ID:     "source",
+		Config: map[string]interface{}{},
+		Proxies: map[string]*proxy.ProxyInfo{
+			"a": {ID: "a", Name: "a", Type: proxy.ProtocolDIRECT, Config: map[string]interface{}{}},
+			"b": {ID: "b", Name: "b", Type: proxy.ProtocolDIRECT, Config: map[string]interface{}{}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("source")
+
+	path := "/proxy-sources/source/proxies/a/delay?url=" + url.QueryEscape(probe.URL+"/generate_204")
+	for i := 0; i < 2; i++ {
+		recorder := request(t, handler, "GET", path, nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+		}
+		var response struct {
+			Result  proxy.DelayRecord   `json:"result"`
+			History []proxy.DelayRecord `json:"history"`
+		}
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Result.Error != "" || response.Result.StatusCode != http.StatusNoContent || len(response.History) != i+1 {
+			t.Fatalf("response = %+v", response)
+		}
+	}
+
+	// 超时作为测试结果返回，不是请求错误
+	start := time.Now()
+	recorder := request(t, handler, "GET", "/proxy-sources/source/proxies/b/delay?timeout=100&url="+url.QueryEscape(probe.URL+"/slow"), nil)
+	var response struct {
+		Result proxy.DelayRecord `json:"result"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusOK || response.Result.Error == "" {
+		t.Fatalf("slow target: status = %d, result = %+v", recorder.Code, response.Result)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("timeout took %s", elapsed)
+	}
+
+	recorder = request(t, handler, "GET", "/proxy-sources/source/delay?timeout=2000&url="+url.QueryEscape(probe.URL+"/generate_204"), nil)
+	var batch struct {
+		Delays map[string]proxy.DelayRecord `json:"delays"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.Delays) != 2 || batch.Delays["a"].Error != "" || batch.Delays["b"].Error != "" {
+		t.Fatalf("delays = %+v", batch.Delays)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		status int
+	}{
+		{"/proxy-sources/source/proxies/a/delay?timeout=soon", http.StatusBadRequest},
+		{"/proxy-sources/source/delay?timeout=-1", http.StatusBadRequest},
+		{"/proxy-sources/source/proxies/missing/delay", http.StatusNotFound},
+		{"/proxy-sources/missing/delay", http.StatusNotFound},
+	} {
+		if recorder := request(t, handler, "GET", tc.path, nil); recorder.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.path, recorder.Code, tc.status)
+		}
+	}
+}
@@ -15,9 +15,36 @@ type Config struct {
 	DNSPort     int    `yaml:"dns_port"`
 	DNSType     string `yaml:"dns_type"` // "fakeip" or "doh"
 	DoHServer   string `yaml:"doh_server"`
+	// 出站连接超时时间（秒），包括连接代理服务器和完成握手
+	ConnectTimeout int `yaml:"connect_timeout"`
 	// 移除Clash相关的端口配置，因为不再需要特定的Clash实现
 	// 移除RulesFile字段，因为规则将通过API动态配置
 	LogLevel string `yaml:"log_level"`
+	// 直连出站的套接字选项，OpenVPN推送路由后使直连流量仍从物理网卡出站
+	Direct DirectConfig `yaml:"direct"`
+	// 代理组，规则的proxy_source可以使用组名
+	ProxyGroups []ProxyGroupConfig `yaml:"proxy_groups"`
+}
+
+// DirectConfig 直连出站配置
+type DirectConfig struct {
+	Interface     string `yaml:"interface"`      // 绑定的网卡名称
+	SourceAddress string `yaml:"source_address"` // 本地源地址
+	RoutingMark   int    `yaml:"routing_mark"`   // Linux fwmark
+	IPStrategy    string `yaml:"ip_strategy"`    // 地址族策略: ipv4-only/ipv6-only/prefer-ipv4/prefer-ipv6，默认双栈并行
+}
+
+// ProxyGroupConfig 代理组配置
+type ProxyGroupConfig struct {
+	Name      string   `yaml:"name"`
+	Type      string   `yaml:"type"`      // select/url-test/fallback/load-balance
+	Proxies   []string `yaml:"proxies"`   // 成员，可以是代理源ID、协议名称、其他代理组或DIRECT
+	URL       string   `yaml:"url"`       // 健康检查地址
+	Interval  *int     `yaml:"interval"`  // 健康检查间隔（秒），自动选择类代理组默认300，0表示不定期检查
+	Timeout   int      `yaml:"timeout"`   // 健康检查超时（毫秒）
+	Tolerance int      `yaml:"tolerance"` // url-test切换成员的延迟容差（毫秒）
+	Lazy      *bool    `yaml:"lazy"`      // 未使用时跳过健康检查，默认true
+	Strategy  string   `yaml:"strategy"`  // load-balance策略: consistent-hashing/round-robin
 }
 
 // LoadConfig 从文件加载配置
@@ -38,13 +65,14 @@ func LoadConfig(filename string) (*Config, error) {
 // DefaultConfig 返回默认配置
 func DefaultConfig() *Config {
 	return &Config{
-		HTTPPort:    6160,
-		Socks5Port:  6161,
-		APIPort:     6162,
-		OpenVPNPort: 1080,
-		DNSPort:     53,
-		DNSType:     "fakeip",
-		DoHServer:   "https://1.1.1.1/dns-query",
+		HTTPPort:       6160,
+		Socks5Port:     6161,
+		APIPort:        6162,
+		OpenVPNPort:    1080,
+		DNSPort:        53,
+		DNSType:        "fakeip",
+		DoHServer:      "https://1.1.1.1/dns-query",
+		ConnectTimeout: 10,
 		// 移除Clash相关的端口配置
 		// 移除RulesFile字段
 		LogLevel: "info",
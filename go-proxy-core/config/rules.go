@@ -4,7 +4,7 @@ package config
 type Rule struct {
 	Type        string `yaml:"type" json:"type"`                 // "DOMAIN", "IP-CIDR", "MATCH"
 	Pattern     string `yaml:"pattern" json:"pattern"`           // 匹配模式
-	ProxySource string `yaml:"proxy_source" json:"proxy_source"` // 代理源: "clash", "openvpn", "DIRECT"
+	ProxySource string `yaml:"proxy_source" json:"proxy_source"` // 代理源: "clash", "openvpn", "DIRECT"，多个用逗号分隔时按顺序回退，可用@指定超时如"openvpn-source@3s, clash, DIRECT"
 	Enabled     bool   `yaml:"enabled" json:"enabled"`           // 是否启用
 }
 
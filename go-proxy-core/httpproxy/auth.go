@@ -0,0 +1,197 @@
+package httpproxy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+	krbconfig "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// 支持的认证方式
+const (
+	AuthBasic     = "basic"
+	AuthNTLM      = "ntlm"
+	AuthNegotiate = "negotiate"
+)
+
+// maxAuthLegs 单个连接上最多进行的认证交互次数
+const maxAuthLegs = 4
+
+// KerberosConfig Negotiate认证使用的Kerberos配置，优先使用keytab，否则使用ccache
+type KerberosConfig struct {
+	Krb5Conf string // krb5.conf路径，为空时使用/etc/krb5.conf
+	Realm    string // 使用keytab时的域
+	Keytab   string // keytab文件路径
+	CCache   string // 凭据缓存文件路径，为空时使用KRB5CCNAME或默认路径
+	SPN      string // 代理服务的SPN，默认为HTTP/<代理主机名>
+}
+
+// authenticator 代理认证方式，initial生成首个认证头，
+// next根据407响应中的challenge生成后续认证头，返回空字符串表示认证结束
+type authenticator interface {
+	scheme() string
+	initial() (string, error)
+	next(challenge string) (string, error)
+}
+
+// newAuthenticator 根据配置创建认证器，未配置认证时返回nil
+func (c *Client) newAuthenticator() (authenticator, error) {
+	switch strings.ToLower(c.config.AuthScheme) {
+	case "":
+		if c.config.Username == "" {
+			return nil, nil
+		}
+		return &basicAuthenticator{username: c.config.Username, password: c.config.Password}, nil
+	case AuthBasic:
+		return &basicAuthenticator{username: c.config.Username, password: c.config.Password}, nil
+	case AuthNTLM:
+		return newNTLMAuthenticator(c.config.Username, c.config.Password, c.config.Domain, c.config.Workstation), nil
+	case AuthNegotiate:
+		kc, err := c.kerberosClient()
+		if err != nil {
+			return nil, err
+		}
+		return &negotiateAuthenticator{client: kc, spn: c.spn()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy auth scheme: %s", c.config.AuthScheme)
+	}
+}
+
+// basicAuthenticator Basic认证，只有一次交互
+type basicAuthenticator struct {
+	username string
+	password string
+}
+
+// scheme 返回认证方式名称
+func (a *basicAuthenticator) scheme() string {
+	return "Basic"
+}
+
+// initial 返回Basic认证头
+func (a *basicAuthenticator) initial() (string, error) {
+	return basicAuth(a.username, a.password), nil
+}
+
+// next Basic认证被拒绝后不再重试
+func (a *basicAuthenticator) next(challenge string) (string, error) {
+	return "", nil
+}
+
+// negotiateAuthenticator SPNEGO/Kerberos认证
+type negotiateAuthenticator struct {
+	client *krbclient.Client
+	spn    string
+}
+
+// scheme 返回认证方式名称
+func (a *negotiateAuthenticator) scheme() string {
+	return "Negotiate"
+}
+
+// initial 获取服务票据并生成SPNEGO初始令牌
+func (a *negotiateAuthenticator) initial() (string, error) {
+	token, err := spnego.SPNEGOClient(a.client, a.spn).InitSecContext()
+	if err != nil {
+		return "", fmt.Errorf("failed to get kerberos service ticket for %s: %v", a.spn, err)
+	}
+	data, err := token.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SPNEGO token: %v", err)
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// next Kerberos只需一次交互，再次收到407表示认证失败
+func (a *negotiateAuthenticator) next(challenge string) (string, error) {
+	return "", nil
+}
+
+// kerberosClient 返回已登录的Kerberos客户端，首次使用时根据keytab或ccache创建
+func (c *Client) kerberosClient() (*krbclient.Client, error) {
+	c.krbMu.Lock()
+	defer c.krbMu.Unlock()
+
+	if c.krb != nil {
+		return c.krb, nil
+	}
+
+	kc := c.config.Kerberos
+	confPath := kc.Krb5Conf
+	if confPath == "" {
+		confPath = "/etc/krb5.conf"
+	}
+	conf, err := krbconfig.Load(confPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load krb5 config %s: %v", confPath, err)
+	}
+
+	var cl *krbclient.Client
+	switch {
+	case kc.Keytab != "":
+		kt, err := keytab.Load(kc.Keytab)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load keytab %s: %v", kc.Keytab, err)
+		}
+		realm := kc.Realm
+		if realm == "" {
+			realm = conf.LibDefaults.DefaultRealm
+		}
+		cl = krbclient.NewWithKeytab(c.config.Username, realm, kt, conf, krbclient.DisablePAFXFAST(true))
+	default:
+		ccache := kc.CCache
+		if ccache == "" {
+			ccache = defaultCCachePath()
+		}
+		cc, err := credentials.LoadCCache(ccache)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kerberos ccache %s: %v", ccache, err)
+		}
+		cl, err = krbclient.NewFromCCache(cc, conf, krbclient.DisablePAFXFAST(true))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kerberos client from ccache: %v", err)
+		}
+	}
+
+	if err := cl.AffirmLogin(); err != nil {
+		return nil, fmt.Errorf("kerberos login failed: %v", err)
+	}
+
+	c.krb = cl
+	return cl, nil
+}
+
+// defaultCCachePath 返回默认的凭据缓存路径，优先使用KRB5CCNAME环境变量
+func defaultCCachePath() string {
+	if name := os.Getenv("KRB5CCNAME"); name != "" {
+		return strings.TrimPrefix(name, "FILE:")
+	}
+	return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+}
+
+// spn 返回代理服务的SPN
+func (c *Client) spn() string {
+	if c.config.Kerberos.SPN != "" {
+		return c.config.Kerberos.SPN
+	}
+	host, _, _ := net.SplitHostPort(c.config.Server)
+	return "HTTP/" + host
+}
+
+// findChallenge 从407响应中找到指定认证方式的challenge数据
+func findChallenge(values []string, scheme string) (string, bool) {
+	for _, value := range values {
+		name, data, _ := strings.Cut(strings.TrimSpace(value), " ")
+		if strings.EqualFold(name, scheme) {
+			return strings.TrimSpace(data), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,257 @@
+package httpproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/tlsclient"
+	krbclient "github.com/jcmturner/gokrb5/v8/client"
+)
+
+const (
+	// defaultDialTimeout 连接代理服务器并完成CONNECT的默认超时时间
+	defaultDialTimeout = 5 * time.Second
+	// defaultUserAgent CONNECT请求默认的User-Agent
+	defaultUserAgent = "DualVPN-Proxy/1.0"
+)
+
+// ErrProxyAuthRequired 代理服务器返回407，需要认证或认证失败
+var ErrProxyAuthRequired = errors.New("proxy authentication required")
+
+// ClientConfig HTTP代理客户端配置
+type ClientConfig struct {
+	Server      string            // 代理服务器地址 host:port
+	Username    string            // 用户名，为空时不发送认证信息
+	Password    string            // 密码
+	AuthScheme  string            // 认证方式: basic/ntlm/negotiate，为空时有用户名则使用basic
+	Domain      string            // NTLM认证的域名
+	Workstation string            // NTLM认证的工作站名
+	Kerberos    KerberosConfig    // Negotiate认证的Kerberos配置
+	Headers     http.Header       // CONNECT请求附加的自定义头
+	TLS         *tlsclient.Config // 不为空时使用TLS连接代理服务器（https代理）
+	Timeout     time.Duration
+
+	// DialContext 连接代理服务器使用的拨号函数，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client HTTP CONNECT代理客户端
+type Client struct {
+	config ClientConfig
+
+	krbMu sync.Mutex
+	krb   *krbclient.Client
+}
+
+// NewClient 创建新的HTTP代理客户端
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing http proxy server address")
+	}
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http proxy server address %s: %v", config.Server, err)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+	if config.TLS != nil {
+		config.TLS = config.TLS.Clone()
+		if config.TLS.ServerName == "" {
+			config.TLS.ServerName = host
+		}
+	}
+	return &Client{config: config}, nil
+}
+
+// Dial 通过代理服务器建立到目标地址的隧道
+func (c *Client) Dial(targetAddr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	return c.DialContext(ctx, targetAddr)
+}
+
+// DialContext 通过代理服务器建立到目标地址的隧道
+func (c *Client) DialContext(ctx context.Context, targetAddr string) (net.Conn, error) {
+	conn, err := c.dialServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := c.connect(conn, reader, targetAddr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// 隧道建立后取消握手超时
+	conn.SetDeadline(time.Time{})
+
+	// 代理可能在响应后立即发送了隧道数据，需要保留已缓冲的部分
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// dialServer 建立到代理服务器的连接，https代理需要完成TLS握手
+func (c *Client) dialServer(ctx context.Context) (net.Conn, error) {
+	dial := c.config.DialContext
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+	conn, err := dial(ctx, "tcp", c.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to HTTP proxy server %s: %v", c.config.Server, err)
+	}
+
+	if c.config.TLS == nil {
+		return conn, nil
+	}
+
+	tlsConn, err := c.config.TLS.Client(ctx, conn, "http/1.1")
+	if err != nil {
+		return nil, fmt.Errorf("TLS handshake with HTTP proxy server %s failed: %v", c.config.Server, err)
+	}
+	return tlsConn, nil
+}
+
+// connect 发送CONNECT请求并检查响应
+// NTLM等多次交互的认证在同一连接上完成，认证通过后该连接即为隧道
+func (c *Client) connect(conn net.Conn, reader *bufio.Reader, targetAddr string) error {
+	auth, err := c.newAuthenticator()
+	if err != nil {
+		return err
+	}
+
+	var authHeader string
+	if auth != nil {
+		if authHeader, err = auth.initial(); err != nil {
+			return err
+		}
+	}
+
+	for leg := 1; ; leg++ {
+		req := c.newConnectRequest(targetAddr)
+		if authHeader != "" {
+			req.Header.Set("Proxy-Authorization", authHeader)
+		}
+
+		if err := req.Write(conn); err != nil {
+			return fmt.Errorf("failed to send CONNECT request: %v", err)
+		}
+
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			return fmt.Errorf("failed to read CONNECT response: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusProxyAuthRequired || auth == nil || leg >= maxAuthLegs {
+			resp.Body.Close()
+			return c.checkResponse(resp, auth)
+		}
+
+		challenge, ok := findChallenge(resp.Header.Values("Proxy-Authenticate"), auth.scheme())
+		if ok {
+			authHeader, err = auth.next(challenge)
+			if err != nil {
+				resp.Body.Close()
+				return err
+			}
+		}
+		if !ok || authHeader == "" {
+			resp.Body.Close()
+			return c.checkResponse(resp, auth)
+		}
+
+		// 读完407响应体，继续在同一连接上认证
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.Close {
+			return fmt.Errorf("%w: proxy closed the connection during %s handshake", ErrProxyAuthRequired, auth.scheme())
+		}
+	}
+}
+
+// newConnectRequest 构造CONNECT请求
+func (c *Client) newConnectRequest(targetAddr string) *http.Request {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: targetAddr},
+		Host:   targetAddr,
+		Header: make(http.Header),
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	for key, values := range c.config.Headers {
+		req.Header.Del(key)
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	return req
+}
+
+// checkResponse 将CONNECT响应转换为错误
+func (c *Client) checkResponse(resp *http.Response, auth authenticator) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		schemes := strings.Join(authSchemes(resp.Header), ", ")
+		if auth == nil {
+			return fmt.Errorf("%w: no credentials configured, server offers %s", ErrProxyAuthRequired, schemes)
+		}
+		return fmt.Errorf("%w: %s credentials for user %s were rejected, server offers %s", ErrProxyAuthRequired, auth.scheme(), c.config.Username, schemes)
+	default:
+		return fmt.Errorf("CONNECT request failed with status %s", resp.Status)
+	}
+}
+
+// authSchemes 返回Proxy-Authenticate头中声明的认证方式
+func authSchemes(header http.Header) []string {
+	var schemes []string
+	for _, value := range header.Values("Proxy-Authenticate") {
+		scheme, _, _ := strings.Cut(strings.TrimSpace(value), " ")
+		if scheme != "" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	if len(schemes) == 0 {
+		schemes = []string{"unknown"}
+	}
+	return schemes
+}
+
+// basicAuth 生成Basic认证头
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// bufferedConn 优先返回握手时已缓冲的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read 读取数据
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	if bc.reader.Buffered() > 0 {
+		return bc.reader.Read(b)
+	}
+	return bc.Conn.Read(b)
+}
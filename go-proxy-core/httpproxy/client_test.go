@@ -0,0 +1,272 @@
+package httpproxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+// testRealm 测试使用的Kerberos域
+const testRealm = "DUALVPN.TEST"
+
+// dialAndEcho 通过代理建立隧道并验证数据可以往返
+func dialAndEcho(t *testing.T, config ClientConfig, target string) error {
+	t.Helper()
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := client.Dial(target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	testutil.Echo(t, conn, []byte("through the tunnel"))
+	return nil
+}
+
+func TestNoAuth(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "", "", "")
+	if err := dialAndEcho(t, ClientConfig{Server: server.addr()}, target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, AuthBasic, "alice", "secret")
+
+	if err := dialAndEcho(t, ClientConfig{Server: server.addr(), Username: "alice", Password: "secret"}, target); err != nil {
+		t.Fatal(err)
+	}
+
+	err := dialAndEcho(t, ClientConfig{Server: server.addr(), Username: "alice", Password: "wrong"}, target)
+	if !errors.Is(err, ErrProxyAuthRequired) || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("wrong password: %v", err)
+	}
+
+	err = dialAndEcho(t, ClientConfig{Server: server.addr()}, target)
+	if !errors.Is(err, ErrProxyAuthRequired) || !strings.Contains(err.Error(), "server offers Basic") {
+		t.Fatalf("no credentials: %v", err)
+	}
+}
+
+func TestNTLMAuth(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+
+	for _, domain := range []string{"", "DUALVPN"} {
+		server := newTestServer(t, AuthNTLM, "bob", "Passw0rd!")
+		config := ClientConfig{
+			Server:      server.addr(),
+			Username:    "bob",
+			Password:    "Passw0rd!",
+			AuthScheme:  AuthNTLM,
+			Domain:      domain,
+			Workstation: "WS01",
+		}
+		if err := dialAndEcho(t, config, target); err != nil {
+			t.Fatalf("domain=%q: %v", domain, err)
+		}
+		// NEGOTIATE、CHALLENGE、AUTHENTICATE三次交互在同一连接上完成
+		if n := server.accepted.Load(); n != 1 {
+			t.Fatalf("domain=%q: NTLM handshake used %d connections, want 1", domain, n)
+		}
+	}
+
+	server := newTestServer(t, AuthNTLM, "bob", "Passw0rd!")
+	err := dialAndEcho(t, ClientConfig{Server: server.addr(), Username: "bob", Password: "wrong", AuthScheme: AuthNTLM}, target)
+	if !errors.Is(err, ErrProxyAuthRequired) {
+		t.Fatalf("wrong NTLM password: %v", err)
+	}
+}
+
+func TestNTLMv2Response(t *testing.T) {
+	// MS-NLMP 4.2.4.1.1 的NTOWFv2测试向量
+	got := ntowfv2("User", "Password", "Domain")
+	want := []byte{0x0c, 0x86, 0x8a, 0x40, 0x3b, 0xfd, 0x7a, 0x93, 0xa3, 0x00, 0x1e, 0xf2, 0x2e, 0xf0, 0x2e, 0x3f}
+	if string(got) != string(want) {
+		t.Fatalf("ntowfv2 = %x, want %x", got, want)
+	}
+}
+
+func TestNegotiateAuth(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+
+	serverKeytab, krb5Conf, ccache := newKerberosFixture(t, "HTTP/127.0.0.1", "service-secret")
+	server := newTestServer(t, AuthNegotiate, "", "")
+	server.keytab = serverKeytab
+
+	config := ClientConfig{
+		Server:     server.addr(),
+		Username:   "carol",
+		AuthScheme: AuthNegotiate,
+		Kerberos:   KerberosConfig{Krb5Conf: krb5Conf, CCache: ccache},
+	}
+	if err := dialAndEcho(t, config, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务密钥与票据不匹配时认证失败
+	otherKeytab, _, _ := newKerberosFixture(t, "HTTP/127.0.0.1", "other-secret")
+	server.keytab = otherKeytab
+	err := dialAndEcho(t, config, target)
+	if !errors.Is(err, ErrProxyAuthRequired) || !strings.Contains(err.Error(), "Negotiate") {
+		t.Fatalf("mismatched service key: %v", err)
+	}
+}
+
+func TestCustomHeaders(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	got := make(chan http.Header, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		got <- req.Header
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	}()
+
+	client, _ := NewClient(ClientConfig{
+		Server:  listener.Addr().String(),
+		Headers: http.Header{"User-Agent": {"custom-agent"}, "X-Token": {"abc"}},
+	})
+	conn, err := client.Dial("example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	header := <-got
+	if header.Get("User-Agent") != "custom-agent" || header.Get("X-Token") != "abc" {
+		t.Fatalf("CONNECT headers = %v", header)
+	}
+}
+
+// newKerberosFixture 生成服务keytab、krb5.conf和包含TGT及服务票据的ccache，不需要KDC
+func newKerberosFixture(t *testing.T, spn, servicePassword string) (*keytab.Keytab, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Second)
+	start, end := now.Add(-time.Minute), now.Add(time.Hour)
+
+	serviceKeytab := keytab.New()
+	if err := serviceKeytab.AddEntry(spn, testRealm, servicePassword, now, 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+	tgtKeytab := keytab.New()
+	if err := tgtKeytab.AddEntry("krbtgt/"+testRealm, testRealm, "krbtgt-secret", now, 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "carol")
+	ticketFlags := types.NewKrbFlags()
+	types.SetFlag(&ticketFlags, flags.Initial)
+
+	var creds []ccacheCredential
+	for _, entry := range []struct {
+		sname  types.PrincipalName
+		keytab *keytab.Keytab
+	}{
+		{types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testRealm), tgtKeytab},
+		{types.NewPrincipalName(nametype.KRB_NT_SRV_HST, spn), serviceKeytab},
+	} {
+		ticket, sessionKey, err := messages.NewTicket(cname, testRealm, entry.sname, testRealm, ticketFlags, entry.keytab,
+			etypeID.AES256_CTS_HMAC_SHA1_96, 1, start, start, end, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := ticket.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		creds = append(creds, ccacheCredential{server: entry.sname, key: sessionKey, start: start, end: end, ticket: raw})
+	}
+
+	ccachePath := filepath.Join(dir, "krb5cc")
+	if err := os.WriteFile(ccachePath, marshalCCache(cname, testRealm, creds), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	krb5Conf := filepath.Join(dir, "krb5.conf")
+	conf := "[libdefaults]\n default_realm = " + testRealm + "\n" +
+		" default_tkt_enctypes = aes256-cts-hmac-sha1-96\n default_tgs_enctypes = aes256-cts-hmac-sha1-96\n" +
+		" permitted_enctypes = aes256-cts-hmac-sha1-96\n"
+	if err := os.WriteFile(krb5Conf, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return serviceKeytab, krb5Conf, ccachePath
+}
+
+// ccacheCredential ccache中的一个票据
+type ccacheCredential struct {
+	server     types.PrincipalName
+	key        types.EncryptionKey
+	start, end time.Time
+	ticket     []byte
+}
+
+// marshalCCache 按MIT ccache v4格式编码凭据缓存
+func marshalCCache(client types.PrincipalName, realm string, creds []ccacheCredential) []byte {
+	b := []byte{5, 4, 0, 0} // 版本0x0504，无头部字段
+	b = appendPrincipal(b, client, realm)
+	for _, cred := range creds {
+		b = appendPrincipal(b, client, realm)
+		b = appendPrincipal(b, cred.server, realm)
+		b = binary.BigEndian.AppendUint16(b, uint16(cred.key.KeyType))
+		b = appendData(b, cred.key.KeyValue)
+		for _, ts := range []time.Time{cred.start, cred.start, cred.end, cred.end} {
+			b = binary.BigEndian.AppendUint32(b, uint32(ts.Unix()))
+		}
+		b = append(b, 0)          // is_skey
+		b = append(b, 0, 0, 0, 0) // ticket flags
+		b = append(b, 0, 0, 0, 0) // addresses
+		b = append(b, 0, 0, 0, 0) // authdata
+		b = appendData(b, cred.ticket)
+		b = appendData(b, nil) // second ticket
+	}
+	return b
+}
+
+// appendPrincipal 编码主体名称
+func appendPrincipal(b []byte, name types.PrincipalName, realm string) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(name.NameType))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(name.NameString)))
+	b = appendData(b, []byte(realm))
+	for _, component := range name.NameString {
+		b = appendData(b, []byte(component))
+	}
+	return b
+}
+
+// appendData 编码带32位长度前缀的数据
+func appendData(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
@@ -0,0 +1,278 @@
+package httpproxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// NTLM消息类型和标志位（MS-NLMP）
+const (
+	ntlmNegotiateMessage    uint32 = 1
+	ntlmChallengeMessage    uint32 = 2
+	ntlmAuthenticateMessage uint32 = 3
+
+	ntlmNegotiateUnicode          uint32 = 0x00000001
+	ntlmRequestTarget             uint32 = 0x00000004
+	ntlmNegotiateNTLM             uint32 = 0x00000200
+	ntlmNegotiateAlwaysSign       uint32 = 0x00008000
+	ntlmNegotiateExtendedSecurity uint32 = 0x00080000
+	ntlmNegotiateTargetInfo       uint32 = 0x00800000
+	ntlmNegotiate128              uint32 = 0x20000000
+	ntlmNegotiate56               uint32 = 0x80000000
+
+	// TargetInfo中的AV_PAIR类型
+	ntlmAvEOL       uint16 = 0
+	ntlmAvTimestamp uint16 = 7
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmNegotiateFlags 客户端协商使用的标志位
+const ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+	ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSecurity | ntlmNegotiateTargetInfo |
+	ntlmNegotiate128 | ntlmNegotiate56
+
+// ntlmChallenge 解析后的CHALLENGE消息
+type ntlmChallenge struct {
+	flags           uint32
+	serverChallenge []byte
+	targetName      string
+	targetInfo      []byte
+}
+
+// ntlmAuthenticator NTLMv2认证，需要在同一连接上完成三次交互
+type ntlmAuthenticator struct {
+	username    string
+	password    string
+	domain      string
+	workstation string
+}
+
+// newNTLMAuthenticator 创建NTLM认证器，用户名支持DOMAIN\user格式
+func newNTLMAuthenticator(username, password, domain, workstation string) *ntlmAuthenticator {
+	if d, u, ok := strings.Cut(username, `\`); ok && domain == "" {
+		domain, username = d, u
+	}
+	return &ntlmAuthenticator{
+		username:    username,
+		password:    password,
+		domain:      domain,
+		workstation: workstation,
+	}
+}
+
+// scheme 返回认证方式名称
+func (a *ntlmAuthenticator) scheme() string {
+	return "NTLM"
+}
+
+// initial 返回NEGOTIATE消息
+func (a *ntlmAuthenticator) initial() (string, error) {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmNegotiateMessage)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmNegotiateFlags)
+	// 域名和工作站字段留空
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg), nil
+}
+
+// next 根据CHALLENGE消息生成AUTHENTICATE消息
+func (a *ntlmAuthenticator) next(challenge string) (string, error) {
+	if challenge == "" {
+		return "", nil
+	}
+	data, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil {
+		return "", fmt.Errorf("invalid NTLM challenge encoding: %v", err)
+	}
+	chal, err := parseNTLMChallenge(data)
+	if err != nil {
+		return "", err
+	}
+	// CHALLENGE之后的407表示认证失败，不再继续
+	if chal == nil {
+		return "", nil
+	}
+
+	msg, err := a.authenticateMessage(chal)
+	if err != nil {
+		return "", err
+	}
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg), nil
+}
+
+// authenticateMessage 生成NTLMv2的AUTHENTICATE消息
+func (a *ntlmAuthenticator) authenticateMessage(chal *ntlmChallenge) ([]byte, error) {
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	// 服务器提供时间戳时必须使用它，且LM响应置零
+	timestamp, hasTimestamp := ntlmTimestamp(chal.targetInfo)
+	if !hasTimestamp {
+		timestamp = ntlmFileTime(time.Now())
+	}
+
+	// 未配置域名时使用服务器返回的目标名称
+	domainName := a.domain
+	if domainName == "" {
+		domainName = chal.targetName
+	}
+
+	responseKey := ntowfv2(a.username, a.password, domainName)
+	ntResponse := ntlmv2Response(responseKey, chal.serverChallenge, clientChallenge, timestamp, chal.targetInfo)
+
+	var lmResponse []byte
+	if hasTimestamp {
+		lmResponse = make([]byte, 24)
+	} else {
+		mac := hmac.New(md5.New, responseKey)
+		mac.Write(chal.serverChallenge)
+		mac.Write(clientChallenge)
+		lmResponse = append(mac.Sum(nil), clientChallenge...)
+	}
+
+	domain := encodeUTF16(domainName)
+	user := encodeUTF16(a.username)
+	workstation := encodeUTF16(a.workstation)
+
+	const headerLen = 64
+	fields := [][]byte{lmResponse, ntResponse, domain, user, workstation, nil}
+
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmAuthenticateMessage)
+
+	offset := headerLen
+	for i, field := range fields {
+		pos := 12 + i*8
+		binary.LittleEndian.PutUint16(msg[pos:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(msg[pos+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(msg[pos+4:], uint32(offset))
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(msg[60:], chal.flags&ntlmNegotiateFlags|ntlmNegotiateUnicode)
+
+	for _, field := range fields {
+		msg = append(msg, field...)
+	}
+	return msg, nil
+}
+
+// parseNTLMChallenge 解析CHALLENGE消息，空数据返回nil
+func parseNTLMChallenge(data []byte) (*ntlmChallenge, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < 32 || !bytes.Equal(data[:8], ntlmSignature) {
+		return nil, fmt.Errorf("invalid NTLM challenge message")
+	}
+	if binary.LittleEndian.Uint32(data[8:]) != ntlmChallengeMessage {
+		return nil, fmt.Errorf("unexpected NTLM message type: %d", binary.LittleEndian.Uint32(data[8:]))
+	}
+
+	chal := &ntlmChallenge{
+		flags:           binary.LittleEndian.Uint32(data[20:]),
+		serverChallenge: data[24:32],
+	}
+
+	if name, ok := ntlmField(data, 12); ok {
+		chal.targetName = decodeUTF16(name)
+	}
+	if len(data) >= 48 {
+		if info, ok := ntlmField(data, 40); ok {
+			chal.targetInfo = info
+		}
+	}
+	return chal, nil
+}
+
+// ntlmField 读取消息中的安全缓冲区字段 [长度(2)][最大长度(2)][偏移(4)]
+func ntlmField(data []byte, pos int) ([]byte, bool) {
+	if len(data) < pos+8 {
+		return nil, false
+	}
+	length := int(binary.LittleEndian.Uint16(data[pos:]))
+	offset := int(binary.LittleEndian.Uint32(data[pos+4:]))
+	if length == 0 || offset+length > len(data) {
+		return nil, false
+	}
+	return data[offset : offset+length], true
+}
+
+// ntlmTimestamp 从TargetInfo中读取服务器时间戳
+func ntlmTimestamp(targetInfo []byte) ([]byte, bool) {
+	for pos := 0; pos+4 <= len(targetInfo); {
+		id := binary.LittleEndian.Uint16(targetInfo[pos:])
+		length := int(binary.LittleEndian.Uint16(targetInfo[pos+2:]))
+		pos += 4
+		if id == ntlmAvEOL || pos+length > len(targetInfo) {
+			break
+		}
+		if id == ntlmAvTimestamp && length == 8 {
+			return targetInfo[pos : pos+8], true
+		}
+		pos += length
+	}
+	return nil, false
+}
+
+// ntowfv2 计算NTLMv2响应密钥
+func ntowfv2(username, password, domain string) []byte {
+	h := md4.New()
+	h.Write(encodeUTF16(password))
+	mac := hmac.New(md5.New, h.Sum(nil))
+	mac.Write(encodeUTF16(strings.ToUpper(username) + domain))
+	return mac.Sum(nil)
+}
+
+// ntlmv2Response 计算NTLMv2响应 NTProofStr + blob
+func ntlmv2Response(responseKey, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	blob := []byte{0x01, 0x01, 0, 0, 0, 0, 0, 0}
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	mac := hmac.New(md5.New, responseKey)
+	mac.Write(serverChallenge)
+	mac.Write(blob)
+	return append(mac.Sum(nil), blob...)
+}
+
+// ntlmFileTime 转换为Windows FILETIME（1601年起的100纳秒数）
+func ntlmFileTime(t time.Time) []byte {
+	ft := uint64(t.UnixNano()/100) + 116444736000000000
+	return binary.LittleEndian.AppendUint64(nil, ft)
+}
+
+// encodeUTF16 编码为UTF-16LE
+func encodeUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, len(units)*2)
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[i*2:], u)
+	}
+	return b
+}
+
+// decodeUTF16 解码UTF-16LE
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
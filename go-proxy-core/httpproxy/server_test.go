@@ -0,0 +1,277 @@
+package httpproxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+// testServer 最小化的HTTP CONNECT代理，用于验证认证实现
+// 支持Basic、NTLMv2和Negotiate认证，NTLM握手必须在同一连接上完成
+type testServer struct {
+	scheme   string
+	username string
+	password string
+	domain   string
+	keytab   *keytab.Keytab // Negotiate认证使用的服务密钥
+
+	listener net.Listener
+	accepted atomic.Int32
+}
+
+// newTestServer 在本机随机端口上启动测试代理，scheme为空时不需要认证
+func newTestServer(t *testing.T, scheme, username, password string) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		scheme:   strings.ToLower(scheme),
+		username: username,
+		password: password,
+		domain:   "DUALVPN",
+		listener: listener,
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			go s.handleConn(conn)
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// handleConn 处理一个客户端连接，认证通过前可以在连接上收到多个CONNECT请求
+func (s *testServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	// 当前连接上发出的NTLM服务器challenge
+	var serverChallenge []byte
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+
+		if req.Method != http.MethodConnect {
+			writeResponse(conn, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		authorized, challenge, err := s.authorize(req.Header.Get("Proxy-Authorization"), &serverChallenge)
+		if err != nil {
+			log.Printf("HTTP测试代理认证错误: %v", err)
+		}
+		if !authorized {
+			writeResponse(conn, http.StatusProxyAuthRequired, http.Header{"Proxy-Authenticate": {challenge}})
+			continue
+		}
+
+		s.tunnel(conn, reader, req.Host)
+		return
+	}
+}
+
+// authorize 校验认证头，未通过时返回需要发送的Proxy-Authenticate值
+func (s *testServer) authorize(header string, serverChallenge *[]byte) (bool, string, error) {
+	switch s.scheme {
+	case "":
+		return true, "", nil
+	case AuthBasic:
+		if header == basicAuth(s.username, s.password) {
+			return true, "", nil
+		}
+		return false, `Basic realm="dualvpn"`, nil
+	case AuthNTLM:
+		name, data, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(name, "NTLM") || data == "" {
+			return false, "NTLM", nil
+		}
+		msg, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil || len(msg) < 12 || !bytes.Equal(msg[:8], ntlmSignature) {
+			return false, "NTLM", fmt.Errorf("invalid NTLM message")
+		}
+
+		switch binary.LittleEndian.Uint32(msg[8:]) {
+		case ntlmNegotiateMessage:
+			challenge, chalMsg := s.challengeMessage()
+			*serverChallenge = challenge
+			return false, "NTLM " + base64.StdEncoding.EncodeToString(chalMsg), nil
+		case ntlmAuthenticateMessage:
+			if *serverChallenge == nil {
+				return false, "NTLM", fmt.Errorf("NTLM authenticate message without challenge")
+			}
+			err := s.verifyNTLM(msg, *serverChallenge)
+			*serverChallenge = nil
+			if err != nil {
+				return false, "NTLM", err
+			}
+			return true, "", nil
+		default:
+			return false, "NTLM", fmt.Errorf("unexpected NTLM message type")
+		}
+	case AuthNegotiate:
+		name, data, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(name, "Negotiate") || data == "" {
+			return false, "Negotiate", nil
+		}
+		if err := s.verifyNegotiate(strings.TrimSpace(data)); err != nil {
+			return false, "Negotiate", err
+		}
+		return true, "", nil
+	default:
+		return false, "", fmt.Errorf("unsupported auth scheme: %s", s.scheme)
+	}
+}
+
+// challengeMessage 生成CHALLENGE消息，TargetInfo中带有域名和时间戳
+func (s *testServer) challengeMessage() ([]byte, []byte) {
+	challenge := make([]byte, 8)
+	rand.Read(challenge)
+
+	targetName := encodeUTF16(s.domain)
+
+	var targetInfo []byte
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, 2) // MsvAvNbDomainName
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, uint16(len(targetName)))
+	targetInfo = append(targetInfo, targetName...)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, ntlmAvTimestamp)
+	targetInfo = binary.LittleEndian.AppendUint16(targetInfo, 8)
+	targetInfo = append(targetInfo, ntlmFileTime(time.Now())...)
+	targetInfo = append(targetInfo, 0, 0, 0, 0) // MsvAvEOL
+
+	const headerLen = 48
+	msg := make([]byte, headerLen)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmChallengeMessage)
+	binary.LittleEndian.PutUint16(msg[12:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint16(msg[14:], uint16(len(targetName)))
+	binary.LittleEndian.PutUint32(msg[16:], headerLen)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmNegotiateFlags)
+	copy(msg[24:], challenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], uint32(headerLen+len(targetName)))
+	msg = append(msg, targetName...)
+	msg = append(msg, targetInfo...)
+
+	return challenge, msg
+}
+
+// verifyNTLM 校验AUTHENTICATE消息中的NTLMv2响应
+func (s *testServer) verifyNTLM(msg, serverChallenge []byte) error {
+	ntResponse, ok := ntlmField(msg, 20)
+	if !ok || len(ntResponse) <= 16 {
+		return fmt.Errorf("missing NTLMv2 response")
+	}
+	domainField, _ := ntlmField(msg, 28)
+	userField, ok := ntlmField(msg, 36)
+	if !ok {
+		return fmt.Errorf("missing NTLM user name")
+	}
+
+	user := decodeUTF16(userField)
+	if !strings.EqualFold(user, s.username) {
+		return fmt.Errorf("unknown NTLM user: %s", user)
+	}
+
+	responseKey := ntowfv2(user, s.password, decodeUTF16(domainField))
+	mac := hmac.New(md5.New, responseKey)
+	mac.Write(serverChallenge)
+	mac.Write(ntResponse[16:])
+	if !hmac.Equal(mac.Sum(nil), ntResponse[:16]) {
+		return fmt.Errorf("NTLMv2 response mismatch for user %s", user)
+	}
+	return nil
+}
+
+// verifyNegotiate 使用服务密钥校验SPNEGO令牌中的Kerberos AP-REQ
+func (s *testServer) verifyNegotiate(data string) error {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("invalid Negotiate token: %v", err)
+	}
+	var token spnego.SPNEGOToken
+	if err := token.Unmarshal(raw); err != nil {
+		return fmt.Errorf("invalid SPNEGO token: %v", err)
+	}
+	ok, _, status := spnego.SPNEGOService(s.keytab, service.DecodePAC(false)).AcceptSecContext(&token)
+	if !ok {
+		return fmt.Errorf("kerberos authentication failed: %s", status.Message)
+	}
+	return nil
+}
+
+// tunnel 连接目标并双向转发数据
+func (s *testServer) tunnel(conn net.Conn, reader *bufio.Reader, target string) {
+	remote, err := net.DialTimeout("tcp", target, defaultDialTimeout)
+	if err != nil {
+		writeResponse(conn, http.StatusBadGateway, nil)
+		return
+	}
+	defer remote.Close()
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(remote, reader)
+		if tcpConn, ok := remote.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(conn, remote)
+	conn.Close()
+	<-done
+}
+
+// writeResponse 发送不带响应体的HTTP响应，连接保持可用
+func writeResponse(conn net.Conn, status int, header http.Header) {
+	resp := &http.Response{
+		StatusCode:    status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: 0,
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Write(conn)
+}
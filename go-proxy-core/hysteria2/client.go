@@ -0,0 +1,402 @@
+package hysteria2
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+const (
+	// defaultDialTimeout 建立QUIC连接并完成认证的默认超时时间
+	defaultDialTimeout = 10 * time.Second
+	// defaultKeepAlive QUIC保活间隔
+	defaultKeepAlive = 10 * time.Second
+	// defaultIdleTimeout QUIC空闲超时时间
+	defaultIdleTimeout = 30 * time.Second
+
+	// closeErrCodeOK 正常关闭连接
+	closeErrCodeOK = 0x100
+	// closeErrCodeProtocolError 协议错误，如认证失败
+	closeErrCodeProtocolError = 0x101
+)
+
+// ClientConfig Hysteria2客户端配置
+type ClientConfig struct {
+	Server   string      // 服务器地址 host:port
+	Auth     string      // 认证密码
+	TLS      *tls.Config // TLS配置，ServerName为空时使用服务器主机名
+	Obfs     string      // 混淆类型，目前只支持salamander
+	ObfsPass string      // 混淆密码
+	UpMbps   int         // 上行带宽提示，0表示未知
+	DownMbps int         // 下行带宽提示，0表示未知，通过Hysteria-CC-RX告知服务端
+	Timeout  time.Duration
+
+	// DialContext 建立到服务器的UDP连接，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client Hysteria2客户端
+// 所有TCP流和UDP会话复用同一个QUIC连接，连接断开后在下次使用时重新建立
+type Client struct {
+	config ClientConfig
+
+	mu           sync.Mutex
+	conn         quic.Connection
+	udpSupported bool
+	txBPS        uint64 // 协商后的上行速率，0表示由拥塞控制决定
+	sessions     map[uint32]*udpConn
+	nextSession  uint32
+}
+
+// NewClient 创建新的Hysteria2客户端
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing hysteria2 server")
+	}
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hysteria2 server %s: %v", config.Server, err)
+	}
+	switch config.Obfs {
+	case "", "none":
+		config.Obfs = ""
+	case ObfsSalamander:
+		if len(config.ObfsPass) < salamanderMinPSKLen {
+			return nil, fmt.Errorf("salamander password must be at least %d bytes", salamanderMinPSKLen)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported hysteria2 obfs: %s", config.Obfs)
+	}
+	if config.UpMbps < 0 || config.DownMbps < 0 {
+		return nil, fmt.Errorf("invalid bandwidth: up=%d, down=%d", config.UpMbps, config.DownMbps)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.TLS != nil {
+		tlsConfig = config.TLS.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{http3.NextProtoH3}
+	}
+	config.TLS = tlsConfig
+
+	return &Client{
+		config:   config,
+		sessions: make(map[uint32]*udpConn),
+	}, nil
+}
+
+// DialContext 通过新的QUIC流连接到目标地址
+func (c *Client) DialContext(ctx context.Context, targetAddr string) (net.Conn, error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		c.dropConnection(conn)
+		return nil, fmt.Errorf("failed to open hysteria2 stream: %v", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(deadline)
+	}
+	// ctx在握手过程中被取消时中断读写
+	stop := context.AfterFunc(ctx, func() {
+		stream.SetDeadline(time.Now())
+	})
+	err = c.request(stream, targetAddr)
+	if !stop() {
+		err = errors.Join(err, ctx.Err())
+	}
+	if err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	stream.SetDeadline(time.Time{})
+
+	return &streamConn{Stream: stream, conn: conn}, nil
+}
+
+// request 发送TCP代理请求并读取响应
+func (c *Client) request(stream quic.Stream, targetAddr string) error {
+	if err := writeTCPRequest(stream, targetAddr); err != nil {
+		return fmt.Errorf("failed to send hysteria2 request: %v", err)
+	}
+	ok, msg, err := readTCPResponse(stream)
+	if err != nil {
+		return fmt.Errorf("failed to read hysteria2 response: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("hysteria2 server rejected %s: %s", targetAddr, msg)
+	}
+	return nil
+}
+
+// ListenPacket 建立UDP会话，数据报通过QUIC datagram传输
+func (c *Client) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.udpSupported {
+		return nil, fmt.Errorf("udp relay is disabled by hysteria2 server")
+	}
+	c.nextSession++
+	session := newUDPConn(c, conn, c.nextSession)
+	c.sessions[session.id] = session
+	return session, nil
+}
+
+// Close 关闭QUIC连接和所有UDP会话
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.CloseWithError(closeErrCodeOK, "")
+}
+
+// UDPSupported 返回服务端是否允许UDP转发，需要在连接建立后调用
+func (c *Client) UDPSupported() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.udpSupported
+}
+
+// connection 返回可用的QUIC连接，必要时重新连接并认证
+func (c *Client) connection(ctx context.Context) (quic.Connection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && c.conn.Context().Err() == nil {
+		return c.conn, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	conn, err := c.dialQUIC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	udpSupported, serverRX, err := c.authenticate(ctx, conn)
+	if err != nil {
+		conn.CloseWithError(closeErrCodeProtocolError, "")
+		return nil, err
+	}
+
+	c.conn = conn
+	c.udpSupported = udpSupported
+	c.txBPS = negotiateTX(uint64(c.config.UpMbps)*125000, serverRX)
+	log.Printf("Hysteria2连接已建立: server=%s, udp=%t, tx=%d bytes/s", c.config.Server, udpSupported, c.txBPS)
+
+	if udpSupported {
+		go c.receiveDatagrams(conn)
+	}
+	return conn, nil
+}
+
+// dialQUIC 建立到服务器的QUIC连接
+func (c *Client) dialQUIC(ctx context.Context) (quic.Connection, error) {
+	dial := c.config.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	raw, err := dial(ctx, "udp", c.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to hysteria2 server %s: %v", c.config.Server, err)
+	}
+
+	var pconn net.PacketConn = &connPacketConn{Conn: raw}
+	if c.config.Obfs == ObfsSalamander {
+		pconn, err = newSalamanderConn(pconn, c.config.ObfsPass)
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+	}
+
+	conn, err := quic.Dial(ctx, pconn, raw.RemoteAddr(), c.config.TLS, &quic.Config{
+		HandshakeIdleTimeout: c.config.Timeout,
+		MaxIdleTimeout:       defaultIdleTimeout,
+		KeepAlivePeriod:      defaultKeepAlive,
+		EnableDatagrams:      true,
+	})
+	if err != nil {
+		raw.Close()
+		return nil, fmt.Errorf("hysteria2 QUIC handshake with %s failed: %v", c.config.Server, err)
+	}
+
+	// QUIC连接关闭后释放底层UDP连接
+	go func() {
+		<-conn.Context().Done()
+		raw.Close()
+	}()
+	return conn, nil
+}
+
+// authenticate 通过HTTP/3请求完成认证，返回服务端是否支持UDP和服务端的接收速率
+func (c *Client) authenticate(ctx context.Context, conn quic.Connection) (bool, uint64, error) {
+	rt := (&http3.Transport{}).NewClientConn(conn)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, authURL, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	req.Header.Set(headerAuth, c.config.Auth)
+	req.Header.Set(headerCCRX, bandwidthHeader(uint64(c.config.DownMbps)*125000))
+	req.Header.Set(headerPadding, padding(authPaddingRange))
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return false, 0, fmt.Errorf("hysteria2 auth request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != StatusAuthOK {
+		return false, 0, fmt.Errorf("hysteria2 authentication failed with status %d", resp.StatusCode)
+	}
+
+	udpSupported, _ := strconv.ParseBool(resp.Header.Get(headerUDP))
+	// 服务端返回auto表示由服务端决定拥塞控制，数值为服务端的最大接收速率
+	serverRX, _ := strconv.ParseUint(resp.Header.Get(headerCCRX), 10, 64)
+	return udpSupported, serverRX, nil
+}
+
+// negotiateTX 计算上行速率，取本地上行带宽和服务端接收速率的较小值
+// 上游quic-go不支持Brutal拥塞控制，该值仅作为带宽提示记录
+func negotiateTX(localTX, serverRX uint64) uint64 {
+	if localTX == 0 || (serverRX != 0 && serverRX < localTX) {
+		return serverRX
+	}
+	return localTX
+}
+
+// dropConnection 丢弃已失效的连接，下次使用时重新建立
+func (c *Client) dropConnection(conn quic.Connection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn && conn.Context().Err() != nil {
+		c.conn = nil
+	}
+}
+
+// receiveDatagrams 接收QUIC datagram并分发给对应的UDP会话
+func (c *Client) receiveDatagrams(conn quic.Connection) {
+	defragers := make(map[uint32]*defragger)
+	for {
+		data, err := conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			c.closeSessions(conn)
+			return
+		}
+		msg, err := parseUDPMessage(data)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		session := c.sessions[msg.SessionID]
+		c.mu.Unlock()
+		if session == nil {
+			delete(defragers, msg.SessionID)
+			continue
+		}
+
+		d := defragers[msg.SessionID]
+		if d == nil {
+			d = &defragger{}
+			defragers[msg.SessionID] = d
+		}
+		if full := d.feed(msg); full != nil {
+			session.deliver(full)
+		}
+	}
+}
+
+// removeSession 移除UDP会话
+func (c *Client) removeSession(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, id)
+}
+
+// closeSessions 关闭属于指定连接的所有UDP会话
+func (c *Client) closeSessions(conn quic.Connection) {
+	c.mu.Lock()
+	var sessions []*udpConn
+	for id, session := range c.sessions {
+		if session.conn == conn {
+			sessions = append(sessions, session)
+			delete(c.sessions, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, session := range sessions {
+		session.Close()
+	}
+}
+
+// streamConn 将QUIC流包装为net.Conn
+type streamConn struct {
+	quic.Stream
+	conn quic.Connection
+}
+
+// LocalAddr 返回本地地址
+func (sc *streamConn) LocalAddr() net.Addr {
+	return sc.conn.LocalAddr()
+}
+
+// RemoteAddr 返回服务器地址
+func (sc *streamConn) RemoteAddr() net.Addr {
+	return sc.conn.RemoteAddr()
+}
+
+// Close 关闭流的读写两个方向
+func (sc *streamConn) Close() error {
+	sc.Stream.CancelRead(0)
+	return sc.Stream.Close()
+}
+
+// connPacketConn 将已连接的UDP连接包装为net.PacketConn供quic-go使用
+type connPacketConn struct {
+	net.Conn
+}
+
+// ReadFrom 读取一个UDP包，来源总是服务器
+func (c *connPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Conn.Read(b)
+	return n, c.Conn.RemoteAddr(), err
+}
+
+// WriteTo 向服务器发送一个UDP包
+func (c *connPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Conn.Write(b)
+}
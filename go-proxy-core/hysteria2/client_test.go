@@ -0,0 +1,195 @@
+package hysteria2
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// newTestClient 创建连接到测试服务端的客户端，测试结束时关闭
+func newTestClient(t *testing.T, server *testServer, config ClientConfig) *Client {
+	t.Helper()
+	config.Server = server.addr()
+	config.TLS = &tls.Config{RootCAs: server.roots}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientTCPStreams(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	for _, obfsPass := range []string{"", "salamander-secret"} {
+		server := newTestServer(t, "password", obfsPass)
+		config := ClientConfig{Auth: "password"}
+		if obfsPass != "" {
+			config.Obfs = ObfsSalamander
+			config.ObfsPass = obfsPass
+		}
+		client := newTestClient(t, server, config)
+
+		// 多个流并发复用同一个QUIC连接
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, err := client.DialContext(context.Background(), target)
+				if err != nil {
+					t.Errorf("obfs=%q: dial: %v", obfsPass, err)
+					return
+				}
+				defer conn.Close()
+				data := make([]byte, 256<<10)
+				rand.Read(data)
+				if err := testutil.CheckEcho(conn, data); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func TestClientAuthFailure(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "password", "")
+	client := newTestClient(t, server, ClientConfig{Auth: "wrong"})
+
+	_, err := client.DialContext(context.Background(), target)
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("dial with wrong auth: %v", err)
+	}
+}
+
+func TestClientObfsMismatch(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "password", "salamander-secret")
+
+	// 混淆密码不一致时QUIC握手无法完成
+	client := newTestClient(t, server, ClientConfig{
+		Auth:     "password",
+		Obfs:     ObfsSalamander,
+		ObfsPass: "other-secret",
+		Timeout:  500 * time.Millisecond,
+	})
+	if _, err := client.DialContext(context.Background(), target); err == nil {
+		t.Fatal("expected handshake failure with mismatched obfs password")
+	}
+
+	// 服务端启用混淆而客户端未启用
+	client = newTestClient(t, server, ClientConfig{Auth: "password", Timeout: 500 * time.Millisecond})
+	if _, err := client.DialContext(context.Background(), target); err == nil {
+		t.Fatal("expected handshake failure without obfs")
+	}
+}
+
+func TestClientTargetRejected(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	server := newTestServer(t, "password", "")
+	client := newTestClient(t, server, ClientConfig{Auth: "password"})
+	_, err = client.DialContext(context.Background(), closedAddr)
+	if err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("dial closed port: %v", err)
+	}
+
+	// 目标拒绝后连接仍然可用
+	conn, err := client.DialContext(context.Background(), testutil.StartEchoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	testutil.Echo(t, conn, []byte("still usable"))
+}
+
+func TestClientUDP(t *testing.T) {
+	target := testutil.StartUDPEchoServer(t)
+	for _, obfsPass := range []string{"", "salamander-secret"} {
+		server := newTestServer(t, "password", obfsPass)
+		config := ClientConfig{Auth: "password"}
+		if obfsPass != "" {
+			config.Obfs = ObfsSalamander
+			config.ObfsPass = obfsPass
+		}
+		client := newTestClient(t, server, config)
+
+		pc, err := client.ListenPacket(context.Background())
+		if err != nil {
+			t.Fatalf("obfs=%q: listen packet: %v", obfsPass, err)
+		}
+		if !client.UDPSupported() {
+			t.Fatal("server should allow udp relay")
+		}
+
+		// 超过单个QUIC datagram长度的数据报需要分片和重组
+		for _, size := range []int{64, 4000} {
+			payload := make([]byte, size)
+			rand.Read(payload)
+			if _, err := pc.WriteTo(payload, Addr(target)); err != nil {
+				t.Fatalf("obfs=%q size=%d: write: %v", obfsPass, size, err)
+			}
+			pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, 64*1024)
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("obfs=%q size=%d: read: %v", obfsPass, size, err)
+			}
+			if !bytes.Equal(buf[:n], payload) {
+				t.Fatalf("obfs=%q size=%d: reply mismatch (%d bytes)", obfsPass, size, n)
+			}
+			if from.String() != target {
+				t.Fatalf("reply from %s, want %s", from, target)
+			}
+		}
+		pc.Close()
+		if _, err := pc.WriteTo([]byte("x"), Addr(target)); err == nil {
+			t.Fatal("expected write error after close")
+		}
+	}
+}
+
+func TestUDPMessageFragmentation(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.Read(data)
+	msg := &udpMessage{SessionID: 7, PacketID: 42, FragCount: 1, Addr: "example.com:53", Data: data}
+
+	frags, err := fragmentUDPMessage(msg, 1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) < 2 {
+		t.Fatalf("got %d fragments, want several", len(frags))
+	}
+
+	// 乱序到达的分片也能重组
+	d := &defragger{}
+	var full *udpMessage
+	for i := len(frags) - 1; i >= 0; i-- {
+		parsed, err := parseUDPMessage(frags[i].marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if full = d.feed(parsed); full != nil && i != 0 {
+			t.Fatal("packet completed before all fragments arrived")
+		}
+	}
+	if full == nil || full.Addr != msg.Addr || !bytes.Equal(full.Data, data) {
+		t.Fatal("defragmented packet mismatch")
+	}
+}
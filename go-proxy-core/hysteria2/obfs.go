@@ -0,0 +1,88 @@
+package hysteria2
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// ObfsSalamander Salamander混淆
+	ObfsSalamander = "salamander"
+
+	salamanderSaltLen   = 8
+	salamanderMinPSKLen = 4
+	maxPacketSize       = 2048
+)
+
+// salamanderConn 对每个UDP包进行Salamander混淆
+// 包格式: [8字节随机盐][载荷 XOR BLAKE2b-256(密码 + 盐)]，密钥流按32字节循环
+type salamanderConn struct {
+	net.PacketConn
+	psk []byte
+
+	readMu  sync.Mutex
+	readBuf []byte
+	writeMu sync.Mutex
+	wrBuf   []byte
+}
+
+// newSalamanderConn 创建Salamander混淆连接
+func newSalamanderConn(conn net.PacketConn, password string) (*salamanderConn, error) {
+	if len(password) < salamanderMinPSKLen {
+		return nil, fmt.Errorf("salamander password must be at least %d bytes", salamanderMinPSKLen)
+	}
+	return &salamanderConn{
+		PacketConn: conn,
+		psk:        []byte(password),
+		readBuf:    make([]byte, maxPacketSize),
+		wrBuf:      make([]byte, maxPacketSize+salamanderSaltLen),
+	}, nil
+}
+
+// ReadFrom 读取并还原一个UDP包，忽略过短的包
+func (c *salamanderConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(c.readBuf)
+		if err != nil {
+			return 0, addr, err
+		}
+		if n <= salamanderSaltLen {
+			continue
+		}
+		return c.xor(b, c.readBuf[salamanderSaltLen:n], c.readBuf[:salamanderSaltLen]), addr, nil
+	}
+}
+
+// WriteTo 混淆并发送一个UDP包
+func (c *salamanderConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if len(b) > maxPacketSize {
+		return 0, fmt.Errorf("packet too large: %d bytes", len(b))
+	}
+	salt := c.wrBuf[:salamanderSaltLen]
+	if _, err := rand.Read(salt); err != nil {
+		return 0, err
+	}
+	n := c.xor(c.wrBuf[salamanderSaltLen:], b, salt)
+	if _, err := c.PacketConn.WriteTo(c.wrBuf[:salamanderSaltLen+n], addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// xor 使用由盐派生的密钥流处理数据，写入dst并返回长度
+func (c *salamanderConn) xor(dst, src, salt []byte) int {
+	key := blake2b.Sum256(append(append([]byte(nil), c.psk...), salt...))
+	n := copy(dst, src)
+	for i := 0; i < n; i++ {
+		dst[i] ^= key[i%blake2b.Size256]
+	}
+	return n
+}
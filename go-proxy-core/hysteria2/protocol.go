@@ -0,0 +1,273 @@
+package hysteria2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+const (
+	// StatusAuthOK 认证成功时服务端返回的HTTP状态码
+	StatusAuthOK = 233
+
+	// frameTypeTCPRequest TCP代理请求在双向流上的帧类型
+	frameTypeTCPRequest = 0x401
+
+	// tcpStatusOK TCP代理请求成功
+	tcpStatusOK = 0x00
+	// tcpStatusError TCP代理请求失败
+	tcpStatusError = 0x01
+
+	// 认证请求使用的URL和请求头
+	authURL         = "https://hysteria/auth"
+	headerAuth      = "Hysteria-Auth"
+	headerCCRX      = "Hysteria-CC-RX"
+	headerUDP       = "Hysteria-UDP"
+	headerPadding   = "Hysteria-Padding"
+	maxAddressLen   = 2048
+	maxMessageLen   = 2048
+	maxPaddingLen   = 4096
+	udpHeaderLen    = 8 // SessionID(4) + PacketID(2) + FragID(1) + FragCount(1)
+	maxUDPFragments = 255
+)
+
+// 各类消息填充长度范围，与官方实现一致
+var (
+	authPaddingRange        = [2]int{256, 2048}
+	tcpRequestPaddingRange  = [2]int{64, 512}
+	tcpResponsePaddingRange = [2]int{128, 1024}
+)
+
+const paddingChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// padding 生成指定范围内随机长度的填充字符串
+func padding(r [2]int) string {
+	b := make([]byte, r[0]+rand.Intn(r[1]-r[0]))
+	for i := range b {
+		b[i] = paddingChars[rand.Intn(len(paddingChars))]
+	}
+	return string(b)
+}
+
+// writeTCPRequest 发送TCP代理请求
+// 格式: [varint 0x401][varint 地址长度][地址][varint 填充长度][填充]
+func writeTCPRequest(w io.Writer, addr string) error {
+	pad := padding(tcpRequestPaddingRange)
+	buf := make([]byte, 0, 8+len(addr)+len(pad))
+	buf = quicvarint.Append(buf, frameTypeTCPRequest)
+	buf = quicvarint.Append(buf, uint64(len(addr)))
+	buf = append(buf, addr...)
+	buf = quicvarint.Append(buf, uint64(len(pad)))
+	buf = append(buf, pad...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readTCPRequest 读取TCP代理请求，帧类型已被读取
+func readTCPRequest(r io.Reader) (string, error) {
+	vr := quicvarint.NewReader(r)
+	addrLen, err := quicvarint.Read(vr)
+	if err != nil {
+		return "", err
+	}
+	if addrLen == 0 || addrLen > maxAddressLen {
+		return "", fmt.Errorf("invalid address length: %d", addrLen)
+	}
+	addr := make([]byte, addrLen)
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return "", err
+	}
+	if err := skipPadding(r, vr); err != nil {
+		return "", err
+	}
+	return string(addr), nil
+}
+
+// writeTCPResponse 发送TCP代理响应
+// 格式: [uint8 状态][varint 消息长度][消息][varint 填充长度][填充]
+func writeTCPResponse(w io.Writer, ok bool, msg string) error {
+	pad := padding(tcpResponsePaddingRange)
+	buf := make([]byte, 0, 8+len(msg)+len(pad))
+	if ok {
+		buf = append(buf, tcpStatusOK)
+	} else {
+		buf = append(buf, tcpStatusError)
+	}
+	buf = quicvarint.Append(buf, uint64(len(msg)))
+	buf = append(buf, msg...)
+	buf = quicvarint.Append(buf, uint64(len(pad)))
+	buf = append(buf, pad...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readTCPResponse 读取TCP代理响应，返回是否成功和服务端消息
+func readTCPResponse(r io.Reader) (bool, string, error) {
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return false, "", err
+	}
+	vr := quicvarint.NewReader(r)
+	msgLen, err := quicvarint.Read(vr)
+	if err != nil {
+		return false, "", err
+	}
+	if msgLen > maxMessageLen {
+		return false, "", fmt.Errorf("invalid message length: %d", msgLen)
+	}
+	msg := make([]byte, msgLen)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return false, "", err
+	}
+	if err := skipPadding(r, vr); err != nil {
+		return false, "", err
+	}
+	return status[0] == tcpStatusOK, string(msg), nil
+}
+
+// skipPadding 读取并丢弃填充
+func skipPadding(r io.Reader, vr quicvarint.Reader) error {
+	padLen, err := quicvarint.Read(vr)
+	if err != nil {
+		return err
+	}
+	if padLen > maxPaddingLen {
+		return fmt.Errorf("invalid padding length: %d", padLen)
+	}
+	_, err = io.CopyN(io.Discard, r, int64(padLen))
+	return err
+}
+
+// udpMessage UDP数据报消息，通过QUIC datagram传输
+// 格式: [uint32 会话ID][uint16 包ID][uint8 分片序号][uint8 分片数量][varint 地址长度][地址][数据]
+type udpMessage struct {
+	SessionID uint32
+	PacketID  uint16
+	FragID    uint8
+	FragCount uint8
+	Addr      string
+	Data      []byte
+}
+
+// headerSize 返回除数据外的消息长度
+func (m *udpMessage) headerSize() int {
+	return udpHeaderLen + quicvarint.Len(uint64(len(m.Addr))) + len(m.Addr)
+}
+
+// marshal 编码消息
+func (m *udpMessage) marshal() []byte {
+	buf := make([]byte, 0, m.headerSize()+len(m.Data))
+	buf = binary.BigEndian.AppendUint32(buf, m.SessionID)
+	buf = binary.BigEndian.AppendUint16(buf, m.PacketID)
+	buf = append(buf, m.FragID, m.FragCount)
+	buf = quicvarint.Append(buf, uint64(len(m.Addr)))
+	buf = append(buf, m.Addr...)
+	return append(buf, m.Data...)
+}
+
+// parseUDPMessage 解析消息，返回的数据引用原缓冲区
+func parseUDPMessage(b []byte) (*udpMessage, error) {
+	if len(b) < udpHeaderLen {
+		return nil, fmt.Errorf("udp message too short: %d", len(b))
+	}
+	m := &udpMessage{
+		SessionID: binary.BigEndian.Uint32(b),
+		PacketID:  binary.BigEndian.Uint16(b[4:]),
+		FragID:    b[6],
+		FragCount: b[7],
+	}
+	addrLen, n, err := quicvarint.Parse(b[udpHeaderLen:])
+	if err != nil {
+		return nil, err
+	}
+	rest := b[udpHeaderLen+n:]
+	if addrLen == 0 || addrLen > maxAddressLen || uint64(len(rest)) < addrLen {
+		return nil, fmt.Errorf("invalid address length: %d", addrLen)
+	}
+	if m.FragCount == 0 || m.FragID >= m.FragCount {
+		return nil, fmt.Errorf("invalid fragment %d/%d", m.FragID, m.FragCount)
+	}
+	m.Addr = string(rest[:addrLen])
+	m.Data = rest[addrLen:]
+	return m, nil
+}
+
+// fragmentUDPMessage 按最大长度拆分消息，拆分后的分片使用同一个非零包ID
+func fragmentUDPMessage(m *udpMessage, maxSize int) ([]*udpMessage, error) {
+	payload := maxSize - m.headerSize()
+	if payload <= 0 {
+		return nil, fmt.Errorf("udp message header exceeds max datagram size %d", maxSize)
+	}
+	count := (len(m.Data) + payload - 1) / payload
+	if count > maxUDPFragments {
+		return nil, fmt.Errorf("udp packet too large: %d bytes", len(m.Data))
+	}
+
+	frags := make([]*udpMessage, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * payload
+		if end > len(m.Data) {
+			end = len(m.Data)
+		}
+		frags = append(frags, &udpMessage{
+			SessionID: m.SessionID,
+			PacketID:  m.PacketID,
+			FragID:    uint8(i),
+			FragCount: uint8(count),
+			Addr:      m.Addr,
+			Data:      m.Data[i*payload : end],
+		})
+	}
+	return frags, nil
+}
+
+// defragger 重组分片的UDP消息，每个会话同时只重组一个包
+type defragger struct {
+	packetID uint16
+	frags    []*udpMessage
+	count    int
+	size     int
+}
+
+// feed 处理一个消息，包完整时返回重组后的消息
+func (d *defragger) feed(m *udpMessage) *udpMessage {
+	if m.FragCount <= 1 {
+		return m
+	}
+	if m.PacketID != d.packetID || len(d.frags) != int(m.FragCount) {
+		// 新的包，丢弃未完成的旧包
+		d.packetID = m.PacketID
+		d.frags = make([]*udpMessage, m.FragCount)
+		d.count = 0
+		d.size = 0
+	}
+	if d.frags[m.FragID] != nil {
+		return nil
+	}
+	// 数据引用接收缓冲区，需要复制
+	frag := *m
+	frag.Data = append([]byte(nil), m.Data...)
+	d.frags[m.FragID] = &frag
+	d.count++
+	d.size += len(m.Data)
+	if d.count != len(d.frags) {
+		return nil
+	}
+
+	data := make([]byte, 0, d.size)
+	for _, f := range d.frags {
+		data = append(data, f.Data...)
+	}
+	full := &udpMessage{SessionID: m.SessionID, PacketID: m.PacketID, FragCount: 1, Addr: m.Addr, Data: data}
+	d.frags = nil
+	return full
+}
+
+// bandwidthHeader 将字节每秒转换为请求头的值，0表示未知
+func bandwidthHeader(bps uint64) string {
+	return strconv.FormatUint(bps, 10)
+}
@@ -0,0 +1,206 @@
+package hysteria2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// testServer 最小化的Hysteria2服务端，用于验证客户端实现
+// 支持密码认证、Salamander混淆、TCP流和UDP数据报转发，使用自签名证书
+type testServer struct {
+	auth     string
+	roots    *x509.CertPool // 客户端校验自签名证书使用的根证书
+	listener *quic.Listener
+}
+
+// newTestServer 在本机随机端口上启动Hysteria2服务端，obfsPass为空时不启用混淆
+func newTestServer(t *testing.T, auth, obfsPass string) *testServer {
+	t.Helper()
+	cert, roots := testutil.Certificate(t)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if obfsPass != "" {
+		if conn, err = newSalamanderConn(conn, obfsPass); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listener, err := quic.Listen(conn, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{http3.NextProtoH3},
+	}, &quic.Config{
+		MaxIdleTimeout:  defaultIdleTimeout,
+		EnableDatagrams: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &testServer{auth: auth, roots: roots, listener: listener}
+	go func() {
+		for {
+			qconn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go s.handleConn(qconn)
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// handleConn 处理一个QUIC连接，认证通过前拒绝所有代理请求
+func (s *testServer) handleConn(conn quic.Connection) {
+	var authed atomic.Bool
+
+	h3s := &http3.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Host != "hysteria" || r.URL.Path != "/auth" || r.Header.Get(headerAuth) != s.auth {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if authed.CompareAndSwap(false, true) {
+				go s.relayUDP(conn)
+			}
+			w.Header().Set(headerUDP, "true")
+			w.Header().Set(headerCCRX, "auto")
+			w.Header().Set(headerPadding, padding(authPaddingRange))
+			w.WriteHeader(StatusAuthOK)
+		}),
+		StreamHijacker: func(ft http3.FrameType, _ quic.ConnectionTracingID, stream quic.Stream, err error) (bool, error) {
+			if err != nil || ft != frameTypeTCPRequest {
+				return false, nil
+			}
+			if !authed.Load() {
+				stream.CancelRead(closeErrCodeProtocolError)
+				stream.CancelWrite(closeErrCodeProtocolError)
+				return true, nil
+			}
+			go s.handleStream(stream)
+			return true, nil
+		},
+	}
+	h3s.ServeQUICConn(conn)
+}
+
+// handleStream 处理TCP代理请求并双向转发数据
+func (s *testServer) handleStream(stream quic.Stream) {
+	defer stream.Close()
+
+	target, err := readTCPRequest(stream)
+	if err != nil {
+		stream.CancelRead(closeErrCodeProtocolError)
+		return
+	}
+
+	remote, err := net.DialTimeout("tcp", target, defaultDialTimeout)
+	if err != nil {
+		writeTCPResponse(stream, false, err.Error())
+		return
+	}
+	defer remote.Close()
+
+	if err := writeTCPResponse(stream, true, ""); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(remote, stream)
+		if tcpConn, ok := remote.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(stream, remote)
+	stream.Close()
+	<-done
+}
+
+// relayUDP 转发连接上的UDP数据报，每个会话使用独立的本地UDP套接字
+func (s *testServer) relayUDP(conn quic.Connection) {
+	sessions := make(map[uint32]net.PacketConn)
+	defragers := make(map[uint32]*defragger)
+	defer func() {
+		for _, pc := range sessions {
+			pc.Close()
+		}
+	}()
+
+	for {
+		data, err := conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		msg, err := parseUDPMessage(data)
+		if err != nil {
+			continue
+		}
+
+		d := defragers[msg.SessionID]
+		if d == nil {
+			d = &defragger{}
+			defragers[msg.SessionID] = d
+		}
+		full := d.feed(msg)
+		if full == nil {
+			continue
+		}
+
+		pc := sessions[full.SessionID]
+		if pc == nil {
+			pc, err = net.ListenPacket("udp", "")
+			if err != nil {
+				continue
+			}
+			sessions[full.SessionID] = pc
+			go s.udpReplies(conn, pc, full.SessionID)
+		}
+
+		addr, err := net.ResolveUDPAddr("udp", full.Addr)
+		if err != nil {
+			continue
+		}
+		pc.WriteTo(full.Data, addr)
+	}
+}
+
+// udpReplies 将目标返回的数据报发回客户端
+func (s *testServer) udpReplies(conn quic.Connection, pc net.PacketConn, sessionID uint32) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		msg := &udpMessage{
+			SessionID: sessionID,
+			FragCount: 1,
+			Addr:      from.String(),
+			Data:      buf[:n],
+		}
+		if err := sendUDPMessage(conn, msg); err != nil {
+			log.Printf("Hysteria2测试服务端发送UDP数据失败: %v", err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package hysteria2
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// udpQueueSize 每个UDP会话缓存的待读取数据报数量
+const udpQueueSize = 128
+
+// Addr UDP数据报的来源或目标地址，保留服务端返回的原始形式
+type Addr string
+
+// Network 返回网络类型
+func (a Addr) Network() string {
+	return "udp"
+}
+
+// String 返回host:port形式的地址
+func (a Addr) String() string {
+	return string(a)
+}
+
+// udpConn 客户端UDP会话，实现net.PacketConn
+type udpConn struct {
+	client *Client
+	conn   quic.Connection
+	id     uint32
+
+	queue     chan *udpMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+// newUDPConn 创建UDP会话
+func newUDPConn(client *Client, conn quic.Connection, id uint32) *udpConn {
+	return &udpConn{
+		client: client,
+		conn:   conn,
+		id:     id,
+		queue:  make(chan *udpMessage, udpQueueSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// deliver 投递收到的数据报，队列满时丢弃
+func (uc *udpConn) deliver(msg *udpMessage) {
+	select {
+	case <-uc.closed:
+	case uc.queue <- msg:
+	default:
+	}
+}
+
+// ReadFrom 读取一个数据报
+func (uc *udpConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	uc.mu.Lock()
+	deadline := uc.readDeadline
+	uc.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case msg := <-uc.queue:
+		return copy(b, msg.Data), Addr(msg.Addr), nil
+	case <-uc.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// WriteTo 向目标地址发送一个数据报
+func (uc *udpConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-uc.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	msg := &udpMessage{
+		SessionID: uc.id,
+		FragCount: 1,
+		Addr:      addr.String(),
+		Data:      b,
+	}
+	if err := sendUDPMessage(uc.conn, msg); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 关闭UDP会话，服务端在会话空闲超时后释放资源
+func (uc *udpConn) Close() error {
+	uc.closeOnce.Do(func() {
+		close(uc.closed)
+		uc.client.removeSession(uc.id)
+	})
+	return nil
+}
+
+// LocalAddr 返回本地地址
+func (uc *udpConn) LocalAddr() net.Addr {
+	return uc.conn.LocalAddr()
+}
+
+// SetDeadline 设置读写超时，写操作不会阻塞因此只影响读取
+func (uc *udpConn) SetDeadline(t time.Time) error {
+	return uc.SetReadDeadline(t)
+}
+
+// SetReadDeadline 设置读取超时
+func (uc *udpConn) SetReadDeadline(t time.Time) error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline 写操作不会阻塞，忽略写超时
+func (uc *udpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// sendUDPMessage 发送UDP消息，超过QUIC datagram长度时分片发送
+func sendUDPMessage(conn quic.Connection, msg *udpMessage) error {
+	err := conn.SendDatagram(msg.marshal())
+	var tooLarge *quic.DatagramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		return err
+	}
+
+	// 分片使用随机的非零包ID
+	msg.PacketID = uint16(rand.Intn(0xffff)) + 1
+	frags, err := fragmentUDPMessage(msg, int(tooLarge.MaxDatagramPayloadSize))
+	if err != nil {
+		return err
+	}
+	for _, frag := range frags {
+		if err := conn.SendDatagram(frag.marshal()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package testutil 各协议测试共用的回显服务器、回显检查和自签名证书
+// 只应在_test.go文件中导入
+package testutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoTimeout 回显检查的读写超时
+const echoTimeout = 10 * time.Second
+
+// StartEchoServer 在本机随机端口上启动TCP回显服务器，返回监听地址，测试结束时关闭
+func StartEchoServer(t testing.TB) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go ServeEcho(listener)
+	return listener.Addr().String()
+}
+
+// ServeEcho 回显监听器上每个连接的数据，直到监听器关闭
+func ServeEcho(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			io.Copy(conn, conn)
+		}()
+	}
+}
+
+// StartUDPEchoServer 在本机随机端口上启动UDP回显服务器，返回监听地址，测试结束时关闭
+func StartUDPEchoServer(t testing.TB) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(buf[:n], from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// CheckEcho 通过连接发送数据并读回相同长度的回显
+// 写入和读取并发进行，窗口较小的流发送大块数据时也不会阻塞；可以在测试的其他goroutine中调用
+func CheckEcho(conn net.Conn, data []byte) error {
+	conn.SetDeadline(time.Now().Add(echoTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(data)
+		errCh <- err
+	}()
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return fmt.Errorf("read echo: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		return fmt.Errorf("write: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		if len(data) <= 64 {
+			return fmt.Errorf("echo = %q, want %q", got, data)
+		}
+		return fmt.Errorf("echo data mismatch")
+	}
+	return nil
+}
+
+// Echo 同CheckEcho，失败时结束测试，只能在测试的goroutine中调用
+func Echo(t testing.TB, conn net.Conn, data []byte) {
+	t.Helper()
+	if err := CheckEcho(conn, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Certificate 生成自签名证书，返回服务端证书和客户端校验使用的根证书
+// 证书对localhost、127.0.0.1、::1以及dnsNames有效
+func Certificate(t testing.TB, dnsNames ...string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "go-proxy-core-test"},
+		DNSNames:     append([]string{"localhost"}, dnsNames...),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
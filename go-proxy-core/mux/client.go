@@ -0,0 +1,292 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/xtaci/smux"
+)
+
+const (
+	// defaultDialTimeout 建立复用会话的默认超时时间
+	defaultDialTimeout = 10 * time.Second
+	// defaultMinStreams 未配置连接数和流数量时，每个会话承载的流数量
+	defaultMinStreams = 8
+	// streamTimeout yamux打开和关闭流的超时时间
+	streamTimeout = 5 * time.Second
+)
+
+// ClientConfig 多路复用客户端配置
+// MaxConnections与MaxStreams互斥：
+// 设置MaxConnections时，会话数达到上限后复用流最少的会话，否则当前会话的流数量达到MinStreams才新建会话；
+// 设置MaxStreams时，会话的流数量达到MaxStreams才新建会话
+type ClientConfig struct {
+	Protocol       string // smux/yamux，默认smux
+	MaxConnections int
+	MinStreams     int
+	MaxStreams     int
+	Padding        bool // 是否对会话开头的数据添加随机填充
+	Timeout        time.Duration
+
+	// DialContext 通过上游协议连接到目标地址，用于建立复用会话
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client 多路复用客户端，维护到同一上游的会话池
+type Client struct {
+	config   ClientConfig
+	protocol byte
+
+	mu       sync.Mutex
+	sessions []session
+}
+
+// session smux和yamux会话的公共接口
+type session interface {
+	Open() (net.Conn, error)
+	Accept() (net.Conn, error)
+	NumStreams() int
+	IsClosed() bool
+	Close() error
+}
+
+// smuxSession 适配smux会话
+// smux在底层连接读取失败时不会关闭会话，IsClosed需要结合连接状态判断
+type smuxSession struct {
+	*smux.Session
+	conn *readErrorConn
+}
+
+// IsClosed 返回会话是否已关闭或底层连接已失效
+func (s *smuxSession) IsClosed() bool {
+	return s.Session.IsClosed() || s.conn.failed.Load()
+}
+
+// Open 打开一个新流
+func (s *smuxSession) Open() (net.Conn, error) {
+	return s.OpenStream()
+}
+
+// Accept 接受一个新流
+func (s *smuxSession) Accept() (net.Conn, error) {
+	return s.AcceptStream()
+}
+
+// NewClient 创建新的多路复用客户端
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.DialContext == nil {
+		return nil, fmt.Errorf("missing mux dialer")
+	}
+	if config.Protocol == "" {
+		config.Protocol = ProtocolSmux
+	}
+	protocol, err := protocolID(config.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxConnections > 0 && config.MaxStreams > 0 {
+		return nil, fmt.Errorf("mux max_connections conflicts with max_streams")
+	}
+	if config.MaxStreams == 0 && config.MinStreams <= 0 {
+		config.MinStreams = defaultMinStreams
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+
+	return &Client{config: config, protocol: protocol}, nil
+}
+
+// DialContext 在复用会话上打开到目标地址的TCP流
+func (c *Client) DialContext(ctx context.Context, targetAddr string) (net.Conn, error) {
+	request, err := streamRequest(targetAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 会话已断开但尚未被发现时丢弃后再试一次
+	for attempt := 0; ; attempt++ {
+		s, err := c.offer(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stream, err := s.Open()
+		if err == nil {
+			// 立即发送流请求，服务端先发数据的协议不需要等待客户端写入
+			if _, err = stream.Write(request); err == nil {
+				return &streamConn{Conn: stream}, nil
+			}
+			stream.Close()
+		}
+		if attempt > 0 || ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to open mux stream to %s: %v", targetAddr, err)
+		}
+		c.removeSession(s)
+	}
+}
+
+// Close 关闭所有会话
+func (c *Client) Close() error {
+	c.mu.Lock()
+	sessions := c.sessions
+	c.sessions = nil
+	c.mu.Unlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+	return nil
+}
+
+// offer 按连接数和流数量限制选择会话，需要时新建
+func (c *Client) offer(ctx context.Context) (session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best session
+	alive := c.sessions[:0]
+	for _, s := range c.sessions {
+		if s.IsClosed() {
+			s.Close()
+			continue
+		}
+		alive = append(alive, s)
+		if best == nil || s.NumStreams() < best.NumStreams() {
+			best = s
+		}
+	}
+	c.sessions = alive
+
+	if best != nil {
+		streams := best.NumStreams()
+		switch {
+		case streams == 0:
+			return best, nil
+		case c.config.MaxConnections > 0 && len(c.sessions) >= c.config.MaxConnections:
+			return best, nil
+		case c.config.MaxStreams > 0:
+			if streams < c.config.MaxStreams {
+				return best, nil
+			}
+		case streams < c.config.MinStreams:
+			return best, nil
+		}
+	}
+
+	s, err := c.newSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.sessions = append(c.sessions, s)
+	return s, nil
+}
+
+// newSession 通过上游协议建立新的复用会话
+func (c *Client) newSession(ctx context.Context) (session, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	conn, err := c.config.DialContext(ctx, "tcp", Destination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish mux session: %v", err)
+	}
+	request := sessionRequest{Protocol: c.protocol, Padding: c.config.Padding}
+	conn = &protocolConn{Conn: conn, request: request.marshal()}
+	if c.config.Padding {
+		conn = &paddingConn{Conn: conn}
+	}
+
+	s, err := newMuxSession(conn, c.protocol, true)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Printf("建立多路复用会话: protocol=%s, padding=%t, sessions=%d", c.config.Protocol, c.config.Padding, len(c.sessions)+1)
+	return s, nil
+}
+
+// removeSession 关闭并移除会话
+func (c *Client) removeSession(s session) {
+	c.mu.Lock()
+	for i, existing := range c.sessions {
+		if existing == s {
+			c.sessions = append(c.sessions[:i], c.sessions[i+1:]...)
+			break
+		}
+	}
+	c.mu.Unlock()
+	s.Close()
+}
+
+// newMuxSession 在连接上创建客户端或服务端会话
+func newMuxSession(conn net.Conn, protocol byte, client bool) (session, error) {
+	switch protocol {
+	case protocolSmux:
+		config := smux.DefaultConfig()
+		// 与sing-mux一致，不发送保活帧
+		config.KeepAliveDisabled = true
+		rc := &readErrorConn{Conn: conn}
+		var s *smux.Session
+		var err error
+		if client {
+			s, err = smux.Client(rc, config)
+		} else {
+			s, err = smux.Server(rc, config)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &smuxSession{Session: s, conn: rc}, nil
+	case protocolYamux:
+		config := yamux.DefaultConfig()
+		config.LogOutput = io.Discard
+		config.StreamOpenTimeout = streamTimeout
+		config.StreamCloseTimeout = streamTimeout
+		if client {
+			return yamux.Client(conn, config)
+		}
+		return yamux.Server(conn, config)
+	default:
+		return nil, fmt.Errorf("unsupported mux protocol: %d", protocol)
+	}
+}
+
+// readErrorConn 记录底层连接是否出现读取错误
+type readErrorConn struct {
+	net.Conn
+	failed atomic.Bool
+}
+
+// Read 读取数据，出错时标记连接失效
+func (c *readErrorConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.failed.Store(true)
+	}
+	return n, err
+}
+
+// streamConn 复用流，第一次读取时解析服务端响应
+type streamConn struct {
+	net.Conn
+	responseRead bool
+}
+
+// Read 读取数据
+func (c *streamConn) Read(b []byte) (int, error) {
+	if !c.responseRead {
+		if err := readStreamResponse(c.Conn); err != nil {
+			return 0, err
+		}
+		c.responseRead = true
+	}
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,202 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// newTestClient 创建通过测试服务端建立会话的客户端，测试结束时关闭
+func newTestClient(t *testing.T, server *testServer, config ClientConfig) *Client {
+	t.Helper()
+	config.DialContext = server.dial
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientProtocols(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	for _, protocol := range []string{ProtocolSmux, ProtocolYamux} {
+		for _, padding := range []bool{false, true} {
+			server := newTestServer(t)
+			client := newTestClient(t, server, ClientConfig{Protocol: protocol, Padding: padding})
+
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					conn, err := client.DialContext(context.Background(), target)
+					if err != nil {
+						t.Errorf("%s padding=%t: dial: %v", protocol, padding, err)
+						return
+					}
+					defer conn.Close()
+					data := make([]byte, 128<<10)
+					rand.Read(data)
+					if err := testutil.CheckEcho(conn, data); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// 默认每个会话承载多个流，并发的流共享同一个会话
+			if n := server.sessions(); n != 1 {
+				t.Fatalf("%s padding=%t: %d sessions, want 1", protocol, padding, n)
+			}
+		}
+	}
+}
+
+func TestClientSessionLimits(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	for _, tc := range []struct {
+		name     string
+		config   ClientConfig
+		sessions int
+	}{
+		{"max streams", ClientConfig{MaxStreams: 2}, 3},
+		{"max connections", ClientConfig{MaxConnections: 2, MinStreams: 1}, 2},
+		{"min streams", ClientConfig{MinStreams: 5}, 1},
+	} {
+		server := newTestServer(t)
+		client := newTestClient(t, server, tc.config)
+
+		// 保持所有流打开，使会话选择依赖当前流数量
+		var conns []net.Conn
+		for i := 0; i < 5; i++ {
+			conn, err := client.DialContext(context.Background(), target)
+			if err != nil {
+				t.Fatalf("%s: dial: %v", tc.name, err)
+			}
+			testutil.Echo(t, conn, []byte("stream"))
+			conns = append(conns, conn)
+		}
+		if n := server.sessions(); n != tc.sessions {
+			t.Fatalf("%s: %d sessions, want %d", tc.name, n, tc.sessions)
+		}
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+}
+
+func TestClientRemoteError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	server := newTestServer(t)
+	client := newTestClient(t, server, ClientConfig{})
+
+	// 流请求不等待响应，连接目标失败在首次读取时返回
+	conn, err := client.DialContext(context.Background(), closedAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err == nil || !strings.Contains(err.Error(), "mux remote error") {
+		t.Fatalf("read error = %v, want remote error", err)
+	}
+}
+
+func TestClientRecreatesClosedSession(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	for _, protocol := range []string{ProtocolSmux, ProtocolYamux} {
+		server := newTestServer(t)
+		client := newTestClient(t, server, ClientConfig{Protocol: protocol})
+
+		conn, err := client.DialContext(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.Echo(t, conn, []byte("first"))
+		conn.Close()
+
+		server.dropSessions()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			client.mu.Lock()
+			closed := len(client.sessions) == 1 && client.sessions[0].IsClosed()
+			client.mu.Unlock()
+			if closed {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: session was not closed", protocol)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		conn, err = client.DialContext(context.Background(), target)
+		if err != nil {
+			t.Fatalf("%s: dial after session closed: %v", protocol, err)
+		}
+		testutil.Echo(t, conn, []byte("second"))
+		conn.Close()
+		if n := server.sessions(); n != 2 {
+			t.Fatalf("%s: %d sessions, want 2", protocol, n)
+		}
+	}
+}
+
+func TestNewClientValidation(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, io.EOF
+	}
+	for _, tc := range []struct {
+		config ClientConfig
+		err    string
+	}{
+		{ClientConfig{}, "missing mux dialer"},
+		{ClientConfig{DialContext: dial, Protocol: "h2mux"}, "unsupported mux protocol"},
+		{ClientConfig{DialContext: dial, MaxConnections: 2, MaxStreams: 4}, "conflicts"},
+	} {
+		if _, err := NewClient(tc.config); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("NewClient(%+v) = %v, want %q", tc.config, err, tc.err)
+		}
+	}
+}
+
+func TestSessionRequest(t *testing.T) {
+	for _, request := range []sessionRequest{
+		{Protocol: protocolSmux},
+		{Protocol: protocolYamux, Padding: true},
+	} {
+		// 会话请求之后紧跟会话数据，读取时不能多读
+		data := append(request.marshal(), "session data"...)
+		r := bytes.NewReader(data)
+		got, err := readSessionRequest(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != request {
+			t.Fatalf("request = %+v, want %+v", *got, request)
+		}
+		rest, _ := io.ReadAll(r)
+		if string(rest) != "session data" {
+			t.Fatalf("remaining data = %q", rest)
+		}
+	}
+
+	if _, err := readSessionRequest(bytes.NewReader([]byte{0x05, protocolSmux})); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+}
@@ -0,0 +1,92 @@
+package mux
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+)
+
+// paddedFrames 开启填充时前若干次读写带有随机填充，用于隐藏握手阶段的包长特征
+const paddedFrames = 16
+
+// paddingConn 前paddedFrames次写入编码为[数据长度][填充长度][数据][填充]
+type paddingConn struct {
+	net.Conn
+	readFrames  int
+	writeFrames int
+
+	readRemaining    int // 当前帧未读取的数据长度
+	paddingRemaining int // 当前帧未跳过的填充长度
+}
+
+// Read 读取数据并跳过填充
+func (c *paddingConn) Read(b []byte) (int, error) {
+	if c.readRemaining > 0 {
+		if len(b) > c.readRemaining {
+			b = b[:c.readRemaining]
+		}
+		n, err := c.Conn.Read(b)
+		c.readRemaining -= n
+		return n, err
+	}
+	if c.paddingRemaining > 0 {
+		if _, err := io.CopyN(io.Discard, c.Conn, int64(c.paddingRemaining)); err != nil {
+			return 0, err
+		}
+		c.paddingRemaining = 0
+	}
+	if c.readFrames >= paddedFrames {
+		return c.Conn.Read(b)
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return 0, err
+	}
+	c.readFrames++
+	c.readRemaining = int(binary.BigEndian.Uint16(header[:2]))
+	c.paddingRemaining = int(binary.BigEndian.Uint16(header[2:]))
+	if c.readRemaining == 0 {
+		return 0, nil
+	}
+	return c.Read(b)
+}
+
+// Write 写入数据，超过帧长度上限时拆分
+func (c *paddingConn) Write(b []byte) (int, error) {
+	if c.writeFrames >= paddedFrames {
+		return c.Conn.Write(b)
+	}
+
+	var written int
+	for len(b) > 0 {
+		data := b
+		if len(data) > 65535 {
+			data = data[:65535]
+		}
+		if err := c.writeFrame(data); err != nil {
+			return written, err
+		}
+		written += len(data)
+		b = b[len(data):]
+	}
+	return written, nil
+}
+
+// writeFrame 写入一个带填充的帧，填充次数用完后直接写入
+func (c *paddingConn) writeFrame(data []byte) error {
+	if c.writeFrames >= paddedFrames {
+		_, err := c.Conn.Write(data)
+		return err
+	}
+	c.writeFrames++
+
+	paddingLen := 256 + rand.Intn(512)
+	frame := make([]byte, 4+len(data)+paddingLen)
+	binary.BigEndian.PutUint16(frame[:2], uint16(len(data)))
+	binary.BigEndian.PutUint16(frame[2:4], uint16(paddingLen))
+	copy(frame[4:], data)
+	_, err := c.Conn.Write(frame)
+	return err
+}
@@ -0,0 +1,192 @@
+package mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+
+	"github.com/shadowsocks/go-shadowsocks2/socks"
+)
+
+// 与sing-mux兼容的多路复用协议
+// 客户端通过上游协议连接到Destination，先发送会话请求选择复用协议，之后在会话上为每个目标打开一个流
+
+// Destination 建立复用会话时通过上游协议请求的虚拟目标地址
+const Destination = "sp.mux.sing-box.arpa:444"
+
+// 复用协议
+const (
+	ProtocolSmux  = "smux"
+	ProtocolYamux = "yamux"
+)
+
+const (
+	// 会话请求中的协议编号
+	protocolSmux  = 0x00
+	protocolYamux = 0x01
+
+	// 会话请求版本，version1支持填充
+	version0 = 0x00
+	version1 = 0x01
+
+	// 流请求标志
+	flagUDP = 0x01
+
+	// 流响应状态
+	statusSuccess = 0x00
+	statusError   = 0x01
+)
+
+// protocolID 返回复用协议在会话请求中的编号
+func protocolID(protocol string) (byte, error) {
+	switch protocol {
+	case ProtocolSmux:
+		return protocolSmux, nil
+	case ProtocolYamux:
+		return protocolYamux, nil
+	default:
+		return 0, fmt.Errorf("unsupported mux protocol: %s", protocol)
+	}
+}
+
+// sessionRequest 会话请求
+type sessionRequest struct {
+	Protocol byte
+	Padding  bool
+}
+
+// marshal 编码会话请求: [版本][协议]，version1追加[是否填充]以及[填充长度][填充]
+func (r sessionRequest) marshal() []byte {
+	if !r.Padding {
+		return []byte{version0, r.Protocol}
+	}
+	paddingLen := 256 + rand.Intn(512)
+	b := make([]byte, 5+paddingLen)
+	b[0] = version1
+	b[1] = r.Protocol
+	b[2] = 1
+	binary.BigEndian.PutUint16(b[3:5], uint16(paddingLen))
+	return b
+}
+
+// readSessionRequest 读取会话请求
+func readSessionRequest(r io.Reader) (*sessionRequest, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != version0 && header[0] != version1 {
+		return nil, fmt.Errorf("unsupported mux version: %d", header[0])
+	}
+	request := &sessionRequest{Protocol: header[1]}
+	if header[0] == version0 {
+		return request, nil
+	}
+
+	var padding [1]byte
+	if _, err := io.ReadFull(r, padding[:]); err != nil {
+		return nil, err
+	}
+	if padding[0] == 0 {
+		return request, nil
+	}
+	request.Padding = true
+
+	var paddingLen [2]byte
+	if _, err := io.ReadFull(r, paddingLen[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(binary.BigEndian.Uint16(paddingLen[:]))); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// streamRequest 编码TCP流请求: [标志][SOCKS地址]
+func streamRequest(targetAddr string) ([]byte, error) {
+	addr := socks.ParseAddr(targetAddr)
+	if addr == nil {
+		return nil, fmt.Errorf("failed to parse target address: %s", targetAddr)
+	}
+	b := make([]byte, 2, 2+len(addr))
+	return append(b, addr...), nil
+}
+
+// readStreamRequest 读取流请求，返回目标地址和是否为UDP
+func readStreamRequest(r io.Reader) (string, bool, error) {
+	var flags [2]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return "", false, err
+	}
+	addr, err := socks.ReadAddr(r)
+	if err != nil {
+		return "", false, err
+	}
+	return addr.String(), binary.BigEndian.Uint16(flags[:])&flagUDP != 0, nil
+}
+
+// readStreamResponse 读取流响应，服务端连接目标失败时返回其错误信息
+func readStreamResponse(r io.Reader) error {
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return err
+	}
+	switch status[0] {
+	case statusSuccess:
+		return nil
+	case statusError:
+		length, err := binary.ReadUvarint(byteReader{r})
+		if err != nil {
+			return err
+		}
+		message := make([]byte, length)
+		if _, err := io.ReadFull(r, message); err != nil {
+			return err
+		}
+		return fmt.Errorf("mux remote error: %s", message)
+	default:
+		return fmt.Errorf("unknown mux stream status: %d", status[0])
+	}
+}
+
+// writeStreamError 向流写入失败响应
+func writeStreamError(w io.Writer, message string) error {
+	b := make([]byte, 1, 1+binary.MaxVarintLen64+len(message))
+	b[0] = statusError
+	b = binary.AppendUvarint(b, uint64(len(message)))
+	_, err := w.Write(append(b, message...))
+	return err
+}
+
+// byteReader 逐字节读取，用于解析变长整数
+type byteReader struct {
+	io.Reader
+}
+
+// ReadByte 读取一个字节
+func (r byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r.Reader, b[:])
+	return b[0], err
+}
+
+// protocolConn 在第一次写入前发送会话请求
+type protocolConn struct {
+	net.Conn
+	request []byte
+}
+
+// Write 写入数据，第一次写入时携带会话请求
+func (c *protocolConn) Write(b []byte) (int, error) {
+	if c.request == nil {
+		return c.Conn.Write(b)
+	}
+	data := append(c.request, b...)
+	c.request = nil
+	if _, err := c.Conn.Write(data); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
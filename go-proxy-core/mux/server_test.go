@@ -0,0 +1,143 @@
+package mux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serverDialTimeout 服务端连接目标的超时时间
+const serverDialTimeout = 10 * time.Second
+
+// testServer 模拟上游协议服务端，在收到的连接上处理复用会话
+type testServer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// newTestServer 在本机随机端口上启动服务端
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{listener: listener}
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropSessions()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go serveConn(conn)
+		}
+	}()
+	return s
+}
+
+// dial 模拟上游协议的拨号函数，只允许请求复用会话的虚拟目标地址
+func (s *testServer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if address != Destination {
+		return nil, fmt.Errorf("unexpected upstream target %s", address)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, s.listener.Addr().String())
+}
+
+// sessions 返回建立过的会话数量
+func (s *testServer) sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// dropSessions 断开所有会话，用于验证客户端重建会话
+func (s *testServer) dropSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// serveConn 处理一个复用会话，连接关闭或会话出错时返回
+// 只支持TCP流
+func serveConn(conn net.Conn) error {
+	defer conn.Close()
+
+	request, err := readSessionRequest(conn)
+	if err != nil {
+		return err
+	}
+	if request.Padding {
+		conn = &paddingConn{Conn: conn}
+	}
+
+	s, err := newMuxSession(conn, request.Protocol, false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for {
+		stream, err := s.Accept()
+		if err != nil {
+			if s.IsClosed() {
+				return nil
+			}
+			return err
+		}
+		go handleStream(stream)
+	}
+}
+
+// handleStream 连接流请求中的目标并双向转发数据
+func handleStream(stream net.Conn) {
+	defer stream.Close()
+
+	target, udp, err := readStreamRequest(stream)
+	if err != nil {
+		return
+	}
+	if udp {
+		writeStreamError(stream, "udp is not supported")
+		return
+	}
+
+	remote, err := net.DialTimeout("tcp", target, serverDialTimeout)
+	if err != nil {
+		writeStreamError(stream, err.Error())
+		return
+	}
+	defer remote.Close()
+
+	if _, err := stream.Write([]byte{statusSuccess}); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(remote, stream)
+		if tcpConn, ok := remote.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(stream, remote)
+	stream.Close()
+	<-done
+}
@@ -2,6 +2,7 @@ package openvpn
 
 import (
 	"bufio"
+	"context"
 	_ "embed"
 	"fmt"
 	"io"
@@ -34,6 +35,9 @@ type OpenVPNClient struct {
 	cmd              *exec.Cmd // 用于外部OpenVPN进程
 	tunIP            string    // TUN设备的IP地址
 	helperConfigPath string    // 特权助手处理后的配置文件路径
+	// dialContext 连接隧道内目标使用的拨号函数，为空时使用系统网络栈直接连接
+	// 配置为绑定TUN设备的拨号器后，连接不受系统路由表影响
+	dialContext func(ctx context.Context, network, address string) (net.Conn, error)
 	// DNS缓存相关字段
 	dnsCache      map[string]dnsCacheEntry // DNS缓存
 	dnsCacheMutex sync.RWMutex             // DNS缓存的读写锁
@@ -74,6 +78,26 @@ func (oc *OpenVPNClient) SetCredentials(username, password string) {
 	log.Printf("OpenVPN客户端设置凭据: username=%s", username)
 }
 
+// SetDialContext 设置连接隧道内目标使用的拨号函数
+func (oc *OpenVPNClient) SetDialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) {
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+	oc.dialContext = dial
+}
+
+// dial 使用配置的拨号函数连接，带超时
+func (oc *OpenVPNClient) dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	oc.mutex.Lock()
+	dial := oc.dialContext
+	oc.mutex.Unlock()
+	if dial == nil {
+		return net.DialTimeout(network, address, timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dial(ctx, network, address)
+}
+
 // SetHelperConfigPath 设置特权助手处理后的配置文件路径
 func (oc *OpenVPNClient) SetHelperConfigPath(helperConfigPath string) {
 	oc.mutex.Lock()
@@ -526,7 +550,7 @@ func (oc *OpenVPNClient) ConnectToTarget(targetAddr string) (net.Conn, error) {
 
 	// 直接通过系统网络栈连接到目标地址（流量会自动通过TUN设备传输）
 	log.Printf("通过OpenVPN隧道连接到目标: %s", targetAddr)
-	conn, err := net.DialTimeout("tcp", targetAddr, 30*time.Second)
+	conn, err := oc.dial("tcp", targetAddr, 30*time.Second)
 	if err != nil {
 		log.Printf("通过OpenVPN隧道连接到目标失败: %v", err)
 		return nil, fmt.Errorf("failed to connect to target %s through OpenVPN: %v", targetAddr, err)
@@ -620,7 +644,7 @@ func (oc *OpenVPNClient) resolveWithDNSServerOverVPN(domain, dnsServer string) (
 	log.Printf("通过OpenVPN连接解析域名: %s (DNS服务器: %s)", domain, dnsServer)
 
 	// 创建到DNS服务器的连接（通过OpenVPN隧道）
-	conn, err := net.DialTimeout("udp", net.JoinHostPort(dnsServer, "53"), 5*time.Second)
+	conn, err := oc.dial("udp", net.JoinHostPort(dnsServer, "53"), 5*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("无法连接到DNS服务器 %s: %v", dnsServer, err)
 	}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrProtocolNotImplemented 协议尚未实现
+var ErrProtocolNotImplemented = errors.New("protocol not implemented")
+
+// ProtocolCapabilities 协议工厂声明的能力
+type ProtocolCapabilities struct {
+	Implemented bool   `json:"implemented"`    // 是否完整实现了协议握手和加密
+	TCP         bool   `json:"tcp"`            // 是否支持TCP连接
+	UDP         bool   `json:"udp"`            // 是否支持UDP会话，部分协议还取决于配置或服务端
+	Note        string `json:"note,omitempty"` // 补充说明
+}
+
+// unimplementedCapabilities 尚未实现的协议的能力
+// 这类协议的工厂只建立到服务器的原始连接，没有握手和加密，使用它们会把客户端数据明文发送到服务器
+func unimplementedCapabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Note: "protocol handshake is not implemented"}
+}
+
+// checkCapabilities 拒绝创建尚未实现的协议
+func checkCapabilities(protocolType ProtocolType, factory ProtocolFactory) error {
+	if !factory.Capabilities().Implemented {
+		return fmt.Errorf("%w: %s", ErrProtocolNotImplemented, protocolType)
+	}
+	return nil
+}
+
+// Capabilities 返回所有已注册协议类型的能力
+func (pm *ProtocolManager) Capabilities() map[ProtocolType]ProtocolCapabilities {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	capabilities := make(map[ProtocolType]ProtocolCapabilities, len(pm.factories))
+	for protocolType, factory := range pm.factories {
+		capabilities[protocolType] = factory.Capabilities()
+	}
+	return capabilities
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dualvpn/go-proxy-core/config"
+)
+
+func TestProtocolCapabilities(t *testing.T) {
+	pc := NewProxyCore(&config.Config{})
+	pm := pc.protocolManager
+	capabilities := pm.Capabilities()
+	if len(capabilities) != len(pm.factories) {
+		t.Fatalf("capabilities for %d protocols, %d registered", len(capabilities), len(pm.factories))
+	}
+
+	var unimplemented []ProtocolType
+	for protocolType, capability := range capabilities {
+		name := "capability-test-" + string(protocolType)
+		// 尚未实现的协议在检查配置之前拒绝创建，配置完整与否都返回ErrProtocolNotImplemented
+		_, createErr := pm.CreateProtocol(protocolType, name, map[string]interface{}{})
+		_, schemaErr := pm.Schema(protocolType)
+
+		if !capability.Implemented {
+			unimplemented = append(unimplemented, protocolType)
+			if !errors.Is(createErr, ErrProtocolNotImplemented) || !errors.Is(schemaErr, ErrProtocolNotImplemented) {
+				t.Errorf("%s: create error = %v, schema error = %v, want ErrProtocolNotImplemented", protocolType, createErr, schemaErr)
+			}
+			if capability.TCP || capability.UDP {
+				t.Errorf("%s: unimplemented protocol reports networks %+v", protocolType, capability)
+			}
+			if pm.GetProtocol(name) != nil {
+				t.Errorf("%s: unimplemented protocol registered", protocolType)
+			}
+			continue
+		}
+
+		// 已实现的协议可能因为配置不完整而创建失败，但不能报告为未实现
+		if errors.Is(createErr, ErrProtocolNotImplemented) {
+			t.Errorf("%s: implemented protocol rejected: %v", protocolType, createErr)
+		}
+		if createErr == nil {
+			pm.RemoveProtocol(name)
+		}
+		if schemaErr != nil {
+			t.Errorf("%s: schema error = %v", protocolType, schemaErr)
+		}
+		if !capability.TCP {
+			t.Errorf("%s: implemented protocol does not support TCP", protocolType)
+		}
+	}
+
+	// 能力变化时需要同步更新README中的协议列表
+	want := []ProtocolType{ProtocolIKEv2, ProtocolIPsec, ProtocolL2TP, ProtocolPPTP, ProtocolShadowsocksR, ProtocolSoftEther, ProtocolVLESS, ProtocolVMess}
+	if !sameProtocolTypes(unimplemented, want) {
+		t.Errorf("unimplemented protocols = %v, want %v", unimplemented, want)
+	}
+}
+
+// sameProtocolTypes 比较两组协议类型，不考虑顺序
+func sameProtocolTypes(a, b []ProtocolType) bool {
+	set := func(types []ProtocolType) map[ProtocolType]bool {
+		m := make(map[ProtocolType]bool, len(types))
+		for _, protocolType := range types {
+			m[protocolType] = true
+		}
+		return m
+	}
+	return len(a) == len(b) && reflect.DeepEqual(set(a), set(b))
+}
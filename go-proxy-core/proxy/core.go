@@ -1,7 +1,10 @@
 package proxy
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"reflect"
 	"sync"
 	"time"
 
@@ -30,6 +33,25 @@ type ProxyCore struct {
 	proxySourceStatsCollectors map[string]*ProxySourceStatsCollector // key: proxySourceId
 	statsCollectorMu           sync.RWMutex
 
+	// 延迟测试创建临时协议时修改协议管理器，需要串行进行
+	delayTestMu sync.Mutex
+
+	// 切换当前代理时串行创建协议实例
+	switchMu sync.Mutex
+
+	// 代理源故障切换
+	failovers         map[string]*sourceFailover // key: proxySourceId
+	failoverListeners []func(FailoverEvent)
+	failoverMu        sync.RWMutex
+
+	// 托管的外部内核进程
+	externalCores  map[string]*externalCore // key: proxySourceId
+	externalCoreMu sync.Mutex
+
+	// 代理源的订阅
+	subscriptions  map[string]*sourceSubscription // key: proxySourceId
+	subscriptionMu sync.Mutex
+
 	mu      sync.RWMutex
 	running bool
 }
@@ -52,6 +74,14 @@ type ProxyInfo struct {
 	Port   int                    `json:"port"`
 	Config map[string]interface{} `json:"config"` // 认证信息等
 	Stats  *ProxyStats            `json:"stats"`
+
+	delayMu sync.RWMutex
+	delays  []DelayRecord // 最近的延迟测试结果，按时间顺序
+}
+
+// String 返回用于日志的描述
+func (p *ProxyInfo) String() string {
+	return fmt.Sprintf("{ID:%s Name:%s Type:%s Server:%s Port:%d}", p.ID, p.Name, p.Type, p.Server, p.Port)
 }
 
 // ProxyStats 代理统计信息
@@ -79,9 +109,9 @@ func NewProxyCore(cfg *config.Config) *ProxyCore {
 
 	// 注册协议工厂
 	protocolManager.RegisterFactory(ProtocolHTTP, &HTTPProtocolFactory{})
-	protocolManager.RegisterFactory(ProtocolHTTPS, &HTTPProtocolFactory{})
+	protocolManager.RegisterFactory(ProtocolHTTPS, &HTTPProtocolFactory{TLS: true})
 	protocolManager.RegisterFactory(ProtocolDIRECT, &DirectProtocolFactory{})
-	protocolManager.RegisterFactory(ProtocolSOCKS5, &HTTPProtocolFactory{}) // SOCKS5可以复用HTTP的连接逻辑
+	protocolManager.RegisterFactory(ProtocolSOCKS5, &SOCKS5ProtocolFactory{})
 	protocolManager.RegisterFactory(ProtocolOpenVPN, &OpenVPNProtocolFactory{})
 	protocolManager.RegisterFactory(ProtocolWireGuard, &WireGuardProtocolFactory{})
 	protocolManager.RegisterFactory(ProtocolIPsec, &IPsecProtocolFactory{})
@@ -95,12 +125,24 @@ func NewProxyCore(cfg *config.Config) *ProxyCore {
 	protocolManager.RegisterFactory(ProtocolIKEv2, &IKEv2ProtocolFactory{})
 	protocolManager.RegisterFactory(ProtocolSoftEther, &SoftEtherProtocolFactory{})
 	protocolManager.RegisterFactory(ProtocolVLESS, &VLESSProtocolFactory{}) // 注册VLESS协议工厂
+	protocolManager.RegisterFactory(ProtocolHysteria2, &Hysteria2ProtocolFactory{})
+	protocolManager.RegisterFactory(ProtocolTUIC, &TUICProtocolFactory{})
+	protocolManager.RegisterFactory(ProtocolSSH, &SSHProtocolFactory{})
+	for _, groupType := range []ProtocolType{ProtocolSelect, ProtocolURLTest, ProtocolFallback, ProtocolLoadBalance} {
+		protocolManager.RegisterFactory(groupType, NewGroupProtocolFactory(protocolManager, groupType))
+	}
 	// TODO: 注册其他协议工厂
 
 	// 添加默认的直连协议
 	directConfig := map[string]interface{}{
 		"name": "direct",
 	}
+	if cfg != nil {
+		directConfig["interface"] = cfg.Direct.Interface
+		directConfig["source_address"] = cfg.Direct.SourceAddress
+		directConfig["routing_mark"] = cfg.Direct.RoutingMark
+		directConfig["ip_strategy"] = cfg.Direct.IPStrategy
+	}
 	protocolManager.CreateProtocol(ProtocolDIRECT, "direct", directConfig)
 
 	// Shadowsocks协议
@@ -135,14 +177,28 @@ func NewProxyCore(cfg *config.Config) *ProxyCore {
 	}
 	protocolManager.CreateProtocol(ProtocolSOCKS5, "socks5", socks5Config)
 
+	// 配置文件中的代理组
+	if cfg != nil {
+		for _, group := range cfg.ProxyGroups {
+			if !IsGroupType(ProtocolType(group.Type)) {
+				log.Printf("代理组 %s 的类型 %s 无效", group.Name, group.Type)
+				continue
+			}
+			if _, err := protocolManager.CreateProtocol(ProtocolType(group.Type), group.Name, groupConfig(group)); err != nil {
+				log.Printf("创建代理组 %s 失败: %v", group.Name, err)
+			}
+		}
+	}
+
 	// 创建TUN设备（如果需要）
 	var tunDevice *TUNDevice
 	// TODO: 根据配置决定是否启用TUN模式
 
 	// 添加日志以确认协议管理器初始化完成
 	log.Printf("协议管理器初始化完成，已注册的协议工厂数量: %d", len(protocolManager.factories))
-	log.Printf("协议管理器中已创建的协议数量: %d", len(protocolManager.protocols))
-	for name, protocol := range protocolManager.protocols {
+	protocols := protocolManager.GetAllProtocols()
+	log.Printf("协议管理器中已创建的协议数量: %d", len(protocols))
+	for name, protocol := range protocols {
 		log.Printf("已创建协议: name=%s, type=%s", name, protocol.Type())
 	}
 
@@ -154,6 +210,9 @@ func NewProxyCore(cfg *config.Config) *ProxyCore {
 		proxySources:               make(map[string]*ProxySource),
 		currentProxies:             make(map[string]*ProxyInfo),
 		proxySourceStatsCollectors: make(map[string]*ProxySourceStatsCollector),
+		failovers:                  make(map[string]*sourceFailover),
+		externalCores:              make(map[string]*externalCore),
+		subscriptions:              make(map[string]*sourceSubscription),
 		// 其他组件将在后续实现
 	}
 }
@@ -234,16 +293,42 @@ func (pc *ProxyCore) Stop() {
 		pc.tunDevice.Stop()
 	}
 
-	// 停止所有协议，包括OpenVPN协议
+	// 停止故障切换的后台探测
+	pc.failoverMu.RLock()
+	var sourceIds []string
+	for sourceId := range pc.failovers {
+		sourceIds = append(sourceIds, sourceId)
+	}
+	pc.failoverMu.RUnlock()
+	for _, sourceId := range sourceIds {
+		pc.removeFailover(sourceId)
+	}
+
+	// 停止订阅的定时更新
+	pc.subscriptionMu.Lock()
+	var subscriptionIds []string
+	for sourceId := range pc.subscriptions {
+		subscriptionIds = append(subscriptionIds, sourceId)
+	}
+	pc.subscriptionMu.Unlock()
+	for _, sourceId := range subscriptionIds {
+		pc.removeSubscription(sourceId)
+	}
+
+	// 停止托管的外部内核进程
+	pc.externalCoreMu.Lock()
+	var coreIds []string
+	for sourceId := range pc.externalCores {
+		coreIds = append(coreIds, sourceId)
+	}
+	pc.externalCoreMu.Unlock()
+	for _, sourceId := range coreIds {
+		pc.removeExternalCore(sourceId)
+	}
+
+	// 停止所有协议，包括OpenVPN协议和等待连接结束的旧实例
 	if pc.protocolManager != nil {
-		// 获取所有协议并停止它们
-		protocols := pc.protocolManager.GetAllProtocols()
-		for name, protocol := range protocols {
-			log.Printf("停止协议: %s", name)
-			if err := protocol.Close(); err != nil {
-				log.Printf("停止协议 %s 时出错: %v", name, err)
-			}
-		}
+		pc.protocolManager.Close()
 	}
 
 	pc.running = false
@@ -282,20 +367,67 @@ func (pc *ProxyCore) GetRulesEngine() *routing.RulesEngine {
 	return pc.rulesEngine
 }
 
-// AddProxySource 添加代理源
-func (pc *ProxyCore) AddProxySource(source *ProxySource) {
+// AddProxySource 添加代理源，已存在相同ID的代理源时替换
+// 外部内核类型的代理源同时启动内核进程，配置了订阅地址的代理源在后台下载订阅
+// 配置无效或内核启动失败时返回错误，代理源不会被添加
+func (pc *ProxyCore) AddProxySource(source *ProxySource) error {
+	failoverConfig, err := parseFailoverConfig(source.Config)
+	if err != nil {
+		return fmt.Errorf("invalid failover config: %v", err)
+	}
+
+	var coreConfig ExternalCoreConfig
+	var subscriptionConfig *SubscriptionConfig
+	if source.Type == SourceTypeExternalCore {
+		cfg, err := parseExternalCoreConfig(source.Config)
+		if err != nil {
+			return fmt.Errorf("invalid external core config: %v", err)
+		}
+		coreConfig = cfg
+	} else {
+		cfg, err := parseSubscriptionConfig(source.Config)
+		if err != nil {
+			return fmt.Errorf("invalid subscription config: %v", err)
+		}
+		subscriptionConfig = cfg
+	}
+
 	pc.proxySourceMu.Lock()
-	defer pc.proxySourceMu.Unlock()
+	if source.Proxies == nil {
+		// 外部内核和订阅会向代理列表写入代理
+		source.Proxies = make(map[string]*ProxyInfo)
+	}
 	pc.proxySources[source.ID] = source
+	pc.proxySourceMu.Unlock()
+
+	// 按代理源配置启用或关闭故障切换
+	pc.setupFailover(source, failoverConfig)
+
+	// 按代理源类型启动或停止外部内核
+	if err := pc.setupExternalCore(source, coreConfig); err != nil {
+		pc.RemoveProxySource(source.ID)
+		return fmt.Errorf("failed to start external core: %v", err)
+	}
+
+	// 按代理源配置启动或停止订阅更新
+	pc.setupSubscription(source, subscriptionConfig)
+	return nil
 }
 
 // RemoveProxySource 移除代理源
 func (pc *ProxyCore) RemoveProxySource(sourceId string) {
+	pc.removeFailover(sourceId)
+	pc.removeExternalCore(sourceId)
+	pc.removeSubscription(sourceId)
+
 	pc.proxySourceMu.Lock()
-	defer pc.proxySourceMu.Unlock()
 	delete(pc.proxySources, sourceId)
 	// 同时移除当前代理
 	delete(pc.currentProxies, sourceId)
+	pc.proxySourceMu.Unlock()
+
+	// 代理源的协议实例在已有连接结束后关闭
+	pc.protocolManager.RemoveProtocol(sourceId)
 }
 
 // GetProxySource 获取代理源
@@ -305,6 +437,36 @@ func (pc *ProxyCore) GetProxySource(sourceId string) *ProxySource {
 	return pc.proxySources[sourceId]
 }
 
+// GetProxy 获取代理源中的代理，代理源或代理不存在时返回nil
+// 代理源的代理列表会被故障切换、订阅更新等后台任务修改，不能在锁外直接读取source.Proxies
+func (pc *ProxyCore) GetProxy(sourceId, proxyId string) *ProxyInfo {
+	pc.proxySourceMu.RLock()
+	defer pc.proxySourceMu.RUnlock()
+	if source, exists := pc.proxySources[sourceId]; exists {
+		return source.Proxies[proxyId]
+	}
+	return nil
+}
+
+// GetProxySourceProxies 返回代理源代理列表的副本，代理源不存在时返回nil
+func (pc *ProxyCore) GetProxySourceProxies(sourceId string) map[string]*ProxyInfo {
+	pc.proxySourceMu.RLock()
+	defer pc.proxySourceMu.RUnlock()
+	if source, exists := pc.proxySources[sourceId]; exists {
+		return copyProxies(source.Proxies)
+	}
+	return nil
+}
+
+// copyProxies 复制代理列表，调用方需要持有proxySourceMu
+func copyProxies(proxies map[string]*ProxyInfo) map[string]*ProxyInfo {
+	result := make(map[string]*ProxyInfo, len(proxies))
+	for pid, proxy := range proxies {
+		result[pid] = proxy
+	}
+	return result
+}
+
 // GetAllProxySources 获取所有代理源
 func (pc *ProxyCore) GetAllProxySources() map[string]*ProxySource {
 	pc.proxySourceMu.RLock()
@@ -313,17 +475,12 @@ func (pc *ProxyCore) GetAllProxySources() map[string]*ProxySource {
 	result := make(map[string]*ProxySource)
 	for id, source := range pc.proxySources {
 		// 创建副本以避免并发访问问题
-		proxies := make(map[string]*ProxyInfo)
-		for pid, proxy := range source.Proxies {
-			proxies[pid] = proxy
-		}
-
 		sourceCopy := &ProxySource{
 			ID:      source.ID,
 			Name:    source.Name,
 			Type:    source.Type,
 			Config:  source.Config,
-			Proxies: proxies,
+			Proxies: copyProxies(source.Proxies),
 		}
 		result[id] = sourceCopy
 	}
@@ -331,29 +488,78 @@ func (pc *ProxyCore) GetAllProxySources() map[string]*ProxySource {
 }
 
 // UpdateProxySourceProxies 更新代理源的代理列表
+// 保存的是proxies的副本，之后切换当前代理时写入的是代理源自己的列表，调用方可以继续读取proxies
 func (pc *ProxyCore) UpdateProxySourceProxies(sourceId string, proxies map[string]*ProxyInfo) {
 	pc.proxySourceMu.Lock()
 	defer pc.proxySourceMu.Unlock()
 
 	if source, exists := pc.proxySources[sourceId]; exists {
-		source.Proxies = proxies
+		for pid, proxy := range proxies {
+			proxy.copyDelayHistory(source.Proxies[pid])
+		}
+		source.Proxies = copyProxies(proxies)
 	}
 }
 
-// SetCurrentProxy 设置代理源的当前代理
-func (pc *ProxyCore) SetCurrentProxy(sourceId string, proxy *ProxyInfo) {
+// SetCurrentProxy 设置代理源的当前代理，启用故障切换时同时记录为首选代理
+// 新连接立即使用新代理，切换前建立的连接继续使用旧协议实例，全部结束后旧实例被关闭
+func (pc *ProxyCore) SetCurrentProxy(sourceId string, proxy *ProxyInfo) error {
+	if err := pc.setCurrentProxy(sourceId, proxy); err != nil {
+		return err
+	}
+	if f := pc.getFailover(sourceId); f != nil {
+		f.setPreferred(proxy.ID)
+	}
+	return nil
+}
+
+// setCurrentProxy 为代理源创建新代理的协议实例并设为当前代理，不修改故障切换的首选代理
+// 协议实例以代理源ID注册，路由规则按代理源ID匹配；创建失败时保留原来的当前代理
+func (pc *ProxyCore) setCurrentProxy(sourceId string, proxy *ProxyInfo) error {
+	// 同一时间只进行一次切换，避免并发切换时后创建的协议被先创建的覆盖
+	pc.switchMu.Lock()
+	defer pc.switchMu.Unlock()
+
+	config := protocolConfig(proxy)
+	previous := pc.GetCurrentProxy(sourceId)
+	if previous != nil && previous.ID == proxy.ID && previous.Type == proxy.Type &&
+		reflect.DeepEqual(protocolConfig(previous), config) &&
+		pc.protocolManager.GetProtocol(sourceId) != nil {
+		// 配置没有变化，继续使用现有协议实例，避免断开已有连接
+		log.Printf("代理源 %s 的当前代理 %s 没有变化，保留现有协议实例", sourceId, proxy.ID)
+	} else {
+		// 协议的创建可能需要连接服务器，不持有代理源的锁
+		log.Printf("创建协议: type=%s, name=%s, config=%v", proxy.Type, sourceId, config)
+		protocol, err := pc.protocolManager.CreateProtocol(proxy.Type, sourceId, config)
+		if err != nil {
+			log.Printf("创建代理源协议失败: %v", err)
+			return fmt.Errorf("failed to create protocol for proxy %s: %w", proxy.ID, err)
+		}
+		log.Printf("成功创建代理源协议: %s", protocol.Name())
+	}
+
 	pc.proxySourceMu.Lock()
 	defer pc.proxySourceMu.Unlock()
 
 	// 更新代理源中的代理信息
 	if source, exists := pc.proxySources[sourceId]; exists {
+		proxy.copyDelayHistory(source.Proxies[proxy.ID])
 		source.Proxies[proxy.ID] = proxy
 	}
 
 	// 设置当前代理
 	pc.currentProxies[sourceId] = proxy
 
-	// 同时在协议管理器中创建或更新协议实例
+	// 添加日志以确认当前代理已设置
+	log.Printf("代理源 %s 的当前代理已设置为: %+v", sourceId, proxy)
+
+	// 注意：我们不再需要启动外部的OpenVPN代理，因为OpenVPN协议现在完全在内部实现
+	// OpenVPN连接将通过OpenVPNProtocol和OpenVPNClient内部处理
+	return nil
+}
+
+// protocolConfig 根据代理信息生成协议配置
+func protocolConfig(proxy *ProxyInfo) map[string]interface{} {
 	config := make(map[string]interface{})
 	for k, v := range proxy.Config {
 		config[k] = v
@@ -361,49 +567,13 @@ func (pc *ProxyCore) SetCurrentProxy(sourceId string, proxy *ProxyInfo) {
 	config["server"] = proxy.Server
 	config["port"] = proxy.Port
 
-	// 添加日志以调试协议创建过程
-	log.Printf("创建协议: type=%s, name=%s, config=%v", proxy.Type, sourceId, config)
-
-	// 特别处理Shadowsocks协议，确保包含必要的配置
+	// Clash格式的Shadowsocks配置使用cipher字段表示加密方法
 	if proxy.Type == ProtocolShadowsocks {
-		log.Printf("特别处理Shadowsocks协议配置")
 		if cipher, ok := config["cipher"]; ok {
 			config["method"] = cipher
-			log.Printf("设置method为cipher值: %v", cipher)
-		}
-		if password, ok := config["password"]; ok {
-			config["password"] = password
-			log.Printf("设置password值: %v", password)
-		}
-		if method, ok := config["method"]; ok {
-			config["method"] = method
-			log.Printf("设置method值: %v", method)
 		}
-		log.Printf("Shadowsocks协议配置: %v", config)
-	}
-
-	// 使用代理的实际类型创建协议，而不是使用代理源ID作为协议名称
-	protocol, err := pc.protocolManager.CreateProtocol(proxy.Type, proxy.ID, config)
-	if err != nil {
-		log.Printf("创建协议失败: %v", err)
-	} else {
-		log.Printf("成功创建协议: %s", protocol.Name())
-	}
-
-	// 同时确保代理源ID对应的协议也存在，以便路由规则可以正确匹配
-	// 使用代理的实际类型创建代理源协议
-	sourceProtocol, err := pc.protocolManager.CreateProtocol(proxy.Type, sourceId, config)
-	if err != nil {
-		log.Printf("创建代理源协议失败: %v", err)
-	} else {
-		log.Printf("成功创建代理源协议: %s", sourceProtocol.Name())
 	}
-
-	// 添加日志以确认当前代理已设置
-	log.Printf("代理源 %s 的当前代理已设置为: %+v", sourceId, proxy)
-
-	// 注意：我们不再需要启动外部的OpenVPN代理，因为OpenVPN协议现在完全在内部实现
-	// OpenVPN连接将通过OpenVPNProtocol和OpenVPNClient内部处理
+	return config
 }
 
 // GetCurrentProxy 获取代理源的当前代理
@@ -499,3 +669,16 @@ func (pc *ProxyCore) updateStats() {
 		}
 	}
 }
+
+// connectContext 返回建立出站连接使用的上下文，超时时间取自配置
+func (pc *ProxyCore) connectContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), pc.connectTimeout())
+}
+
+// connectTimeout 返回配置的出站连接超时时间
+func (pc *ProxyCore) connectTimeout() time.Duration {
+	if pc != nil && pc.config != nil && pc.config.ConnectTimeout > 0 {
+		return time.Duration(pc.config.ConnectTimeout) * time.Second
+	}
+	return DefaultConnectTimeout
+}
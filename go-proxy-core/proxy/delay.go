@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// delayHistorySize 每个代理保留的延迟测试结果数量
+	delayHistorySize = 10
+	// delayTestConcurrency 批量测试时同时进行的测试数量
+	delayTestConcurrency = 8
+)
+
+// DelayRecord 一次延迟测试的结果，时间单位为毫秒，失败时Error不为空
+type DelayRecord struct {
+	Time        time.Time `json:"time"`
+	URL         string    `json:"url"`
+	Delay       int64     `json:"delay"`        // 从开始连接到收到首个响应字节的总耗时
+	ConnectTime int64     `json:"connect_time"` // 通过代理建立连接（含TLS握手）的耗时
+	TTFB        int64     `json:"ttfb"`         // 发出请求到收到首个响应字节的耗时
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// RecordDelay 保存延迟测试结果，只保留最近delayHistorySize条
+func (p *ProxyInfo) RecordDelay(record DelayRecord) {
+	p.delayMu.Lock()
+	defer p.delayMu.Unlock()
+	p.delays = append(p.delays, record)
+	if len(p.delays) > delayHistorySize {
+		p.delays = append([]DelayRecord(nil), p.delays[len(p.delays)-delayHistorySize:]...)
+	}
+}
+
+// DelayHistory 返回最近的延迟测试结果，按时间顺序
+func (p *ProxyInfo) DelayHistory() []DelayRecord {
+	p.delayMu.RLock()
+	defer p.delayMu.RUnlock()
+	return append([]DelayRecord(nil), p.delays...)
+}
+
+// LastDelay 返回最近一次延迟测试结果，没有测试过时返回nil
+func (p *ProxyInfo) LastDelay() *DelayRecord {
+	p.delayMu.RLock()
+	defer p.delayMu.RUnlock()
+	if len(p.delays) == 0 {
+		return nil
+	}
+	record := p.delays[len(p.delays)-1]
+	return &record
+}
+
+// copyDelayHistory 更新代理列表时保留同一代理的测试历史
+func (p *ProxyInfo) copyDelayHistory(from *ProxyInfo) {
+	if from == nil || from == p {
+		return
+	}
+	history := from.DelayHistory()
+	p.delayMu.Lock()
+	defer p.delayMu.Unlock()
+	if len(p.delays) == 0 {
+		p.delays = history
+	}
+}
+
+// TestProxyDelay 测试代理源中某个代理的延迟，结果保存到ProxyInfo
+// 代理是代理源的当前代理时使用已创建的协议实例，否则创建临时实例，测试后关闭
+func (pc *ProxyCore) TestProxyDelay(ctx context.Context, sourceId string, proxy *ProxyInfo, testURL string) DelayRecord {
+	if testURL == "" {
+		testURL = DefaultTestURL
+	}
+	record := DelayRecord{Time: time.Now(), URL: testURL}
+
+	protocol, release, err := pc.delayTestProtocol(sourceId, proxy)
+	if err != nil {
+		record.Error = err.Error()
+		proxy.RecordDelay(record)
+		return record
+	}
+	defer release()
+
+	result, err := urlTest(ctx, protocol, testURL)
+	if err != nil {
+		record.Error = err.Error()
+		log.Printf("代理 %s/%s 延迟测试失败: %v", sourceId, proxy.ID, err)
+	} else {
+		record.Delay = result.Delay().Milliseconds()
+		record.ConnectTime = result.ConnectTime.Milliseconds()
+		record.TTFB = result.TTFB.Milliseconds()
+		record.StatusCode = result.StatusCode
+	}
+	proxy.RecordDelay(record)
+	return record
+}
+
+// TestProxySourceDelay 并发测试代理源中所有代理的延迟，返回代理ID到结果的映射
+func (pc *ProxyCore) TestProxySourceDelay(ctx context.Context, sourceId string, testURL string, timeout time.Duration) (map[string]DelayRecord, error) {
+	proxies := pc.GetProxySourceProxies(sourceId)
+	if proxies == nil {
+		return nil, fmt.Errorf("proxy source %s not found", sourceId)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]DelayRecord, len(proxies))
+	sem := make(chan struct{}, delayTestConcurrency)
+	for _, proxy := range proxies {
+		wg.Add(1)
+		go func(proxy *ProxyInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			testCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			record := pc.TestProxyDelay(testCtx, sourceId, proxy, testURL)
+
+			mu.Lock()
+			results[proxy.ID] = record
+			mu.Unlock()
+		}(proxy)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// delayTestProtocol 返回测试代理使用的协议实例和用完后的清理函数
+func (pc *ProxyCore) delayTestProtocol(sourceId string, proxy *ProxyInfo) (ProxyProtocol, func(), error) {
+	pc.delayTestMu.Lock()
+	defer pc.delayTestMu.Unlock()
+
+	if current := pc.GetCurrentProxy(sourceId); current != nil && current.ID == proxy.ID {
+		if protocol, release, err := pc.protocolManager.acquire(sourceId); err == nil {
+			return protocol, release, nil
+		}
+	}
+
+	name := fmt.Sprintf("%s/%s#delay-test", sourceId, proxy.ID)
+	protocol, release, err := pc.protocolManager.CreateTemporaryProtocol(proxy.Type, name, protocolConfig(proxy))
+	if err != nil {
+		return nil, nil, err
+	}
+	return protocol, func() {
+		pc.delayTestMu.Lock()
+		defer pc.delayTestMu.Unlock()
+		release()
+	}, nil
+}
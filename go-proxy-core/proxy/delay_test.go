@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+)
+
+// startSlowTarget 启动处理每个请求前等待delay的HTTP服务，测试结束时关闭
+func startSlowTarget(t *testing.T, delay time.Duration) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/generate_204"
+}
+
+func TestURLTest(t *testing.T) {
+	direct, err := (&DirectProtocolFactory{}).CreateProtocol(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := urlTest(context.Background(), direct, startSlowTarget(t, 100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StatusCode != http.StatusNoContent {
+		t.Fatalf("status = %d", result.StatusCode)
+	}
+	// 服务端的等待计入首字节时间，不计入连接时间
+	if result.TTFB < 100*time.Millisecond || result.ConnectTime >= 100*time.Millisecond {
+		t.Fatalf("connect = %s, ttfb = %s", result.ConnectTime, result.TTFB)
+	}
+	if result.Delay() != result.ConnectTime+result.TTFB {
+		t.Fatalf("delay = %s", result.Delay())
+	}
+
+	// 收到任何HTTP响应都视为成功
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	if result, err := urlTest(context.Background(), direct, notFound.URL); err != nil || result.StatusCode != http.StatusNotFound {
+		t.Fatalf("404 target: status = %d, err = %v", result.StatusCode, err)
+	}
+
+	// 超时后中断等待中的读取
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := urlTest(ctx, direct, startSlowTarget(t, 5*time.Second)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("slow target: err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("timeout took %s", elapsed)
+	}
+
+	// 自签名证书校验失败
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	if _, err := urlTest(context.Background(), direct, tlsServer.URL); err == nil || !strings.Contains(err.Error(), "tls handshake") {
+		t.Fatalf("self-signed target: err = %v", err)
+	}
+
+	for _, rawURL := range []string{"ftp://example.com/", "://bad"} {
+		if _, err := urlTest(context.Background(), direct, rawURL); err == nil {
+			t.Fatalf("%s: expected error", rawURL)
+		}
+	}
+}
+
+func TestDelayHistory(t *testing.T) {
+	proxy := &ProxyInfo{ID: "a"}
+	if proxy.LastDelay() != nil || len(proxy.DelayHistory()) != 0 {
+		t.Fatal("new proxy has delay history")
+	}
+
+	for i := 0; i < delayHistorySize+5; i++ {
+		proxy.RecordDelay(DelayRecord{Delay: int64(i)})
+	}
+	history := proxy.DelayHistory()
+	if len(history) != delayHistorySize {
+		t.Fatalf("history length = %d, want %d", len(history), delayHistorySize)
+	}
+	for i, record := range history {
+		if want := int64(i + 5); record.Delay != want {
+			t.Fatalf("history[%d] = %d, want %d", i, record.Delay, want)
+		}
+	}
+	if last := proxy.LastDelay(); last == nil || last.Delay != delayHistorySize+4 {
+		t.Fatalf("last delay = %+v", last)
+	}
+
+	// 返回的是副本
+	history[0].Delay = -1
+	if proxy.DelayHistory()[0].Delay != 5 {
+		t.Fatal("modifying history changed the proxy")
+	}
+
+	// 更新代理列表时保留测试历史，已有历史时不覆盖
+	updated := &ProxyInfo{ID: "a"}
+	updated.copyDelayHistory(proxy)
+	if len(updated.DelayHistory()) != delayHistorySize {
+		t.Fatal("history not copied")
+	}
+	fresh := &ProxyInfo{ID: "a"}
+	fresh.RecordDelay(DelayRecord{Delay: 1})
+	fresh.copyDelayHistory(proxy)
+	if history := fresh.DelayHistory(); len(history) != 1 || history[0].Delay != 1 {
+		t.Fatalf("existing history overwritten: %+v", history)
+	}
+}
+
+func TestProxyDelay(t *testing.T) {
+	probe := startSlowTarget(t, 0)
+	a, b := startTestProxy(t), startTestProxy(t)
+	b.down.Store(true)
+	pc := NewProxyCore(&config.Config{})
+	if err := pc.AddProxySource(&ProxySource{
+		ID:      "source",
+		Config:  map[string]interface{}{},
+		Proxies: map[string]*ProxyInfo{"a": a.info("a"), "b": b.info("b")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("source")
+
+	// 不是当前代理时使用临时实例
+	proxyA := pc.GetProxy("source", "a")
+	record := pc.TestProxyDelay(context.Background(), "source", proxyA, probe)
+	if record.Error != "" || record.StatusCode != http.StatusNoContent || record.URL != probe {
+		t.Fatalf("record = %+v", record)
+	}
+	if a.accepted.Load() != 1 {
+		t.Fatalf("proxy a accepted %d connections", a.accepted.Load())
+	}
+	if last := proxyA.LastDelay(); last == nil || *last != record {
+		t.Fatalf("last delay = %+v, want %+v", last, record)
+	}
+	if protocols := pc.protocolManager.GetAllProtocols(); protocols["source/a#delay-test"] != nil {
+		t.Fatal("temporary protocol registered in the protocol manager")
+	}
+
+	// 当前代理使用以代理源ID注册的实例
+	if err := pc.SetCurrentProxy("source", proxyA); err != nil {
+		t.Fatal(err)
+	}
+	if record := pc.TestProxyDelay(context.Background(), "source", proxyA, probe); record.Error != "" {
+		t.Fatalf("current proxy: %s", record.Error)
+	}
+	if len(proxyA.DelayHistory()) != 2 {
+		t.Fatalf("history = %+v", proxyA.DelayHistory())
+	}
+
+	if record := pc.TestProxyDelay(context.Background(), "source", pc.GetProxy("source", "b"), probe); record.Error == "" {
+		t.Fatal("unavailable proxy passed the delay test")
+	}
+
+	// 批量测试每个代理使用各自的超时
+	b.down.Store(false)
+	b.delay.Store(int64(2 * time.Second))
+	results, err := pc.TestProxySourceDelay(context.Background(), "source", probe, 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results["a"].Error != "" || results["b"].Error == "" {
+		t.Fatalf("results = %+v", results)
+	}
+	if _, err := pc.TestProxySourceDelay(context.Background(), "missing", probe, time.Second); err == nil {
+		t.Fatal("missing proxy source should fail")
+	}
+
+	// 默认使用DefaultTestURL
+	unreachable := &ProxyInfo{ID: "c", Type: "unknown", Config: map[string]interface{}{}}
+	if record := pc.TestProxyDelay(context.Background(), "source", unreachable, ""); record.URL != DefaultTestURL || record.Error == "" {
+		t.Fatalf("record = %+v", record)
+	}
+}
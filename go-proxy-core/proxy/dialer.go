@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// Dialer 出站拨号器，协议通过它连接自己的服务器
+// 默认直接连接，配置dialer_proxy后经由另一个协议或代理源连接
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// defaultDialer 默认的直连拨号器，双栈并行尝试
+var defaultDialer Dialer = &directDialer{strategy: IPStrategyDual}
+
+// DialOptions 协议连接服务器的方式，由协议管理器在创建协议时读取，所有协议通用
+// 字段的解析见dialerProxyName、parseSocketOptions和parseIPStrategy
+type DialOptions struct {
+	DialerProxy   string `config:"dialer-proxy,dialer_proxy" desc:"前置代理，经由另一个协议或代理源连接服务器"`
+	Interface     string `config:"interface-name,interface_name,bind_interface,bind-interface,interface" desc:"绑定的网卡"`
+	RoutingMark   int    `config:"routing-mark,routing_mark,so_mark,fwmark,mark" min:"0" desc:"Linux的SO_MARK"`
+	SourceAddress string `config:"source_address,source-address,bind_address,bind-address,local_address" desc:"本地源地址"`
+	IPStrategy    string `config:"ip-version,ip_version,ip-strategy,ip_strategy,domain_strategy,domainStrategy" enum:"dual,ipv4-only,ipv6-only,prefer-ipv4,prefer-ipv6,as-is,AsIs,ipv4,ipv6,use-ipv4,use-ipv6,UseIPv4,UseIPv6,ipv4-prefer,ipv6-prefer,PreferIPv4,PreferIPv6" desc:"地址族策略"`
+}
+
+// dialerProxyName 读取配置中的前置代理名称，兼容Clash的dialer-proxy字段
+func dialerProxyName(config map[string]interface{}) string {
+	for _, key := range []string{"dialer_proxy", "dialer-proxy"} {
+		if name, ok := config[key].(string); ok && strings.TrimSpace(name) != "" {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// setupDirectDialer 根据套接字选项和地址族策略为协议设置直连拨号器
+// 协议可以实现SetSocketOptions自行处理套接字选项，否则替换为对应的directDialer
+func (pm *ProtocolManager) setupDirectDialer(name string, protocol ProxyProtocol, config map[string]interface{}) error {
+	options, err := parseSocketOptions(config)
+	if err != nil {
+		return err
+	}
+	strategy, err := parseIPStrategy(config)
+	if err != nil {
+		return err
+	}
+	if options.isZero() && strategy == IPStrategyDual {
+		return nil
+	}
+
+	// 经由前置代理时连接由前置协议建立，这些选项应配置在前置协议上
+	if via := dialerProxyName(config); via != "" {
+		if !options.isZero() {
+			return fmt.Errorf("socket options cannot be used together with dialer proxy %s", via)
+		}
+		log.Printf("协议 %s 经由前置代理 %s 连接，忽略地址族策略 %s", name, via, strategy)
+		return nil
+	}
+
+	if setter, ok := protocol.(interface{ SetSocketOptions(SocketOptions) error }); ok {
+		if options.isZero() {
+			return nil
+		}
+		if err := setter.SetSocketOptions(options); err != nil {
+			return err
+		}
+	} else {
+		setter, ok := protocol.(interface{ SetDialer(Dialer) })
+		if !ok {
+			return fmt.Errorf("protocol %s does not support socket options", protocol.Type())
+		}
+		setter.SetDialer(&directDialer{options: options, strategy: strategy})
+	}
+	log.Printf("协议 %s 使用直连选项: %s, ip strategy=%s", name, options, strategy)
+	return nil
+}
+
+// chainDialer 通过协议管理器中的另一个协议建立连接
+// 前置协议在拨号时才查找，因此可以引用之后创建或被替换的协议
+type chainDialer struct {
+	pm    *ProtocolManager
+	owner string // 使用该拨号器的协议名称
+	via   string // 前置协议名称
+}
+
+// DialContext 通过前置协议连接到目标地址
+func (cd *chainDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	// 链路在创建后可能被修改，拨号时再次检查是否成环
+	if _, err := cd.pm.dialerChain(cd.owner); err != nil {
+		return nil, err
+	}
+
+	if cd.pm.lookupProtocol(cd.via) == nil {
+		return nil, fmt.Errorf("dialer proxy %s not found", cd.via)
+	}
+
+	conn, err := cd.pm.dial(ctx, cd.via, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s via %s: %v", address, cd.via, err)
+	}
+	return conn, nil
+}
+
+// dialerChain 返回从指定协议开始的前置代理链，链路成环时返回错误
+func (pm *ProtocolManager) dialerChain(name string) ([]string, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.dialerChainLocked(name)
+}
+
+// dialerChainLocked 同dialerChain，调用方需持有锁
+func (pm *ProtocolManager) dialerChainLocked(name string) ([]string, error) {
+	chain := []string{name}
+	seen := map[string]bool{name: true}
+	for current := name; ; {
+		via, ok := pm.dialerProxies[current]
+		if !ok {
+			return chain, nil
+		}
+		chain = append(chain, via)
+		if seen[via] {
+			return nil, fmt.Errorf("dialer proxy loop detected: %s", strings.Join(chain, " -> "))
+		}
+		seen[via] = true
+		current = via
+	}
+}
+
+// lookupProtocol 按名称查找协议，DIRECT不区分大小写
+// 返回的实例只用于查询状态，建立连接应使用dial以便协议被替换时正确关闭
+func (pm *ProtocolManager) lookupProtocol(name string) ProxyProtocol {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if entry := pm.lookupEntryLocked(name); entry != nil {
+		return entry.protocol
+	}
+	return nil
+}
+
+// lookupEntryLocked 按名称查找注册项，调用方需持有锁
+func (pm *ProtocolManager) lookupEntryLocked(name string) *protocolEntry {
+	if entry, ok := pm.protocols[name]; ok {
+		return entry
+	}
+	if strings.EqualFold(name, "direct") {
+		return pm.protocols["direct"]
+	}
+	return nil
+}
@@ -1,9 +1,9 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"time"
 )
 
 // DirectProtocol 直连协议实现
@@ -14,10 +14,29 @@ type DirectProtocol struct {
 // DirectProtocolFactory 直连协议工厂
 type DirectProtocolFactory struct{}
 
+// Capabilities 返回直连协议支持的能力
+func (f *DirectProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true}
+}
+
+// DirectConfig 直连协议配置，套接字选项和地址族策略见DialOptions
+type DirectConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+}
+
+// Config 返回直连协议的配置结构
+func (f *DirectProtocolFactory) Config() interface{} {
+	return &DirectConfig{}
+}
+
 // CreateProtocol 创建直连协议实例
 func (f *DirectProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	name, _ := config["name"].(string)
+	var cfg DirectConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
 
+	name := cfg.Name
 	if name == "" {
 		name = "direct"
 	}
@@ -34,8 +53,12 @@ func (f *DirectProtocolFactory) CreateProtocol(config map[string]interface{}) (P
 
 // Connect 直接连接到目标地址
 func (dp *DirectProtocol) Connect(targetAddr string) (net.Conn, error) {
-	// 直接连接到目标地址
-	conn, err := net.DialTimeout("tcp", targetAddr, 5*time.Second)
+	return connectTimeout(dp, targetAddr)
+}
+
+// DialContext 直接连接到目标地址
+func (dp *DirectProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	conn, err := dp.dial(ctx, network, targetAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to target %s: %v", targetAddr, err)
 	}
@@ -43,6 +66,20 @@ func (dp *DirectProtocol) Connect(targetAddr string) (net.Conn, error) {
 	return conn, nil
 }
 
+// ListenPacket 在本地创建UDP套接字，直接收发数据报
+func (dp *DirectProtocol) ListenPacket(ctx context.Context, targetAddr string) (net.PacketConn, error) {
+	pc, err := dp.listenPacket(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen udp: %v", err)
+	}
+	return pc, nil
+}
+
+// SupportsUDP 直连支持UDP
+func (dp *DirectProtocol) SupportsUDP() bool {
+	return true
+}
+
 // Close 关闭连接
 func (dp *DirectProtocol) Close() error {
 	// 直连协议不需要特殊关闭逻辑
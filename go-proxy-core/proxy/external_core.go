@@ -0,0 +1,710 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SourceTypeExternalCore 托管外部内核的代理源类型
+// 代理源启动配置的xray、sing-box或mihomo进程，通过进程的本地SOCKS5端口转发流量
+const SourceTypeExternalCore = "external-core"
+
+// ExternalCoreType 外部内核类型，决定生成的配置格式和启动参数
+type ExternalCoreType string
+
+// 支持的外部内核
+const (
+	ExternalCoreXray    ExternalCoreType = "xray"
+	ExternalCoreSingBox ExternalCoreType = "sing-box"
+	ExternalCoreMihomo  ExternalCoreType = "mihomo"
+)
+
+// ExternalCoreState 外部内核进程的状态
+type ExternalCoreState string
+
+// 外部内核进程状态
+const (
+	ExternalCoreStarting   ExternalCoreState = "starting"   // 进程已启动，等待SOCKS5端口可用
+	ExternalCoreRunning    ExternalCoreState = "running"    // SOCKS5端口可用
+	ExternalCoreRestarting ExternalCoreState = "restarting" // 进程退出或健康检查失败，等待重启
+	ExternalCoreStopped    ExternalCoreState = "stopped"    // 代理源被移除或代理核心停止
+	ExternalCoreFailed     ExternalCoreState = "failed"     // 超过最大重启次数，不再重启
+)
+
+const (
+	// externalCoreInboundTag 生成的配置中SOCKS5入站的标签
+	externalCoreInboundTag = "dualvpn-socks"
+	// externalCoreLogLines 每个外部内核保留的日志行数
+	externalCoreLogLines = 200
+	// externalCoreStableTime 进程持续运行超过这个时间后，重启间隔恢复为初始值
+	externalCoreStableTime = time.Minute
+	// externalCoreMaxRestartDelay 重启间隔的上限
+	externalCoreMaxRestartDelay = time.Minute
+	// externalCoreStopTimeout 停止进程时等待其自行退出的时间，超时后强制结束
+	externalCoreStopTimeout = 3 * time.Second
+	// externalCoreCheckTimeout 单次健康检查的超时
+	externalCoreCheckTimeout = 3 * time.Second
+)
+
+// ExternalCoreConfig 托管外部内核的代理源配置，来自ProxySource.Config
+type ExternalCoreConfig struct {
+	Core                ExternalCoreType       `config:"core,kernel" required:"true" enum:"xray,sing-box,mihomo" desc:"内核类型，clash视为mihomo，v2ray视为xray"`
+	Binary              string                 `config:"binary,path,executable" required:"true" desc:"内核可执行文件路径"`
+	Args                []string               `config:"args" desc:"启动参数，{config}替换为配置文件路径，{dir}替换为工作目录；默认按内核类型生成"`
+	CoreConfig          map[string]interface{} `config:"core_config,core-config" desc:"内核配置，会加入监听本地端口的SOCKS5入站"`
+	ConfigFile          string                 `config:"config_file,config-file" desc:"直接使用的内核配置文件，需要同时配置socks_port"`
+	SOCKSPort           int                    `config:"socks_port,socks-port" min:"0" max:"65535" desc:"内核SOCKS5入站的本地端口，默认自动选择"`
+	WorkDir             string                 `config:"work_dir,work-dir" desc:"工作目录，默认使用临时目录"`
+	Env                 map[string]string      `config:"env" desc:"附加的环境变量"`
+	StartTimeout        int                    `config:"start_timeout,start-timeout" default:"10" min:"1" desc:"等待SOCKS5端口可用的时间（秒）"`
+	HealthCheckInterval int                    `config:"health_check_interval,health-check-interval" default:"30" min:"0" desc:"健康检查间隔（秒），0表示不检查"`
+	HealthCheckFailures int                    `config:"health_check_failures,health-check-failures" default:"3" min:"1" desc:"连续多少次健康检查失败后重启进程"`
+	RestartDelay        int                    `config:"restart_delay,restart-delay" default:"1" min:"0" desc:"首次重启前等待的时间（秒），之后每次加倍，最长60秒"`
+	MaxRestarts         int                    `config:"max_restarts,max-restarts" min:"0" desc:"最大连续重启次数，0表示不限制"`
+}
+
+// parseExternalCoreConfig 读取并校验外部内核配置
+func parseExternalCoreConfig(sourceConfig map[string]interface{}) (ExternalCoreConfig, error) {
+	var cfg ExternalCoreConfig
+	if err := decodeConfig(sourceConfig, &cfg); err != nil {
+		return cfg, err
+	}
+
+	switch strings.ToLower(string(cfg.Core)) {
+	case "xray", "v2ray":
+		cfg.Core = ExternalCoreXray
+	case "sing-box", "singbox":
+		cfg.Core = ExternalCoreSingBox
+	case "mihomo", "clash", "clash-meta", "clash.meta":
+		cfg.Core = ExternalCoreMihomo
+	default:
+		return cfg, fmt.Errorf("unsupported external core: %s", cfg.Core)
+	}
+
+	if cfg.ConfigFile != "" {
+		if cfg.CoreConfig != nil {
+			return cfg, fmt.Errorf("core_config and config_file cannot be used together")
+		}
+		if cfg.SOCKSPort == 0 {
+			return cfg, fmt.Errorf("socks_port is required when using config_file")
+		}
+	}
+	return cfg, nil
+}
+
+// ExternalCoreStatus 外部内核的运行状态，用于API输出
+type ExternalCoreStatus struct {
+	SourceID       string            `json:"source_id"`
+	Core           ExternalCoreType  `json:"core"`
+	Binary         string            `json:"binary"`
+	State          ExternalCoreState `json:"state"`
+	PID            int               `json:"pid,omitempty"`
+	SOCKSPort      int               `json:"socks_port"`
+	ConfigPath     string            `json:"config_path"`
+	StartedAt      *time.Time        `json:"started_at,omitempty"` // 当前进程的启动时间
+	Restarts       int               `json:"restarts"`             // 累计重启次数
+	HealthFailures int               `json:"health_failures"`      // 当前进程连续健康检查失败次数
+	LastError      string            `json:"last_error,omitempty"`
+	Logs           []string          `json:"logs"` // 进程最近输出的日志
+}
+
+// externalCore 单个托管的外部内核进程
+type externalCore struct {
+	sourceId   string
+	config     ExternalCoreConfig
+	port       int
+	workDir    string
+	ownWorkDir bool // 工作目录是自动创建的临时目录，停止后删除
+	configPath string
+	args       []string
+
+	mu             sync.Mutex
+	state          ExternalCoreState
+	pid            int
+	startedAt      time.Time
+	restarts       int
+	healthFailures int
+	lastError      string
+	logs           []string
+
+	restart  chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newExternalCore 选择端口并写入内核配置，不启动进程
+func newExternalCore(sourceId string, cfg ExternalCoreConfig) (*externalCore, error) {
+	c := &externalCore{
+		sourceId: sourceId,
+		config:   cfg,
+		port:     cfg.SOCKSPort,
+		workDir:  cfg.WorkDir,
+		state:    ExternalCoreStarting,
+		restart:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if c.port == 0 {
+		port, err := freeLocalPort()
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate socks port: %v", err)
+		}
+		c.port = port
+	}
+
+	if c.workDir == "" {
+		dir, err := os.MkdirTemp("", "dualvpn-core-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create work dir: %v", err)
+		}
+		c.workDir = dir
+		c.ownWorkDir = true
+	} else if err := os.MkdirAll(c.workDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %v", err)
+	}
+
+	if err := c.writeConfig(); err != nil {
+		c.cleanup()
+		return nil, err
+	}
+	c.args = c.buildArgs()
+	return c, nil
+}
+
+// freeLocalPort 返回一个当前空闲的本地TCP端口
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// writeConfig 生成内核配置文件；使用config_file时直接使用用户的配置文件
+func (c *externalCore) writeConfig() error {
+	if c.config.ConfigFile != "" {
+		c.configPath = c.config.ConfigFile
+		return nil
+	}
+
+	var data []byte
+	var err error
+	switch c.config.Core {
+	case ExternalCoreXray:
+		c.configPath = filepath.Join(c.workDir, "config.json")
+		data, err = json.MarshalIndent(xrayCoreConfig(c.config.CoreConfig, c.port), "", "  ")
+	case ExternalCoreSingBox:
+		c.configPath = filepath.Join(c.workDir, "config.json")
+		data, err = json.MarshalIndent(singBoxCoreConfig(c.config.CoreConfig, c.port), "", "  ")
+	case ExternalCoreMihomo:
+		c.configPath = filepath.Join(c.workDir, "config.yaml")
+		data, err = yaml.Marshal(mihomoCoreConfig(c.config.CoreConfig, c.port))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate %s config: %v", c.config.Core, err)
+	}
+	if err := os.WriteFile(c.configPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s config: %v", c.config.Core, err)
+	}
+	return nil
+}
+
+// copyCoreConfig 复制用户的内核配置，避免修改代理源中的原始配置
+func copyCoreConfig(coreConfig map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(coreConfig)+2)
+	for k, v := range coreConfig {
+		result[k] = v
+	}
+	return result
+}
+
+// prependInbound 将SOCKS5入站放在用户入站之前
+func prependInbound(config map[string]interface{}, inbound map[string]interface{}) {
+	inbounds := []interface{}{inbound}
+	if existing, ok := config["inbounds"].([]interface{}); ok {
+		inbounds = append(inbounds, existing...)
+	}
+	config["inbounds"] = inbounds
+}
+
+// xrayCoreConfig 生成xray配置
+func xrayCoreConfig(coreConfig map[string]interface{}, port int) map[string]interface{} {
+	config := copyCoreConfig(coreConfig)
+	if _, ok := config["log"]; !ok {
+		config["log"] = map[string]interface{}{"loglevel": "warning"}
+	}
+	prependInbound(config, map[string]interface{}{
+		"tag":      externalCoreInboundTag,
+		"listen":   "127.0.0.1",
+		"port":     port,
+		"protocol": "socks",
+		"settings": map[string]interface{}{"auth": "noauth", "udp": true},
+	})
+	return config
+}
+
+// singBoxCoreConfig 生成sing-box配置
+func singBoxCoreConfig(coreConfig map[string]interface{}, port int) map[string]interface{} {
+	config := copyCoreConfig(coreConfig)
+	if _, ok := config["log"]; !ok {
+		config["log"] = map[string]interface{}{"level": "warn"}
+	}
+	prependInbound(config, map[string]interface{}{
+		"type":        "socks",
+		"tag":         externalCoreInboundTag,
+		"listen":      "127.0.0.1",
+		"listen_port": port,
+	})
+	return config
+}
+
+// mihomoCoreConfig 生成mihomo配置，SOCKS5端口只监听本机
+func mihomoCoreConfig(coreConfig map[string]interface{}, port int) map[string]interface{} {
+	config := copyCoreConfig(coreConfig)
+	config["socks-port"] = port
+	config["bind-address"] = "127.0.0.1"
+	config["allow-lan"] = false
+	if _, ok := config["log-level"]; !ok {
+		config["log-level"] = "warning"
+	}
+	return config
+}
+
+// buildArgs 生成启动参数
+func (c *externalCore) buildArgs() []string {
+	args := c.config.Args
+	if len(args) == 0 {
+		switch c.config.Core {
+		case ExternalCoreMihomo:
+			args = []string{"-d", "{dir}", "-f", "{config}"}
+		default:
+			args = []string{"run", "-c", "{config}"}
+		}
+	}
+
+	result := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{config}", c.configPath)
+		result[i] = strings.ReplaceAll(arg, "{dir}", c.workDir)
+	}
+	return result
+}
+
+// run 启动并监控进程，进程退出或健康检查失败时按退避间隔重启，直到被停止或超过最大重启次数
+func (c *externalCore) run() {
+	defer close(c.done)
+
+	initialDelay := time.Duration(c.config.RestartDelay) * time.Second
+	delay := initialDelay
+	consecutive := 0
+	for {
+		started := time.Now()
+		manual := c.runOnce()
+
+		select {
+		case <-c.stop:
+			c.setState(ExternalCoreStopped)
+			return
+		default:
+		}
+
+		if manual || time.Since(started) >= externalCoreStableTime {
+			delay = initialDelay
+			consecutive = 0
+		}
+		consecutive++
+
+		c.mu.Lock()
+		c.pid = 0
+		c.startedAt = time.Time{}
+		if c.config.MaxRestarts > 0 && consecutive > c.config.MaxRestarts {
+			c.state = ExternalCoreFailed
+			c.mu.Unlock()
+			log.Printf("外部内核 %s 连续重启 %d 次仍然失败，不再重启", c.sourceId, c.config.MaxRestarts)
+			return
+		}
+		c.restarts++
+		c.state = ExternalCoreRestarting
+		c.mu.Unlock()
+
+		if manual {
+			continue
+		}
+		log.Printf("外部内核 %s 将在 %s 后重启", c.sourceId, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-c.stop:
+			timer.Stop()
+			c.setState(ExternalCoreStopped)
+			return
+		case <-c.restart:
+			timer.Stop()
+			delay = initialDelay
+			consecutive = 0
+		case <-timer.C:
+			delay *= 2
+			if delay > externalCoreMaxRestartDelay {
+				delay = externalCoreMaxRestartDelay
+			}
+		}
+	}
+}
+
+// runOnce 运行一次进程，直到进程退出、连续健康检查失败或收到停止、重启请求
+// 返回是否因手动重启而结束
+func (c *externalCore) runOnce() bool {
+	output := &coreLogWriter{core: c}
+	defer output.flush()
+
+	cmd := exec.Command(c.config.Binary, c.args...)
+	cmd.Dir = c.workDir
+	cmd.Env = os.Environ()
+	for k, v := range c.config.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// 内核派生的子进程可能继续持有输出管道，进程退出后最多再等待这么久
+	cmd.WaitDelay = externalCoreStopTimeout
+
+	c.setState(ExternalCoreStarting)
+	if err := cmd.Start(); err != nil {
+		c.setError(fmt.Sprintf("failed to start %s: %v", c.config.Binary, err))
+		return false
+	}
+	log.Printf("外部内核 %s 已启动: pid=%d, core=%s, socks=127.0.0.1:%d", c.sourceId, cmd.Process.Pid, c.config.Core, c.port)
+
+	c.mu.Lock()
+	c.pid = cmd.Process.Pid
+	c.startedAt = time.Now()
+	c.healthFailures = 0
+	c.mu.Unlock()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	// 等待SOCKS5端口可用
+	deadline := time.NewTimer(time.Duration(c.config.StartTimeout) * time.Second)
+	defer deadline.Stop()
+	poll := time.NewTicker(200 * time.Millisecond)
+	defer poll.Stop()
+	for ready := false; !ready; {
+		select {
+		case err := <-exited:
+			c.setError(fmt.Sprintf("process exited before ready: %v", exitDescription(err)))
+			return false
+		case <-c.stop:
+			stopProcess(cmd, exited)
+			return false
+		case <-c.restart:
+			stopProcess(cmd, exited)
+			return true
+		case <-deadline.C:
+			c.setError(fmt.Sprintf("socks port %d not ready in %ds", c.port, c.config.StartTimeout))
+			cmd.Process.Kill()
+			<-exited
+			return false
+		case <-poll.C:
+			ready = c.check() == nil
+		}
+	}
+	c.setState(ExternalCoreRunning)
+	log.Printf("外部内核 %s 的SOCKS5端口已可用", c.sourceId)
+
+	var health <-chan time.Time
+	if c.config.HealthCheckInterval > 0 {
+		ticker := time.NewTicker(time.Duration(c.config.HealthCheckInterval) * time.Second)
+		defer ticker.Stop()
+		health = ticker.C
+	}
+	for {
+		select {
+		case err := <-exited:
+			c.setError(fmt.Sprintf("process exited: %v", exitDescription(err)))
+			return false
+		case <-c.stop:
+			stopProcess(cmd, exited)
+			return false
+		case <-c.restart:
+			log.Printf("手动重启外部内核 %s", c.sourceId)
+			stopProcess(cmd, exited)
+			return true
+		case <-health:
+			err := c.check()
+			c.mu.Lock()
+			if err == nil {
+				c.healthFailures = 0
+				c.mu.Unlock()
+				continue
+			}
+			c.healthFailures++
+			failures := c.healthFailures
+			c.mu.Unlock()
+			log.Printf("外部内核 %s 健康检查失败 (%d/%d): %v", c.sourceId, failures, c.config.HealthCheckFailures, err)
+			if failures >= c.config.HealthCheckFailures {
+				c.setError(fmt.Sprintf("health check failed %d times: %v", failures, err))
+				cmd.Process.Kill()
+				<-exited
+				return false
+			}
+		}
+	}
+}
+
+// stopProcess 请求进程退出，超时后强制结束
+func stopProcess(cmd *exec.Cmd, exited <-chan error) {
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+		<-exited
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(externalCoreStopTimeout):
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// exitDescription 返回进程退出原因的描述
+func exitDescription(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// check 通过SOCKS5方法协商检查内核是否在正常工作
+func (c *externalCore) check() error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(c.port)), externalCoreCheckTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(externalCoreCheckTimeout))
+
+	if _, err := conn.Write([]byte{0x05, 0x01, 0x00}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 || reply[1] != 0x00 {
+		return fmt.Errorf("unexpected socks reply: %x", reply)
+	}
+	return nil
+}
+
+// requestRestart 请求重启进程，已在等待重启时立即重启
+func (c *externalCore) requestRestart() {
+	select {
+	case c.restart <- struct{}{}:
+	default:
+	}
+}
+
+// close 停止进程，等待监控协程退出后删除自动创建的工作目录
+func (c *externalCore) close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+		c.cleanup()
+	})
+	<-c.done
+}
+
+// cleanup 删除自动创建的工作目录
+func (c *externalCore) cleanup() {
+	if c.ownWorkDir {
+		os.RemoveAll(c.workDir)
+	}
+}
+
+// setState 更新进程状态
+func (c *externalCore) setState(state ExternalCoreState) {
+	c.mu.Lock()
+	c.state = state
+	c.mu.Unlock()
+}
+
+// setError 记录错误并输出日志
+func (c *externalCore) setError(message string) {
+	log.Printf("外部内核 %s: %s", c.sourceId, message)
+	c.mu.Lock()
+	c.lastError = message
+	c.mu.Unlock()
+}
+
+// appendLog 记录一行进程输出，只保留最近的externalCoreLogLines行
+func (c *externalCore) appendLog(line string) {
+	log.Printf("[%s] %s", c.sourceId, line)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.logs) >= externalCoreLogLines {
+		c.logs = append(c.logs[:0], c.logs[len(c.logs)-externalCoreLogLines+1:]...)
+	}
+	c.logs = append(c.logs, line)
+}
+
+// status 返回当前状态
+func (c *externalCore) status() ExternalCoreStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := ExternalCoreStatus{
+		SourceID:       c.sourceId,
+		Core:           c.config.Core,
+		Binary:         c.config.Binary,
+		State:          c.state,
+		PID:            c.pid,
+		SOCKSPort:      c.port,
+		ConfigPath:     c.configPath,
+		Restarts:       c.restarts,
+		HealthFailures: c.healthFailures,
+		LastError:      c.lastError,
+		Logs:           append([]string{}, c.logs...),
+	}
+	if !c.startedAt.IsZero() {
+		startedAt := c.startedAt
+		status.StartedAt = &startedAt
+	}
+	return status
+}
+
+// coreLogWriter 按行收集进程的标准输出和标准错误
+// 标准输出和标准错误使用同一个写入器，exec保证同一时间只有一个协程调用Write
+type coreLogWriter struct {
+	core *externalCore
+	buf  []byte
+}
+
+// Write 实现io.Writer接口
+func (w *coreLogWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	// 没有换行的超长输出也按行记录
+	if len(w.buf) > 4096 {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush 记录缓冲中剩余的输出
+func (w *coreLogWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+// emit 记录一行非空输出
+func (w *coreLogWriter) emit(line []byte) {
+	if text := strings.TrimRight(string(line), "\r"); strings.TrimSpace(text) != "" {
+		w.core.appendLog(text)
+	}
+}
+
+// setupExternalCore 停止代理源原有的外部内核，代理源是外部内核类型时按cfg启动新的内核
+// 外部内核的本地SOCKS5端口以代理源ID注册为当前代理，路由规则可以像其他代理源一样使用它
+func (pc *ProxyCore) setupExternalCore(source *ProxySource, cfg ExternalCoreConfig) error {
+	pc.removeExternalCore(source.ID)
+	if source.Type != SourceTypeExternalCore {
+		return nil
+	}
+
+	core, err := newExternalCore(source.ID, cfg)
+	if err != nil {
+		return err
+	}
+
+	pc.externalCoreMu.Lock()
+	pc.externalCores[source.ID] = core
+	pc.externalCoreMu.Unlock()
+	go core.run()
+
+	proxy := &ProxyInfo{
+		ID:     "core",
+		Name:   fmt.Sprintf("%s (%s)", source.Name, cfg.Core),
+		Type:   ProtocolSOCKS5,
+		Server: "127.0.0.1",
+		Port:   core.port,
+		Config: make(map[string]interface{}),
+		Stats:  &ProxyStats{},
+	}
+	if err := pc.setCurrentProxy(source.ID, proxy); err != nil {
+		pc.removeExternalCore(source.ID)
+		return err
+	}
+	return nil
+}
+
+// removeExternalCore 停止代理源的外部内核，没有时不做任何事
+func (pc *ProxyCore) removeExternalCore(sourceId string) {
+	pc.externalCoreMu.Lock()
+	core := pc.externalCores[sourceId]
+	delete(pc.externalCores, sourceId)
+	pc.externalCoreMu.Unlock()
+	if core != nil {
+		core.close()
+		log.Printf("外部内核 %s 已停止", sourceId)
+	}
+}
+
+// GetExternalCoreStatus 返回代理源的外部内核状态，代理源不是外部内核类型时返回false
+func (pc *ProxyCore) GetExternalCoreStatus(sourceId string) (ExternalCoreStatus, bool) {
+	pc.externalCoreMu.Lock()
+	core := pc.externalCores[sourceId]
+	pc.externalCoreMu.Unlock()
+	if core == nil {
+		return ExternalCoreStatus{}, false
+	}
+	return core.status(), true
+}
+
+// RestartExternalCore 重启代理源的外部内核，已超过最大重启次数的内核重新启动
+func (pc *ProxyCore) RestartExternalCore(sourceId string) error {
+	pc.externalCoreMu.Lock()
+	core := pc.externalCores[sourceId]
+	pc.externalCoreMu.Unlock()
+	if core == nil {
+		return fmt.Errorf("proxy source %s has no external core", sourceId)
+	}
+
+	select {
+	case <-core.done:
+		// 监控协程已因超过最大重启次数退出，使用相同的配置重新启动
+		source := pc.GetProxySource(sourceId)
+		if source == nil {
+			return fmt.Errorf("proxy source %s not found", sourceId)
+		}
+		return pc.setupExternalCore(source, core.config)
+	default:
+		core.requestRestart()
+		return nil
+	}
+}
@@ -0,0 +1,311 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"github.com/shadowsocks/go-shadowsocks2/socks"
+)
+
+// testCoreEnv 设置该环境变量时测试二进制作为外部内核运行
+const testCoreEnv = "DUALVPN_TEST_CORE"
+
+// testCoreUnhealthyFile 工作目录中存在该文件时，测试内核拒绝SOCKS5方法协商
+const testCoreUnhealthyFile = "unhealthy"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testCoreEnv) == "1" {
+		runTestCore()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runTestCore 模拟xray: 从run -c指定的配置文件中读取SOCKS5入站端口，延迟片刻后开始监听
+// 收到SIGINT时退出，标准输出和标准错误各输出一行日志
+func runTestCore() {
+	var configPath string
+	for i, arg := range os.Args {
+		if arg == "-c" && i+1 < len(os.Args) {
+			configPath = os.Args[i+1]
+		}
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read config: %v\n", err)
+		os.Exit(2)
+	}
+	var cfg struct {
+		Inbounds []struct {
+			Port int `json:"port"`
+		} `json:"inbounds"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil || len(cfg.Inbounds) == 0 {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Fprintln(os.Stderr, "test core starting")
+	// 模拟内核初始化，端口不会立即可用
+	time.Sleep(300 * time.Millisecond)
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", cfg.Inbounds[0].Port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "listen: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Printf("test core listening on %s\n", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			os.Exit(1)
+		}
+		go serveTestCoreConn(conn)
+	}
+}
+
+// serveTestCoreConn 处理一个无认证的SOCKS5 CONNECT请求
+func serveTestCoreConn(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != 0x05 {
+		return
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return
+	}
+	if _, err := os.Stat(testCoreUnhealthyFile); err == nil {
+		conn.Write([]byte{0x05, 0xff})
+		return
+	}
+	conn.Write([]byte{0x05, 0x00})
+
+	request := make([]byte, 3)
+	if _, err := io.ReadFull(conn, request); err != nil || request[1] != 0x01 {
+		return
+	}
+	target, err := socks.ReadAddr(conn)
+	if err != nil {
+		return
+	}
+	remote, err := net.Dial("tcp", target.String())
+	if err != nil {
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer remote.Close()
+	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	go io.Copy(remote, conn)
+	io.Copy(conn, remote)
+}
+
+// addTestCore 添加使用测试内核的外部内核代理源，测试结束时移除
+func addTestCore(t *testing.T, pc *ProxyCore, workDir string, options map[string]interface{}) {
+	t.Helper()
+	binary, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceConfig := map[string]interface{}{
+		"core":          "xray",
+		"binary":        binary,
+		"work_dir":      workDir,
+		"env":           map[string]interface{}{testCoreEnv: "1"},
+		"restart_delay": float64(0),
+		"start_timeout": float64(5),
+	}
+	for k, v := range options {
+		sourceConfig[k] = v
+	}
+	if err := pc.AddProxySource(&ProxySource{ID: "core", Name: "test", Type: SourceTypeExternalCore, Config: sourceConfig}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.RemoveProxySource("core") })
+}
+
+// waitCoreStatus 等待外部内核状态满足条件
+func waitCoreStatus(t *testing.T, pc *ProxyCore, what string, done func(ExternalCoreStatus) bool) ExternalCoreStatus {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		status, ok := pc.GetExternalCoreStatus("core")
+		if !ok {
+			t.Fatal("external core not found")
+		}
+		if done(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s: %+v", what, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processAlive 检查进程是否仍在运行
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// coreRunning 内核已就绪
+func coreRunning(status ExternalCoreStatus) bool {
+	return status.State == ExternalCoreRunning
+}
+
+// connectThroughCore 经由代理源的当前代理连接回显服务器
+func connectThroughCore(t *testing.T, pc *ProxyCore, target string) {
+	t.Helper()
+	conn, err := pc.GetProtocolManager().Connect("core", target)
+	if err != nil {
+		t.Fatalf("connect through core: %v", err)
+	}
+	defer conn.Close()
+	testutil.Echo(t, conn, []byte("through core"))
+}
+
+func TestExternalCoreStart(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	pc := NewProxyCore(&config.Config{})
+	workDir := t.TempDir()
+	addTestCore(t, pc, workDir, nil)
+
+	// 端口可用前保持starting状态
+	status, _ := pc.GetExternalCoreStatus("core")
+	if status.State != ExternalCoreStarting || status.SOCKSPort == 0 {
+		t.Fatalf("initial status = %+v", status)
+	}
+	if current := pc.GetCurrentProxy("core"); current == nil || current.Type != ProtocolSOCKS5 || current.Port != status.SOCKSPort {
+		t.Fatalf("current proxy = %+v", current)
+	}
+
+	status = waitCoreStatus(t, pc, "core ready", coreRunning)
+	if status.PID == 0 || status.StartedAt == nil || status.Restarts != 0 {
+		t.Fatalf("running status = %+v", status)
+	}
+	if status.ConfigPath != filepath.Join(workDir, "config.json") {
+		t.Fatalf("config path = %s", status.ConfigPath)
+	}
+	connectThroughCore(t, pc, target)
+
+	// 标准输出和标准错误都被记录
+	status = waitCoreStatus(t, pc, "logs", func(s ExternalCoreStatus) bool { return len(s.Logs) >= 2 })
+	logs := strings.Join(status.Logs, "\n")
+	if !strings.Contains(logs, "test core starting") || !strings.Contains(logs, "test core listening on 127.0.0.1:") {
+		t.Fatalf("logs = %q", status.Logs)
+	}
+
+	// 移除代理源时停止进程
+	pid := status.PID
+	pc.RemoveProxySource("core")
+	if _, ok := pc.GetExternalCoreStatus("core"); ok {
+		t.Fatal("external core still registered")
+	}
+	if processAlive(pid) {
+		t.Fatalf("process %d still running", pid)
+	}
+}
+
+func TestExternalCoreRestartAfterKill(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	pc := NewProxyCore(&config.Config{})
+	addTestCore(t, pc, t.TempDir(), nil)
+
+	first := waitCoreStatus(t, pc, "core ready", coreRunning)
+	process, err := os.FindProcess(first.PID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+
+	status := waitCoreStatus(t, pc, "restart", func(s ExternalCoreStatus) bool {
+		return s.State == ExternalCoreRunning && s.PID != first.PID
+	})
+	if status.Restarts != 1 || !strings.Contains(status.LastError, "process exited") {
+		t.Fatalf("status after restart = %+v", status)
+	}
+	connectThroughCore(t, pc, target)
+
+	// 手动重启立即启动新进程
+	if err := pc.RestartExternalCore("core"); err != nil {
+		t.Fatal(err)
+	}
+	waitCoreStatus(t, pc, "manual restart", func(s ExternalCoreStatus) bool {
+		return s.State == ExternalCoreRunning && s.Restarts == 2
+	})
+	connectThroughCore(t, pc, target)
+}
+
+func TestExternalCoreHealthCheckFailure(t *testing.T) {
+	pc := NewProxyCore(&config.Config{})
+	workDir := t.TempDir()
+	addTestCore(t, pc, workDir, map[string]interface{}{
+		"health_check_interval": float64(1),
+		"health_check_failures": float64(2),
+		"start_timeout":         float64(1),
+		"max_restarts":          float64(1),
+	})
+	first := waitCoreStatus(t, pc, "core ready", coreRunning)
+
+	// 内核拒绝方法协商后，连续健康检查失败达到次数时重启进程
+	unhealthy := filepath.Join(workDir, testCoreUnhealthyFile)
+	if err := os.WriteFile(unhealthy, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	status := waitCoreStatus(t, pc, "health check restart", func(s ExternalCoreStatus) bool { return s.Restarts == 1 })
+	if !strings.Contains(status.LastError, "health check failed 2 times") {
+		t.Fatalf("last error = %q", status.LastError)
+	}
+
+	// 重启后的进程端口不可用，超过max_restarts后不再重启
+	status = waitCoreStatus(t, pc, "core failed", func(s ExternalCoreStatus) bool { return s.State == ExternalCoreFailed })
+	if status.PID != 0 || !strings.Contains(status.LastError, "not ready") {
+		t.Fatalf("failed status = %+v", status)
+	}
+	if processAlive(first.PID) {
+		t.Fatalf("unhealthy process %d still running", first.PID)
+	}
+
+	// 恢复后手动重启
+	os.Remove(unhealthy)
+	if err := pc.RestartExternalCore("core"); err != nil {
+		t.Fatal(err)
+	}
+	waitCoreStatus(t, pc, "core recovered", coreRunning)
+}
+
+func TestParseExternalCoreConfig(t *testing.T) {
+	cfg, err := parseExternalCoreConfig(map[string]interface{}{"core": "clash", "binary": "/usr/bin/mihomo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Core != ExternalCoreMihomo || cfg.StartTimeout != 10 || cfg.HealthCheckFailures != 3 {
+		t.Fatalf("config = %+v", cfg)
+	}
+
+	for _, sourceConfig := range []map[string]interface{}{
+		{"binary": "/usr/bin/xray"},
+		{"core": "v2fly", "binary": "/usr/bin/xray"},
+		{"core": "xray", "binary": "/usr/bin/xray", "config_file": "/etc/xray.json"},
+		{"core": "xray", "binary": "/usr/bin/xray", "config_file": "/etc/xray.json", "core_config": map[string]interface{}{}, "socks_port": float64(1080)},
+	} {
+		if _, err := parseExternalCoreConfig(sourceConfig); err == nil {
+			t.Fatalf("parseExternalCoreConfig(%v): expected error", sourceConfig)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FailbackPolicy 故障切换后的回切策略
+type FailbackPolicy string
+
+// 回切策略
+const (
+	FailbackAuto FailbackPolicy = "auto" // 用户选择的代理恢复后自动切回
+	FailbackNone FailbackPolicy = "none" // 保持使用切换后的代理，直到用户重新选择
+)
+
+const (
+	// failoverEventLimit 每个代理源保留的切换事件数量
+	failoverEventLimit = 50
+)
+
+// FailoverConfig 代理源的故障切换配置，来自ProxySource.Config的failover字段
+type FailoverConfig struct {
+	Enabled          bool
+	MaxFailures      int            // 连续连接失败多少次后切换
+	ProbeInterval    time.Duration  // 后台探测当前代理的间隔，为0时只根据连接结果切换
+	ProbeURL         string         // 探测地址
+	ProbeTimeout     time.Duration  // 单次探测超时
+	Failback         FailbackPolicy // 回切策略
+	FailbackProbes   int            // 用户选择的代理连续探测成功多少次后回切
+	UnhealthyTimeout time.Duration  // 不可用标记的有效期，过期后代理可以重新被选用
+}
+
+// failoverOptions failover配置对象的字段
+type failoverOptions struct {
+	Enabled          bool   `config:"enabled" default:"true" desc:"是否启用故障切换"`
+	MaxFailures      int    `config:"max_failures,max-failures" default:"3" min:"1" desc:"连续连接失败多少次后切换"`
+	ProbeInterval    int    `config:"probe_interval,probe-interval,interval" default:"60" min:"0" desc:"后台探测当前代理的间隔（秒），0表示只根据连接结果切换"`
+	ProbeURL         string `config:"probe_url,probe-url,url" desc:"探测地址，默认使用延迟测试地址"`
+	ProbeTimeout     int    `config:"probe_timeout,probe-timeout,timeout" min:"1" desc:"单次探测超时（毫秒），默认使用延迟测试超时"`
+	Failback         string `config:"failback" default:"auto" enum:"auto,none" desc:"回切策略"`
+	FailbackProbes   int    `config:"failback_probes,failback-probes" default:"2" min:"1" desc:"用户选择的代理连续探测成功多少次后回切"`
+	UnhealthyTimeout int    `config:"unhealthy_timeout,unhealthy-timeout" default:"300" min:"0" desc:"不可用标记的有效期（秒），0表示不过期"`
+}
+
+// parseFailoverConfig 读取故障切换配置，failover可以是布尔值或配置对象
+func parseFailoverConfig(sourceConfig map[string]interface{}) (FailoverConfig, error) {
+	options := make(map[string]interface{})
+	switch v := sourceConfig["failover"].(type) {
+	case bool:
+		options["enabled"] = v
+	case map[string]interface{}:
+		options = v
+	case nil:
+		options["enabled"] = false
+	default:
+		return FailoverConfig{}, fmt.Errorf("failover must be a boolean or an object, got %T", v)
+	}
+
+	var opts failoverOptions
+	if err := decodeConfig(options, &opts); err != nil {
+		return FailoverConfig{}, err
+	}
+	cfg := FailoverConfig{
+		Enabled:          opts.Enabled,
+		MaxFailures:      opts.MaxFailures,
+		ProbeInterval:    time.Duration(opts.ProbeInterval) * time.Second,
+		ProbeURL:         opts.ProbeURL,
+		ProbeTimeout:     time.Duration(opts.ProbeTimeout) * time.Millisecond,
+		Failback:         FailbackPolicy(opts.Failback),
+		FailbackProbes:   opts.FailbackProbes,
+		UnhealthyTimeout: time.Duration(opts.UnhealthyTimeout) * time.Second,
+	}
+	if cfg.ProbeURL == "" {
+		cfg.ProbeURL = DefaultTestURL
+	}
+	if cfg.ProbeTimeout == 0 {
+		cfg.ProbeTimeout = DefaultTestTimeout
+	}
+	if cfg.Failback != FailbackAuto && cfg.Failback != FailbackNone {
+		return cfg, fmt.Errorf("unsupported failback policy: %s", cfg.Failback)
+	}
+	return cfg, nil
+}
+
+// FailoverEvent 代理源切换当前代理的事件
+type FailoverEvent struct {
+	Time     time.Time `json:"time"`
+	SourceID string    `json:"source_id"`
+	From     string    `json:"from"`
+	To       string    `json:"to"` // 没有可用代理时为空
+	Reason   string    `json:"reason"`
+	Failback bool      `json:"failback"` // 是否为切回用户选择的代理
+}
+
+// FailoverStatus 代理源的故障切换状态，用于API输出
+type FailoverStatus struct {
+	Enabled   bool                 `json:"enabled"`
+	Failback  FailbackPolicy       `json:"failback"`
+	Preferred string               `json:"preferred"` // 用户选择的代理
+	Current   string               `json:"current"`
+	Failures  int                  `json:"failures"`  // 当前代理的连续连接失败次数
+	Unhealthy map[string]time.Time `json:"unhealthy"` // 代理ID -> 标记为不可用的时间
+	Events    []FailoverEvent      `json:"events"`
+}
+
+// sourceFailover 单个代理源的故障切换状态
+type sourceFailover struct {
+	pc       *ProxyCore
+	sourceId string
+	config   FailoverConfig
+
+	mu             sync.Mutex
+	preferred      string
+	failures       int
+	failbackPasses int
+	unhealthy      map[string]time.Time
+	switching      bool
+	events         []FailoverEvent
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// setupFailover 根据解析后的配置创建故障切换状态，替换同一代理源之前的状态
+func (pc *ProxyCore) setupFailover(source *ProxySource, cfg FailoverConfig) {
+	pc.failoverMu.Lock()
+	previous := pc.failovers[source.ID]
+	delete(pc.failovers, source.ID)
+	var f *sourceFailover
+	if cfg.Enabled {
+		f = &sourceFailover{
+			pc:        pc,
+			sourceId:  source.ID,
+			config:    cfg,
+			unhealthy: make(map[string]time.Time),
+			stop:      make(chan struct{}),
+			done:      make(chan struct{}),
+		}
+		if previous != nil {
+			previous.mu.Lock()
+			f.preferred = previous.preferred
+			f.events = previous.events
+			previous.mu.Unlock()
+		} else if current := pc.GetCurrentProxy(source.ID); current != nil {
+			f.preferred = current.ID
+		}
+		pc.failovers[source.ID] = f
+	}
+	pc.failoverMu.Unlock()
+
+	if previous != nil {
+		previous.close()
+	}
+	if f == nil {
+		return
+	}
+	if cfg.ProbeInterval > 0 {
+		go f.probeLoop()
+	} else {
+		close(f.done)
+	}
+	log.Printf("代理源 %s 启用故障切换: max_failures=%d, probe_interval=%s, failback=%s",
+		source.ID, cfg.MaxFailures, cfg.ProbeInterval, cfg.Failback)
+}
+
+// removeFailover 停止并移除代理源的故障切换
+func (pc *ProxyCore) removeFailover(sourceId string) {
+	pc.failoverMu.Lock()
+	f := pc.failovers[sourceId]
+	delete(pc.failovers, sourceId)
+	pc.failoverMu.Unlock()
+	if f != nil {
+		f.close()
+	}
+}
+
+// getFailover 返回代理源的故障切换状态，未启用时返回nil
+func (pc *ProxyCore) getFailover(sourceId string) *sourceFailover {
+	if pc == nil {
+		return nil
+	}
+	pc.failoverMu.RLock()
+	defer pc.failoverMu.RUnlock()
+	return pc.failovers[sourceId]
+}
+
+// OnFailover 注册切换事件的回调，回调在后台协程中执行
+func (pc *ProxyCore) OnFailover(callback func(FailoverEvent)) {
+	pc.failoverMu.Lock()
+	defer pc.failoverMu.Unlock()
+	pc.failoverListeners = append(pc.failoverListeners, callback)
+}
+
+// GetFailoverStatus 返回代理源的故障切换状态，未启用时Enabled为false
+func (pc *ProxyCore) GetFailoverStatus(sourceId string) FailoverStatus {
+	status := FailoverStatus{Unhealthy: make(map[string]time.Time)}
+	if current := pc.GetCurrentProxy(sourceId); current != nil {
+		status.Current = current.ID
+	}
+	f := pc.getFailover(sourceId)
+	if f == nil {
+		return status
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status.Enabled = true
+	status.Failback = f.config.Failback
+	status.Preferred = f.preferred
+	status.Failures = f.failures
+	for id, since := range f.unhealthy {
+		status.Unhealthy[id] = since
+	}
+	status.Events = append([]FailoverEvent(nil), f.events...)
+	return status
+}
+
+// reportConnectResult 记录经由代理源建立连接的结果，连续失败达到阈值时切换代理
+func (pc *ProxyCore) reportConnectResult(sourceId string, err error) {
+	f := pc.getFailover(sourceId)
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	if err == nil {
+		f.failures = 0
+		f.mu.Unlock()
+		return
+	}
+	f.failures++
+	failures := f.failures
+	f.mu.Unlock()
+
+	if failures >= f.config.MaxFailures {
+		// 目标地址不可达时经由正常的代理连接也会失败，切换前需要先探测当前代理
+		f.triggerSwitch(fmt.Sprintf("%d consecutive connect failures: %v", failures, err), true)
+	}
+}
+
+// setPreferred 用户选择当前代理后记录为首选代理，清除该代理的状态
+func (f *sourceFailover) setPreferred(proxyId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.preferred = proxyId
+	f.failures = 0
+	f.failbackPasses = 0
+	delete(f.unhealthy, proxyId)
+}
+
+// close 停止后台探测
+func (f *sourceFailover) close() {
+	f.stopOnce.Do(func() { close(f.stop) })
+	<-f.done
+}
+
+// isUnhealthyLocked 代理是否被标记为不可用且标记尚未过期
+func (f *sourceFailover) isUnhealthyLocked(proxyId string) bool {
+	since, ok := f.unhealthy[proxyId]
+	if !ok {
+		return false
+	}
+	if f.config.UnhealthyTimeout > 0 && time.Since(since) > f.config.UnhealthyTimeout {
+		delete(f.unhealthy, proxyId)
+		return false
+	}
+	return true
+}
+
+// triggerSwitch 在后台切换到下一个可用代理，同一时间只进行一次切换
+// verifyCurrent为真时先探测当前代理，探测成功则不切换
+func (f *sourceFailover) triggerSwitch(reason string, verifyCurrent bool) {
+	f.mu.Lock()
+	if f.switching {
+		f.mu.Unlock()
+		return
+	}
+	f.switching = true
+	f.mu.Unlock()
+
+	go func() {
+		defer func() {
+			f.mu.Lock()
+			f.switching = false
+			f.mu.Unlock()
+		}()
+		f.switchToNext(reason, verifyCurrent)
+	}()
+}
+
+// switchToNext 将当前代理标记为不可用，依次探测其他代理并切换到第一个可用的代理
+// 候选代理按最近一次测试的延迟排序，没有测试结果的排在后面
+// verifyCurrent为真时先探测当前代理，探测成功说明连接失败由目标地址引起，清零失败次数后返回
+func (f *sourceFailover) switchToNext(reason string, verifyCurrent bool) {
+	pc := f.pc
+	proxies := pc.GetProxySourceProxies(f.sourceId)
+	current := pc.GetCurrentProxy(f.sourceId)
+	if proxies == nil || current == nil {
+		return
+	}
+	if verifyCurrent {
+		ctx, cancel := context.WithTimeout(context.Background(), f.config.ProbeTimeout)
+		record := pc.TestProxyDelay(ctx, f.sourceId, current, f.config.ProbeURL)
+		cancel()
+		if record.Error == "" {
+			log.Printf("代理源 %s 的当前代理 %s 探测正常，不切换: %s", f.sourceId, current.ID, reason)
+			f.mu.Lock()
+			f.failures = 0
+			f.mu.Unlock()
+			return
+		}
+		reason += "; probe failed: " + record.Error
+	}
+	log.Printf("代理源 %s 的当前代理 %s 不可用: %s", f.sourceId, current.ID, reason)
+
+	f.mu.Lock()
+	f.unhealthy[current.ID] = time.Now()
+	var candidates []*ProxyInfo
+	for _, proxy := range proxies {
+		if proxy.ID != current.ID && !f.isUnhealthyLocked(proxy.ID) {
+			candidates = append(candidates, proxy)
+		}
+	}
+	f.mu.Unlock()
+	sortByDelay(candidates)
+
+	for _, candidate := range candidates {
+		select {
+		case <-f.stop:
+			return
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), f.config.ProbeTimeout)
+		record := pc.TestProxyDelay(ctx, f.sourceId, candidate, f.config.ProbeURL)
+		cancel()
+		if record.Error != "" {
+			f.mu.Lock()
+			f.unhealthy[candidate.ID] = time.Now()
+			f.mu.Unlock()
+			continue
+		}
+
+		// 探测期间用户可能已经选择了其他代理，订阅更新也可能已经移除或替换了候选代理
+		if now := pc.GetCurrentProxy(f.sourceId); now == nil || now.ID != current.ID {
+			return
+		}
+		if pc.GetProxy(f.sourceId, candidate.ID) != candidate {
+			continue
+		}
+		if err := pc.setCurrentProxy(f.sourceId, candidate); err != nil {
+			log.Printf("代理源 %s 切换到代理 %s 失败: %v", f.sourceId, candidate.ID, err)
+			f.mu.Lock()
+			f.unhealthy[candidate.ID] = time.Now()
+			f.mu.Unlock()
+			continue
+		}
+		f.mu.Lock()
+		f.failures = 0
+		f.failbackPasses = 0
+		f.mu.Unlock()
+		f.emit(FailoverEvent{From: current.ID, To: candidate.ID, Reason: reason})
+		return
+	}
+
+	f.emit(FailoverEvent{From: current.ID, Reason: reason + "; no healthy proxy available"})
+}
+
+// sortByDelay 按最近一次成功测试的延迟排序，没有结果或失败的代理排在后面，其次按ID排序
+func sortByDelay(proxies []*ProxyInfo) {
+	delay := func(p *ProxyInfo) int64 {
+		if record := p.LastDelay(); record != nil && record.Error == "" {
+			return record.Delay
+		}
+		return -1
+	}
+	sort.SliceStable(proxies, func(i, j int) bool {
+		di, dj := delay(proxies[i]), delay(proxies[j])
+		if (di < 0) != (dj < 0) {
+			return di >= 0
+		}
+		if di != dj {
+			return di < dj
+		}
+		return proxies[i].ID < proxies[j].ID
+	})
+}
+
+// probeLoop 定期探测当前代理，探测失败时切换；按回切策略探测用户选择的代理
+func (f *sourceFailover) probeLoop() {
+	defer close(f.done)
+	ticker := time.NewTicker(f.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.probe()
+		}
+	}
+}
+
+// probe 执行一次探测
+func (f *sourceFailover) probe() {
+	pc := f.pc
+	current := pc.GetCurrentProxy(f.sourceId)
+	if current == nil {
+		return
+	}
+
+	f.mu.Lock()
+	switching := f.switching
+	f.mu.Unlock()
+	if switching {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.config.ProbeTimeout)
+	record := pc.TestProxyDelay(ctx, f.sourceId, current, f.config.ProbeURL)
+	cancel()
+	if record.Error != "" {
+		// 探测使用固定的测试地址，失败说明代理本身不可用，直接切换
+		f.triggerSwitch("probe failed: "+record.Error, false)
+		return
+	}
+	f.mu.Lock()
+	delete(f.unhealthy, current.ID)
+	preferred := f.preferred
+	f.mu.Unlock()
+
+	if f.config.Failback != FailbackAuto || preferred == "" || preferred == current.ID {
+		return
+	}
+	target := pc.GetProxy(f.sourceId, preferred)
+	if target == nil {
+		return
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), f.config.ProbeTimeout)
+	record = pc.TestProxyDelay(ctx, f.sourceId, target, f.config.ProbeURL)
+	cancel()
+
+	f.mu.Lock()
+	if record.Error != "" {
+		f.failbackPasses = 0
+		f.mu.Unlock()
+		return
+	}
+	delete(f.unhealthy, preferred)
+	f.failbackPasses++
+	ready := f.failbackPasses >= f.config.FailbackProbes
+	f.mu.Unlock()
+	if !ready {
+		return
+	}
+
+	if now := pc.GetCurrentProxy(f.sourceId); now == nil || now.ID != current.ID {
+		return
+	}
+	if pc.GetProxy(f.sourceId, preferred) != target {
+		return
+	}
+	if err := pc.setCurrentProxy(f.sourceId, target); err != nil {
+		log.Printf("代理源 %s 切回首选代理 %s 失败: %v", f.sourceId, preferred, err)
+		return
+	}
+	f.mu.Lock()
+	f.failures = 0
+	f.failbackPasses = 0
+	f.mu.Unlock()
+	f.emit(FailoverEvent{From: current.ID, To: preferred, Reason: "preferred proxy recovered", Failback: true})
+}
+
+// emit 记录切换事件并通知回调
+func (f *sourceFailover) emit(event FailoverEvent) {
+	event.Time = time.Now()
+	event.SourceID = f.sourceId
+	if event.To != "" {
+		log.Printf("代理源 %s 切换当前代理: %s -> %s (%s)", f.sourceId, event.From, event.To, event.Reason)
+	} else {
+		log.Printf("代理源 %s 没有可用的代理，保持使用 %s (%s)", f.sourceId, event.From, event.Reason)
+	}
+
+	f.mu.Lock()
+	f.events = append(f.events, event)
+	if len(f.events) > failoverEventLimit {
+		f.events = append([]FailoverEvent(nil), f.events[len(f.events)-failoverEventLimit:]...)
+	}
+	f.mu.Unlock()
+
+	f.pc.failoverMu.RLock()
+	listeners := append([]func(FailoverEvent){}, f.pc.failoverListeners...)
+	f.pc.failoverMu.RUnlock()
+	for _, listener := range listeners {
+		go listener(event)
+	}
+}
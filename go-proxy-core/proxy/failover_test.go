@@ -0,0 +1,482 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+func TestParseFailoverConfig(t *testing.T) {
+	defaults := FailoverConfig{
+		Enabled:          true,
+		MaxFailures:      3,
+		ProbeInterval:    60 * time.Second,
+		ProbeURL:         DefaultTestURL,
+		ProbeTimeout:     DefaultTestTimeout,
+		Failback:         FailbackAuto,
+		FailbackProbes:   2,
+		UnhealthyTimeout: 5 * time.Minute,
+	}
+	disabled := defaults
+	disabled.Enabled = false
+
+	for _, tc := range []struct {
+		name   string
+		config map[string]interface{}
+		want   FailoverConfig
+	}{
+		{"not configured", map[string]interface{}{}, disabled},
+		{"true", map[string]interface{}{"failover": true}, defaults},
+		{"false", map[string]interface{}{"failover": false}, disabled},
+		{"empty object", map[string]interface{}{"failover": map[string]interface{}{}}, defaults},
+		{
+			// JSON中的数字为float64，也兼容字符串和短横线写法
+			name: "object",
+			config: map[string]interface{}{"failover": map[string]interface{}{
+				"max-failures":      float64(5),
+				"probe_interval":    "0",
+				"url":               "http://example.com/204",
+				"probe_timeout":     float64(1500),
+				"failback":          "none",
+				"failback_probes":   float64(1),
+				"unhealthy-timeout": float64(0),
+			}},
+			want: FailoverConfig{
+				Enabled:        true,
+				MaxFailures:    5,
+				ProbeURL:       "http://example.com/204",
+				ProbeTimeout:   1500 * time.Millisecond,
+				Failback:       FailbackNone,
+				FailbackProbes: 1,
+			},
+		},
+		{"disabled object", map[string]interface{}{"failover": map[string]interface{}{"enabled": false}}, disabled},
+	} {
+		got, err := parseFailoverConfig(tc.config)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Fatalf("%s: config = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, tc := range []struct {
+		failover interface{}
+		err      string
+	}{
+		{"yes", "boolean or an object"},
+		{map[string]interface{}{"max_failures": float64(0)}, "max_failures"},
+		{map[string]interface{}{"max_failures": "many"}, "max_failures"},
+		{map[string]interface{}{"probe_interval": float64(-1)}, "probe_interval"},
+		{map[string]interface{}{"probe_timeout": float64(0)}, "probe_timeout"},
+		{map[string]interface{}{"failback_probes": float64(0)}, "failback_probes"},
+		{map[string]interface{}{"failback": "sometimes"}, "failback policy"},
+	} {
+		_, err := parseFailoverConfig(map[string]interface{}{"failover": tc.failover})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Fatalf("failover %v: error = %v, want %q", tc.failover, err, tc.err)
+		}
+	}
+}
+
+func TestAddProxySourceInvalidFailover(t *testing.T) {
+	pc := NewProxyCore(&config.Config{})
+	err := pc.AddProxySource(&ProxySource{
+		ID:      "source",
+		Config:  map[string]interface{}{"failover": map[string]interface{}{"failback": "sometimes"}},
+		Proxies: map[string]*ProxyInfo{},
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid failover config") {
+		t.Fatalf("AddProxySource error = %v", err)
+	}
+	if pc.GetProxySource("source") != nil {
+		t.Fatal("proxy source with invalid failover config was added")
+	}
+
+	if err := pc.AddProxySource(&ProxySource{
+		ID:      "source",
+		Config:  map[string]interface{}{"failover": map[string]interface{}{"probe_interval": float64(0)}},
+		Proxies: map[string]*ProxyInfo{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("source")
+	if status := pc.GetFailoverStatus("source"); !status.Enabled {
+		t.Fatal("failover not enabled")
+	}
+}
+
+func TestProxySourceAccessors(t *testing.T) {
+	pc := NewProxyCore(&config.Config{})
+	directProxy := func(id string) *ProxyInfo {
+		return &ProxyInfo{ID: id, Name: id, Type: ProtocolDIRECT, Config: map[string]interface{}{}}
+	}
+	if err := pc.AddProxySource(&ProxySource{
+		ID:      "source",
+		Config:  map[string]interface{}{},
+		Proxies: map[string]*ProxyInfo{"a": directProxy("a")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("source")
+
+	if pc.GetProxy("source", "a") == nil || pc.GetProxy("source", "b") != nil || pc.GetProxy("missing", "a") != nil {
+		t.Fatal("GetProxy lookup mismatch")
+	}
+	if pc.GetProxySourceProxies("missing") != nil {
+		t.Fatal("expected nil proxies for missing source")
+	}
+	// 返回的是副本，修改不影响代理源
+	snapshot := pc.GetProxySourceProxies("source")
+	delete(snapshot, "a")
+	if pc.GetProxy("source", "a") == nil {
+		t.Fatal("modifying snapshot changed proxy source")
+	}
+
+	// 切换当前代理和替换代理列表会写入代理列表，与读取并发执行，由-race检查
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			id := fmt.Sprintf("p%d", i%4)
+			if err := pc.setCurrentProxy("source", directProxy(id)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pc.UpdateProxySourceProxies("source", map[string]*ProxyInfo{"a": directProxy("a")})
+		}
+	}()
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		for pid, proxy := range pc.GetProxySourceProxies("source") {
+			if proxy.ID != pid {
+				t.Fatalf("proxy %s stored as %s", proxy.ID, pid)
+			}
+		}
+		pc.GetProxy("source", "p1")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// testProxy 测试使用的SOCKS5代理，down为真时接受连接后立即关闭，模拟不可用的代理服务器
+// delay不为0时握手前等待该时长，模拟延迟较高的代理
+type testProxy struct {
+	listener net.Listener
+	down     atomic.Bool
+	delay    atomic.Int64
+	accepted atomic.Int32
+}
+
+// startTestProxy 在本机随机端口上启动SOCKS5代理，测试结束时关闭
+func startTestProxy(t *testing.T) *testProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	p := &testProxy{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			p.accepted.Add(1)
+			if p.down.Load() {
+				conn.Close()
+				continue
+			}
+			go func() {
+				time.Sleep(time.Duration(p.delay.Load()))
+				serveTestCoreConn(conn)
+			}()
+		}
+	}()
+	return p
+}
+
+// info 返回使用该代理的代理信息
+func (p *testProxy) info(id string) *ProxyInfo {
+	port := p.listener.Addr().(*net.TCPAddr).Port
+	return &ProxyInfo{ID: id, Name: id, Type: ProtocolSOCKS5, Server: "127.0.0.1", Port: port, Config: map[string]interface{}{}}
+}
+
+// startProbeTarget 启动返回204的HTTP服务，作为探测和延迟测试的地址
+func startProbeTarget(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/generate_204"
+}
+
+// failoverFixture 两个代理的代理源，当前代理为a
+type failoverFixture struct {
+	pc     *ProxyCore
+	a, b   *testProxy
+	events chan FailoverEvent
+}
+
+// newFailoverFixture 创建启用故障切换的代理源，options覆盖默认的故障切换配置
+func newFailoverFixture(t *testing.T, options map[string]interface{}) *failoverFixture {
+	t.Helper()
+	fx := &failoverFixture{
+		pc:     NewProxyCore(&config.Config{}),
+		a:      startTestProxy(t),
+		b:      startTestProxy(t),
+		events: make(chan FailoverEvent, 16),
+	}
+	failover := map[string]interface{}{
+		"max_failures":   float64(2),
+		"probe_interval": float64(0),
+		"probe_url":      startProbeTarget(t),
+		"probe_timeout":  float64(2000),
+		"failback":       "none",
+	}
+	for k, v := range options {
+		failover[k] = v
+	}
+	if err := fx.pc.AddProxySource(&ProxySource{
+		ID:      "source",
+		Config:  map[string]interface{}{"failover": failover},
+		Proxies: map[string]*ProxyInfo{"a": fx.a.info("a"), "b": fx.b.info("b")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fx.pc.RemoveProxySource("source") })
+	fx.pc.OnFailover(func(event FailoverEvent) { fx.events <- event })
+	if err := fx.pc.SetCurrentProxy("source", fx.pc.GetProxy("source", "a")); err != nil {
+		t.Fatal(err)
+	}
+	return fx
+}
+
+// connect 按规则目标经由代理源连接目标地址，返回连接错误
+func (fx *failoverFixture) connect(target string) error {
+	conn, _, err := fx.pc.dialRuleTargets(fx.pc.protocolManager, "source", "tcp", target)
+	if err == nil {
+		conn.Close()
+	}
+	return err
+}
+
+// waitEvent 等待下一个切换事件
+func (fx *failoverFixture) waitEvent(t *testing.T) FailoverEvent {
+	t.Helper()
+	select {
+	case event := <-fx.events:
+		return event
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for failover event")
+		return FailoverEvent{}
+	}
+}
+
+// waitIdle 等待后台切换结束
+func (fx *failoverFixture) waitIdle(t *testing.T) {
+	t.Helper()
+	f := fx.pc.getFailover("source")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		f.mu.Lock()
+		switching := f.switching
+		f.mu.Unlock()
+		if !switching {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for switch to finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// closedAddr 返回没有监听的本机地址
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestFailoverSwitchAfterConsecutiveFailures(t *testing.T) {
+	fx := newFailoverFixture(t, nil)
+	target := testutil.StartEchoServer(t)
+	if err := fx.connect(target); err != nil {
+		t.Fatal(err)
+	}
+
+	fx.a.down.Store(true)
+	// 第一次失败未达到max_failures，不切换
+	if err := fx.connect(target); err == nil {
+		t.Fatal("expected connect failure through dead proxy")
+	}
+	if status := fx.pc.GetFailoverStatus("source"); status.Failures != 1 || status.Current != "a" {
+		t.Fatalf("status after one failure = %+v", status)
+	}
+	fx.connect(target)
+
+	event := fx.waitEvent(t)
+	if event.SourceID != "source" || event.From != "a" || event.To != "b" || event.Failback {
+		t.Fatalf("event = %+v", event)
+	}
+	if !strings.Contains(event.Reason, "2 consecutive connect failures") || !strings.Contains(event.Reason, "probe failed") {
+		t.Fatalf("event reason = %q", event.Reason)
+	}
+	fx.waitIdle(t)
+	status := fx.pc.GetFailoverStatus("source")
+	if status.Current != "b" || status.Preferred != "a" || status.Failures != 0 {
+		t.Fatalf("status after switch = %+v", status)
+	}
+	if _, ok := status.Unhealthy["a"]; !ok {
+		t.Fatalf("dead proxy not marked unhealthy: %+v", status.Unhealthy)
+	}
+	if len(status.Events) != 1 || status.Events[0] != event {
+		t.Fatalf("status events = %+v", status.Events)
+	}
+	if err := fx.connect(target); err != nil {
+		t.Fatalf("connect after switch: %v", err)
+	}
+}
+
+func TestFailoverIgnoresUnreachableTarget(t *testing.T) {
+	fx := newFailoverFixture(t, nil)
+	unreachable := closedAddr(t)
+
+	// 代理正常但目标不可达，探测当前代理成功后不切换，也不标记为不可用
+	for i := 0; i < 2; i++ {
+		if err := fx.connect(unreachable); err == nil {
+			t.Fatal("expected connect failure to closed port")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for fx.pc.GetFailoverStatus("source").Failures != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("failures not reset after successful probe")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fx.waitIdle(t)
+
+	status := fx.pc.GetFailoverStatus("source")
+	if status.Current != "a" || len(status.Unhealthy) != 0 || len(status.Events) != 0 {
+		t.Fatalf("status = %+v", status)
+	}
+	if history := fx.pc.GetProxy("source", "a").DelayHistory(); len(history) != 1 || history[0].Error != "" {
+		t.Fatalf("current proxy was not probed: %+v", history)
+	}
+	select {
+	case event := <-fx.events:
+		t.Fatalf("unexpected event %+v", event)
+	default:
+	}
+}
+
+func TestFailoverFailback(t *testing.T) {
+	fx := newFailoverFixture(t, map[string]interface{}{
+		"probe_interval":  float64(1),
+		"failback":        "auto",
+		"failback_probes": float64(2),
+	})
+
+	// 后台探测发现当前代理不可用后切换
+	fx.a.down.Store(true)
+	event := fx.waitEvent(t)
+	if event.From != "a" || event.To != "b" || !strings.HasPrefix(event.Reason, "probe failed") {
+		t.Fatalf("switch event = %+v", event)
+	}
+
+	// 用户选择的代理恢复后，连续探测成功failback_probes次后切回
+	fx.a.down.Store(false)
+	start := time.Now()
+	event = fx.waitEvent(t)
+	if event.From != "b" || event.To != "a" || !event.Failback {
+		t.Fatalf("failback event = %+v", event)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("failed back after %v, want at least two probes", elapsed)
+	}
+	status := fx.pc.GetFailoverStatus("source")
+	if status.Current != "a" || len(status.Unhealthy) != 0 {
+		t.Fatalf("status after failback = %+v", status)
+	}
+}
+
+func TestFailoverUnhealthyExpiry(t *testing.T) {
+	fx := newFailoverFixture(t, map[string]interface{}{"unhealthy_timeout": float64(60)})
+	target := testutil.StartEchoServer(t)
+
+	fx.a.down.Store(true)
+	fx.connect(target)
+	fx.connect(target)
+	if event := fx.waitEvent(t); event.To != "b" {
+		t.Fatalf("event = %+v", event)
+	}
+	fx.waitIdle(t)
+
+	// a仍被标记为不可用，b失效后没有可切换的代理
+	probed := fx.a.accepted.Load()
+	fx.a.down.Store(false)
+	fx.b.down.Store(true)
+	fx.connect(target)
+	fx.connect(target)
+	event := fx.waitEvent(t)
+	if event.From != "b" || event.To != "" || !strings.Contains(event.Reason, "no healthy proxy available") {
+		t.Fatalf("event = %+v", event)
+	}
+	fx.waitIdle(t)
+	if accepted := fx.a.accepted.Load(); accepted != probed {
+		t.Fatalf("unhealthy proxy was probed: %d connections, want %d", accepted, probed)
+	}
+
+	// 标记过期后a重新成为候选代理
+	f := fx.pc.getFailover("source")
+	f.mu.Lock()
+	f.unhealthy["a"] = time.Now().Add(-2 * time.Minute)
+	f.mu.Unlock()
+	fx.connect(target)
+	fx.connect(target)
+	event = fx.waitEvent(t)
+	if event.From != "b" || event.To != "a" {
+		t.Fatalf("event after expiry = %+v", event)
+	}
+	fx.waitIdle(t)
+	if _, ok := fx.pc.GetFailoverStatus("source").Unhealthy["a"]; ok {
+		t.Fatal("expired unhealthy mark not cleared")
+	}
+}
@@ -0,0 +1,660 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+)
+
+// 代理组类型，代理组作为协议注册到协议管理器，规则的proxy_source可以直接使用组名
+const (
+	ProtocolSelect      ProtocolType = "select"       // 手动选择成员
+	ProtocolURLTest     ProtocolType = "url-test"     // 使用延迟最低的成员
+	ProtocolFallback    ProtocolType = "fallback"     // 使用第一个可用的成员
+	ProtocolLoadBalance ProtocolType = "load-balance" // 在可用成员之间分配连接
+)
+
+// 负载均衡策略
+const (
+	StrategyConsistentHashing = "consistent-hashing" // 同一目标主机始终使用同一成员
+	StrategyRoundRobin        = "round-robin"        // 依次轮换成员
+)
+
+const (
+	// defaultGroupInterval 自动选择类代理组的默认健康检查间隔
+	defaultGroupInterval = 300 * time.Second
+)
+
+// IsGroupType 返回协议类型是否为代理组
+func IsGroupType(protocolType ProtocolType) bool {
+	switch protocolType {
+	case ProtocolSelect, ProtocolURLTest, ProtocolFallback, ProtocolLoadBalance:
+		return true
+	}
+	return false
+}
+
+// HealthCheckConfig 代理组健康检查配置
+type HealthCheckConfig struct {
+	URL       string        // 测试地址
+	Interval  time.Duration // 检查间隔，为0时不定期检查
+	Timeout   time.Duration // 单个成员的测试超时
+	Tolerance time.Duration // url-test切换成员的延迟容差，避免频繁切换
+	Lazy      bool          // 代理组在一个检查间隔内未被使用时跳过检查
+}
+
+// memberState 成员的健康状态
+type memberState struct {
+	alive     bool
+	delay     time.Duration
+	lastCheck time.Time
+	err       string
+}
+
+// ProxyGroup 代理组，按类型从成员协议中选择一个建立连接
+// 成员是协议管理器中的协议名称，在拨号时才查找，因此可以引用代理源、其他代理组或DIRECT
+type ProxyGroup struct {
+	BaseProtocol
+	pm       *ProtocolManager
+	members  []string
+	health   HealthCheckConfig
+	strategy string
+
+	mu       sync.RWMutex
+	selected string // select组用户选择的成员
+	fastest  string // url-test组当前使用的成员
+	states   map[string]*memberState
+
+	counter  uint32 // 轮询计数
+	lastUsed int64  // 最近一次使用的时间，UnixNano
+	checking int32  // 是否有正在进行的触发检查
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// GroupProtocolFactory 代理组工厂
+type GroupProtocolFactory struct {
+	pm        *ProtocolManager
+	groupType ProtocolType
+}
+
+// NewGroupProtocolFactory 创建指定类型的代理组工厂
+func NewGroupProtocolFactory(pm *ProtocolManager, groupType ProtocolType) *GroupProtocolFactory {
+	return &GroupProtocolFactory{pm: pm, groupType: groupType}
+}
+
+// ProxyGroupConfig 代理组配置
+type ProxyGroupConfig struct {
+	Name      string   `config:"name" required:"true" desc:"代理组名称"`
+	Proxies   []string `config:"proxies,members" required:"true" desc:"成员协议、代理源或代理组的名称"`
+	URL       string   `config:"url,health_check_url,health-check-url" default:"https://www.gstatic.com/generate_204" desc:"健康检查地址"`
+	Interval  *int     `config:"interval" min:"0" desc:"健康检查间隔（秒），select组默认不检查，其他组默认300"`
+	Timeout   int      `config:"timeout" min:"0" desc:"健康检查超时（毫秒），默认5000"`
+	Tolerance int      `config:"tolerance" min:"0" desc:"url-test组切换成员的延迟容差（毫秒）"`
+	Lazy      bool     `config:"lazy" default:"true" desc:"没有流量时跳过健康检查"`
+	Strategy  string   `config:"strategy" enum:"consistent-hashing,round-robin" desc:"load-balance组的负载均衡策略"`
+	Selected  string   `config:"selected,now" desc:"select组当前选择的成员"`
+}
+
+// Config 返回代理组的配置结构
+func (f *GroupProtocolFactory) Config() interface{} {
+	return &ProxyGroupConfig{}
+}
+
+// Capabilities 代理组是否支持UDP取决于当前使用的成员
+func (f *GroupProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true, Note: "udp depends on the selected member"}
+}
+
+// CreateProtocol 创建代理组
+// 配置项兼容Clash的proxy-groups写法: proxies, url, interval(秒), timeout(毫秒), tolerance(毫秒), lazy, strategy
+func (f *GroupProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
+	var cfg ProxyGroupConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	name, members := cfg.Name, cfg.Proxies
+	if len(members) == 0 {
+		return nil, fmt.Errorf("group %s has no members", name)
+	}
+
+	seen := make(map[string]bool)
+	for _, member := range members {
+		if member == name {
+			return nil, fmt.Errorf("group %s cannot contain itself", name)
+		}
+		if seen[member] {
+			return nil, fmt.Errorf("group %s contains duplicate member %s", name, member)
+		}
+		seen[member] = true
+	}
+	if err := f.pm.checkGroupLoop(name, members); err != nil {
+		return nil, err
+	}
+
+	health := HealthCheckConfig{
+		URL:       cfg.URL,
+		Timeout:   time.Duration(cfg.Timeout) * time.Millisecond,
+		Tolerance: time.Duration(cfg.Tolerance) * time.Millisecond,
+		Lazy:      cfg.Lazy,
+	}
+	if cfg.Interval != nil {
+		health.Interval = time.Duration(*cfg.Interval) * time.Second
+	} else if f.groupType != ProtocolSelect {
+		health.Interval = defaultGroupInterval
+	}
+	if health.Timeout <= 0 {
+		health.Timeout = DefaultTestTimeout
+	}
+
+	strategy := ""
+	if f.groupType == ProtocolLoadBalance {
+		strategy = cfg.Strategy
+		switch strategy {
+		case "":
+			strategy = StrategyConsistentHashing
+		case StrategyConsistentHashing, StrategyRoundRobin:
+		default:
+			return nil, fmt.Errorf("unsupported load balance strategy: %s", strategy)
+		}
+	}
+
+	group := &ProxyGroup{
+		BaseProtocol: BaseProtocol{
+			name:         name,
+			protocolType: f.groupType,
+		},
+		pm:       f.pm,
+		members:  members,
+		health:   health,
+		strategy: strategy,
+		states:   make(map[string]*memberState),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, member := range members {
+		// 检查之前认为成员可用
+		group.states[member] = &memberState{alive: true}
+		if f.pm.lookupProtocol(member) == nil {
+			log.Printf("代理组 %s 的成员 %s 尚未创建", name, member)
+		}
+	}
+	group.selected = members[0]
+	if selected := cfg.Selected; selected != "" {
+		if !seen[selected] {
+			return nil, fmt.Errorf("group %s has no member %s", name, selected)
+		}
+		group.selected = selected
+	}
+
+	if health.Interval > 0 {
+		go group.healthCheckLoop()
+	} else {
+		close(group.done)
+	}
+	log.Printf("创建代理组: name=%s, type=%s, members=%v, url=%s, interval=%s",
+		name, f.groupType, members, health.URL, health.Interval)
+	return group, nil
+}
+
+// checkGroupLoop 检查代理组成员中是否间接包含代理组自身
+func (pm *ProtocolManager) checkGroupLoop(name string, members []string) error {
+	var visit func(path []string, members []string) error
+	visit = func(path []string, members []string) error {
+		for _, member := range members {
+			if member == name {
+				return fmt.Errorf("group loop detected: %s", strings.Join(append(path, member), " -> "))
+			}
+			if group, ok := pm.lookupProtocol(member).(*ProxyGroup); ok {
+				if err := visit(append(path, member), group.members); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return visit([]string{name}, members)
+}
+
+// GetGroups 返回所有代理组
+func (pm *ProtocolManager) GetGroups() map[string]*ProxyGroup {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	groups := make(map[string]*ProxyGroup)
+	for name, entry := range pm.protocols {
+		if group, ok := entry.protocol.(*ProxyGroup); ok {
+			groups[name] = group
+		}
+	}
+	return groups
+}
+
+// GetGroup 按名称获取代理组
+func (pm *ProtocolManager) GetGroup(name string) *ProxyGroup {
+	group, _ := pm.GetProtocol(name).(*ProxyGroup)
+	return group
+}
+
+// groupConfig 将配置文件中的代理组转换为协议配置
+func groupConfig(g config.ProxyGroupConfig) map[string]interface{} {
+	cfg := map[string]interface{}{
+		"name":      g.Name,
+		"proxies":   g.Proxies,
+		"url":       g.URL,
+		"timeout":   g.Timeout,
+		"tolerance": g.Tolerance,
+		"strategy":  g.Strategy,
+	}
+	if g.Interval != nil {
+		cfg["interval"] = *g.Interval
+	}
+	if g.Lazy != nil {
+		cfg["lazy"] = *g.Lazy
+	}
+	return cfg
+}
+
+// Members 返回成员名称
+func (g *ProxyGroup) Members() []string {
+	return append([]string(nil), g.members...)
+}
+
+// Now 返回当前使用的成员，load-balance组按连接选择成员，返回空字符串
+func (g *ProxyGroup) Now() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.nowLocked()
+}
+
+// nowLocked 返回当前使用的成员，调用方需持有锁
+func (g *ProxyGroup) nowLocked() string {
+	switch g.protocolType {
+	case ProtocolSelect:
+		return g.selected
+	case ProtocolURLTest:
+		return g.fastestLocked()
+	case ProtocolFallback:
+		return g.firstAliveLocked()
+	}
+	return ""
+}
+
+// Select 选择select组使用的成员
+func (g *ProxyGroup) Select(member string) error {
+	if g.protocolType != ProtocolSelect {
+		return fmt.Errorf("group %s of type %s does not support manual selection", g.name, g.protocolType)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.states[member]; !ok {
+		return fmt.Errorf("group %s has no member %s", g.name, member)
+	}
+	if g.selected != member {
+		log.Printf("代理组 %s 切换成员: %s -> %s", g.name, g.selected, member)
+		g.selected = member
+	}
+	return nil
+}
+
+// fastestLocked 返回url-test组使用的成员，尚未检查出结果时使用第一个可用的成员
+func (g *ProxyGroup) fastestLocked() string {
+	if g.fastest != "" && g.states[g.fastest].alive {
+		return g.fastest
+	}
+	return g.firstAliveLocked()
+}
+
+// firstAliveLocked 返回第一个可用的成员，全部不可用时返回第一个成员
+func (g *ProxyGroup) firstAliveLocked() string {
+	for _, member := range g.members {
+		if g.states[member].alive {
+			return member
+		}
+	}
+	return g.members[0]
+}
+
+// aliveMembersLocked 返回可用的成员，全部不可用时返回所有成员
+func (g *ProxyGroup) aliveMembersLocked() []string {
+	var alive []string
+	for _, member := range g.members {
+		if g.states[member].alive {
+			alive = append(alive, member)
+		}
+	}
+	if len(alive) == 0 {
+		return g.members
+	}
+	return alive
+}
+
+// candidates 返回本次连接按顺序尝试的成员
+// fallback组依次尝试所有可用成员，其他类型只使用选出的一个成员
+func (g *ProxyGroup) candidates(address string) []string {
+	atomic.StoreInt64(&g.lastUsed, time.Now().UnixNano())
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	switch g.protocolType {
+	case ProtocolSelect:
+		return []string{g.selected}
+	case ProtocolURLTest:
+		return []string{g.fastestLocked()}
+	case ProtocolFallback:
+		return g.aliveMembersLocked()
+	}
+
+	alive := g.aliveMembersLocked()
+	if g.strategy == StrategyRoundRobin {
+		index := atomic.AddUint32(&g.counter, 1) - 1
+		return []string{alive[int(index%uint32(len(alive)))]}
+	}
+	return []string{rendezvousHash(alive, hashKey(address))}
+}
+
+// hashKey 返回一致性哈希使用的键，同一主机的不同端口使用同一成员
+func hashKey(address string) string {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		return host
+	}
+	return address
+}
+
+// rendezvousHash 使用最高随机权重哈希选择成员，成员增减时只有少部分键改变映射
+func rendezvousHash(members []string, key string) string {
+	var best string
+	var bestScore uint64
+	for _, member := range members {
+		h := fnv.New64a()
+		h.Write([]byte(member))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = member, score
+		}
+	}
+	return best
+}
+
+// memberProtocol 查找成员协议并增加引用计数，用完后调用返回的release
+func (g *ProxyGroup) memberProtocol(member string) (ProxyProtocol, func(), error) {
+	protocol, release, err := g.pm.acquire(member)
+	if err != nil {
+		return nil, nil, fmt.Errorf("member %s of group %s not found", member, g.name)
+	}
+	return protocol, release, nil
+}
+
+// Connect 通过代理组连接到目标地址
+func (g *ProxyGroup) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(g, targetAddr)
+}
+
+// DialContext 通过选出的成员连接到目标地址，失败时触发一次健康检查
+func (g *ProxyGroup) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	var lastErr error
+	for _, member := range g.candidates(address) {
+		if g.pm.lookupProtocol(member) == nil {
+			lastErr = fmt.Errorf("member %s of group %s not found", member, g.name)
+			continue
+		}
+		conn, err := g.pm.dial(ctx, member, network, address)
+		if err == nil {
+			return conn, nil
+		}
+		log.Printf("代理组 %s 通过成员 %s 连接 %s 失败: %v", g.name, member, address, err)
+		lastErr = fmt.Errorf("group %s member %s: %v", g.name, member, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	g.triggerHealthCheck()
+	return nil, lastErr
+}
+
+// ListenPacket 通过选出的成员建立UDP会话
+func (g *ProxyGroup) ListenPacket(ctx context.Context, address string) (net.PacketConn, error) {
+	var lastErr error
+	for _, member := range g.candidates(address) {
+		protocol := g.pm.lookupProtocol(member)
+		if protocol == nil {
+			lastErr = fmt.Errorf("member %s of group %s not found", member, g.name)
+			continue
+		}
+		if !protocol.SupportsUDP() {
+			lastErr = fmt.Errorf("%w: group %s member %s (%s)", ErrUDPNotSupported, g.name, member, protocol.Type())
+			continue
+		}
+		pc, err := g.pm.listenPacket(ctx, member, address)
+		if err == nil {
+			return pc, nil
+		}
+		lastErr = fmt.Errorf("group %s member %s: %v", g.name, member, err)
+	}
+	return nil, lastErr
+}
+
+// SupportsUDP 返回当前使用的成员是否支持UDP，load-balance组要求所有成员都支持
+func (g *ProxyGroup) SupportsUDP() bool {
+	members := g.members
+	if now := g.Now(); now != "" {
+		members = []string{now}
+	}
+	for _, member := range members {
+		protocol := g.pm.lookupProtocol(member)
+		if protocol == nil || !protocol.SupportsUDP() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close 停止健康检查，成员协议由各自的所有者关闭
+func (g *ProxyGroup) Close() error {
+	g.stopOnce.Do(func() { close(g.stop) })
+	<-g.done
+	return nil
+}
+
+// IsRunning 检查代理组是否正在运行
+func (g *ProxyGroup) IsRunning() bool {
+	select {
+	case <-g.stop:
+		return false
+	default:
+		return true
+	}
+}
+
+// healthCheckLoop 定期检查成员，lazy模式下跳过最近未使用的代理组
+func (g *ProxyGroup) healthCheckLoop() {
+	defer close(g.done)
+
+	g.runHealthCheck()
+	ticker := time.NewTicker(g.health.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			lastUsed := time.Unix(0, atomic.LoadInt64(&g.lastUsed))
+			if g.health.Lazy && time.Since(lastUsed) > g.health.Interval {
+				continue
+			}
+			g.runHealthCheck()
+		}
+	}
+}
+
+// runHealthCheck 执行一次健康检查，代理组关闭时中止
+func (g *ProxyGroup) runHealthCheck() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-g.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	g.HealthCheck(ctx)
+}
+
+// triggerHealthCheck 连接失败后在后台检查成员，同一时间只进行一次
+func (g *ProxyGroup) triggerHealthCheck() {
+	if !atomic.CompareAndSwapInt32(&g.checking, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&g.checking, 0)
+		g.runHealthCheck()
+	}()
+}
+
+// HealthCheck 并发测试所有成员的延迟并更新状态，url-test组按容差重新选择成员
+func (g *ProxyGroup) HealthCheck(ctx context.Context) {
+	type result struct {
+		member string
+		delay  time.Duration
+		err    error
+	}
+	results := make(chan result, len(g.members))
+	for _, member := range g.members {
+		go func(member string) {
+			protocol, release, err := g.memberProtocol(member)
+			if err != nil {
+				results <- result{member: member, err: err}
+				return
+			}
+			defer release()
+			testCtx, cancel := context.WithTimeout(ctx, g.health.Timeout)
+			defer cancel()
+			r, err := urlTest(testCtx, protocol, g.health.URL)
+			results <- result{member: member, delay: r.Delay(), err: err}
+		}(member)
+	}
+
+	collected := make([]result, 0, len(g.members))
+	for range g.members {
+		collected = append(collected, <-results)
+	}
+	if ctx.Err() != nil {
+		// 代理组已关闭，结果不可信
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for _, r := range collected {
+		state := g.states[r.member]
+		state.lastCheck = now
+		state.alive = r.err == nil
+		state.delay = r.delay
+		state.err = ""
+		if r.err != nil {
+			state.delay = 0
+			state.err = r.err.Error()
+			log.Printf("代理组 %s 的成员 %s 健康检查失败: %v", g.name, r.member, r.err)
+		}
+	}
+
+	if g.protocolType == ProtocolURLTest {
+		best := ""
+		for _, member := range g.members {
+			state := g.states[member]
+			if state.alive && (best == "" || state.delay < g.states[best].delay) {
+				best = member
+			}
+		}
+		// 当前成员的延迟与最优成员相差不超过容差时保持不变
+		if current := g.fastest; current != "" && best != "" && g.states[current].alive &&
+			g.states[current].delay <= g.states[best].delay+g.health.Tolerance {
+			best = current
+		}
+		if best != g.fastest {
+			log.Printf("代理组 %s 切换到延迟最低的成员: %s -> %s", g.name, g.fastest, best)
+			g.fastest = best
+		}
+	}
+}
+
+// GroupInfo 代理组信息，用于API输出
+type GroupInfo struct {
+	Name        string            `json:"name"`
+	Type        ProtocolType      `json:"type"`
+	Now         string            `json:"now"`
+	Strategy    string            `json:"strategy,omitempty"`
+	HealthCheck HealthCheckInfo   `json:"health_check"`
+	Members     []GroupMemberInfo `json:"members"`
+}
+
+// HealthCheckInfo 健康检查配置，interval单位为秒，timeout和tolerance单位为毫秒
+type HealthCheckInfo struct {
+	URL       string `json:"url"`
+	Interval  int64  `json:"interval"`
+	Timeout   int64  `json:"timeout"`
+	Tolerance int64  `json:"tolerance"`
+	Lazy      bool   `json:"lazy"`
+}
+
+// GroupMemberInfo 成员信息，delay单位为毫秒
+type GroupMemberInfo struct {
+	Name      string       `json:"name"`
+	Type      ProtocolType `json:"type,omitempty"`
+	Alive     bool         `json:"alive"`
+	Delay     int64        `json:"delay"`
+	LastCheck *time.Time   `json:"last_check,omitempty"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// Info 返回代理组及成员的当前状态
+func (g *ProxyGroup) Info() GroupInfo {
+	info := GroupInfo{
+		Name:     g.name,
+		Type:     g.protocolType,
+		Strategy: g.strategy,
+		HealthCheck: HealthCheckInfo{
+			URL:       g.health.URL,
+			Interval:  int64(g.health.Interval / time.Second),
+			Timeout:   g.health.Timeout.Milliseconds(),
+			Tolerance: g.health.Tolerance.Milliseconds(),
+			Lazy:      g.health.Lazy,
+		},
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	info.Now = g.nowLocked()
+	for _, member := range g.members {
+		state := g.states[member]
+		memberInfo := GroupMemberInfo{
+			Name:  member,
+			Alive: state.alive,
+			Delay: state.delay.Milliseconds(),
+			Error: state.err,
+		}
+		if protocol := g.pm.lookupProtocol(member); protocol != nil {
+			memberInfo.Type = protocol.Type()
+		}
+		if !state.lastCheck.IsZero() {
+			lastCheck := state.lastCheck
+			memberInfo.LastCheck = &lastCheck
+		}
+		info.Members = append(info.Members, memberInfo)
+	}
+	return info
+}
@@ -0,0 +1,339 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// newGroupTestManager 创建注册了SOCKS5和代理组工厂的协议管理器
+func newGroupTestManager() *ProtocolManager {
+	pm := NewProtocolManager()
+	pm.RegisterFactory(ProtocolSOCKS5, &SOCKS5ProtocolFactory{})
+	for _, groupType := range []ProtocolType{ProtocolSelect, ProtocolURLTest, ProtocolFallback, ProtocolLoadBalance} {
+		pm.RegisterFactory(groupType, NewGroupProtocolFactory(pm, groupType))
+	}
+	return pm
+}
+
+// addTestMember 将测试代理注册为SOCKS5协议，作为代理组的成员
+func addTestMember(t *testing.T, pm *ProtocolManager, name string, p *testProxy) {
+	t.Helper()
+	config := map[string]interface{}{"server": "127.0.0.1", "port": p.listener.Addr().(*net.TCPAddr).Port}
+	if _, err := pm.CreateProtocol(ProtocolSOCKS5, name, config); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addTestGroup 创建代理组，不定期检查，健康检查使用probeURL
+func addTestGroup(t *testing.T, pm *ProtocolManager, groupType ProtocolType, name string, probeURL string, options map[string]interface{}) *ProxyGroup {
+	t.Helper()
+	config := map[string]interface{}{"name": name, "url": probeURL, "interval": 0, "timeout": 2000}
+	for k, v := range options {
+		config[k] = v
+	}
+	protocol, err := pm.CreateProtocol(groupType, name, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pm.RemoveProtocol(name) })
+	return protocol.(*ProxyGroup)
+}
+
+// dialGroup 通过代理组连接回显服务器并检查数据
+func dialGroup(t *testing.T, group *ProxyGroup, target string) {
+	t.Helper()
+	conn, err := group.DialContext(context.Background(), "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	testutil.Echo(t, conn, []byte("through group"))
+}
+
+// acceptedCounts 返回各测试代理接受的连接数
+func acceptedCounts(proxies ...*testProxy) []int32 {
+	counts := make([]int32, len(proxies))
+	for i, p := range proxies {
+		counts[i] = p.accepted.Load()
+	}
+	return counts
+}
+
+func TestGroupSelect(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	pm := newGroupTestManager()
+	a, b := startTestProxy(t), startTestProxy(t)
+	addTestMember(t, pm, "a", a)
+	addTestMember(t, pm, "b", b)
+	group := addTestGroup(t, pm, ProtocolSelect, "manual", startProbeTarget(t), map[string]interface{}{"proxies": []interface{}{"a", "b"}})
+
+	if now := group.Now(); now != "a" {
+		t.Fatalf("now = %s, want first member", now)
+	}
+	dialGroup(t, group, target)
+	if got := acceptedCounts(a, b); got[0] != 1 || got[1] != 0 {
+		t.Fatalf("accepted = %v, want only a", got)
+	}
+
+	if err := group.Select("b"); err != nil {
+		t.Fatal(err)
+	}
+	dialGroup(t, group, target)
+	if got := acceptedCounts(a, b); got[0] != 1 || got[1] != 1 {
+		t.Fatalf("accepted = %v after selecting b", got)
+	}
+	if err := group.Select("c"); err == nil {
+		t.Fatal("selecting an unknown member should fail")
+	}
+
+	// selected配置指定初始成员
+	preset := addTestGroup(t, pm, ProtocolSelect, "preset", startProbeTarget(t), map[string]interface{}{"proxies": "a,b", "selected": "b"})
+	if now := preset.Now(); now != "b" {
+		t.Fatalf("preset now = %s, want b", now)
+	}
+}
+
+func TestGroupURLTest(t *testing.T) {
+	probe := startProbeTarget(t)
+	pm := newGroupTestManager()
+	a, b := startTestProxy(t), startTestProxy(t)
+	addTestMember(t, pm, "a", a)
+	addTestMember(t, pm, "b", b)
+
+	// 不设容差时使用延迟最低的成员
+	a.delay.Store(int64(200 * time.Millisecond))
+	strict := addTestGroup(t, pm, ProtocolURLTest, "strict", probe, map[string]interface{}{"proxies": []interface{}{"a", "b"}})
+	if now := strict.Now(); now != "a" {
+		t.Fatalf("now before check = %s, want first member", now)
+	}
+	strict.HealthCheck(context.Background())
+	if now := strict.Now(); now != "b" {
+		t.Fatalf("now = %s, want the faster member b", now)
+	}
+	if err := strict.Select("a"); err == nil {
+		t.Fatal("url-test group should not support manual selection")
+	}
+
+	// 当前成员比最优成员慢，但在容差内时保持不变
+	a.delay.Store(0)
+	b.down.Store(true)
+	tolerant := addTestGroup(t, pm, ProtocolURLTest, "tolerant", probe, map[string]interface{}{"proxies": []interface{}{"a", "b"}, "tolerance": 1000})
+	tolerant.HealthCheck(context.Background())
+	if now := tolerant.Now(); now != "a" {
+		t.Fatalf("now = %s, want a while b is down", now)
+	}
+
+	b.down.Store(false)
+	a.delay.Store(int64(200 * time.Millisecond))
+	tolerant.HealthCheck(context.Background())
+	if now := tolerant.Now(); now != "a" {
+		t.Fatalf("now = %s, want a within tolerance", now)
+	}
+
+	// 超出容差时切换
+	a.delay.Store(int64(1500 * time.Millisecond))
+	tolerant.HealthCheck(context.Background())
+	if now := tolerant.Now(); now != "b" {
+		t.Fatalf("now = %s, want b beyond tolerance", now)
+	}
+
+	// 当前成员不可用时立即切换
+	b.down.Store(true)
+	a.delay.Store(0)
+	tolerant.HealthCheck(context.Background())
+	if now := tolerant.Now(); now != "a" {
+		t.Fatalf("now = %s, want a after b failed", now)
+	}
+}
+
+func TestGroupFallback(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	pm := newGroupTestManager()
+	a, b := startTestProxy(t), startTestProxy(t)
+	addTestMember(t, pm, "a", a)
+	addTestMember(t, pm, "b", b)
+	group := addTestGroup(t, pm, ProtocolFallback, "fallback", startProbeTarget(t), map[string]interface{}{"proxies": []interface{}{"a", "b"}})
+
+	dialGroup(t, group, target)
+	if got := acceptedCounts(a, b); got[0] != 1 || got[1] != 0 {
+		t.Fatalf("accepted = %v, want only a", got)
+	}
+
+	// 第一个成员不可用时，同一次连接依次尝试下一个成员
+	a.down.Store(true)
+	dialGroup(t, group, target)
+	if got := acceptedCounts(a, b); got[0] != 2 || got[1] != 1 {
+		t.Fatalf("accepted = %v, want a tried before b", got)
+	}
+
+	group.HealthCheck(context.Background())
+	if now := group.Now(); now != "b" {
+		t.Fatalf("now = %s, want b after a failed the health check", now)
+	}
+	info := group.Info()
+	if info.Members[0].Alive || info.Members[0].Error == "" || !info.Members[1].Alive {
+		t.Fatalf("member states = %+v", info.Members)
+	}
+
+	a.down.Store(false)
+	group.HealthCheck(context.Background())
+	if now := group.Now(); now != "a" {
+		t.Fatalf("now = %s, want a after it recovered", now)
+	}
+}
+
+func TestGroupLoadBalance(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	pm := newGroupTestManager()
+	a, b := startTestProxy(t), startTestProxy(t)
+	addTestMember(t, pm, "a", a)
+	addTestMember(t, pm, "b", b)
+
+	roundRobin := addTestGroup(t, pm, ProtocolLoadBalance, "round-robin", startProbeTarget(t), map[string]interface{}{"proxies": []interface{}{"a", "b"}, "strategy": StrategyRoundRobin})
+	for i := 0; i < 4; i++ {
+		dialGroup(t, roundRobin, target)
+	}
+	if got := acceptedCounts(a, b); got[0] != 2 || got[1] != 2 {
+		t.Fatalf("round-robin accepted = %v, want 2 each", got)
+	}
+	if now := roundRobin.Now(); now != "" {
+		t.Fatalf("load-balance now = %q, want empty", now)
+	}
+
+	// 一致性哈希为默认策略，同一主机的连接始终使用同一成员
+	hashing := addTestGroup(t, pm, ProtocolLoadBalance, "hashing", startProbeTarget(t), map[string]interface{}{"proxies": []interface{}{"a", "b"}})
+	if hashing.strategy != StrategyConsistentHashing {
+		t.Fatalf("default strategy = %s", hashing.strategy)
+	}
+	before := acceptedCounts(a, b)
+	for i := 0; i < 4; i++ {
+		dialGroup(t, hashing, target)
+	}
+	after := acceptedCounts(a, b)
+	if da, db := after[0]-before[0], after[1]-before[1]; !(da == 4 && db == 0) && !(da == 0 && db == 4) {
+		t.Fatalf("consistent hashing spread connections to one host: a+%d, b+%d", da, db)
+	}
+
+	if _, err := pm.CreateProtocol(ProtocolLoadBalance, "bad", map[string]interface{}{"name": "bad", "proxies": "a,b", "strategy": "random"}); err == nil {
+		t.Fatal("unknown strategy should fail")
+	}
+}
+
+func TestRendezvousHash(t *testing.T) {
+	members := []string{"a", "b", "c", "d"}
+	used := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("host%d.example.com", i)
+		member := rendezvousHash(members, key)
+		used[member]++
+
+		// 同一主机的不同端口使用同一成员
+		if got := rendezvousHash(members, hashKey(key+":443")); got != member {
+			t.Fatalf("%s:443 -> %s, want %s", key, got, member)
+		}
+
+		// 移除另一个成员不影响已有映射
+		var others []string
+		for _, m := range members {
+			if m != member && len(others) == 0 {
+				continue
+			}
+			others = append(others, m)
+		}
+		if got := rendezvousHash(others, key); got != member {
+			t.Fatalf("%s moved from %s to %s after removing other members", key, member, got)
+		}
+	}
+	for _, member := range members {
+		if used[member] == 0 {
+			t.Fatalf("member %s never selected: %v", member, used)
+		}
+	}
+}
+
+func TestGroupConfigErrors(t *testing.T) {
+	pm := newGroupTestManager()
+	a := startTestProxy(t)
+	addTestMember(t, pm, "a", a)
+	probe := startProbeTarget(t)
+
+	inner := addTestGroup(t, pm, ProtocolSelect, "inner", probe, map[string]interface{}{"proxies": []interface{}{"a"}})
+	addTestGroup(t, pm, ProtocolSelect, "outer", probe, map[string]interface{}{"proxies": []interface{}{"inner"}})
+
+	for _, tc := range []struct {
+		name   string
+		config map[string]interface{}
+		err    string
+	}{
+		{"inner", map[string]interface{}{"proxies": []interface{}{"a", "outer"}}, "group loop detected: inner -> outer -> inner"},
+		{"self", map[string]interface{}{"proxies": []interface{}{"a", "self"}}, "cannot contain itself"},
+		{"duplicate", map[string]interface{}{"proxies": []interface{}{"a", "a"}}, "duplicate member"},
+		{"empty", map[string]interface{}{"proxies": []interface{}{}}, "no members"},
+		{"preset", map[string]interface{}{"proxies": []interface{}{"a"}, "selected": "b"}, "has no member b"},
+	} {
+		config := map[string]interface{}{"name": tc.name, "url": probe, "interval": 0}
+		for k, v := range tc.config {
+			config[k] = v
+		}
+		_, err := pm.CreateProtocol(ProtocolSelect, tc.name, config)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.err)
+		}
+	}
+
+	// 创建失败时保留原来的代理组
+	if pm.GetGroup("inner") != inner {
+		t.Fatal("failed replacement changed the existing group")
+	}
+}
+
+func TestGroupLookup(t *testing.T) {
+	pm := newGroupTestManager()
+	a := startTestProxy(t)
+	addTestMember(t, pm, "a", a)
+	addTestGroup(t, pm, ProtocolSelect, "manual", startProbeTarget(t), map[string]interface{}{"proxies": []interface{}{"a", "missing"}, "tolerance": 50})
+	group := addTestGroup(t, pm, ProtocolURLTest, "auto", startProbeTarget(t), map[string]interface{}{"proxies": []interface{}{"manual", "a"}, "interval": 60, "lazy": false})
+
+	groups := pm.GetGroups()
+	if len(groups) != 2 || groups["manual"] == nil || groups["auto"] != group {
+		t.Fatalf("groups = %v", groups)
+	}
+	if pm.GetGroup("a") != nil || pm.GetGroup("unknown") != nil {
+		t.Fatal("GetGroup returned a non-group protocol")
+	}
+
+	info := group.Info()
+	if info.Name != "auto" || info.Type != ProtocolURLTest || info.HealthCheck.Interval != 60 || info.HealthCheck.Timeout != 2000 || info.HealthCheck.Lazy {
+		t.Fatalf("info = %+v", info)
+	}
+	if len(info.Members) != 2 || info.Members[0].Type != ProtocolSelect || info.Members[1].Type != ProtocolSOCKS5 {
+		t.Fatalf("members = %+v", info.Members)
+	}
+
+	// 成员不存在时连接失败，健康检查将其标记为不可用
+	manual := pm.GetGroup("manual")
+	if err := manual.Select("missing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manual.DialContext(context.Background(), "tcp", "127.0.0.1:1"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("dial through missing member: %v", err)
+	}
+	manual.HealthCheck(context.Background())
+	if info := manual.Info(); info.Members[1].Alive || info.Members[1].Error == "" {
+		t.Fatalf("missing member state = %+v", info.Members[1])
+	}
+
+	pm.RemoveProtocol("auto")
+	if pm.GetGroup("auto") != nil {
+		t.Fatal("group still registered after removal")
+	}
+	if group.IsRunning() {
+		t.Fatal("removed group is still running")
+	}
+}
@@ -0,0 +1,390 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const (
+	// connectionAttemptDelay RFC 8305建议的连接尝试间隔，上一个地址在此时间内未连接成功时开始尝试下一个
+	connectionAttemptDelay = 250 * time.Millisecond
+	// resolutionDelay 非优先地址族先解析完成时等待优先地址族的时间
+	resolutionDelay = 50 * time.Millisecond
+)
+
+// IPStrategy 出站连接的地址族策略
+type IPStrategy string
+
+// 地址族策略
+const (
+	IPStrategyDual       IPStrategy = "dual"        // 双栈，按RFC 8305优先IPv6并行尝试
+	IPStrategyIPv4Only   IPStrategy = "ipv4-only"   // 只使用IPv4
+	IPStrategyIPv6Only   IPStrategy = "ipv6-only"   // 只使用IPv6
+	IPStrategyPreferIPv4 IPStrategy = "prefer-ipv4" // 双栈，优先IPv4并行尝试
+	IPStrategyPreferIPv6 IPStrategy = "prefer-ipv6" // 双栈，优先IPv6并行尝试
+)
+
+// ipStrategyAliases 地址族策略的各种写法，兼容Clash的ip-version和Xray的domainStrategy，不区分大小写
+// DialOptions的enum标签列出了同样的写法
+var ipStrategyAliases = map[string]IPStrategy{
+	"dual":        IPStrategyDual,
+	"asis":        IPStrategyDual,
+	"as-is":       IPStrategyDual,
+	"ipv4-only":   IPStrategyIPv4Only,
+	"ipv4":        IPStrategyIPv4Only,
+	"useipv4":     IPStrategyIPv4Only,
+	"use-ipv4":    IPStrategyIPv4Only,
+	"ipv6-only":   IPStrategyIPv6Only,
+	"ipv6":        IPStrategyIPv6Only,
+	"useipv6":     IPStrategyIPv6Only,
+	"use-ipv6":    IPStrategyIPv6Only,
+	"prefer-ipv4": IPStrategyPreferIPv4,
+	"ipv4-prefer": IPStrategyPreferIPv4,
+	"preferipv4":  IPStrategyPreferIPv4,
+	"prefer-ipv6": IPStrategyPreferIPv6,
+	"ipv6-prefer": IPStrategyPreferIPv6,
+	"preferipv6":  IPStrategyPreferIPv6,
+}
+
+// parseIPStrategy 读取地址族策略，未配置时为双栈
+func parseIPStrategy(config map[string]interface{}) (IPStrategy, error) {
+	var dialOptions DialOptions
+	if err := decodeConfig(config, &dialOptions); err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(dialOptions.IPStrategy)
+	if value == "" {
+		return IPStrategyDual, nil
+	}
+	strategy, ok := ipStrategyAliases[strings.ToLower(value)]
+	if !ok {
+		return "", fmt.Errorf("unsupported ip strategy: %s", value)
+	}
+	return strategy, nil
+}
+
+// families 返回按优先顺序排列的地址族，network为tcp4/tcp6等时只使用对应地址族
+func (s IPStrategy) families(network string) []string {
+	var families []string
+	switch s {
+	case IPStrategyIPv4Only:
+		families = []string{"ip4"}
+	case IPStrategyIPv6Only:
+		families = []string{"ip6"}
+	case IPStrategyPreferIPv4:
+		families = []string{"ip4", "ip6"}
+	default:
+		families = []string{"ip6", "ip4"}
+	}
+	if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+		want := "ip" + network[len(network)-1:]
+		for _, family := range families {
+			if family == want {
+				return []string{want}
+			}
+		}
+		return nil
+	}
+	return families
+}
+
+// hostResolver 按地址族解析域名，与net.Resolver的LookupNetIP相同
+type hostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// directDialer 直接连接的拨号器
+// 域名按地址族策略解析，TCP连接按RFC 8305（Happy Eyeballs v2）交替地址族并行尝试；
+// 同时应用套接字选项。协议连接自己的服务器时也使用它解析服务器域名
+type directDialer struct {
+	options  SocketOptions
+	strategy IPStrategy
+
+	resolver hostResolver                                                         // 为nil时使用net.DefaultResolver
+	dial     func(ctx context.Context, network, address string) (net.Conn, error) // 连接单个地址，为nil时使用net.Dialer，测试中替换
+}
+
+// addrAnswer 一个地址族的解析结果
+type addrAnswer struct {
+	family string
+	addrs  []netip.Addr
+	err    error
+}
+
+// DialContext 建立连接
+func (d *directDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", address, err)
+	}
+	// 连接建立后停止尚未返回的解析
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	addrs, late, pending, err := d.resolve(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+		// UDP连接不需要握手，无法通过竞速判断地址是否可用，直接使用首选地址
+		return d.dialAddr(ctx, network, addrs[0], port)
+	default:
+		return d.race(ctx, network, addrs, late, pending, port)
+	}
+}
+
+// ListenPacket 创建应用套接字选项的本地UDP套接字
+func (d *directDialer) ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	if address == "" && d.options.SourceAddr != nil {
+		address = net.JoinHostPort(d.options.SourceAddr.String(), "0")
+	}
+	lc := &net.ListenConfig{Control: d.options.control}
+	return lc.ListenPacket(ctx, network, address)
+}
+
+// lookup 按策略解析主机名，返回交替排列的地址，首个地址属于优先地址族
+// 用于不竞速的场景，超过resolutionDelay仍未返回的地址族被忽略
+func (d *directDialer) lookup(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	addrs, _, _, err := d.resolve(ctx, network, host)
+	return addrs, err
+}
+
+// resolve 各地址族并发查询，某个地址族返回地址后最多再等待resolutionDelay，使其他地址族也能参与竞速
+// 返回已得到的交替排列的地址，以及等待结束时仍未返回的地址族数量和它们的结果通道，
+// 之后返回的地址由race合并到正在进行的竞速中。查询在ctx取消后停止
+func (d *directDialer) resolve(ctx context.Context, network, host string) ([]netip.Addr, <-chan addrAnswer, int, error) {
+	families := d.strategy.families(network)
+	// 配置了源地址时只能连接同一地址族
+	if source, ok := netip.AddrFromSlice(d.options.SourceAddr); ok {
+		family := addrFamily(source)
+		var filtered []string
+		for _, f := range families {
+			if f == family {
+				filtered = append(filtered, f)
+			}
+		}
+		families = filtered
+	}
+	if len(families) == 0 {
+		return nil, nil, 0, fmt.Errorf("no address family available for %s with ip strategy %s", host, d.strategy)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.Unmap()
+		for _, family := range families {
+			if addrFamily(addr) == family {
+				return []netip.Addr{addr}, nil, 0, nil
+			}
+		}
+		return nil, nil, 0, fmt.Errorf("address %s is not allowed by ip strategy %s", host, d.strategy)
+	}
+
+	var resolver hostResolver = net.DefaultResolver
+	if d.resolver != nil {
+		resolver = d.resolver
+	}
+	// 通道有足够的缓冲，调用方不再读取时查询也不会阻塞
+	answers := make(chan addrAnswer, len(families))
+	for _, family := range families {
+		go func(family string) {
+			addrs, err := resolver.LookupNetIP(ctx, family, host)
+			answers <- answer(family, addrs, err)
+		}(family)
+	}
+
+	results := make(map[string][]netip.Addr)
+	var firstErr error
+	var delay <-chan time.Time
+	received := 0
+wait:
+	for received < len(families) {
+		select {
+		case a := <-answers:
+			received++
+			if a.err != nil && firstErr == nil {
+				firstErr = a.err
+			}
+			results[a.family] = a.addrs
+			if delay == nil && len(a.addrs) > 0 {
+				timer := time.NewTimer(resolutionDelay)
+				defer timer.Stop()
+				delay = timer.C
+			}
+		case <-delay:
+			break wait
+		case <-ctx.Done():
+			return nil, nil, 0, ctx.Err()
+		}
+	}
+
+	// 交替排列地址族: 优先1, 其他1, 优先2, 其他2...
+	lists := make([][]netip.Addr, 0, len(families))
+	for _, family := range families {
+		lists = append(lists, results[family])
+	}
+	addrs := interleave(lists...)
+	if len(addrs) == 0 {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("no suitable address")
+		}
+		return nil, nil, 0, fmt.Errorf("failed to resolve %s: %v", host, firstErr)
+	}
+	return addrs, answers, len(families) - received, nil
+}
+
+// answer 创建解析结果，地址统一去掉IPv4映射
+func answer(family string, addrs []netip.Addr, err error) addrAnswer {
+	unmapped := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		unmapped = append(unmapped, addr.Unmap())
+	}
+	return addrAnswer{family: family, addrs: unmapped, err: err}
+}
+
+// interleave 从各列表轮流取出地址合并为一个列表
+func interleave(lists ...[]netip.Addr) []netip.Addr {
+	var addrs []netip.Addr
+	for i := 0; ; i++ {
+		added := false
+		for _, list := range lists {
+			if i < len(list) {
+				addrs = append(addrs, list[i])
+				added = true
+			}
+		}
+		if !added {
+			return addrs
+		}
+	}
+}
+
+// mergeAddrs 将晚到的地址族合并到尚未尝试的地址中，已尝试的地址保持不变
+// 合并后的下一个地址与最近一次尝试的地址属于不同的地址族
+func mergeAddrs(addrs []netip.Addr, next int, late []netip.Addr) []netip.Addr {
+	rest := append([]netip.Addr(nil), addrs[next:]...)
+	merged := addrs[:next:next]
+	if next > 0 && addrFamily(addrs[next-1]) == addrFamily(late[0]) {
+		return append(merged, interleave(rest, late)...)
+	}
+	return append(merged, interleave(late, rest)...)
+}
+
+// race 按顺序启动连接尝试，上一个尝试失败或超过connectionAttemptDelay后开始下一个，返回最先成功的连接
+// pending个地址族仍在解析，它们的地址从late中读取并加入竞速；地址都失败时等待这些地址族返回
+func (d *directDialer) race(ctx context.Context, network string, addrs []netip.Addr, late <-chan addrAnswer, pending int, port string) (net.Conn, error) {
+	if len(addrs) == 1 && pending == 0 {
+		return d.dialAddr(ctx, network, addrs[0], port)
+	}
+	if pending == 0 {
+		late = nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result)
+	next, attempts := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		attempts++
+		go func() {
+			conn, err := d.dialAddr(ctx, network, addr, port)
+			select {
+			case results <- result{conn: conn, err: err}:
+			case <-ctx.Done():
+				// 其他尝试已经成功
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(connectionAttemptDelay)
+	defer timer.Stop()
+	// 等待间隔已过但没有地址可以尝试，新地址到达后立即尝试
+	idle := false
+	var firstErr error
+	for {
+		select {
+		case r := <-results:
+			attempts--
+			if r.err == nil {
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(addrs) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			} else if attempts == 0 && pending == 0 {
+				return nil, firstErr
+			}
+		case a := <-late:
+			pending--
+			if pending == 0 {
+				late = nil
+			}
+			if len(a.addrs) > 0 {
+				addrs = mergeAddrs(addrs, next, a.addrs)
+				if attempts == 0 || idle {
+					idle = false
+					start()
+					timer.Reset(connectionAttemptDelay)
+				}
+			} else if attempts == 0 && pending == 0 && next == len(addrs) {
+				return nil, firstErr
+			}
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(connectionAttemptDelay)
+			} else {
+				idle = true
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dialAddr 连接指定地址
+func (d *directDialer) dialAddr(ctx context.Context, network string, addr netip.Addr, port string) (net.Conn, error) {
+	network = strings.TrimRight(network, "46")
+	if addr.Is4() {
+		network += "4"
+	} else {
+		network += "6"
+	}
+	address := net.JoinHostPort(addr.String(), port)
+	if d.dial != nil {
+		return d.dial(ctx, network, address)
+	}
+	dialer := &net.Dialer{
+		LocalAddr: d.options.localAddr(network),
+		Control:   d.options.control,
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// addrFamily 返回地址所属的地址族
+func addrFamily(addr netip.Addr) string {
+	if addr.Unmap().Is4() {
+		return "ip4"
+	}
+	return "ip6"
+}
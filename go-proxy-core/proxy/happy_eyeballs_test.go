@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+func TestParseIPStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		config map[string]interface{}
+		want   IPStrategy
+	}{
+		{map[string]interface{}{}, IPStrategyDual},
+		{map[string]interface{}{"ip-version": "dual"}, IPStrategyDual},
+		{map[string]interface{}{"domain_strategy": "AsIs"}, IPStrategyDual},
+		{map[string]interface{}{"ip-version": "ipv4"}, IPStrategyIPv4Only},
+		{map[string]interface{}{"domainStrategy": "UseIPv4"}, IPStrategyIPv4Only},
+		{map[string]interface{}{"ip_version": "ipv6-only"}, IPStrategyIPv6Only},
+		{map[string]interface{}{"ip-strategy": "use-ipv6"}, IPStrategyIPv6Only},
+		{map[string]interface{}{"ip-version": "ipv4-prefer"}, IPStrategyPreferIPv4},
+		{map[string]interface{}{"ip_strategy": "PreferIPv4"}, IPStrategyPreferIPv4},
+		{map[string]interface{}{"ip-version": "prefer-ipv6"}, IPStrategyPreferIPv6},
+	} {
+		got, err := parseIPStrategy(tc.config)
+		if err != nil {
+			t.Fatalf("parseIPStrategy(%v): %v", tc.config, err)
+		}
+		if got != tc.want {
+			t.Fatalf("parseIPStrategy(%v) = %s, want %s", tc.config, got, tc.want)
+		}
+	}
+
+	for _, config := range []map[string]interface{}{
+		{"ip-version": "ipv5"},
+		{"domain_strategy": "UseIP"},
+	} {
+		if got, err := parseIPStrategy(config); err == nil {
+			t.Fatalf("parseIPStrategy(%v) = %s, expected error", config, got)
+		}
+	}
+}
+
+func TestIPStrategyEnum(t *testing.T) {
+	// Schema的enum与解析器接受的写法一致
+	field, _ := reflect.TypeOf(DialOptions{}).FieldByName("IPStrategy")
+	enum := strings.Split(field.Tag.Get("enum"), ",")
+	listed := make(map[string]bool)
+	for _, value := range enum {
+		if _, err := parseIPStrategy(map[string]interface{}{"ip-version": value}); err != nil {
+			t.Errorf("enum value %s: %v", value, err)
+		}
+		listed[strings.ToLower(value)] = true
+	}
+	for alias := range ipStrategyAliases {
+		if !listed[alias] {
+			t.Errorf("alias %s is missing from the schema enum", alias)
+		}
+	}
+}
+
+func TestIPStrategyFamilies(t *testing.T) {
+	for _, tc := range []struct {
+		strategy IPStrategy
+		network  string
+		want     []string
+	}{
+		{IPStrategyDual, "tcp", []string{"ip6", "ip4"}},
+		{IPStrategyPreferIPv6, "tcp", []string{"ip6", "ip4"}},
+		{IPStrategyPreferIPv4, "udp", []string{"ip4", "ip6"}},
+		{IPStrategyIPv4Only, "tcp", []string{"ip4"}},
+		{IPStrategyDual, "tcp4", []string{"ip4"}},
+		{IPStrategyIPv4Only, "tcp6", nil},
+	} {
+		if got := tc.strategy.families(tc.network); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s.families(%s) = %v, want %v", tc.strategy, tc.network, got, tc.want)
+		}
+	}
+}
+
+// fakeAnswer 测试解析器对一个地址族的应答
+type fakeAnswer struct {
+	delay time.Duration
+	addrs []string
+}
+
+// fakeResolver 按地址族在指定延迟后返回固定地址，没有配置的地址族返回错误
+type fakeResolver map[string]fakeAnswer
+
+func (r fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	a, ok := r[network]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	select {
+	case <-time.After(a.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var addrs []netip.Addr
+	for _, s := range a.addrs {
+		addrs = append(addrs, netip.MustParseAddr(s))
+	}
+	return addrs, nil
+}
+
+// deadAddr 测试中不可达的IPv6地址，连接一直挂起或立即被拒绝
+const deadAddr = "2001:db8::1"
+
+// raceDialer 返回使用fakeResolver的拨号器
+// 连接deadAddr时挂起直到取消（refused为真时立即失败），其他地址连接到本机的target端口，记录尝试的地址
+func raceDialer(resolver fakeResolver, target string, refused bool) (*directDialer, func() []string) {
+	var mu sync.Mutex
+	var attempts []string
+	d := &directDialer{strategy: IPStrategyDual, resolver: resolver}
+	d.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(address)
+		mu.Lock()
+		attempts = append(attempts, host)
+		mu.Unlock()
+		if host == deadAddr {
+			if refused {
+				return nil, errors.New("connection refused")
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", target)
+	}
+	return d, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), attempts...)
+	}
+}
+
+func TestDirectDialerFallback(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	_, port, _ := net.SplitHostPort(target)
+
+	for _, tc := range []struct {
+		name     string
+		resolver fakeResolver
+		refused  bool
+		// 连接成功的时间范围
+		min, max time.Duration
+	}{
+		{
+			// IPv6先返回，IPv4在resolutionDelay内返回，一起参与竞速，IPv6挂起时经过一个尝试间隔切换到IPv4
+			name: "ipv4 within resolution delay",
+			resolver: fakeResolver{
+				"ip6": {addrs: []string{deadAddr}},
+				"ip4": {delay: 20 * time.Millisecond, addrs: []string{"127.0.0.1"}},
+			},
+			min: connectionAttemptDelay,
+			max: connectionAttemptDelay + 150*time.Millisecond,
+		},
+		{
+			// IPv4在竞速开始后才返回，合并到竞速中，在IPv6尝试间隔结束时开始尝试
+			name: "late ipv4 merged into race",
+			resolver: fakeResolver{
+				"ip6": {addrs: []string{deadAddr}},
+				"ip4": {delay: 150 * time.Millisecond, addrs: []string{"127.0.0.1"}},
+			},
+			min: resolutionDelay + connectionAttemptDelay,
+			max: resolutionDelay + connectionAttemptDelay + 150*time.Millisecond,
+		},
+		{
+			// IPv6立即失败时不等待尝试间隔，IPv4返回后立即尝试
+			name: "late ipv4 after ipv6 refused",
+			resolver: fakeResolver{
+				"ip6": {addrs: []string{deadAddr}},
+				"ip4": {delay: 150 * time.Millisecond, addrs: []string{"127.0.0.1"}},
+			},
+			refused: true,
+			min:     150 * time.Millisecond,
+			max:     connectionAttemptDelay,
+		},
+		{
+			name: "ipv6 not resolved",
+			resolver: fakeResolver{
+				"ip4": {delay: 20 * time.Millisecond, addrs: []string{"127.0.0.1"}},
+			},
+			max: connectionAttemptDelay,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, attempts := raceDialer(tc.resolver, target, tc.refused)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort("example.com", port))
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatalf("dial: %v (attempts %v)", err, attempts())
+			}
+			defer conn.Close()
+			testutil.Echo(t, conn, []byte("happy eyeballs"))
+			if elapsed < tc.min || elapsed > tc.max {
+				t.Fatalf("connected after %v, want between %v and %v", elapsed, tc.min, tc.max)
+			}
+			if got := attempts(); got[len(got)-1] != "127.0.0.1" {
+				t.Fatalf("attempts = %v", got)
+			}
+		})
+	}
+}
+
+func TestDirectDialerAllFailed(t *testing.T) {
+	d, attempts := raceDialer(fakeResolver{
+		"ip6": {addrs: []string{deadAddr}},
+		"ip4": {delay: 100 * time.Millisecond, addrs: []string{"127.0.0.1"}},
+	}, "127.0.0.1:1", true)
+	d.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := d.DialContext(ctx, "tcp", "example.com:80"); err == nil || ctx.Err() != nil {
+		t.Fatalf("dial error = %v, attempts %v", err, attempts())
+	}
+
+	// 所有地址族都解析失败
+	d, _ = raceDialer(fakeResolver{}, "127.0.0.1:1", true)
+	if _, err := d.DialContext(ctx, "tcp", "example.com:80"); err == nil {
+		t.Fatal("expected resolve error")
+	}
+}
+
+func TestDirectDialerLookup(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		strategy IPStrategy
+		resolver fakeResolver
+		want     []string
+	}{
+		{
+			name:     "interleaved",
+			strategy: IPStrategyDual,
+			resolver: fakeResolver{
+				"ip6": {addrs: []string{"2001:db8::1", "2001:db8::2"}},
+				"ip4": {delay: 10 * time.Millisecond, addrs: []string{"192.0.2.1", "192.0.2.2", "::ffff:192.0.2.3"}},
+			},
+			want: []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "192.0.2.3"},
+		},
+		{
+			// 非优先地址族先返回时，优先地址族仍排在前面
+			name:     "preferred family answers later",
+			strategy: IPStrategyDual,
+			resolver: fakeResolver{
+				"ip6": {delay: 20 * time.Millisecond, addrs: []string{"2001:db8::1"}},
+				"ip4": {addrs: []string{"192.0.2.1"}},
+			},
+			want: []string{"2001:db8::1", "192.0.2.1"},
+		},
+		{
+			// 超过resolutionDelay才返回的地址族被忽略
+			name:     "slow family ignored",
+			strategy: IPStrategyPreferIPv4,
+			resolver: fakeResolver{
+				"ip6": {delay: 500 * time.Millisecond, addrs: []string{"2001:db8::1"}},
+				"ip4": {addrs: []string{"192.0.2.1"}},
+			},
+			want: []string{"192.0.2.1"},
+		},
+		{
+			name:     "ipv6 only",
+			strategy: IPStrategyIPv6Only,
+			resolver: fakeResolver{
+				"ip6": {addrs: []string{"2001:db8::1"}},
+				"ip4": {addrs: []string{"192.0.2.1"}},
+			},
+			want: []string{"2001:db8::1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &directDialer{strategy: tc.strategy, resolver: tc.resolver}
+			addrs, err := d.lookup(context.Background(), "tcp", "example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("lookup = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// 源地址限制地址族，IP地址不经过解析
+	d := &directDialer{strategy: IPStrategyDual, options: SocketOptions{SourceAddr: net.ParseIP("127.0.0.1")}}
+	if _, err := d.lookup(context.Background(), "tcp", "::1"); err == nil {
+		t.Fatal("expected error for ipv6 address with ipv4 source")
+	}
+	if addrs, err := d.lookup(context.Background(), "tcp", "127.0.0.1"); err != nil || len(addrs) != 1 {
+		t.Fatalf("lookup = %v, %v", addrs, err)
+	}
+}
@@ -209,8 +209,8 @@ func (hs *HTTPServer) handleConnection(clientConn net.Conn) {
 func (hs *HTTPServer) handleProxyConnection(clientConn net.Conn, req *http.Request, targetAddr string, proxySource string) {
 	log.Printf("HTTP服务器通过代理源 %s 连接到目标 %s", proxySource, targetAddr)
 
-	// 使用协议管理器通过指定代理连接
-	conn, err := hs.protocolManager.Connect(proxySource, targetAddr)
+	// 使用协议管理器通过指定代理连接，规则指定了多个目标时依次尝试
+	conn, target, err := hs.proxyCore.dialRuleTargets(hs.protocolManager, proxySource, "tcp", targetAddr)
 	if err != nil {
 		log.Printf("Proxy connection to %s via %s failed: %v", targetAddr, proxySource, err)
 		// 发送错误响应
@@ -218,6 +218,8 @@ func (hs *HTTPServer) handleProxyConnection(clientConn net.Conn, req *http.Reque
 		return
 	}
 	defer conn.Close()
+	// 流量计入实际使用的目标
+	statsSource := statsSourceName(target)
 
 	if req.Method == "CONNECT" {
 		// 对于HTTPS CONNECT请求，发送连接成功的响应
@@ -225,7 +227,7 @@ func (hs *HTTPServer) handleProxyConnection(clientConn net.Conn, req *http.Reque
 		clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
 
 		// 创建按代理源维度的统计收集器
-		proxySourceStatsCollector := hs.proxyCore.CreateOrGetProxySourceStatsCollector(proxySource)
+		proxySourceStatsCollector := hs.proxyCore.CreateOrGetProxySourceStatsCollector(statsSource)
 
 		// 创建自定义的流量统计连接，正确区分上传和下载
 		// 客户端连接：isClientSide=true
@@ -258,7 +260,7 @@ func (hs *HTTPServer) handleProxyConnection(clientConn net.Conn, req *http.Reque
 	} else {
 		// 对于普通HTTP请求，转发请求到目标服务器
 		// 创建按代理源维度的统计收集器
-		proxySourceStatsCollector := hs.proxyCore.CreateOrGetProxySourceStatsCollector(proxySource)
+		proxySourceStatsCollector := hs.proxyCore.CreateOrGetProxySourceStatsCollector(statsSource)
 
 		// 创建自定义的流量统计连接，正确区分上传和下载
 		// 客户端连接：isClientSide=true
@@ -333,7 +335,9 @@ func (hs *HTTPServer) handleDirectConnection(clientConn net.Conn, req *http.Requ
 	log.Printf("HTTP服务器直接连接到目标 %s", targetAddr)
 
 	// 使用协议管理器进行直连
-	conn, err := hs.protocolManager.Connect("direct", targetAddr)
+	ctx, cancel := hs.proxyCore.connectContext()
+	conn, err := hs.protocolManager.DialContext(ctx, "direct", "tcp", targetAddr)
+	cancel()
 	if err != nil {
 		log.Printf("Error connecting to target: %v", err)
 		// 发送错误响应
@@ -1,13 +1,15 @@
 package proxy
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
-	"net/url"
-	"time"
+	"strconv"
+
+	"github.com/dualvpn/go-proxy-core/httpproxy"
+	"github.com/dualvpn/go-proxy-core/tlsclient"
 )
 
 // HTTPProtocol HTTP协议实现
@@ -15,91 +17,137 @@ type HTTPProtocol struct {
 	BaseProtocol
 	server string
 	port   int
+	client *httpproxy.Client
 }
 
 // HTTPProtocolFactory HTTP协议工厂
-type HTTPProtocolFactory struct{}
+// TLS为true时创建https代理，即使用TLS连接代理服务器本身
+type HTTPProtocolFactory struct {
+	TLS bool
+}
+
+// Capabilities 返回HTTP协议支持的能力
+func (f *HTTPProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true}
+}
+
+// HTTPConfig HTTP/HTTPS协议配置
+type HTTPConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username    string            `config:"username" desc:"用户名"`
+	Password    string            `config:"password" desc:"密码"`
+	AuthScheme  string            `config:"auth_scheme" enum:"basic,ntlm,negotiate" desc:"认证方式，默认basic"`
+	Domain      string            `config:"domain" desc:"NTLM域"`
+	Workstation string            `config:"workstation" desc:"NTLM工作站名称"`
+	Krb5Conf    string            `config:"krb5_conf" desc:"Kerberos配置文件路径"`
+	Realm       string            `config:"realm" desc:"Kerberos realm"`
+	Keytab      string            `config:"keytab" desc:"Kerberos keytab文件路径"`
+	CCache      string            `config:"ccache" desc:"Kerberos凭据缓存路径"`
+	SPN         string            `config:"spn" desc:"Kerberos服务主体名称"`
+	Headers     map[string]string `config:"headers" desc:"CONNECT请求附加的请求头"`
+	TLS         *bool             `config:"tls" desc:"使用TLS连接代理服务器（https代理）"`
+	TLSOptions
+}
+
+// Config 返回HTTP协议的配置结构
+func (f *HTTPProtocolFactory) Config() interface{} {
+	return &HTTPConfig{}
+}
 
 // CreateProtocol 创建HTTP协议实例
 func (f *HTTPProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg HTTPConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
+	// 自定义请求头
+	headers := make(http.Header)
+	for key, value := range cfg.Headers {
+		headers.Set(key, value)
 	}
 
-	name, _ := config["name"].(string)
+	protocolType := ProtocolHTTP
+	useTLS := f.TLS
+	if cfg.TLS != nil {
+		useTLS = *cfg.TLS
+	}
+
+	var tlsConfig *tlsclient.Config
+	if useTLS {
+		protocolType = ProtocolHTTPS
+		var err error
+		tlsConfig, err = parseTLSConfig(cfg.TLSOptions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := cfg.Name
 	if name == "" {
-		name = fmt.Sprintf("http-%s:%d", server, port)
+		name = fmt.Sprintf("%s-%s:%d", protocolType, server, port)
 	}
 
 	protocol := &HTTPProtocol{
 		BaseProtocol: BaseProtocol{
 			name:         name,
-			protocolType: ProtocolHTTP,
+			protocolType: protocolType,
 		},
 		server: server,
 		port:   port,
 	}
 
+	client, err := httpproxy.NewClient(httpproxy.ClientConfig{
+		Server:      net.JoinHostPort(server, strconv.Itoa(port)),
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		AuthScheme:  cfg.AuthScheme,
+		Domain:      cfg.Domain,
+		Workstation: cfg.Workstation,
+		Kerberos: httpproxy.KerberosConfig{
+			Krb5Conf: cfg.Krb5Conf,
+			Realm:    cfg.Realm,
+			Keytab:   cfg.Keytab,
+			CCache:   cfg.CCache,
+			SPN:      cfg.SPN,
+		},
+		Headers:     headers,
+		TLS:         tlsConfig,
+		DialContext: protocol.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol.client = client
+
 	// 添加日志以调试HTTP协议创建
-	log.Printf("创建HTTP协议: server=%s, port=%d", server, port)
+	log.Printf("创建HTTP协议: server=%s, port=%d, tls=%t, auth=%s", server, port, useTLS, cfg.AuthScheme)
 
 	return protocol, nil
 }
 
 // Connect 连接到目标地址（通过HTTP代理）
 func (hp *HTTPProtocol) Connect(targetAddr string) (net.Conn, error) {
-	// 添加详细的连接日志
-	log.Printf("HTTP协议开始连接: targetAddr=%s, server=%s, port=%d",
-		targetAddr, hp.server, hp.port)
-
-	// 连接到HTTP代理服务器
-	proxyAddr := fmt.Sprintf("%s:%d", hp.server, hp.port)
-	log.Printf("连接到HTTP代理服务器地址: %s", proxyAddr)
+	return connectTimeout(hp, targetAddr)
+}
 
-	conn, err := net.DialTimeout("tcp", proxyAddr, 5*time.Second)
-	if err != nil {
-		log.Printf("连接HTTP代理服务器失败: %v", err)
-		return nil, fmt.Errorf("failed to connect to HTTP proxy server %s: %v", proxyAddr, err)
+// DialContext 通过HTTP代理的CONNECT方法连接到目标地址，仅支持TCP
+func (hp *HTTPProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("%w: network %s", ErrUDPNotSupported, network)
 	}
 
-	// 发送CONNECT请求
-	connectReq := &http.Request{
-		Method: "CONNECT",
-		URL:    &url.URL{Opaque: targetAddr},
-		Host:   targetAddr,
-		Header: make(http.Header),
-	}
-	connectReq.Header.Set("User-Agent", "DualVPN-Proxy/1.0")
-
-	// 发送请求
-	log.Printf("发送CONNECT请求到HTTP代理服务器")
-	if err := connectReq.Write(conn); err != nil {
-		conn.Close()
-		log.Printf("发送CONNECT请求失败: %v", err)
-		return nil, fmt.Errorf("failed to send CONNECT request: %v", err)
-	}
+	// 添加详细的连接日志
+	log.Printf("HTTP协议开始连接: targetAddr=%s, server=%s, port=%d",
+		targetAddr, hp.server, hp.port)
 
-	// 读取响应
-	log.Printf("读取HTTP代理服务器响应")
-	resp, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	conn, err := hp.client.DialContext(ctx, targetAddr)
 	if err != nil {
-		conn.Close()
-		log.Printf("读取HTTP代理服务器响应失败: %v", err)
-		return nil, fmt.Errorf("failed to read CONNECT response: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 检查响应状态
-	if resp.StatusCode != http.StatusOK {
-		conn.Close()
-		log.Printf("HTTP代理服务器CONNECT请求失败，状态码: %d", resp.StatusCode)
-		return nil, fmt.Errorf("CONNECT request failed with status %d", resp.StatusCode)
+		log.Printf("通过HTTP代理连接目标失败: %v", err)
+		return nil, err
 	}
 
 	// 添加日志以调试HTTP连接过程
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dualvpn/go-proxy-core/hysteria2"
+)
+
+// Hysteria2Protocol Hysteria2协议实现
+type Hysteria2Protocol struct {
+	BaseProtocol
+	server string
+	port   int
+	obfs   string // 混淆类型: salamander
+	client *hysteria2.Client
+}
+
+// Hysteria2ProtocolFactory Hysteria2协议工厂
+type Hysteria2ProtocolFactory struct{}
+
+// Capabilities 返回Hysteria2协议支持的能力
+func (f *Hysteria2ProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true}
+}
+
+// Hysteria2Config Hysteria2协议配置，兼容auth和Clash的obfs-password字段
+type Hysteria2Config struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Password     string `config:"password,auth" desc:"认证密码"`
+	Obfs         string `config:"obfs" enum:"salamander" desc:"混淆方式"`
+	ObfsPassword string `config:"obfs-password,obfs_password" desc:"混淆密码"`
+	Up           string `config:"up" desc:"上行带宽，单位Mbps，也可以写成100 Mbps"`
+	Down         string `config:"down" desc:"下行带宽，单位Mbps，也可以写成100 Mbps"`
+	TLSOptions
+}
+
+// Config 返回Hysteria2协议的配置结构
+func (f *Hysteria2ProtocolFactory) Config() interface{} {
+	return &Hysteria2Config{}
+}
+
+// CreateProtocol 创建Hysteria2协议实例
+func (f *Hysteria2ProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
+	var cfg Hysteria2Config
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	server, port, obfs := cfg.Server, cfg.Port, cfg.Obfs
+
+	// 带宽提示，单位Mbps，支持"100 Mbps"形式
+	up, err := parseBandwidthMbps(cfg.Up)
+	if err != nil {
+		return nil, err
+	}
+	down, err := parseBandwidthMbps(cfg.Down)
+	if err != nil {
+		return nil, err
+	}
+
+	// TLS配置，QUIC不支持uTLS指纹和REALITY
+	tlsConfig, err := parseQUICTLSConfig(cfg.TLSOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("hysteria2-%s:%d", server, port)
+	}
+
+	protocol := &Hysteria2Protocol{
+		BaseProtocol: BaseProtocol{
+			name:         name,
+			protocolType: ProtocolHysteria2,
+		},
+		server: server,
+		port:   port,
+		obfs:   obfs,
+	}
+
+	client, err := hysteria2.NewClient(hysteria2.ClientConfig{
+		Server:      net.JoinHostPort(server, strconv.Itoa(port)),
+		Auth:        cfg.Password,
+		TLS:         tlsConfig,
+		Obfs:        obfs,
+		ObfsPass:    cfg.ObfsPassword,
+		UpMbps:      up,
+		DownMbps:    down,
+		Timeout:     DefaultConnectTimeout,
+		DialContext: protocol.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol.client = client
+
+	// 添加日志以调试Hysteria2协议创建
+	log.Printf("创建Hysteria2协议: server=%s, port=%d, obfs=%s, up=%dMbps, down=%dMbps", server, port, obfs, up, down)
+
+	return protocol, nil
+}
+
+// parseBandwidthMbps 解析带宽配置，数字按Mbps处理，字符串支持Kbps/Mbps/Gbps单位
+func parseBandwidthMbps(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	case string:
+		s := strings.ToLower(strings.TrimSpace(v))
+		if s == "" {
+			return 0, nil
+		}
+		unit := 1.0
+		for suffix, scale := range map[string]float64{"kbps": 0.001, "mbps": 1, "gbps": 1000} {
+			if strings.HasSuffix(s, suffix) {
+				s = strings.TrimSpace(strings.TrimSuffix(s, suffix))
+				unit = scale
+				break
+			}
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid bandwidth: %s", v)
+		}
+		return int(value * unit), nil
+	default:
+		return 0, fmt.Errorf("invalid bandwidth: %v", v)
+	}
+}
+
+// Connect 连接到目标地址（通过Hysteria2）
+func (hp *Hysteria2Protocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(hp, targetAddr)
+}
+
+// DialContext 连接到目标地址，tcp使用QUIC流，udp使用QUIC datagram
+func (hp *Hysteria2Protocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return dialPacketConn(ctx, hp, targetAddr)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	log.Printf("Hysteria2协议开始连接: targetAddr=%s, server=%s, port=%d", targetAddr, hp.server, hp.port)
+
+	conn, err := hp.client.DialContext(ctx, targetAddr)
+	if err != nil {
+		log.Printf("通过Hysteria2服务器连接目标失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("Hysteria2协议成功连接到目标: %s 通过服务器: %s:%d", targetAddr, hp.server, hp.port)
+	return conn, nil
+}
+
+// ListenPacket 建立UDP会话
+func (hp *Hysteria2Protocol) ListenPacket(ctx context.Context, targetAddr string) (net.PacketConn, error) {
+	log.Printf("Hysteria2协议建立UDP转发: server=%s, port=%d", hp.server, hp.port)
+	return hp.client.ListenPacket(ctx)
+}
+
+// SupportsUDP Hysteria2通过QUIC datagram支持UDP，服务端禁用时在建立会话时返回错误
+func (hp *Hysteria2Protocol) SupportsUDP() bool {
+	return true
+}
+
+// Close 关闭连接
+func (hp *Hysteria2Protocol) Close() error {
+	return hp.client.Close()
+}
+
+// IsRunning 检查协议是否正在运行
+func (hp *Hysteria2Protocol) IsRunning() bool {
+	return true
+}
@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -19,23 +21,34 @@ type IKEv2Protocol struct {
 // IKEv2ProtocolFactory IKEv2协议工厂
 type IKEv2ProtocolFactory struct{}
 
+// Capabilities IKEv2协议尚未实现握手，不能创建
+func (f *IKEv2ProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// IKEv2Config IKEv2协议配置
+type IKEv2Config struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username string `config:"username" desc:"用户名"`
+	Password string `config:"password" desc:"密码"`
+	PSK      string `config:"psk" desc:"预共享密钥"`
+}
+
+// Config 返回IKEv2协议的配置结构
+func (f *IKEv2ProtocolFactory) Config() interface{} {
+	return &IKEv2Config{}
+}
+
 // CreateProtocol 创建IKEv2协议实例
 func (f *IKEv2ProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg IKEv2Config
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	username, _ := config["username"].(string)
-	password, _ := config["password"].(string)
-	psk, _ := config["psk"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("ikev2-%s:%d", server, port)
 	}
@@ -47,20 +60,25 @@ func (f *IKEv2ProtocolFactory) CreateProtocol(config map[string]interface{}) (Pr
 		},
 		server:   server,
 		port:     port,
-		username: username,
-		password: password,
-		psk:      psk,
+		username: cfg.Username,
+		password: cfg.Password,
+		psk:      cfg.PSK,
 	}
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (ip *IKEv2Protocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, ip.Connect)
+}
+
 // Connect 连接到目标地址（通过IKEv2）
 func (ip *IKEv2Protocol) Connect(targetAddr string) (net.Conn, error) {
 	// 连接到IKEv2服务器
 	// 注意：这是一个简化的实现，实际的IKEv2连接需要更复杂的IKE协商过程
-	ikev2Addr := fmt.Sprintf("%s:%d", ip.server, ip.port)
-	conn, err := net.DialTimeout("udp", ikev2Addr, 10*time.Second)
+	ikev2Addr := net.JoinHostPort(ip.server, strconv.Itoa(ip.port))
+	conn, err := ip.dialTimeout("udp", ikev2Addr, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to IKEv2 server %s: %v", ikev2Addr, err)
 	}
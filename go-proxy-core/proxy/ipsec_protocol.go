@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -19,23 +21,34 @@ type IPsecProtocol struct {
 // IPsecProtocolFactory IPsec协议工厂
 type IPsecProtocolFactory struct{}
 
+// Capabilities IPsec协议尚未实现握手，不能创建
+func (f *IPsecProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// IPsecConfig IPsec协议配置
+type IPsecConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username string `config:"username" desc:"用户名"`
+	Password string `config:"password" desc:"密码"`
+	PSK      string `config:"psk" desc:"预共享密钥"`
+}
+
+// Config 返回IPsec协议的配置结构
+func (f *IPsecProtocolFactory) Config() interface{} {
+	return &IPsecConfig{}
+}
+
 // CreateProtocol 创建IPsec协议实例
 func (f *IPsecProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg IPsecConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	username, _ := config["username"].(string)
-	password, _ := config["password"].(string)
-	psk, _ := config["psk"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("ipsec-%s:%d", server, port)
 	}
@@ -47,20 +60,25 @@ func (f *IPsecProtocolFactory) CreateProtocol(config map[string]interface{}) (Pr
 		},
 		server:   server,
 		port:     port,
-		username: username,
-		password: password,
-		psk:      psk,
+		username: cfg.Username,
+		password: cfg.Password,
+		psk:      cfg.PSK,
 	}
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (ip *IPsecProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, ip.Connect)
+}
+
 // Connect 连接到目标地址（通过IPsec）
 func (ip *IPsecProtocol) Connect(targetAddr string) (net.Conn, error) {
 	// 连接到IPsec服务器
 	// 注意：这是一个简化的实现，实际的IPsec连接需要更复杂的IKE协商过程
-	ipsecAddr := fmt.Sprintf("%s:%d", ip.server, ip.port)
-	conn, err := net.DialTimeout("udp", ipsecAddr, 10*time.Second)
+	ipsecAddr := net.JoinHostPort(ip.server, strconv.Itoa(ip.port))
+	conn, err := ip.dialTimeout("udp", ipsecAddr, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to IPsec server %s: %v", ipsecAddr, err)
 	}
@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -19,23 +21,34 @@ type L2TPProtocol struct {
 // L2TPProtocolFactory L2TP协议工厂
 type L2TPProtocolFactory struct{}
 
+// Capabilities L2TP协议尚未实现握手，不能创建
+func (f *L2TPProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// L2TPConfig L2TP协议配置
+type L2TPConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username string `config:"username" desc:"用户名"`
+	Password string `config:"password" desc:"密码"`
+	PSK      string `config:"psk" desc:"IPsec预共享密钥"`
+}
+
+// Config 返回L2TP协议的配置结构
+func (f *L2TPProtocolFactory) Config() interface{} {
+	return &L2TPConfig{}
+}
+
 // CreateProtocol 创建L2TP协议实例
 func (f *L2TPProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg L2TPConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	username, _ := config["username"].(string)
-	password, _ := config["password"].(string)
-	psk, _ := config["psk"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("l2tp-%s:%d", server, port)
 	}
@@ -47,20 +60,25 @@ func (f *L2TPProtocolFactory) CreateProtocol(config map[string]interface{}) (Pro
 		},
 		server:   server,
 		port:     port,
-		username: username,
-		password: password,
-		psk:      psk,
+		username: cfg.Username,
+		password: cfg.Password,
+		psk:      cfg.PSK,
 	}
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (lp *L2TPProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, lp.Connect)
+}
+
 // Connect 连接到目标地址（通过L2TP）
 func (lp *L2TPProtocol) Connect(targetAddr string) (net.Conn, error) {
 	// 连接到L2TP服务器
 	// 注意：这是一个简化的实现，实际的L2TP连接需要更复杂的控制通道建立过程
-	l2tpAddr := fmt.Sprintf("%s:%d", lp.server, lp.port)
-	conn, err := net.DialTimeout("udp", l2tpAddr, 10*time.Second)
+	l2tpAddr := net.JoinHostPort(lp.server, strconv.Itoa(lp.port))
+	conn, err := lp.dialTimeout("udp", l2tpAddr, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to L2TP server %s: %v", l2tpAddr, err)
 	}
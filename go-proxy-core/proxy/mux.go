@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/dualvpn/go-proxy-core/mux"
+)
+
+// MuxOptions 多路复用配置，Shadowsocks和Trojan支持
+// 配置兼容Clash的smux写法，也可以直接写mux: true使用默认参数:
+//
+//	smux:
+//	  enabled: true
+//	  protocol: smux      # smux/yamux
+//	  max-connections: 4
+//	  min-streams: 4
+//	  max-streams: 0
+//	  padding: true
+type MuxOptions struct {
+	Mux interface{} `config:"smux,mux" desc:"多路复用，true或{enabled, protocol, max-connections, min-streams, max-streams, padding}"`
+}
+
+// muxConfig smux配置块的字段
+type muxConfig struct {
+	Enabled        bool   `config:"enabled" desc:"是否启用多路复用"`
+	Protocol       string `config:"protocol" default:"smux" enum:"smux,yamux" desc:"复用协议"`
+	MaxConnections int    `config:"max_connections,max-connections" min:"0" desc:"最大会话数，与max_streams互斥"`
+	MinStreams     int    `config:"min_streams,min-streams" min:"0" desc:"会话的流数量达到该值后新建会话"`
+	MaxStreams     int    `config:"max_streams,max-streams" min:"0" desc:"每个会话的最大流数量"`
+	Padding        bool   `config:"padding" desc:"是否对会话开头的数据添加随机填充"`
+}
+
+// parseMuxConfig 解码多路复用配置，未启用时返回nil
+// 配置可以是布尔值（包括"true"这样的字符串）或smux配置块
+func parseMuxConfig(opts MuxOptions) (*muxConfig, error) {
+	var cfg muxConfig
+	switch v := opts.Mux.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if err := decodeConfig(v, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid mux config: %v", err)
+		}
+	default:
+		enabled, err := configToBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mux config: %v", err)
+		}
+		if err := decodeConfig(map[string]interface{}{"enabled": enabled}, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return &cfg, nil
+}
+
+// newMuxClient 根据多路复用配置创建客户端，未启用时返回nil
+// dial通过上游协议连接到目标地址，不经过多路复用
+func newMuxClient(opts MuxOptions, dial func(ctx context.Context, network, address string) (net.Conn, error)) (*mux.Client, error) {
+	cfg, err := parseMuxConfig(opts)
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+
+	clientConfig := mux.ClientConfig{
+		Protocol:       cfg.Protocol,
+		MaxConnections: cfg.MaxConnections,
+		MinStreams:     cfg.MinStreams,
+		MaxStreams:     cfg.MaxStreams,
+		Padding:        cfg.Padding,
+		Timeout:        DefaultConnectTimeout,
+		DialContext:    dial,
+	}
+	client, err := mux.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mux config: %v", err)
+	}
+
+	log.Printf("启用多路复用: protocol=%s, max_connections=%d, min_streams=%d, max_streams=%d, padding=%t",
+		clientConfig.Protocol, clientConfig.MaxConnections, clientConfig.MinStreams, clientConfig.MaxStreams, cfg.Padding)
+	return client, nil
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestParseMuxConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mux     interface{}
+		want    *muxConfig
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "false", mux: false},
+		{name: "true", mux: true, want: &muxConfig{Enabled: true, Protocol: "smux"}},
+		{name: "string true", mux: "true", want: &muxConfig{Enabled: true, Protocol: "smux"}},
+		{name: "string false", mux: "false"},
+		{name: "disabled block", mux: map[string]interface{}{"enabled": false, "protocol": "yamux"}},
+		{name: "block without enabled", mux: map[string]interface{}{"protocol": "yamux"}},
+		{
+			name: "clash block",
+			mux: map[string]interface{}{
+				"enabled":         "true",
+				"protocol":        "yamux",
+				"max-connections": float64(4),
+				"min-streams":     "2",
+				"padding":         "1",
+			},
+			want: &muxConfig{Enabled: true, Protocol: "yamux", MaxConnections: 4, MinStreams: 2, Padding: true},
+		},
+		{
+			name: "underscore keys",
+			mux:  map[string]interface{}{"enabled": true, "max_streams": 16},
+			want: &muxConfig{Enabled: true, Protocol: "smux", MaxStreams: 16},
+		},
+		{name: "invalid bool", mux: "yes", wantErr: true},
+		{name: "invalid enabled", mux: map[string]interface{}{"enabled": "on"}, wantErr: true},
+		{name: "invalid padding", mux: map[string]interface{}{"enabled": true, "padding": "maybe"}, wantErr: true},
+		{name: "fractional streams", mux: map[string]interface{}{"enabled": true, "max-streams": 1.5}, wantErr: true},
+		{name: "negative connections", mux: map[string]interface{}{"enabled": true, "max-connections": -1}, wantErr: true},
+	} {
+		got, err := parseMuxConfig(MuxOptions{Mux: tc.mux})
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got %+v", tc.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNewMuxClientValidation(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, net.ErrClosed
+	}
+	for _, tc := range []struct {
+		name string
+		mux  map[string]interface{}
+	}{
+		{"unknown protocol", map[string]interface{}{"enabled": true, "protocol": "h2mux"}},
+		{"connections and streams", map[string]interface{}{"enabled": true, "max-connections": 4, "max-streams": 8}},
+	} {
+		if _, err := newMuxClient(MuxOptions{Mux: tc.mux}, dial); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
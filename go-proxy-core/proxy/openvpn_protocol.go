@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -22,26 +23,40 @@ type OpenVPNProtocol struct {
 // OpenVPNProtocolFactory OpenVPN协议工厂
 type OpenVPNProtocolFactory struct{}
 
+// Capabilities 返回OpenVPN协议支持的能力
+func (f *OpenVPNProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true}
+}
+
+// OpenVPNConfig OpenVPN协议配置
+type OpenVPNConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username            string `config:"username" desc:"用户名"`
+	Password            string `config:"password" desc:"密码"`
+	ConfigPath          string `config:"config_path" desc:"OpenVPN配置文件路径"`
+	ProcessedConfigPath string `config:"processed_config_path" desc:"特权助手处理后的配置文件路径"`
+}
+
+// Config 返回OpenVPN协议的配置结构
+func (f *OpenVPNProtocolFactory) Config() interface{} {
+	return &OpenVPNConfig{}
+}
+
 // CreateProtocol 创建OpenVPN协议实例
 func (f *OpenVPNProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg OpenVPNConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port, configPath, processedConfigPath := cfg.Server, cfg.Port, cfg.ConfigPath, cfg.ProcessedConfigPath
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
+	// OpenVPN由外部进程建立隧道，无法经由前置代理连接服务器
+	if via := dialerProxyName(config); via != "" {
+		return nil, fmt.Errorf("openvpn does not support dialer proxy %s", via)
 	}
 
-	username, _ := config["username"].(string)
-	password, _ := config["password"].(string)
-	configPath, _ := config["config_path"].(string)
-	name, _ := config["name"].(string)
-
-	// 检查是否有特权助手处理后的配置文件路径
-	processedConfigPath, _ := config["processed_config_path"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("openvpn-%s:%d", server, port)
 	}
@@ -67,8 +82,8 @@ func (f *OpenVPNProtocolFactory) CreateProtocol(config map[string]interface{}) (
 		},
 		server:     server,
 		port:       port,
-		username:   username,
-		password:   password,
+		username:   cfg.Username,
+		password:   cfg.Password,
 		configPath: configPath,
 		client:     client,
 	}
@@ -76,6 +91,18 @@ func (f *OpenVPNProtocolFactory) CreateProtocol(config map[string]interface{}) (
 	return protocol, nil
 }
 
+// SetDialer 设置隧道内连接目标使用的拨号器，用于将连接绑定到TUN设备
+// OpenVPN不支持前置代理，这里只会收到应用套接字选项的拨号器
+func (op *OpenVPNProtocol) SetDialer(dialer Dialer) {
+	op.BaseProtocol.SetDialer(dialer)
+	op.client.SetDialContext(dialer.DialContext)
+}
+
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (op *OpenVPNProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, op.Connect)
+}
+
 // Connect 连接到目标地址（通过OpenVPN）
 func (op *OpenVPNProtocol) Connect(targetAddr string) (net.Conn, error) {
 	log.Printf("OpenVPN协议开始连接: targetAddr=%s, server=%s, port=%d, configPath=%s", targetAddr, op.server, op.port, op.configPath)
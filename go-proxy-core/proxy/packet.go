@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// packetAddr 以host:port表示的UDP目标地址，域名不在本地解析
+type packetAddr string
+
+// Network 返回网络类型
+func (a packetAddr) Network() string {
+	return "udp"
+}
+
+// String 返回host:port形式的地址
+func (a packetAddr) String() string {
+	return string(a)
+}
+
+// dialPacketConn 通过协议的UDP会话建立到固定目标的连接
+// 用于以DialContext("udp")的方式使用只提供ListenPacket的协议
+func dialPacketConn(ctx context.Context, protocol ProxyProtocol, targetAddr string) (net.Conn, error) {
+	if _, _, err := net.SplitHostPort(targetAddr); err != nil {
+		return nil, fmt.Errorf("invalid target address %s: %v", targetAddr, err)
+	}
+
+	pc, err := protocol.ListenPacket(ctx, targetAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &packetConn{PacketConn: pc, target: packetAddr(targetAddr)}, nil
+}
+
+// packetConn 将UDP会话包装为只与单个目标通信的net.Conn
+type packetConn struct {
+	net.PacketConn
+	target net.Addr
+}
+
+// Read 读取一个数据报
+func (c *packetConn) Read(b []byte) (int, error) {
+	n, _, err := c.PacketConn.ReadFrom(b)
+	return n, err
+}
+
+// Write 向目标发送一个数据报
+func (c *packetConn) Write(b []byte) (int, error) {
+	return c.PacketConn.WriteTo(b, c.target)
+}
+
+// RemoteAddr 返回目标地址
+func (c *packetConn) RemoteAddr() net.Addr {
+	return c.target
+}
+
+// connPacketConn 将已连接的数据报连接包装为net.PacketConn
+// 所有数据报都发往连接的对端，WriteTo中的地址被忽略
+type connPacketConn struct {
+	net.Conn
+}
+
+// ReadFrom 读取一个数据报，来源总是连接的对端
+func (c *connPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Conn.Read(b)
+	return n, c.Conn.RemoteAddr(), err
+}
+
+// WriteTo 向连接的对端发送一个数据报
+func (c *connPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Conn.Write(b)
+}
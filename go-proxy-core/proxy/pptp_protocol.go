@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -18,22 +20,33 @@ type PPTPProtocol struct {
 // PPTPProtocolFactory PPTP协议工厂
 type PPTPProtocolFactory struct{}
 
+// Capabilities PPTP协议尚未实现握手，不能创建
+func (f *PPTPProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// PPTPConfig PPTP协议配置
+type PPTPConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username string `config:"username" desc:"用户名"`
+	Password string `config:"password" desc:"密码"`
+}
+
+// Config 返回PPTP协议的配置结构
+func (f *PPTPProtocolFactory) Config() interface{} {
+	return &PPTPConfig{}
+}
+
 // CreateProtocol 创建PPTP协议实例
 func (f *PPTPProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg PPTPConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	username, _ := config["username"].(string)
-	password, _ := config["password"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("pptp-%s:%d", server, port)
 	}
@@ -45,19 +58,24 @@ func (f *PPTPProtocolFactory) CreateProtocol(config map[string]interface{}) (Pro
 		},
 		server:   server,
 		port:     port,
-		username: username,
-		password: password,
+		username: cfg.Username,
+		password: cfg.Password,
 	}
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (pp *PPTPProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, pp.Connect)
+}
+
 // Connect 连接到目标地址（通过PPTP）
 func (pp *PPTPProtocol) Connect(targetAddr string) (net.Conn, error) {
 	// 连接到PPTP服务器
 	// 注意：这是一个简化的实现，实际的PPTP连接需要更复杂的控制通道建立过程
-	pptpAddr := fmt.Sprintf("%s:%d", pp.server, pp.port)
-	conn, err := net.DialTimeout("tcp", pptpAddr, 10*time.Second)
+	pptpAddr := net.JoinHostPort(pp.server, strconv.Itoa(pp.port))
+	conn, err := pp.dialTimeout("tcp", pptpAddr, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to PPTP server %s: %v", pptpAddr, err)
 	}
@@ -1,9 +1,14 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strings"
+	"sync"
+	"time"
 )
 
 // ProtocolType 协议类型
@@ -27,8 +32,19 @@ const (
 	ProtocolSOCKS5       ProtocolType = "socks5"
 	ProtocolDIRECT       ProtocolType = "direct"
 	ProtocolVLESS        ProtocolType = "vless" // 添加VLESS协议类型
+	ProtocolHysteria2    ProtocolType = "hysteria2"
+	ProtocolTUIC         ProtocolType = "tuic"
+	ProtocolSSH          ProtocolType = "ssh"
 )
 
+const (
+	// DefaultConnectTimeout 未指定上下文时建立连接的默认超时时间
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// ErrUDPNotSupported 协议不支持UDP
+var ErrUDPNotSupported = errors.New("udp not supported")
+
 // ProxyProtocol 代理协议接口
 type ProxyProtocol interface {
 	// Type 返回协议类型
@@ -37,7 +53,16 @@ type ProxyProtocol interface {
 	// Name 返回协议名称
 	Name() string
 
-	// Connect 连接到目标地址
+	// DialContext 通过协议建立到目标地址的连接，ctx取消或超时时放弃连接
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+
+	// ListenPacket 通过协议建立UDP会话，address为首个目标地址，可以为空
+	ListenPacket(ctx context.Context, address string) (net.PacketConn, error)
+
+	// SupportsUDP 返回协议是否支持UDP
+	SupportsUDP() bool
+
+	// Connect 连接到目标地址，等价于使用默认超时的TCP DialContext
 	Connect(targetAddr string) (net.Conn, error)
 
 	// Close 关闭连接
@@ -51,6 +76,7 @@ type ProxyProtocol interface {
 type BaseProtocol struct {
 	name         string
 	protocolType ProtocolType
+	dialer       Dialer // 连接服务器使用的拨号器，为空时直接连接
 }
 
 // Type 返回协议类型
@@ -75,43 +101,181 @@ func (bp *BaseProtocol) IsRunning() bool {
 	return true
 }
 
+// ListenPacket 建立UDP会话，基础实现不支持UDP
+func (bp *BaseProtocol) ListenPacket(ctx context.Context, address string) (net.PacketConn, error) {
+	return nil, fmt.Errorf("%w: %s", ErrUDPNotSupported, bp.protocolType)
+}
+
+// SupportsUDP 返回协议是否支持UDP，基础实现不支持
+func (bp *BaseProtocol) SupportsUDP() bool {
+	return false
+}
+
+// SetDialer 设置连接服务器使用的拨号器
+func (bp *BaseProtocol) SetDialer(dialer Dialer) {
+	bp.dialer = dialer
+}
+
+// dial 使用协议的拨号器连接服务器
+func (bp *BaseProtocol) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := bp.dialer
+	if dialer == nil {
+		dialer = defaultDialer
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// listenPacket 创建本地UDP套接字，拨号器配置了套接字选项时同样生效
+func (bp *BaseProtocol) listenPacket(ctx context.Context) (net.PacketConn, error) {
+	if listener, ok := bp.dialer.(interface {
+		ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error)
+	}); ok {
+		return listener.ListenPacket(ctx, "udp", "")
+	}
+	var lc net.ListenConfig
+	return lc.ListenPacket(ctx, "udp", "")
+}
+
+// dialTimeout 使用协议的拨号器连接服务器，带超时
+func (bp *BaseProtocol) dialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return bp.dial(ctx, network, address)
+}
+
+// connectTimeout 使用默认超时通过协议的DialContext建立TCP连接，供Connect使用
+func connectTimeout(protocol ProxyProtocol, targetAddr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConnectTimeout)
+	defer cancel()
+	return protocol.DialContext(ctx, "tcp", targetAddr)
+}
+
+// dialWithConnect 为只实现了Connect的协议提供DialContext
+// Connect在后台执行，ctx先结束时返回错误并关闭稍后建立的连接
+func dialWithConnect(ctx context.Context, network, address string, connect func(string) (net.Conn, error)) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("%w: network %s", ErrUDPNotSupported, network)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := connect(address)
+		done <- result{conn, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
 // ProtocolFactory 协议工厂接口
 type ProtocolFactory interface {
 	// CreateProtocol 创建协议实例
 	CreateProtocol(config map[string]interface{}) (ProxyProtocol, error)
+
+	// Capabilities 返回协议是否已实现以及支持的网络
+	Capabilities() ProtocolCapabilities
+
+	// Config 返回协议配置结构体的指针，CreateProtocol按它解码配置，也用于生成JSON Schema
+	Config() interface{}
 }
 
-// ProtocolManager 协议管理器
+// ProtocolManager 协议管理器，可以被多个协程同时使用
 type ProtocolManager struct {
-	protocols map[string]ProxyProtocol
-	factories map[ProtocolType]ProtocolFactory
+	mu            sync.RWMutex
+	protocols     map[string]*protocolEntry
+	draining      map[*protocolEntry]struct{} // 已被替换或移除、等待连接结束的协议
+	factories     map[ProtocolType]ProtocolFactory
+	dialerProxies map[string]string // 协议名称 -> 前置协议名称
+	drainTimeout  time.Duration     // 旧实例等待连接结束的最长时间
 }
 
 // NewProtocolManager 创建新的协议管理器
 func NewProtocolManager() *ProtocolManager {
 	log.Printf("创建新的协议管理器")
 	return &ProtocolManager{
-		protocols: make(map[string]ProxyProtocol),
-		factories: make(map[ProtocolType]ProtocolFactory),
+		protocols:     make(map[string]*protocolEntry),
+		draining:      make(map[*protocolEntry]struct{}),
+		factories:     make(map[ProtocolType]ProtocolFactory),
+		dialerProxies: make(map[string]string),
+		drainTimeout:  protocolDrainTimeout,
 	}
 }
 
 // RegisterFactory 注册协议工厂
 func (pm *ProtocolManager) RegisterFactory(protocolType ProtocolType, factory ProtocolFactory) {
 	log.Printf("注册协议工厂: type=%s", protocolType)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	pm.factories[protocolType] = factory
 }
 
-// CreateProtocol 创建协议实例
+// factory 返回协议类型对应的工厂
+func (pm *ProtocolManager) factory(protocolType ProtocolType) (ProtocolFactory, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	factory, exists := pm.factories[protocolType]
+	return factory, exists
+}
+
+// CreateProtocol 创建协议实例并注册到管理器
+// 同名协议已存在时替换：新连接立即使用新实例，旧实例在已有连接结束后关闭
 func (pm *ProtocolManager) CreateProtocol(protocolType ProtocolType, name string, config map[string]interface{}) (ProxyProtocol, error) {
 	log.Printf("尝试创建协议: type=%s, name=%s", protocolType, name)
 
-	factory, exists := pm.factories[protocolType]
+	factory, exists := pm.factory(protocolType)
 	if !exists {
 		log.Printf("不支持的协议类型: %s", protocolType)
 		return nil, fmt.Errorf("unsupported protocol type: %s", protocolType)
 	}
 
+	protocol, err := pm.newProtocol(factory, protocolType, name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// 将协议添加到管理器中
+	pm.mu.Lock()
+	previous := pm.protocols[name]
+	pm.protocols[name] = newProtocolEntry(name, protocol)
+	if previous != nil {
+		pm.draining[previous] = struct{}{}
+	}
+	count := len(pm.protocols)
+	pm.mu.Unlock()
+
+	// 添加日志以调试协议创建过程
+	log.Printf("成功创建并注册协议: name=%s, type=%s, 当前已注册的协议数量: %d", name, protocolType, count)
+
+	if previous != nil {
+		pm.retireEntry(previous)
+	}
+	return protocol, nil
+}
+
+// newProtocol 使用工厂创建协议实例并设置拨号器，不注册到管理器
+func (pm *ProtocolManager) newProtocol(factory ProtocolFactory, protocolType ProtocolType, name string, config map[string]interface{}) (ProxyProtocol, error) {
+	// 尚未实现的协议只会建立到服务器的原始连接，把客户端数据明文发出，直接拒绝
+	if err := checkCapabilities(protocolType, factory); err != nil {
+		log.Printf("拒绝创建协议 %s: %v", name, err)
+		return nil, err
+	}
+
 	// 确保配置中包含协议名称
 	if _, exists := config["name"]; !exists {
 		config["name"] = name
@@ -123,60 +287,127 @@ func (pm *ProtocolManager) CreateProtocol(protocolType ProtocolType, name string
 		return nil, fmt.Errorf("failed to create protocol %s: %v", protocolType, err)
 	}
 
-	// 将协议添加到管理器中
-	pm.protocols[name] = protocol
+	// 配置了前置代理时通过另一个协议或代理源连接服务器
+	if err := pm.setupDialerProxy(name, protocol, config); err != nil {
+		log.Printf("配置协议 %s 的前置代理失败: %v", name, err)
+		protocol.Close()
+		return nil, err
+	}
 
-	// 添加日志以调试协议创建过程
-	log.Printf("成功创建并注册协议: name=%s, type=%s", name, protocolType)
+	// 绑定网卡、源地址或fwmark，使连接不受路由表影响；按地址族策略解析域名
+	if err := pm.setupDirectDialer(name, protocol, config); err != nil {
+		log.Printf("配置协议 %s 的直连选项失败: %v", name, err)
+		protocol.Close()
+		return nil, err
+	}
+	return protocol, nil
+}
 
-	// 打印所有已注册的协议
-	log.Printf("当前已注册的协议数量: %d", len(pm.protocols))
-	for pname, p := range pm.protocols {
-		log.Printf("已注册协议: name=%s, type=%s", pname, p.Type())
+// CreateTemporaryProtocol 创建不注册到管理器的协议实例，用于延迟测试等短期用途
+// 用完后调用返回的release关闭协议并清理前置代理记录
+func (pm *ProtocolManager) CreateTemporaryProtocol(protocolType ProtocolType, name string, config map[string]interface{}) (ProxyProtocol, func(), error) {
+	factory, exists := pm.factory(protocolType)
+	if !exists {
+		return nil, nil, fmt.Errorf("unsupported protocol type: %s", protocolType)
+	}
+	protocol, err := pm.newProtocol(factory, protocolType, name, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		protocol.Close()
+		pm.mu.Lock()
+		delete(pm.dialerProxies, name)
+		pm.mu.Unlock()
 	}
+	return protocol, release, nil
+}
 
-	return protocol, nil
+// setupDialerProxy 为协议设置前置代理拨号器，并检查代理链是否成环
+func (pm *ProtocolManager) setupDialerProxy(name string, protocol ProxyProtocol, config map[string]interface{}) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	via := dialerProxyName(config)
+	if via == "" {
+		delete(pm.dialerProxies, name)
+		return nil
+	}
+
+	setter, ok := protocol.(interface{ SetDialer(Dialer) })
+	if !ok {
+		return fmt.Errorf("protocol %s does not support dialer proxy", protocol.Type())
+	}
+
+	previous, hadPrevious := pm.dialerProxies[name]
+	pm.dialerProxies[name] = via
+	chain, err := pm.dialerChainLocked(name)
+	if err != nil {
+		if hadPrevious {
+			pm.dialerProxies[name] = previous
+		} else {
+			delete(pm.dialerProxies, name)
+		}
+		return err
+	}
+
+	setter.SetDialer(&chainDialer{pm: pm, owner: name, via: via})
+	log.Printf("协议 %s 使用前置代理: %s", name, strings.Join(chain, " -> "))
+	return nil
 }
 
 // GetProtocol 获取协议实例
 func (pm *ProtocolManager) GetProtocol(name string) ProxyProtocol {
 	log.Printf("获取协议: name=%s", name)
-	return pm.protocols[name]
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if entry, ok := pm.protocols[name]; ok {
+		return entry.protocol
+	}
+	return nil
 }
 
-// RemoveProtocol 移除协议实例
+// RemoveProtocol 移除协议实例，实例在已有连接结束后关闭
 func (pm *ProtocolManager) RemoveProtocol(name string) {
 	log.Printf("移除协议: name=%s", name)
+	pm.mu.Lock()
+	entry := pm.protocols[name]
 	delete(pm.protocols, name)
+	delete(pm.dialerProxies, name)
+	if entry != nil {
+		pm.draining[entry] = struct{}{}
+	}
+	pm.mu.Unlock()
+
+	if entry != nil {
+		pm.retireEntry(entry)
+	}
 }
 
-// GetAllProtocols 获取所有协议实例
+// GetAllProtocols 获取所有协议实例的快照
 func (pm *ProtocolManager) GetAllProtocols() map[string]ProxyProtocol {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	log.Printf("获取所有协议，数量: %d", len(pm.protocols))
-	return pm.protocols
+	protocols := make(map[string]ProxyProtocol, len(pm.protocols))
+	for name, entry := range pm.protocols {
+		protocols[name] = entry.protocol
+	}
+	return protocols
 }
 
-// Connect 通过指定协议连接到目标地址
+// Connect 通过指定协议连接到目标地址，使用默认超时
 func (pm *ProtocolManager) Connect(protocolName, targetAddr string) (net.Conn, error) {
-	log.Printf("协议管理器尝试通过协议 %s 连接到目标 %s", protocolName, targetAddr)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultConnectTimeout)
+	defer cancel()
+	return pm.DialContext(ctx, protocolName, "tcp", targetAddr)
+}
 
-	// 添加调试日志，显示当前所有已注册的协议
-	log.Printf("当前已注册的协议数量: %d", len(pm.protocols))
-	for name, protocol := range pm.protocols {
-		log.Printf("已注册协议: %s (%s)", name, protocol.Type())
-	}
+// DialContext 通过指定协议连接到目标地址，连接关闭前协议实例不会被关闭
+func (pm *ProtocolManager) DialContext(ctx context.Context, protocolName, network, targetAddr string) (net.Conn, error) {
+	log.Printf("协议管理器尝试通过协议 %s 连接到目标 %s (%s)", protocolName, targetAddr, network)
 
-	protocol, exists := pm.protocols[protocolName]
-	if !exists {
-		// 尝试查找相似名称的协议
-		log.Printf("协议 %s 未找到，尝试查找相似名称的协议", protocolName)
-		for name, p := range pm.protocols {
-			log.Printf("可用协议: %s (%s)", name, p.Type())
-		}
-		return nil, fmt.Errorf("protocol %s not found", protocolName)
-	}
-
-	conn, err := protocol.Connect(targetAddr)
+	conn, err := pm.dial(ctx, protocolName, network, targetAddr)
 	if err != nil {
 		log.Printf("协议 %s 连接到目标 %s 失败: %v", protocolName, targetAddr, err)
 		return nil, err
@@ -185,3 +416,57 @@ func (pm *ProtocolManager) Connect(protocolName, targetAddr string) (net.Conn, e
 	log.Printf("协议 %s 成功连接到目标 %s", protocolName, targetAddr)
 	return conn, nil
 }
+
+// ListenPacket 通过指定协议建立UDP会话，会话关闭前协议实例不会被关闭
+func (pm *ProtocolManager) ListenPacket(ctx context.Context, protocolName, targetAddr string) (net.PacketConn, error) {
+	log.Printf("协议管理器尝试通过协议 %s 建立UDP会话: %s", protocolName, targetAddr)
+
+	pc, err := pm.listenPacket(ctx, protocolName, targetAddr)
+	if err != nil {
+		log.Printf("协议 %s 建立UDP会话失败: %v", protocolName, err)
+		return nil, err
+	}
+	return pc, nil
+}
+
+// SupportsUDP 返回指定协议是否支持UDP
+func (pm *ProtocolManager) SupportsUDP(protocolName string) bool {
+	protocol := pm.lookupProtocol(protocolName)
+	return protocol != nil && protocol.SupportsUDP()
+}
+
+// configString 按顺序读取第一个非空的字符串配置，用于兼容同一字段的多种写法
+func configString(config map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := config[key].(string); ok && strings.TrimSpace(s) != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// configStringList 读取字符串列表配置，兼容逗号分隔的字符串和JSON数组
+func configStringList(v interface{}) []string {
+	var result []string
+	switch val := v.(type) {
+	case string:
+		for _, s := range strings.Split(val, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+	case []string:
+		for _, s := range val {
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+	case []interface{}:
+		for _, item := range val {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+				result = append(result, strings.TrimSpace(s))
+			}
+		}
+	}
+	return result
+}
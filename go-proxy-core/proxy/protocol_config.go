@@ -0,0 +1,407 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// 协议配置结构体使用以下标签描述字段:
+//
+//	config:"password,psk"    配置键，第一个为标准名称，其余为兼容的别名，按顺序取第一个有值的键
+//	required:"true"          必填
+//	default:"22"             未配置时的默认值
+//	min:"1" max:"65535"      整数的取值范围
+//	enum:"tcp,ws,grpc"       可选值，只用于JSON Schema
+//	desc:"服务器地址"          字段说明，只用于JSON Schema
+//
+// 匿名嵌入的结构体（如ServerOptions、TLSOptions）的字段与外层字段平铺在同一层配置中
+
+// ServerOptions 需要连接服务器的协议共用的地址配置
+type ServerOptions struct {
+	Server string `config:"server" required:"true" desc:"服务器地址"`
+	Port   int    `config:"port" required:"true" min:"1" max:"65535" desc:"服务器端口"`
+}
+
+// decodeConfig 将协议配置解码到带config标签的结构体，out必须是结构体指针
+// 数字可以写成整数、浮点数或字符串（JSON中的数字总是float64），布尔值可以写成字符串
+func decodeConfig(config map[string]interface{}, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config target must be a pointer to struct, got %T", out)
+	}
+	return decodeStruct(config, v.Elem())
+}
+
+// decodeStruct 逐个字段解码
+func decodeStruct(config map[string]interface{}, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := decodeStruct(config, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		tag := field.Tag.Get("config")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+		keys := strings.Split(tag, ",")
+
+		key, raw := lookupConfigValue(config, keys)
+		if raw == nil {
+			def, hasDefault := field.Tag.Lookup("default")
+			if hasDefault {
+				key, raw = keys[0], def
+			} else if field.Tag.Get("required") == "true" {
+				return fmt.Errorf("missing %s in config", keys[0])
+			} else {
+				continue
+			}
+		}
+
+		if err := setConfigField(v.Field(i), raw); err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+		if err := checkConfigRange(field, v.Field(i)); err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// lookupConfigValue 按顺序返回第一个有值的配置键，空字符串视为未配置
+func lookupConfigValue(config map[string]interface{}, keys []string) (string, interface{}) {
+	for _, key := range keys {
+		raw, ok := config[key]
+		if !ok || raw == nil {
+			continue
+		}
+		if s, ok := raw.(string); ok && strings.TrimSpace(s) == "" {
+			continue
+		}
+		return key, raw
+	}
+	return "", nil
+}
+
+// setConfigField 将配置值转换为字段类型
+func setConfigField(field reflect.Value, raw interface{}) error {
+	switch field.Kind() {
+	case reflect.String:
+		s, err := configToString(raw)
+		if err != nil {
+			return err
+		}
+		field.SetString(s)
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		n, err := configToInt(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := configToFloat(raw)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := configToBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported config field type %s", field.Type())
+		}
+		list, err := configToStringList(raw)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		switch field.Type().Elem().Kind() {
+		case reflect.String:
+			switch raw.(type) {
+			case map[string]interface{}, map[string]string:
+			default:
+				return fmt.Errorf("expected an object, got %T", raw)
+			}
+			field.Set(reflect.ValueOf(configStringMap(raw)))
+		case reflect.Interface:
+			m, ok := raw.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("expected an object, got %T", raw)
+			}
+			field.Set(reflect.ValueOf(m))
+		default:
+			return fmt.Errorf("unsupported config field type %s", field.Type())
+		}
+	case reflect.Interface:
+		field.Set(reflect.ValueOf(raw))
+	case reflect.Ptr:
+		// 指针字段用于区分未配置和零值
+		value := reflect.New(field.Type().Elem())
+		if err := setConfigField(value.Elem(), raw); err != nil {
+			return err
+		}
+		field.Set(value)
+	default:
+		return fmt.Errorf("unsupported config field type %s", field.Type())
+	}
+	return nil
+}
+
+// checkConfigRange 检查整数字段的min/max标签
+func checkConfigRange(field reflect.StructField, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32:
+	default:
+		return nil
+	}
+	n := v.Int()
+	if min, ok := field.Tag.Lookup("min"); ok {
+		if limit, err := strconv.ParseInt(min, 10, 64); err == nil && n < limit {
+			return fmt.Errorf("%d is less than %d", n, limit)
+		}
+	}
+	if max, ok := field.Tag.Lookup("max"); ok {
+		if limit, err := strconv.ParseInt(max, 10, 64); err == nil && n > limit {
+			return fmt.Errorf("%d is greater than %d", n, limit)
+		}
+	}
+	return nil
+}
+
+// configToString 转换字符串配置，数字和布尔值按字面转换
+func configToString(raw interface{}) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("expected a string, got %T", raw)
+}
+
+// configToInt 转换整数配置，兼容int、float64和字符串，带小数部分时返回错误
+func configToInt(raw interface{}) (int64, error) {
+	switch v := raw.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	}
+	f, err := configToFloat(raw)
+	if err != nil {
+		return 0, fmt.Errorf("expected an integer, got %v", raw)
+	}
+	if f != math.Trunc(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("expected an integer, got %v", raw)
+	}
+	return int64(f), nil
+}
+
+// configToFloat 转换数字配置，兼容各种数字类型和字符串
+func configToFloat(raw interface{}) (float64, error) {
+	switch v := raw.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || math.IsNaN(f) {
+			return 0, fmt.Errorf("expected a number, got %q", v)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", raw)
+}
+
+// configToBool 转换布尔配置，兼容"true"/"false"/"1"/"0"字符串和数字
+func configToBool(raw interface{}) (bool, error) {
+	switch v := raw.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("expected a boolean, got %q", v)
+		}
+		return b, nil
+	}
+	if f, err := configToFloat(raw); err == nil {
+		return f != 0, nil
+	}
+	return false, fmt.Errorf("expected a boolean, got %T", raw)
+}
+
+// configToStringList 转换字符串列表配置，兼容逗号分隔的字符串和数组
+func configToStringList(raw interface{}) ([]string, error) {
+	switch v := raw.(type) {
+	case string, []string:
+		return configStringList(v), nil
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			s, err := configToString(item)
+			if err != nil {
+				return nil, err
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				result = append(result, s)
+			}
+		}
+		return result, nil
+	}
+	s, err := configToString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("expected a list, got %T", raw)
+	}
+	return []string{s}, nil
+}
+
+// Schema 返回协议类型配置的JSON Schema，供界面生成和校验表单
+// 除代理组外，Schema中还包括协议管理器读取的DialOptions；尚未实现的协议不能创建，不返回Schema
+func (pm *ProtocolManager) Schema(protocolType ProtocolType) (map[string]interface{}, error) {
+	factory, exists := pm.factory(protocolType)
+	if !exists {
+		return nil, fmt.Errorf("unsupported protocol type: %s", protocolType)
+	}
+	if err := checkCapabilities(protocolType, factory); err != nil {
+		return nil, err
+	}
+	configs := []interface{}{factory.Config()}
+	if !IsGroupType(protocolType) {
+		configs = append(configs, &DialOptions{})
+	}
+	schema := configSchema(string(protocolType), configs...)
+	schema["x-capabilities"] = factory.Capabilities()
+	return schema, nil
+}
+
+// configSchema 根据配置结构体的标签生成JSON Schema（draft-07）
+func configSchema(title string, configs ...interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	for _, config := range configs {
+		t := reflect.TypeOf(config)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		schemaFields(t, properties, &required)
+	}
+
+	schema := map[string]interface{}{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      title,
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaFields 生成结构体各字段的Schema
+func schemaFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			schemaFields(field.Type, properties, required)
+			continue
+		}
+		tag := field.Tag.Get("config")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+		keys := strings.Split(tag, ",")
+
+		property := schemaType(field.Type)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			property["description"] = desc
+		}
+		if len(keys) > 1 {
+			property["x-aliases"] = keys[1:]
+		}
+		if def, ok := field.Tag.Lookup("default"); ok {
+			value := reflect.New(field.Type).Elem()
+			if err := setConfigField(value, def); err == nil {
+				property["default"] = reflect.Indirect(value).Interface()
+			}
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			property["enum"] = strings.Split(enum, ",")
+		}
+		if min, ok := field.Tag.Lookup("min"); ok {
+			if n, err := strconv.ParseInt(min, 10, 64); err == nil {
+				property["minimum"] = n
+			}
+		}
+		if max, ok := field.Tag.Lookup("max"); ok {
+			if n, err := strconv.ParseInt(max, 10, 64); err == nil {
+				property["maximum"] = n
+			}
+		}
+		properties[keys[0]] = property
+		if field.Tag.Get("required") == "true" {
+			*required = append(*required, keys[0])
+		}
+	}
+}
+
+// schemaType 返回字段类型对应的Schema类型
+func schemaType(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.String {
+			return map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}
+		}
+		return map[string]interface{}{"type": "object"}
+	}
+	return map[string]interface{}{}
+}
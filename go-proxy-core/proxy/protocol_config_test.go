@@ -0,0 +1,199 @@
+package proxy
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeTestConfig decodeConfig测试使用的配置结构，覆盖各种字段类型和标签
+type decodeTestConfig struct {
+	Name string `config:"name,title"`
+	ServerOptions
+	UDP     bool              `config:"udp" default:"true"`
+	Timeout int               `config:"timeout" default:"30" min:"1" max:"60"`
+	Ratio   float64           `config:"ratio"`
+	Tags    []string          `config:"tags"`
+	Headers map[string]string `config:"headers"`
+	Limit   *int              `config:"limit,max-limit"`
+}
+
+func TestDecodeConfig(t *testing.T) {
+	limit := 0
+	base := func(server string, port int) decodeTestConfig {
+		return decodeTestConfig{ServerOptions: ServerOptions{Server: server, Port: port}, UDP: true, Timeout: 30}
+	}
+	for _, tc := range []struct {
+		name   string
+		config map[string]interface{}
+		want   func() decodeTestConfig
+		err    string // 非空时期望错误信息包含该内容
+	}{
+		{
+			name:   "defaults",
+			config: map[string]interface{}{"server": "example.com", "port": 443},
+			want:   func() decodeTestConfig { return base("example.com", 443) },
+		},
+		{
+			name:   "float64 port",
+			config: map[string]interface{}{"server": "example.com", "port": float64(443)},
+			want:   func() decodeTestConfig { return base("example.com", 443) },
+		},
+		{
+			name:   "string port",
+			config: map[string]interface{}{"server": "example.com", "port": "443"},
+			want:   func() decodeTestConfig { return base("example.com", 443) },
+		},
+		{
+			name:   "fractional port",
+			config: map[string]interface{}{"server": "example.com", "port": 443.5},
+			err:    "invalid port",
+		},
+		{
+			name:   "non-numeric port",
+			config: map[string]interface{}{"server": "example.com", "port": "https"},
+			err:    "invalid port",
+		},
+		{
+			name:   "bool strings and numbers",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "udp": "false", "ratio": "0.5"},
+			want: func() decodeTestConfig {
+				cfg := base("example.com", 443)
+				cfg.UDP, cfg.Ratio = false, 0.5
+				return cfg
+			},
+		},
+		{
+			name:   "numeric bool",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "udp": float64(0)},
+			want: func() decodeTestConfig {
+				cfg := base("example.com", 443)
+				cfg.UDP = false
+				return cfg
+			},
+		},
+		{
+			name:   "invalid bool",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "udp": "yes"},
+			err:    "invalid udp",
+		},
+		{
+			name:   "below min",
+			config: map[string]interface{}{"server": "example.com", "port": 0},
+			err:    "invalid port: 0 is less than 1",
+		},
+		{
+			name:   "above max",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "timeout": "61"},
+			err:    "invalid timeout: 61 is greater than 60",
+		},
+		{
+			name:   "alias and lists",
+			config: map[string]interface{}{"title": "hk", "server": "example.com", "port": 443, "tags": "a, b,,c", "headers": map[string]interface{}{"Host": "cdn.example.com"}},
+			want: func() decodeTestConfig {
+				cfg := base("example.com", 443)
+				cfg.Name, cfg.Tags, cfg.Headers = "hk", []string{"a", "b", "c"}, map[string]string{"Host": "cdn.example.com"}
+				return cfg
+			},
+		},
+		{
+			name:   "first key wins",
+			config: map[string]interface{}{"name": "primary", "title": "alias", "server": "example.com", "port": 443},
+			want: func() decodeTestConfig {
+				cfg := base("example.com", 443)
+				cfg.Name = "primary"
+				return cfg
+			},
+		},
+		{
+			name:   "empty string is unset",
+			config: map[string]interface{}{"name": " ", "title": "alias", "server": "example.com", "port": 443, "timeout": ""},
+			want: func() decodeTestConfig {
+				cfg := base("example.com", 443)
+				cfg.Name = "alias"
+				return cfg
+			},
+		},
+		{
+			name:   "pointer keeps zero value",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "max-limit": 0},
+			want: func() decodeTestConfig {
+				cfg := base("example.com", 443)
+				cfg.Limit = &limit
+				return cfg
+			},
+		},
+		{
+			name:   "unknown keys are ignored",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "unknown": []interface{}{1}},
+			want:   func() decodeTestConfig { return base("example.com", 443) },
+		},
+		{
+			name:   "missing required",
+			config: map[string]interface{}{"port": 443},
+			err:    "missing server",
+		},
+		{
+			name:   "wrong type",
+			config: map[string]interface{}{"server": "example.com", "port": 443, "headers": "Host: example.com"},
+			err:    "invalid headers",
+		},
+	} {
+		var got decodeTestConfig
+		err := decodeConfig(tc.config, &got)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error = %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if want := tc.want(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, want)
+		}
+	}
+
+	if err := decodeConfig(map[string]interface{}{}, decodeTestConfig{}); err == nil {
+		t.Error("decoding into a non-pointer should fail")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	pm := NewProtocolManager()
+	pm.RegisterFactory(ProtocolTrojan, &TrojanProtocolFactory{})
+	pm.RegisterFactory(ProtocolVMess, &VMessProtocolFactory{})
+	pm.RegisterFactory(ProtocolVLESS, &VLESSProtocolFactory{})
+
+	schema, err := pm.Schema(ProtocolTrojan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	for _, key := range []string{"server", "port", "password", "network", "dialer-proxy"} {
+		if _, ok := properties[key]; !ok {
+			t.Fatalf("trojan schema has no %s property", key)
+		}
+	}
+	if capabilities := schema["x-capabilities"].(ProtocolCapabilities); !capabilities.Implemented {
+		t.Fatal("trojan schema reports protocol as unimplemented")
+	}
+
+	// 尚未实现的协议既不能创建，也不提供Schema
+	for _, protocolType := range []ProtocolType{ProtocolVMess, ProtocolVLESS} {
+		if _, err := pm.Schema(protocolType); !errors.Is(err, ErrProtocolNotImplemented) {
+			t.Fatalf("%s schema error = %v, want ErrProtocolNotImplemented", protocolType, err)
+		}
+		config := map[string]interface{}{"server": "127.0.0.1", "port": 443, "uuid": "b831381d-6324-4d53-ad4f-8cda48b30811"}
+		if _, err := pm.CreateProtocol(protocolType, string(protocolType), config); !errors.Is(err, ErrProtocolNotImplemented) {
+			t.Fatalf("%s create error = %v, want ErrProtocolNotImplemented", protocolType, err)
+		}
+	}
+
+	if _, err := pm.Schema("unknown"); err == nil || errors.Is(err, ErrProtocolNotImplemented) {
+		t.Fatalf("unknown schema error = %v", err)
+	}
+}
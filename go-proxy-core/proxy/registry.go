@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// protocolDrainTimeout 被替换或移除的协议等待已有连接结束的最长时间，超时后强制关闭
+	protocolDrainTimeout = 5 * time.Minute
+)
+
+// protocolEntry 协议注册项
+// 引用计数包括注册本身和经由协议建立的活动连接；协议被替换或移除后不再接受新连接，
+// 引用全部释放时关闭，保证每个实例恰好关闭一次
+type protocolEntry struct {
+	name      string
+	protocol  ProxyProtocol
+	refs      int64
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// newProtocolEntry 创建注册项，持有注册本身的引用
+func newProtocolEntry(name string, protocol ProxyProtocol) *protocolEntry {
+	return &protocolEntry{
+		name:     name,
+		protocol: protocol,
+		refs:     1,
+		closed:   make(chan struct{}),
+	}
+}
+
+// acquire 增加一个引用，返回只能调用一次的释放函数
+// 调用方需持有协议管理器的读锁，保证注册项尚未被移除
+func (e *protocolEntry) acquire() func() {
+	atomic.AddInt64(&e.refs, 1)
+	var once sync.Once
+	return func() {
+		once.Do(e.release)
+	}
+}
+
+// release 释放一个引用，最后一个引用释放时关闭协议
+func (e *protocolEntry) release() {
+	if atomic.AddInt64(&e.refs, -1) == 0 {
+		e.close()
+	}
+}
+
+// close 关闭协议，只执行一次
+func (e *protocolEntry) close() {
+	e.closeOnce.Do(func() {
+		log.Printf("关闭协议实例: name=%s, type=%s", e.name, e.protocol.Type())
+		if err := e.protocol.Close(); err != nil {
+			log.Printf("关闭协议 %s 时出错: %v", e.name, err)
+		}
+		close(e.closed)
+	})
+}
+
+// retire 释放注册本身的引用；仍有活动连接时等待连接结束，超过drainTimeout后强制关闭
+// 调用方不能持有协议管理器的锁，协议的Close可能需要访问协议管理器
+func (e *protocolEntry) retire(drainTimeout time.Duration) {
+	if active := atomic.LoadInt64(&e.refs) - 1; active > 0 {
+		log.Printf("协议 %s (%s) 已被替换或移除，等待 %d 个连接结束后关闭", e.name, e.protocol.Type(), active)
+		go func() {
+			timer := time.NewTimer(drainTimeout)
+			defer timer.Stop()
+			select {
+			case <-e.closed:
+			case <-timer.C:
+				log.Printf("协议 %s 的连接在 %s 内未结束，强制关闭", e.name, drainTimeout)
+				e.close()
+			}
+		}()
+	}
+	e.release()
+}
+
+// acquire 查找协议并增加引用计数，用完后调用返回的release
+// 协议在使用期间被替换时，已取得的实例继续可用，所有引用释放后才关闭
+func (pm *ProtocolManager) acquire(name string) (ProxyProtocol, func(), error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	entry := pm.lookupEntryLocked(name)
+	if entry == nil {
+		return nil, nil, fmt.Errorf("protocol %s not found", name)
+	}
+	return entry.protocol, entry.acquire(), nil
+}
+
+// dial 通过协议建立连接，连接关闭前协议实例不会被关闭
+func (pm *ProtocolManager) dial(ctx context.Context, name, network, address string) (net.Conn, error) {
+	protocol, release, err := pm.acquire(name)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := protocol.DialContext(ctx, network, address)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &trackedConn{Conn: conn, release: release}, nil
+}
+
+// listenPacket 通过协议建立UDP会话，会话关闭前协议实例不会被关闭
+func (pm *ProtocolManager) listenPacket(ctx context.Context, name, address string) (net.PacketConn, error) {
+	protocol, release, err := pm.acquire(name)
+	if err != nil {
+		return nil, err
+	}
+	if !protocol.SupportsUDP() {
+		release()
+		return nil, fmt.Errorf("%w: protocol %s (%s)", ErrUDPNotSupported, name, protocol.Type())
+	}
+	pc, err := protocol.ListenPacket(ctx, address)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &trackedPacketConn{PacketConn: pc, release: release}, nil
+}
+
+// Close 立即关闭所有协议，包括等待连接结束的旧实例
+func (pm *ProtocolManager) Close() {
+	pm.mu.Lock()
+	entries := make([]*protocolEntry, 0, len(pm.protocols)+len(pm.draining))
+	for _, entry := range pm.protocols {
+		entries = append(entries, entry)
+	}
+	for entry := range pm.draining {
+		entries = append(entries, entry)
+	}
+	pm.protocols = make(map[string]*protocolEntry)
+	pm.draining = make(map[*protocolEntry]struct{})
+	pm.mu.Unlock()
+
+	for _, entry := range entries {
+		entry.close()
+	}
+}
+
+// retireEntry 释放被替换或移除的注册项的注册引用
+// 调用方在持有锁时已将注册项从protocols移到draining，这里不能持有锁
+func (pm *ProtocolManager) retireEntry(entry *protocolEntry) {
+	go func() {
+		<-entry.closed
+		pm.mu.Lock()
+		delete(pm.draining, entry)
+		pm.mu.Unlock()
+	}()
+	entry.retire(pm.drainTimeout)
+}
+
+// trackedConn 关闭时释放协议引用的连接
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+// Close 关闭连接并释放协议引用
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// trackedPacketConn 关闭时释放协议引用的UDP会话
+type trackedPacketConn struct {
+	net.PacketConn
+	once    sync.Once
+	release func()
+}
+
+// Close 关闭会话并释放协议引用
+func (c *trackedPacketConn) Close() error {
+	err := c.PacketConn.Close()
+	c.once.Do(c.release)
+	return err
+}
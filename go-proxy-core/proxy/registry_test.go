@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// countingProtocol 记录关闭次数的协议
+type countingProtocol struct {
+	BaseProtocol
+	closes atomic.Int32
+}
+
+// DialContext 测试协议不建立连接
+func (p *countingProtocol) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+// Connect 测试协议不建立连接
+func (p *countingProtocol) Connect(targetAddr string) (net.Conn, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+// Close 记录关闭次数
+func (p *countingProtocol) Close() error {
+	p.closes.Add(1)
+	return nil
+}
+
+// countingProtocolFactory 创建countingProtocol并保存所有实例
+type countingProtocolFactory struct {
+	mu        sync.Mutex
+	protocols []*countingProtocol
+}
+
+// Capabilities 测试协议声明为已实现
+func (f *countingProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true}
+}
+
+// Config 测试协议没有配置项
+func (f *countingProtocolFactory) Config() interface{} {
+	return &struct{}{}
+}
+
+// CreateProtocol 创建并记录测试协议实例
+func (f *countingProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	protocol := &countingProtocol{BaseProtocol: BaseProtocol{name: fmt.Sprint(config["name"]), protocolType: "counting"}}
+	f.protocols = append(f.protocols, protocol)
+	return protocol, nil
+}
+
+// registeredEntry 返回当前以name注册的注册项
+func registeredEntry(t *testing.T, pm *ProtocolManager, name string) *protocolEntry {
+	t.Helper()
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	entry := pm.protocols[name]
+	if entry == nil {
+		t.Fatalf("protocol %s not registered", name)
+	}
+	return entry
+}
+
+// isClosed 注册项的协议是否已经关闭
+func isClosed(entry *protocolEntry) bool {
+	select {
+	case <-entry.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitClosed 等待注册项的协议关闭
+func waitClosed(t *testing.T, entry *protocolEntry, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-entry.closed:
+	case <-time.After(timeout):
+		t.Fatalf("protocol %s not closed after %s", entry.name, timeout)
+	}
+}
+
+// drainingCount 返回等待连接结束的旧实例数量
+func drainingCount(pm *ProtocolManager) int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return len(pm.draining)
+}
+
+func TestProtocolGracefulSwap(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	old, replacement := startTestProxy(t), startTestProxy(t)
+	pm := newGroupTestManager()
+	defer pm.Close()
+
+	addTestMember(t, pm, "p", old)
+	oldEntry := registeredEntry(t, pm, "p")
+	conn, err := pm.dial(context.Background(), "p", "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, conn, []byte("before swap"))
+
+	// 替换后已有连接继续使用旧实例，新连接使用新实例
+	addTestMember(t, pm, "p", replacement)
+	if isClosed(oldEntry) || drainingCount(pm) != 1 {
+		t.Fatal("old instance closed while a connection is still active")
+	}
+	testutil.Echo(t, conn, []byte("after swap"))
+	newConn, err := pm.dial(context.Background(), "p", "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, newConn, []byte("new instance"))
+	if old.accepted.Load() != 1 || replacement.accepted.Load() != 1 {
+		t.Fatalf("accepted = %v", acceptedCounts(old, replacement))
+	}
+
+	// 最后一个连接关闭后旧实例关闭并从draining中移除
+	conn.Close()
+	conn.Close()
+	waitClosed(t, oldEntry, 2*time.Second)
+	deadline := time.Now().Add(2 * time.Second)
+	for drainingCount(pm) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("old instance still draining after it was closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	newEntry := registeredEntry(t, pm, "p")
+	newConn.Close()
+	if isClosed(newEntry) {
+		t.Fatal("registered instance closed when its connection ended")
+	}
+
+	// 没有活动连接时移除立即关闭
+	pm.RemoveProtocol("p")
+	waitClosed(t, newEntry, time.Second)
+}
+
+func TestProtocolDrainTimeout(t *testing.T) {
+	factory := &countingProtocolFactory{}
+	pm := NewProtocolManager()
+	pm.drainTimeout = 100 * time.Millisecond
+	pm.RegisterFactory("counting", factory)
+	if _, err := pm.CreateProtocol("counting", "p", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	entry := registeredEntry(t, pm, "p")
+	_, release, err := pm.acquire("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 连接一直不结束时超时后强制关闭
+	start := time.Now()
+	pm.RemoveProtocol("p")
+	if isClosed(entry) {
+		t.Fatal("protocol closed before the drain timeout")
+	}
+	waitClosed(t, entry, 2*time.Second)
+	if elapsed := time.Since(start); elapsed < pm.drainTimeout {
+		t.Fatalf("closed after %s, before the drain timeout", elapsed)
+	}
+
+	// 强制关闭后释放引用不会再次关闭
+	release()
+	release()
+	if closes := factory.protocols[0].closes.Load(); closes != 1 {
+		t.Fatalf("protocol closed %d times", closes)
+	}
+}
+
+func TestProtocolCloseOnce(t *testing.T) {
+	factory := &countingProtocolFactory{}
+	pm := NewProtocolManager()
+	pm.RegisterFactory("counting", factory)
+	if _, err := pm.CreateProtocol("counting", "p", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发取得和释放引用的同时反复替换协议
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, release, err := pm.acquire("p")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				time.Sleep(time.Microsecond)
+				release()
+			}
+		}()
+	}
+	const swaps = 50
+	for i := 0; i < swaps; i++ {
+		if _, err := pm.CreateProtocol("counting", "p", map[string]interface{}{}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+	entry := registeredEntry(t, pm, "p")
+	pm.RemoveProtocol("p")
+	waitClosed(t, entry, time.Second)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for drainingCount(pm) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d instances still draining", drainingCount(pm))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	if len(factory.protocols) != swaps+1 {
+		t.Fatalf("created %d protocols, want %d", len(factory.protocols), swaps+1)
+	}
+	for i, protocol := range factory.protocols {
+		if closes := protocol.closes.Load(); closes != 1 {
+			t.Errorf("protocol %d closed %d times", i, closes)
+		}
+	}
+}
+
+func TestSetCurrentProxyRegistersSource(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	a, b := startTestProxy(t), startTestProxy(t)
+	pc := NewProxyCore(&config.Config{})
+	if err := pc.AddProxySource(&ProxySource{
+		ID:      "source",
+		Config:  map[string]interface{}{},
+		Proxies: map[string]*ProxyInfo{"a": a.info("a"), "b": b.info("b")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("source")
+	pm := pc.protocolManager
+
+	if err := pc.SetCurrentProxy("source", pc.GetProxy("source", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if pm.GetProtocol("source") == nil {
+		t.Fatal("current proxy not registered under the proxy source ID")
+	}
+	for _, name := range []string{"a", "b"} {
+		if pm.GetProtocol(name) != nil {
+			t.Fatalf("current proxy registered under the proxy ID %s", name)
+		}
+	}
+	conn, err := pm.dial(context.Background(), "source", "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	testutil.Echo(t, conn, []byte("proxy a"))
+
+	// 切换当前代理不影响已有连接
+	if err := pc.SetCurrentProxy("source", pc.GetProxy("source", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if current := pc.GetCurrentProxy("source"); current == nil || current.ID != "b" {
+		t.Fatalf("current proxy = %+v", current)
+	}
+	testutil.Echo(t, conn, []byte("still proxy a"))
+	newConn, err := pm.dial(context.Background(), "source", "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newConn.Close()
+	testutil.Echo(t, newConn, []byte("proxy b"))
+	if a.accepted.Load() != 1 || b.accepted.Load() != 1 {
+		t.Fatalf("accepted = %v", acceptedCounts(a, b))
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// ruleTarget 规则目标中的一项
+type ruleTarget struct {
+	name    string
+	timeout time.Duration
+}
+
+// parseRuleTargets 解析规则的proxy_source，多个目标用逗号分隔并按顺序尝试
+// 每个目标可以用@指定连接超时，例如"openvpn-source@3s, clash, DIRECT"，未指定时使用defaultTimeout
+func parseRuleTargets(proxySource string, defaultTimeout time.Duration) []ruleTarget {
+	var targets []ruleTarget
+	for _, item := range strings.Split(proxySource, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		target := ruleTarget{name: item, timeout: defaultTimeout}
+		if i := strings.LastIndex(item, "@"); i > 0 {
+			timeout, err := time.ParseDuration(strings.TrimSpace(item[i+1:]))
+			if err != nil || timeout <= 0 {
+				log.Printf("规则目标 %s 的超时时间无效，使用默认值 %s", item, defaultTimeout)
+			} else {
+				target.timeout = timeout
+			}
+			target.name = strings.TrimSpace(item[:i])
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// isDirectTarget 规则目标是否为直连
+func isDirectTarget(name string) bool {
+	return strings.EqualFold(name, "DIRECT")
+}
+
+// statsSourceName 返回规则目标对应的统计收集器名称，直连统一使用DIRECT
+func statsSourceName(name string) string {
+	if isDirectTarget(name) {
+		return "DIRECT"
+	}
+	return name
+}
+
+// connectAttempt 一次连接尝试的记录
+type connectAttempt struct {
+	target  string
+	timeout time.Duration
+	elapsed time.Duration
+	err     error
+}
+
+// String 返回用于连接日志的描述
+func (a connectAttempt) String() string {
+	if a.err != nil {
+		return fmt.Sprintf("%s(timeout=%s) failed after %s: %v", a.target, a.timeout, a.elapsed.Round(time.Millisecond), a.err)
+	}
+	return fmt.Sprintf("%s(timeout=%s) ok in %s", a.target, a.timeout, a.elapsed.Round(time.Millisecond))
+}
+
+// dialRuleTargets 按顺序尝试规则的各个目标，返回第一个成功的连接和实际使用的目标
+// 每次尝试的结果计入对应代理源的故障切换统计，有多个目标时在日志中输出尝试记录
+func (pc *ProxyCore) dialRuleTargets(pm *ProtocolManager, proxySource, network, targetAddr string) (net.Conn, string, error) {
+	targets := parseRuleTargets(proxySource, pc.connectTimeout())
+	if len(targets) == 0 {
+		return nil, "", fmt.Errorf("empty proxy source")
+	}
+
+	attempts := make([]connectAttempt, 0, len(targets))
+	defer func() {
+		if len(targets) > 1 {
+			records := make([]string, len(attempts))
+			for i, attempt := range attempts {
+				records[i] = attempt.String()
+			}
+			log.Printf("连接 %s 的尝试记录 [%s]: %s", targetAddr, proxySource, strings.Join(records, "; "))
+		}
+	}()
+
+	var lastErr error
+	for _, target := range targets {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), target.timeout)
+		conn, err := pm.DialContext(ctx, target.name, network, targetAddr)
+		cancel()
+		attempts = append(attempts, connectAttempt{target: target.name, timeout: target.timeout, elapsed: time.Since(start), err: err})
+		pc.reportConnectResult(target.name, err)
+		if err == nil {
+			return conn, target.name, nil
+		}
+		lastErr = err
+	}
+	if len(targets) > 1 {
+		return nil, "", fmt.Errorf("all %d targets failed, last error: %v", len(targets), lastErr)
+	}
+	return nil, "", lastErr
+}
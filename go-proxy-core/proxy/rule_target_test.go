@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+func TestParseRuleTargets(t *testing.T) {
+	const def = 10 * time.Second
+	for _, tc := range []struct {
+		input string
+		want  []ruleTarget
+	}{
+		{"a@3s, b, DIRECT", []ruleTarget{{"a", 3 * time.Second}, {"b", def}, {"DIRECT", def}}},
+		{" a @ 500ms ", []ruleTarget{{"a", 500 * time.Millisecond}}},
+		// 无效的超时时间使用默认值，但名称中不保留@部分
+		{"a@soon", []ruleTarget{{"a", def}}},
+		{"a@-1s", []ruleTarget{{"a", def}}},
+		{"a@0s", []ruleTarget{{"a", def}}},
+		{"a@", []ruleTarget{{"a", def}}},
+		// 只按最后一个@拆分，@开头的不视为超时
+		{"user@host@2s", []ruleTarget{{"user@host", 2 * time.Second}}},
+		{"@3s", []ruleTarget{{"@3s", def}}},
+		// 跳过空项
+		{",, a ,,", []ruleTarget{{"a", def}}},
+		{"", nil},
+		{" , ", nil},
+	} {
+		if got := parseRuleTargets(tc.input, def); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseRuleTargets(%q) = %+v, want %+v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestDialRuleTargets(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	dead, slow, good := startTestProxy(t), startTestProxy(t), startTestProxy(t)
+	dead.down.Store(true)
+	slow.delay.Store(int64(2 * time.Second))
+	pc := NewProxyCore(&config.Config{})
+	pm := pc.protocolManager
+	addTestMember(t, pm, "dead", dead)
+	addTestMember(t, pm, "slow", slow)
+	addTestMember(t, pm, "good", good)
+	defer func() {
+		for _, name := range []string{"dead", "slow", "good"} {
+			pm.RemoveProtocol(name)
+		}
+	}()
+
+	// 按顺序尝试，慢的目标在自己的超时后放弃
+	start := time.Now()
+	conn, used, err := pc.dialRuleTargets(pm, "dead, slow@200ms, good", "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, conn, []byte("rule target"))
+	conn.Close()
+	if used != "good" {
+		t.Fatalf("used target = %s, want good", used)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("fallback took %s", elapsed)
+	}
+	if counts := acceptedCounts(dead, slow, good); !reflect.DeepEqual(counts, []int32{1, 1, 1}) {
+		t.Fatalf("accepted = %v", counts)
+	}
+
+	// 成功后不再尝试后面的目标
+	conn, used, err = pc.dialRuleTargets(pm, "good, dead", "tcp", target)
+	if err != nil || used != "good" {
+		t.Fatalf("used = %s, err = %v", used, err)
+	}
+	conn.Close()
+	if dead.accepted.Load() != 1 {
+		t.Fatal("tried a target after a successful one")
+	}
+
+	// 直连目标不区分大小写
+	conn, used, err = pc.dialRuleTargets(pm, "dead, direct", "tcp", target)
+	if err != nil || used != "direct" {
+		t.Fatalf("used = %s, err = %v", used, err)
+	}
+	testutil.Echo(t, conn, []byte("direct"))
+	conn.Close()
+
+	start = time.Now()
+	if _, _, err := pc.dialRuleTargets(pm, "dead, slow@100ms", "tcp", target); err == nil || !strings.Contains(err.Error(), "all 2 targets failed") {
+		t.Fatalf("all targets failing: err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("failing targets took %s", elapsed)
+	}
+
+	// 只有一个目标时直接返回它的错误
+	if _, _, err := pc.dialRuleTargets(pm, "missing", "tcp", target); err == nil || strings.Contains(err.Error(), "targets failed") {
+		t.Fatalf("single target: err = %v", err)
+	}
+
+	for _, proxySource := range []string{"", " , "} {
+		if _, _, err := pc.dialRuleTargets(pm, proxySource, "tcp", target); err == nil || err.Error() != "empty proxy source" {
+			t.Fatalf("%q: err = %v", proxySource, err)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"strconv"
-	"time"
 
+	"github.com/dualvpn/go-proxy-core/mux"
 	"github.com/shadowsocks/go-shadowsocks2/core"
 	"github.com/shadowsocks/go-shadowsocks2/socks"
 )
@@ -19,53 +20,46 @@ type ShadowsocksProtocol struct {
 	password string
 	method   string // 加密方法
 	cipher   core.Cipher
+	udp      bool        // 是否启用UDP转发
+	mux      *mux.Client // 多路复用客户端，未启用时为nil
 }
 
 // ShadowsocksProtocolFactory Shadowsocks协议工厂
 type ShadowsocksProtocolFactory struct{}
 
+// Capabilities 返回Shadowsocks协议支持的能力
+func (f *ShadowsocksProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true, Note: "udp can be disabled with udp: false"}
+}
+
+// ShadowsocksConfig Shadowsocks协议配置
+type ShadowsocksConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Password string `config:"password" desc:"密码"`
+	Method   string `config:"method,cipher" default:"CHACHA20-IETF-POLY1305" desc:"加密方法"`
+	UDP      bool   `config:"udp" default:"true" desc:"启用UDP转发，服务器未开启UDP时关闭"`
+	MuxOptions
+}
+
+// Config 返回Shadowsocks协议的配置结构
+func (f *ShadowsocksProtocolFactory) Config() interface{} {
+	return &ShadowsocksConfig{}
+}
+
 // CreateProtocol 创建Shadowsocks协议实例
 func (f *ShadowsocksProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
-	}
-
-	var port int
-	switch v := config["port"].(type) {
-	case int:
-		port = v
-	case float64:
-		port = int(v)
-	case string:
-		var err error
-		port, err = strconv.Atoi(v)
-		if err != nil {
-			return nil, fmt.Errorf("invalid port format: %v", err)
-		}
-	default:
-		return nil, fmt.Errorf("missing or invalid port in config")
+	var cfg ShadowsocksConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port, password, method, udp := cfg.Server, cfg.Port, cfg.Password, cfg.Method, cfg.UDP
 
-	password, _ := config["password"].(string)
-	method, _ := config["method"].(string)
-	cipherStr, _ := config["cipher"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("shadowsocks-%s:%d", server, port)
 	}
 
-	// 优先使用method，如果没有则使用cipher
-	if method == "" && cipherStr != "" {
-		method = cipherStr
-	}
-
-	// 如果method仍然为空，使用默认值
-	if method == "" {
-		method = "CHACHA20-IETF-POLY1305" // 默认加密方法
-	}
-
 	// 创建加密器
 	cipher, err := core.PickCipher(method, nil, password)
 	if err != nil {
@@ -82,25 +76,52 @@ func (f *ShadowsocksProtocolFactory) CreateProtocol(config map[string]interface{
 		password: password,
 		method:   method,
 		cipher:   cipher,
+		udp:      udp,
+	}
+
+	protocol.mux, err = newMuxClient(cfg.MuxOptions, protocol.dialTCP)
+	if err != nil {
+		return nil, err
 	}
 
 	// 添加日志以调试Shadowsocks协议创建
-	log.Printf("创建Shadowsocks协议: server=%s, port=%d, method=%s, password=%s", server, port, method, password)
+	log.Printf("创建Shadowsocks协议: server=%s, port=%d, method=%s, password=%s, udp=%t", server, port, method, password, udp)
 
 	return protocol, nil
 }
 
 // Connect 连接到目标地址（通过Shadowsocks）
 func (sp *ShadowsocksProtocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(sp, targetAddr)
+}
+
+// DialContext 连接到目标地址，tcp使用加密流，udp使用加密数据报
+func (sp *ShadowsocksProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return dialPacketConn(ctx, sp, targetAddr)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	if sp.mux != nil {
+		return sp.mux.DialContext(ctx, targetAddr)
+	}
+	return sp.dialTCP(ctx, network, targetAddr)
+}
+
+// dialTCP 建立到Shadowsocks服务器的加密连接并发送目标地址
+func (sp *ShadowsocksProtocol) dialTCP(ctx context.Context, network, targetAddr string) (net.Conn, error) {
 	// 添加详细的连接日志
 	log.Printf("Shadowsocks协议开始连接: targetAddr=%s, server=%s, port=%d, method=%s",
 		targetAddr, sp.server, sp.port, sp.method)
 
 	// 连接到Shadowsocks服务器
-	ssAddr := fmt.Sprintf("%s:%d", sp.server, sp.port)
+	ssAddr := net.JoinHostPort(sp.server, strconv.Itoa(sp.port))
 	log.Printf("连接到Shadowsocks服务器地址: %s", ssAddr)
 
-	conn, err := net.DialTimeout("tcp", ssAddr, 5*time.Second)
+	conn, err := sp.dial(ctx, "tcp", ssAddr)
 	if err != nil {
 		log.Printf("连接Shadowsocks服务器失败: %v", err)
 		return nil, fmt.Errorf("failed to connect to Shadowsocks server %s: %v", ssAddr, err)
@@ -133,9 +154,35 @@ func (sp *ShadowsocksProtocol) Connect(targetAddr string) (net.Conn, error) {
 	return conn, nil
 }
 
+// ListenPacket 建立到Shadowsocks服务器的UDP会话
+// 每个数据报前带有目标地址，经由前置代理时要求前置代理支持UDP
+func (sp *ShadowsocksProtocol) ListenPacket(ctx context.Context, targetAddr string) (net.PacketConn, error) {
+	if !sp.udp {
+		return nil, fmt.Errorf("%w: udp is disabled for %s", ErrUDPNotSupported, sp.name)
+	}
+
+	ssAddr := net.JoinHostPort(sp.server, strconv.Itoa(sp.port))
+	log.Printf("Shadowsocks协议建立UDP转发: server=%s", ssAddr)
+
+	conn, err := sp.dial(ctx, "udp", ssAddr)
+	if err != nil {
+		log.Printf("连接Shadowsocks服务器UDP端口失败: %v", err)
+		return nil, fmt.Errorf("failed to connect to Shadowsocks server %s over udp: %v", ssAddr, err)
+	}
+
+	return &shadowsocksPacketConn{PacketConn: sp.cipher.PacketConn(&connPacketConn{Conn: conn})}, nil
+}
+
+// SupportsUDP 返回是否启用了UDP转发
+func (sp *ShadowsocksProtocol) SupportsUDP() bool {
+	return sp.udp
+}
+
 // Close 关闭连接
 func (sp *ShadowsocksProtocol) Close() error {
-	// Shadowsocks协议关闭逻辑
+	if sp.mux != nil {
+		return sp.mux.Close()
+	}
 	return nil
 }
 
@@ -144,3 +191,41 @@ func (sp *ShadowsocksProtocol) IsRunning() bool {
 	// Shadowsocks协议运行状态检查
 	return true
 }
+
+// shadowsocksPacketConn 在加密数据报中添加和解析目标地址
+type shadowsocksPacketConn struct {
+	net.PacketConn
+}
+
+// ReadFrom 读取一个数据报，返回的地址为数据报中携带的来源地址
+func (pc *shadowsocksPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := pc.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		addr := socks.SplitAddr(buf[:n])
+		if addr == nil {
+			// 忽略无法解析的数据报
+			continue
+		}
+		return copy(b, buf[len(addr):n]), packetAddr(addr.String()), nil
+	}
+}
+
+// WriteTo 向目标地址发送一个数据报
+func (pc *shadowsocksPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	target := socks.ParseAddr(addr.String())
+	if target == nil {
+		return 0, fmt.Errorf("failed to parse target address: %s", addr)
+	}
+
+	packet := make([]byte, 0, len(target)+len(b))
+	packet = append(packet, target...)
+	packet = append(packet, b...)
+	if _, err := pc.PacketConn.WriteTo(packet, nil); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
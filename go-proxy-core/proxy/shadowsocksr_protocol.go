@@ -1,9 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"time"
+	"strconv"
 )
 
 // ShadowsocksRProtocol ShadowsocksR协议实现
@@ -22,42 +23,41 @@ type ShadowsocksRProtocol struct {
 // ShadowsocksRProtocolFactory ShadowsocksR协议工厂
 type ShadowsocksRProtocolFactory struct{}
 
+// Capabilities ShadowsocksR协议尚未实现握手，不能创建
+func (f *ShadowsocksRProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// ShadowsocksRConfig ShadowsocksR协议配置
+type ShadowsocksRConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Password      string `config:"password" desc:"密码"`
+	Method        string `config:"method,cipher" default:"AES-256-GCM" desc:"加密方法"`
+	Protocol      string `config:"protocol" default:"origin" desc:"协议插件"`
+	ProtocolParam string `config:"protocol_param,protocol-param" desc:"协议插件参数"`
+	Obfs          string `config:"obfs" default:"plain" desc:"混淆插件"`
+	ObfsParam     string `config:"obfs_param,obfs-param" desc:"混淆插件参数"`
+}
+
+// Config 返回ShadowsocksR协议的配置结构
+func (f *ShadowsocksRProtocolFactory) Config() interface{} {
+	return &ShadowsocksRConfig{}
+}
+
 // CreateProtocol 创建ShadowsocksR协议实例
 func (f *ShadowsocksRProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
-	}
-
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
+	var cfg ShadowsocksRConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	password, _ := config["password"].(string)
-	method, _ := config["method"].(string)
-	protocol, _ := config["protocol"].(string)
-	obfs, _ := config["obfs"].(string)
-	protocolParam, _ := config["protocol_param"].(string)
-	obfsParam, _ := config["obfs_param"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("shadowsocksr-%s:%d", server, port)
 	}
 
-	if method == "" {
-		method = "AES-256-GCM" // 默认加密方法
-	}
-
-	if protocol == "" {
-		protocol = "origin" // 默认协议插件
-	}
-
-	if obfs == "" {
-		obfs = "plain" // 默认混淆插件
-	}
-
 	protocolInstance := &ShadowsocksRProtocol{
 		BaseProtocol: BaseProtocol{
 			name:         name,
@@ -65,22 +65,27 @@ func (f *ShadowsocksRProtocolFactory) CreateProtocol(config map[string]interface
 		},
 		server:        server,
 		port:          port,
-		password:      password,
-		method:        method,
-		protocol:      protocol,
-		obfs:          obfs,
-		protocolParam: protocolParam,
-		obfsParam:     obfsParam,
+		password:      cfg.Password,
+		method:        cfg.Method,
+		protocol:      cfg.Protocol,
+		obfs:          cfg.Obfs,
+		protocolParam: cfg.ProtocolParam,
+		obfsParam:     cfg.ObfsParam,
 	}
 
 	return protocolInstance, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (srp *ShadowsocksRProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, srp.Connect)
+}
+
 // Connect 连接到目标地址（通过ShadowsocksR）
 func (srp *ShadowsocksRProtocol) Connect(targetAddr string) (net.Conn, error) {
 	// 连接到ShadowsocksR服务器
-	ssrAddr := fmt.Sprintf("%s:%d", srp.server, srp.port)
-	conn, err := net.DialTimeout("tcp", ssrAddr, 5*time.Second)
+	ssrAddr := net.JoinHostPort(srp.server, strconv.Itoa(srp.port))
+	conn, err := srp.dialTimeout("tcp", ssrAddr, DefaultConnectTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to ShadowsocksR server %s: %v", ssrAddr, err)
 	}
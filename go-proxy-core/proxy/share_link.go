@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/dualvpn/go-proxy-core/sharelink"
+)
+
+// ShareLink 生成代理的分享链接，协议不支持分享链接或缺少必要配置时返回错误
+func (p *ProxyInfo) ShareLink() (string, error) {
+	return sharelink.Generate(&sharelink.Node{
+		Name:   p.Name,
+		Type:   string(p.Type),
+		Server: p.Server,
+		Port:   p.Port,
+		Config: p.Config,
+	})
+}
+
+// ParseShareLinks 解析多行（可以是base64编码的）分享链接，无法解析的链接放在errs中返回
+func ParseShareLinks(text string) (proxies []*ProxyInfo, errs []error) {
+	nodes, errs := sharelink.ParseList(text)
+	for _, node := range nodes {
+		proxies = append(proxies, proxyInfoFromNode(node))
+	}
+	return proxies, errs
+}
+
+// ImportShareLinks 解析分享链接并添加到代理源的代理列表，返回导入的代理和无法解析的链接
+// 与已有代理重名时在名称后加序号；配置了订阅的代理源在下次更新订阅时会替换导入的代理
+func (pc *ProxyCore) ImportShareLinks(sourceId string, text string) ([]*ProxyInfo, []error, error) {
+	imported, errs := ParseShareLinks(text)
+	if len(imported) == 0 {
+		return nil, errs, fmt.Errorf("no valid share link")
+	}
+
+	pc.proxySourceMu.Lock()
+	defer pc.proxySourceMu.Unlock()
+
+	source, exists := pc.proxySources[sourceId]
+	if !exists {
+		return nil, errs, fmt.Errorf("proxy source %s not found", sourceId)
+	}
+
+	// 复制代理列表后再替换，读取旧列表的调用方不受影响
+	proxies := make(map[string]*ProxyInfo, len(source.Proxies)+len(imported))
+	names := make(map[string]bool, len(source.Proxies)+len(imported))
+	for pid, proxy := range source.Proxies {
+		proxies[pid] = proxy
+		names[proxy.Name] = true
+	}
+	for _, proxy := range imported {
+		name := proxy.Name
+		for i := 2; names[name] || proxies[proxyIDFromName(name)] != nil; i++ {
+			name = fmt.Sprintf("%s %d", proxy.Name, i)
+		}
+		names[name] = true
+		proxy.Name = name
+		proxy.ID = proxyIDFromName(name)
+		proxies[proxy.ID] = proxy
+	}
+	source.Proxies = proxies
+	return imported, errs, nil
+}
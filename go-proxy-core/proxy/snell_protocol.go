@@ -1,9 +1,14 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net"
+	"strconv"
 	"time"
+
+	"github.com/dualvpn/go-proxy-core/snell"
 )
 
 // SnellProtocol Snell协议实现
@@ -12,36 +17,71 @@ type SnellProtocol struct {
 	server   string
 	port     int
 	password string
-	version  string // 协议版本
+	version  int    // 协议版本
+	obfs     string // 混淆模式: http/tls
+	obfsHost string // 混淆域名
+	reuse    bool   // 是否复用连接
+	client   *snell.Client
 }
 
 // SnellProtocolFactory Snell协议工厂
 type SnellProtocolFactory struct{}
 
+// Capabilities 返回Snell协议支持的能力
+func (f *SnellProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true}
+}
+
+// SnellConfig Snell协议配置，兼容Clash的psk和obfs-opts字段
+type SnellConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	PSK         string                 `config:"psk,password" required:"true" desc:"预共享密钥"`
+	Version     int                    `config:"version" default:"3" min:"1" max:"3" desc:"协议版本"`
+	Obfs        string                 `config:"obfs" enum:"none,http,tls" desc:"混淆方式"`
+	ObfsHost    string                 `config:"obfs_host" desc:"混淆使用的主机名，默认bing.com"`
+	ObfsOpts    map[string]interface{} `config:"obfs-opts,obfs_opts" desc:"Clash写法的混淆配置: mode, host"`
+	Reuse       bool                   `config:"reuse" default:"true" desc:"复用到服务器的连接"`
+	KeepAlive   int                    `config:"keepalive" default:"30" min:"0" desc:"TCP保活间隔（秒）"`
+	IdleTimeout int                    `config:"idle_timeout,idle-timeout" default:"30" min:"1" desc:"复用连接的空闲保留时间（秒）"`
+}
+
+// Config 返回Snell协议的配置结构
+func (f *SnellProtocolFactory) Config() interface{} {
+	return &SnellConfig{}
+}
+
 // CreateProtocol 创建Snell协议实例
 func (f *SnellProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg SnellConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port, password, version := cfg.Server, cfg.Port, cfg.PSK, cfg.Version
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
+	// 混淆配置，支持扁平字段和Clash的obfs-opts结构
+	obfs, obfsHost := cfg.Obfs, cfg.ObfsHost
+	if mode := configString(cfg.ObfsOpts, "mode"); mode != "" {
+		obfs = mode
+	}
+	if host := configString(cfg.ObfsOpts, "host"); host != "" {
+		obfsHost = host
+	}
+	if obfs == "none" {
+		obfs = ""
+	}
+	if obfs != "" && obfsHost == "" {
+		obfsHost = "bing.com"
 	}
 
-	password, _ := config["password"].(string)
-	version, _ := config["version"].(string)
-	name, _ := config["name"].(string)
+	reuse := cfg.Reuse
+	keepAlive := time.Duration(cfg.KeepAlive) * time.Second
 
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("snell-%s:%d", server, port)
 	}
 
-	if version == "" {
-		version = "3" // 默认版本
-	}
-
 	protocol := &SnellProtocol{
 		BaseProtocol: BaseProtocol{
 			name:         name,
@@ -51,30 +91,58 @@ func (f *SnellProtocolFactory) CreateProtocol(config map[string]interface{}) (Pr
 		port:     port,
 		password: password,
 		version:  version,
+		obfs:     obfs,
+		obfsHost: obfsHost,
+		reuse:    reuse,
 	}
 
+	client, err := snell.NewClient(snell.ClientConfig{
+		Server:      net.JoinHostPort(server, strconv.Itoa(port)),
+		PSK:         password,
+		Version:     version,
+		Obfs:        obfs,
+		ObfsHost:    obfsHost,
+		Reuse:       reuse,
+		KeepAlive:   keepAlive,
+		IdleTimeout: time.Duration(cfg.IdleTimeout) * time.Second,
+		Timeout:     DefaultConnectTimeout,
+		DialContext: protocol.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol.client = client
+
+	// 添加日志以调试Snell协议创建
+	log.Printf("创建Snell协议: server=%s, port=%d, version=%d, obfs=%s, reuse=%t", server, port, version, obfs, reuse)
+
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (sp *SnellProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, sp.Connect)
+}
+
 // Connect 连接到目标地址（通过Snell）
 func (sp *SnellProtocol) Connect(targetAddr string) (net.Conn, error) {
-	// 连接到Snell服务器
-	snellAddr := fmt.Sprintf("%s:%d", sp.server, sp.port)
-	conn, err := net.DialTimeout("tcp", snellAddr, 5*time.Second)
+	log.Printf("Snell协议开始连接: targetAddr=%s, server=%s, port=%d", targetAddr, sp.server, sp.port)
+
+	conn, err := sp.client.Dial(targetAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Snell server %s: %v", snellAddr, err)
+		log.Printf("通过Snell服务器连接目标失败: %v", err)
+		return nil, err
 	}
 
-	// TODO: 实现Snell协议握手逻辑
-	// 这里简化实现，直接返回连接
-
+	log.Printf("Snell协议成功连接到目标: %s 通过服务器: %s:%d", targetAddr, sp.server, sp.port)
 	return conn, nil
 }
 
 // Close 关闭连接
 func (sp *SnellProtocol) Close() error {
-	// Snell协议关闭逻辑
-	return nil
+	// 关闭复用连接池中的空闲连接
+	return sp.client.Close()
 }
 
 // IsRunning 检查协议是否正在运行
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// SocketOptions 出站套接字选项
+// OpenVPN推送路由后，直连流量也可能进入隧道；绑定网卡、源地址或fwmark后，
+// 连接从指定的网卡出站，不受路由表影响
+type SocketOptions struct {
+	Interface   string // 绑定的网卡名称，Linux使用SO_BINDTODEVICE，macOS使用IP_BOUND_IF
+	SourceAddr  net.IP // 本地源地址
+	RoutingMark int    // Linux的SO_MARK，配合策略路由使用
+}
+
+// parseSocketOptions 读取套接字选项，兼容Clash的interface-name和routing-mark字段
+func parseSocketOptions(config map[string]interface{}) (SocketOptions, error) {
+	var dialOptions DialOptions
+	if err := decodeConfig(config, &dialOptions); err != nil {
+		return SocketOptions{}, err
+	}
+	options := SocketOptions{
+		Interface:   strings.TrimSpace(dialOptions.Interface),
+		RoutingMark: dialOptions.RoutingMark,
+	}
+	if source := strings.TrimSpace(dialOptions.SourceAddress); source != "" {
+		options.SourceAddr = net.ParseIP(source)
+		if options.SourceAddr == nil {
+			return options, fmt.Errorf("invalid source address: %s", source)
+		}
+	}
+	return options, nil
+}
+
+// isZero 是否没有配置任何选项
+func (o SocketOptions) isZero() bool {
+	return o.Interface == "" && o.SourceAddr == nil && o.RoutingMark == 0
+}
+
+// String 返回用于日志的描述
+func (o SocketOptions) String() string {
+	return fmt.Sprintf("interface=%s, source=%v, mark=%d", o.Interface, o.SourceAddr, o.RoutingMark)
+}
+
+// control 在套接字连接或绑定前设置选项
+func (o SocketOptions) control(network, address string, c syscall.RawConn) error {
+	var err error
+	if controlErr := c.Control(func(fd uintptr) {
+		err = setSocketOptions(fd, network, o)
+	}); controlErr != nil {
+		return controlErr
+	}
+	return err
+}
+
+// localAddr 返回与网络类型匹配的本地地址
+func (o SocketOptions) localAddr(network string) net.Addr {
+	if o.SourceAddr == nil {
+		return nil
+	}
+	switch network {
+	case "udp", "udp4", "udp6":
+		return &net.UDPAddr{IP: o.SourceAddr}
+	default:
+		return &net.TCPAddr{IP: o.SourceAddr}
+	}
+}
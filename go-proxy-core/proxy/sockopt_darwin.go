@@ -0,0 +1,36 @@
+//go:build darwin
+// +build darwin
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketOptions 使用IP_BOUND_IF/IPV6_BOUND_IF绑定网卡，macOS不支持fwmark
+func setSocketOptions(fd uintptr, network string, options SocketOptions) error {
+	if options.RoutingMark != 0 {
+		return fmt.Errorf("routing mark is not supported on darwin")
+	}
+	if options.Interface == "" {
+		return nil
+	}
+
+	iface, err := net.InterfaceByName(options.Interface)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %v", options.Interface, err)
+	}
+	switch network {
+	case "tcp6", "udp6":
+		err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, iface.Index)
+	default:
+		err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, iface.Index)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind to interface %s: %v", options.Interface, err)
+	}
+	return nil
+}
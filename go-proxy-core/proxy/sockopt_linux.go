@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package proxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// setSocketOptions 设置SO_BINDTODEVICE和SO_MARK，需要CAP_NET_RAW/CAP_NET_ADMIN权限
+func setSocketOptions(fd uintptr, network string, options SocketOptions) error {
+	if options.Interface != "" {
+		if err := unix.BindToDevice(int(fd), options.Interface); err != nil {
+			return fmt.Errorf("failed to bind to interface %s: %v", options.Interface, err)
+		}
+	}
+	if options.RoutingMark != 0 {
+		if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, options.RoutingMark); err != nil {
+			return fmt.Errorf("failed to set routing mark %d: %v", options.RoutingMark, err)
+		}
+	}
+	return nil
+}
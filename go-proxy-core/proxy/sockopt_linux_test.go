@@ -0,0 +1,79 @@
+//go:build linux
+// +build linux
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// boundDevice 返回连接绑定的网卡名称
+func boundDevice(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	raw, err := conn.(syscall.Conn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var device string
+	var getErr error
+	if err := raw.Control(func(fd uintptr) {
+		device, getErr = unix.GetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	return device
+}
+
+func TestSocketOptionsBindToDevice(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	options := SocketOptions{Interface: "lo"}
+	dialer := &net.Dialer{Control: options.control}
+	conn, err := dialer.DialContext(context.Background(), "tcp", target)
+	if errors.Is(err, unix.EPERM) {
+		t.Skip("binding to an interface is not permitted")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if device := boundDevice(t, conn); device != "lo" {
+		t.Fatalf("bound to %q, want lo", device)
+	}
+	testutil.Echo(t, conn, []byte("bound to lo"))
+
+	// 协议连接服务器时使用绑定网卡的直连拨号器
+	proxy := startTestProxy(t)
+	pm := newGroupTestManager()
+	defer pm.Close()
+	config := map[string]interface{}{"server": "127.0.0.1", "port": proxy.listener.Addr().(*net.TCPAddr).Port, "interface-name": "lo"}
+	if _, err := pm.CreateProtocol(ProtocolSOCKS5, "bound", config); err != nil {
+		t.Fatal(err)
+	}
+	conn, err = pm.dial(context.Background(), "bound", "tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	testutil.Echo(t, conn, []byte("through bound proxy"))
+	if proxy.accepted.Load() != 1 {
+		t.Fatalf("proxy accepted %d connections", proxy.accepted.Load())
+	}
+
+	// 不存在的网卡在连接前报错
+	dialer = &net.Dialer{Control: SocketOptions{Interface: "no-such-if0"}.control}
+	if _, err := dialer.DialContext(context.Background(), "tcp", target); err == nil || !strings.Contains(err.Error(), "failed to bind to interface no-such-if0") {
+		t.Fatalf("unknown interface: err = %v", err)
+	}
+}
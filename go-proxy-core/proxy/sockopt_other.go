@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package proxy
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// setSocketOptions 其他平台只支持源地址，绑定网卡和fwmark返回错误
+func setSocketOptions(fd uintptr, network string, options SocketOptions) error {
+	if options.Interface != "" || options.RoutingMark != 0 {
+		return fmt.Errorf("binding interface and routing mark are not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseSocketOptions(t *testing.T) {
+	for _, tc := range []struct {
+		config map[string]interface{}
+		want   SocketOptions
+		err    string // 非空时期望错误信息包含该内容
+	}{
+		{config: map[string]interface{}{}, want: SocketOptions{}},
+		{config: map[string]interface{}{"interface-name": " eth0 ", "routing-mark": 255}, want: SocketOptions{Interface: "eth0", RoutingMark: 255}},
+		{config: map[string]interface{}{"bind_interface": "wlan0", "fwmark": 16}, want: SocketOptions{Interface: "wlan0", RoutingMark: 16}},
+		{config: map[string]interface{}{"interface": "en0", "so_mark": float64(1)}, want: SocketOptions{Interface: "en0", RoutingMark: 1}},
+		{config: map[string]interface{}{"routing_mark": "100"}, want: SocketOptions{RoutingMark: 100}},
+		{config: map[string]interface{}{"source_address": "192.0.2.1"}, want: SocketOptions{SourceAddr: net.ParseIP("192.0.2.1")}},
+		{config: map[string]interface{}{"bind-address": "2001:db8::1"}, want: SocketOptions{SourceAddr: net.ParseIP("2001:db8::1")}},
+		{config: map[string]interface{}{"routing-mark": "fast"}, err: "invalid routing-mark"},
+		{config: map[string]interface{}{"routing-mark": -1}, err: "invalid routing-mark"},
+		{config: map[string]interface{}{"source_address": "eth0"}, err: "invalid source address"},
+	} {
+		got, err := parseSocketOptions(tc.config)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("parseSocketOptions(%v): error = %v, want %q", tc.config, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSocketOptions(%v): %v", tc.config, err)
+			continue
+		}
+		if got.Interface != tc.want.Interface || got.RoutingMark != tc.want.RoutingMark || !got.SourceAddr.Equal(tc.want.SourceAddr) {
+			t.Errorf("parseSocketOptions(%v) = %s, want %s", tc.config, got, tc.want)
+		}
+		if got.isZero() != (len(tc.config) == 0) {
+			t.Errorf("parseSocketOptions(%v).isZero() = %v", tc.config, got.isZero())
+		}
+	}
+}
+
+func TestSocketOptionsLocalAddr(t *testing.T) {
+	if addr := (SocketOptions{}).localAddr("tcp"); addr != nil {
+		t.Fatalf("local address without source = %v", addr)
+	}
+	options := SocketOptions{SourceAddr: net.ParseIP("127.0.0.1")}
+	if addr, ok := options.localAddr("tcp4").(*net.TCPAddr); !ok || !addr.IP.Equal(options.SourceAddr) {
+		t.Fatalf("tcp local address = %v", options.localAddr("tcp4"))
+	}
+	if addr, ok := options.localAddr("udp").(*net.UDPAddr); !ok || !addr.IP.Equal(options.SourceAddr) {
+		t.Fatalf("udp local address = %v", options.localAddr("udp"))
+	}
+}
+
+func TestSetupDirectDialerErrors(t *testing.T) {
+	pm := newGroupTestManager()
+	defer pm.Close()
+	addTestMember(t, pm, "other", startTestProxy(t))
+	for _, tc := range []struct {
+		config map[string]interface{}
+		err    string
+	}{
+		{map[string]interface{}{"server": "127.0.0.1", "port": 1080, "routing-mark": "fast"}, "invalid routing-mark"},
+		{map[string]interface{}{"server": "127.0.0.1", "port": 1080, "source_address": "eth0"}, "invalid source address"},
+		// 套接字选项应配置在前置协议上
+		{map[string]interface{}{"server": "127.0.0.1", "port": 1080, "interface-name": "lo", "dialer-proxy": "other"}, "cannot be used together with dialer proxy"},
+	} {
+		if _, err := pm.CreateProtocol(ProtocolSOCKS5, "p", tc.config); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%v: error = %v, want %q", tc.config, err, tc.err)
+		}
+	}
+	if pm.GetProtocol("p") != nil {
+		t.Fatal("protocol registered with invalid socket options")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -194,7 +195,7 @@ func (ss *SOCKS5Server) handleConnection(clientConn net.Conn) {
 		}
 		ip := net.IP(buf[4:8])
 		port := int(buf[8])<<8 | int(buf[9])
-		targetAddr = fmt.Sprintf("%s:%d", ip.String(), port)
+		targetAddr = net.JoinHostPort(ip.String(), strconv.Itoa(port))
 	case 0x03: // 域名
 		if n < 7 {
 			log.Printf("Invalid domain address length")
@@ -207,7 +208,7 @@ func (ss *SOCKS5Server) handleConnection(clientConn net.Conn) {
 		}
 		domain := string(buf[5 : 5+domainLen])
 		port := int(buf[5+domainLen])<<8 | int(buf[5+domainLen+1])
-		targetAddr = fmt.Sprintf("%s:%d", domain, port)
+		targetAddr = net.JoinHostPort(domain, strconv.Itoa(port))
 	case 0x04: // IPv6
 		if n < 22 {
 			log.Printf("Invalid IPv6 address length")
@@ -241,8 +242,8 @@ func (ss *SOCKS5Server) handleConnection(clientConn net.Conn) {
 func (ss *SOCKS5Server) handleProxyConnection(clientConn net.Conn, targetAddr string, proxySource string) {
 	log.Printf("SOCKS5服务器通过代理源 %s 连接到目标 %s", proxySource, targetAddr)
 
-	// 使用协议管理器通过指定代理连接
-	conn, err := ss.protocolManager.Connect(proxySource, targetAddr)
+	// 使用协议管理器通过指定代理连接，规则指定了多个目标时依次尝试
+	conn, target, err := ss.proxyCore.dialRuleTargets(ss.protocolManager, proxySource, "tcp", targetAddr)
 	if err != nil {
 		log.Printf("Proxy connection to %s via %s failed: %v", targetAddr, proxySource, err)
 		// 发送连接失败响应
@@ -250,12 +251,14 @@ func (ss *SOCKS5Server) handleProxyConnection(clientConn net.Conn, targetAddr st
 		return
 	}
 	defer conn.Close()
+	// 流量计入实际使用的目标
+	statsSource := statsSourceName(target)
 
 	// 发送连接成功响应
 	clientConn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
 
 	// 创建按代理源维度的统计收集器
-	proxySourceStatsCollector := ss.proxyCore.CreateOrGetProxySourceStatsCollector(proxySource)
+	proxySourceStatsCollector := ss.proxyCore.CreateOrGetProxySourceStatsCollector(statsSource)
 
 	// 创建自定义的流量统计连接，正确区分上传和下载
 	// 客户端连接：isClientSide=true
@@ -292,7 +295,9 @@ func (ss *SOCKS5Server) handleDirectConnection(clientConn net.Conn, targetAddr s
 	log.Printf("SOCKS5服务器直接连接到目标 %s", targetAddr)
 
 	// 使用协议管理器进行直连
-	conn, err := ss.protocolManager.Connect("direct", targetAddr)
+	ctx, cancel := ss.proxyCore.connectContext()
+	conn, err := ss.protocolManager.DialContext(ctx, "direct", "tcp", targetAddr)
+	cancel()
 	if err != nil {
 		log.Printf("Error connecting to target: %v", err)
 		// 发送连接失败响应
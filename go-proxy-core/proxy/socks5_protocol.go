@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/dualvpn/go-proxy-core/socks5"
+)
+
+// SOCKS5Protocol SOCKS5上游代理实现
+type SOCKS5Protocol struct {
+	BaseProtocol
+	server   string
+	port     int
+	username string
+	client   *socks5.Client
+}
+
+// SOCKS5ProtocolFactory SOCKS5协议工厂
+type SOCKS5ProtocolFactory struct{}
+
+// Capabilities 返回SOCKS5协议支持的能力
+func (f *SOCKS5ProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true}
+}
+
+// SOCKS5Config SOCKS5协议配置
+type SOCKS5Config struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username       string `config:"username" desc:"用户名"`
+	Password       string `config:"password" desc:"密码"`
+	Resolve        string `config:"resolve" enum:"remote,local" desc:"域名解析位置，默认由服务器解析"`
+	ResolveLocally *bool  `config:"resolve_locally" desc:"在本地解析域名，优先于resolve"`
+}
+
+// Config 返回SOCKS5协议的配置结构
+func (f *SOCKS5ProtocolFactory) Config() interface{} {
+	return &SOCKS5Config{}
+}
+
+// CreateProtocol 创建SOCKS5协议实例
+func (f *SOCKS5ProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
+	var cfg SOCKS5Config
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	server, port, username := cfg.Server, cfg.Port, cfg.Username
+
+	// 域名解析位置，默认由服务器解析（socks5h语义）
+	resolveLocally := false
+	switch cfg.Resolve {
+	case "local":
+		resolveLocally = true
+	case "remote", "":
+	default:
+		return nil, fmt.Errorf("invalid socks5 resolve mode: %s", cfg.Resolve)
+	}
+	if cfg.ResolveLocally != nil {
+		resolveLocally = *cfg.ResolveLocally
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("socks5-%s:%d", server, port)
+	}
+
+	protocol := &SOCKS5Protocol{
+		BaseProtocol: BaseProtocol{
+			name:         name,
+			protocolType: ProtocolSOCKS5,
+		},
+		server:   server,
+		port:     port,
+		username: username,
+	}
+
+	client, err := socks5.NewClient(socks5.ClientConfig{
+		Server:         net.JoinHostPort(server, strconv.Itoa(port)),
+		Username:       username,
+		Password:       cfg.Password,
+		ResolveLocally: resolveLocally,
+		DialContext:    protocol.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol.client = client
+
+	// 添加日志以调试SOCKS5协议创建
+	log.Printf("创建SOCKS5协议: server=%s, port=%d, auth=%t, resolveLocally=%t", server, port, username != "", resolveLocally)
+
+	return protocol, nil
+}
+
+// Connect 连接到目标地址（通过SOCKS5代理）
+func (sp *SOCKS5Protocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(sp, targetAddr)
+}
+
+// DialContext 连接到目标地址，tcp使用CONNECT，udp使用UDP ASSOCIATE
+func (sp *SOCKS5Protocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	log.Printf("SOCKS5协议开始连接: targetAddr=%s, network=%s, server=%s, port=%d", targetAddr, network, sp.server, sp.port)
+
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return dialPacketConn(ctx, sp, targetAddr)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	conn, err := sp.client.DialContext(ctx, targetAddr)
+	if err != nil {
+		log.Printf("通过SOCKS5代理连接目标失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("SOCKS5协议成功连接到目标: %s 通过代理: %s:%d", targetAddr, sp.server, sp.port)
+	return conn, nil
+}
+
+// ListenPacket 通过UDP ASSOCIATE建立UDP转发会话
+func (sp *SOCKS5Protocol) ListenPacket(ctx context.Context, targetAddr string) (net.PacketConn, error) {
+	log.Printf("SOCKS5协议建立UDP转发: server=%s, port=%d", sp.server, sp.port)
+	return sp.client.ListenPacketContext(ctx)
+}
+
+// SupportsUDP SOCKS5通过UDP ASSOCIATE支持UDP
+func (sp *SOCKS5Protocol) SupportsUDP() bool {
+	return true
+}
+
+// Close 关闭连接
+func (sp *SOCKS5Protocol) Close() error {
+	// SOCKS5客户端不维护长连接
+	return nil
+}
+
+// IsRunning 检查协议是否正在运行
+func (sp *SOCKS5Protocol) IsRunning() bool {
+	return true
+}
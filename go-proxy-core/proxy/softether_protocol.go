@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -19,23 +21,34 @@ type SoftEtherProtocol struct {
 // SoftEtherProtocolFactory SoftEther协议工厂
 type SoftEtherProtocolFactory struct{}
 
+// Capabilities SoftEther协议尚未实现握手，不能创建
+func (f *SoftEtherProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// SoftEtherConfig SoftEther协议配置
+type SoftEtherConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Username string `config:"username" desc:"用户名"`
+	Password string `config:"password" desc:"密码"`
+	Hub      string `config:"hub" desc:"虚拟HUB名称"`
+}
+
+// Config 返回SoftEther协议的配置结构
+func (f *SoftEtherProtocolFactory) Config() interface{} {
+	return &SoftEtherConfig{}
+}
+
 // CreateProtocol 创建SoftEther协议实例
 func (f *SoftEtherProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg SoftEtherConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	username, _ := config["username"].(string)
-	password, _ := config["password"].(string)
-	hub, _ := config["hub"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("softether-%s:%d", server, port)
 	}
@@ -47,19 +60,24 @@ func (f *SoftEtherProtocolFactory) CreateProtocol(config map[string]interface{})
 		},
 		server:   server,
 		port:     port,
-		username: username,
-		password: password,
-		hub:      hub,
+		username: cfg.Username,
+		password: cfg.Password,
+		hub:      cfg.Hub,
 	}
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址，ctx结束时放弃等待
+func (sp *SoftEtherProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	return dialWithConnect(ctx, network, targetAddr, sp.Connect)
+}
+
 // Connect 连接到目标地址（通过SoftEther）
 func (sp *SoftEtherProtocol) Connect(targetAddr string) (net.Conn, error) {
 	// 连接到SoftEther服务器
-	softetherAddr := fmt.Sprintf("%s:%d", sp.server, sp.port)
-	conn, err := net.DialTimeout("tcp", softetherAddr, 10*time.Second)
+	softetherAddr := net.JoinHostPort(sp.server, strconv.Itoa(sp.port))
+	conn, err := sp.dialTimeout("tcp", softetherAddr, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to SoftEther server %s: %v", softetherAddr, err)
 	}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/sshtunnel"
+)
+
+// SSHProtocol SSH隧道协议实现，通过direct-tcpip通道转发TCP连接
+type SSHProtocol struct {
+	BaseProtocol
+	server string
+	port   int
+	user   string
+	client *sshtunnel.Client
+}
+
+// SSHProtocolFactory SSH协议工厂
+type SSHProtocolFactory struct{}
+
+// Capabilities 返回SSH协议支持的能力
+func (f *SSHProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true}
+}
+
+// SSHConfig SSH协议配置，字段兼容Clash的连字符写法
+type SSHConfig struct {
+	Name             string   `config:"name" desc:"协议名称"`
+	Server           string   `config:"server" required:"true" desc:"服务器地址"`
+	Port             int      `config:"port" default:"22" min:"1" max:"65535" desc:"服务器端口"`
+	Username         string   `config:"username,user" desc:"用户名"`
+	Password         string   `config:"password" desc:"密码"`
+	PrivateKey       string   `config:"private_key,private-key" desc:"私钥，PEM内容或文件路径"`
+	Passphrase       string   `config:"private_key_passphrase,private-key-passphrase" desc:"私钥密码"`
+	UseAgent         *bool    `config:"use_agent,agent" desc:"使用ssh-agent认证"`
+	AgentSock        string   `config:"agent_sock,agent-sock" desc:"ssh-agent套接字路径"`
+	HostKey          []string `config:"host_key,host-key" desc:"服务器主机密钥"`
+	KnownHosts       string   `config:"known_hosts,known-hosts" desc:"known_hosts文件路径"`
+	SkipHostKeyCheck bool     `config:"skip_host_key_check,skip-host-key-check" desc:"跳过主机密钥验证"`
+	KeepAlive        int      `config:"keepalive" desc:"保活间隔（秒），小于0时关闭保活"`
+}
+
+// Config 返回SSH协议的配置结构
+func (f *SSHProtocolFactory) Config() interface{} {
+	return &SSHConfig{}
+}
+
+// CreateProtocol 创建SSH协议实例
+func (f *SSHProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
+	var cfg SSHConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	server, port, user := cfg.Server, cfg.Port, cfg.Username
+	privateKey, agentSock := cfg.PrivateKey, cfg.AgentSock
+
+	useAgent := agentSock != ""
+	if cfg.UseAgent != nil {
+		useAgent = *cfg.UseAgent
+	}
+
+	// 保活间隔（秒），小于0时关闭保活
+	var keepAlive time.Duration
+	if cfg.KeepAlive != 0 {
+		keepAlive = time.Duration(cfg.KeepAlive) * time.Second
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("ssh-%s:%d", server, port)
+	}
+
+	protocol := &SSHProtocol{
+		BaseProtocol: BaseProtocol{
+			name:         name,
+			protocolType: ProtocolSSH,
+		},
+		server: server,
+		port:   port,
+		user:   user,
+	}
+
+	client, err := sshtunnel.NewClient(sshtunnel.ClientConfig{
+		Server:              net.JoinHostPort(server, strconv.Itoa(port)),
+		User:                user,
+		Password:            cfg.Password,
+		PrivateKey:          privateKey,
+		Passphrase:          cfg.Passphrase,
+		UseAgent:            useAgent,
+		AgentSock:           agentSock,
+		HostKeys:            cfg.HostKey,
+		KnownHosts:          cfg.KnownHosts,
+		InsecureSkipHostKey: cfg.SkipHostKeyCheck,
+		KeepAlive:           keepAlive,
+		Timeout:             DefaultConnectTimeout,
+		DialContext:         protocol.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol.client = client
+
+	// 添加日志以调试SSH协议创建
+	log.Printf("创建SSH协议: server=%s, port=%d, user=%s, private_key=%t, agent=%t",
+		server, port, user, privateKey != "", useAgent)
+
+	return protocol, nil
+}
+
+// Connect 连接到目标地址（通过SSH隧道）
+func (sp *SSHProtocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(sp, targetAddr)
+}
+
+// DialContext 通过direct-tcpip通道连接到目标地址，SSH隧道只支持TCP
+func (sp *SSHProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%w: network %s", ErrUDPNotSupported, network)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	log.Printf("SSH协议开始连接: targetAddr=%s, server=%s, port=%d", targetAddr, sp.server, sp.port)
+
+	conn, err := sp.client.DialContext(ctx, targetAddr)
+	if err != nil {
+		log.Printf("通过SSH隧道连接目标失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("SSH协议成功连接到目标: %s 通过服务器: %s:%d", targetAddr, sp.server, sp.port)
+	return conn, nil
+}
+
+// Close 关闭SSH连接
+func (sp *SSHProtocol) Close() error {
+	return sp.client.Close()
+}
+
+// IsRunning 检查协议是否正在运行
+func (sp *SSHProtocol) IsRunning() bool {
+	return true
+}
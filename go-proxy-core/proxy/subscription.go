@@ -0,0 +1,492 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/sharelink"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// subscriptionMaxSize 订阅内容的大小上限
+	subscriptionMaxSize = 16 << 20
+	// subscriptionRetryInterval 更新失败后重试的间隔，不超过配置的更新间隔
+	subscriptionRetryInterval = 5 * time.Minute
+)
+
+// SubscriptionConfig 代理源的订阅配置，来自ProxySource.Config，配置了订阅地址时启用
+type SubscriptionConfig struct {
+	URL       string `config:"subscription_url,subscription-url,url" desc:"订阅地址"`
+	UserAgent string `config:"user_agent,user-agent" default:"clash.meta" desc:"下载订阅使用的User-Agent，部分服务按它返回不同格式"`
+	Via       string `config:"subscription_via,subscription-via" default:"direct" desc:"经由哪个代理源、协议或代理组下载订阅，默认直连"`
+	Interval  int    `config:"update_interval,update-interval" default:"86400" min:"0" desc:"自动更新间隔（秒），0表示只在添加代理源时更新"`
+	Timeout   int    `config:"subscription_timeout,subscription-timeout" default:"30" min:"1" desc:"下载订阅的超时（秒）"`
+}
+
+// parseSubscriptionConfig 读取订阅配置，没有订阅地址时返回nil
+func parseSubscriptionConfig(sourceConfig map[string]interface{}) (*SubscriptionConfig, error) {
+	var cfg SubscriptionConfig
+	if err := decodeConfig(sourceConfig, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("unsupported subscription url: %s", cfg.URL)
+	}
+	return &cfg, nil
+}
+
+// SubscriptionUserInfo 订阅服务通过subscription-userinfo响应头返回的流量和到期信息
+type SubscriptionUserInfo struct {
+	Upload   int64      `json:"upload"`   // 已用上行流量（字节）
+	Download int64      `json:"download"` // 已用下行流量（字节）
+	Total    int64      `json:"total"`    // 总流量（字节）
+	Expire   *time.Time `json:"expire,omitempty"`
+}
+
+// parseSubscriptionUserInfo 解析subscription-userinfo响应头，如upload=123; download=456; total=789; expire=1700000000
+func parseSubscriptionUserInfo(header string) *SubscriptionUserInfo {
+	if header == "" {
+		return nil
+	}
+	info := &SubscriptionUserInfo{}
+	for _, item := range strings.Split(header, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+		// 部分服务返回浮点数或科学计数法
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			continue
+		}
+		n := int64(f)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "upload":
+			info.Upload = n
+		case "download":
+			info.Download = n
+		case "total":
+			info.Total = n
+		case "expire":
+			if n > 0 {
+				expire := time.Unix(n, 0)
+				info.Expire = &expire
+			}
+		}
+	}
+	return info
+}
+
+// SubscriptionStatus 代理源的订阅状态，用于API输出
+type SubscriptionStatus struct {
+	URL        string                `json:"url"`
+	Interval   int                   `json:"interval"` // 自动更新间隔（秒）
+	Updating   bool                  `json:"updating"`
+	LastUpdate *time.Time            `json:"last_update,omitempty"` // 最近一次成功更新的时间
+	NextUpdate *time.Time            `json:"next_update,omitempty"`
+	LastError  string                `json:"last_error,omitempty"`
+	Proxies    int                   `json:"proxies"` // 最近一次更新得到的代理数量
+	Skipped    []string              `json:"skipped,omitempty"`
+	UserInfo   *SubscriptionUserInfo `json:"user_info,omitempty"`
+}
+
+// sourceSubscription 单个代理源的订阅
+type sourceSubscription struct {
+	pc       *ProxyCore
+	sourceId string
+	config   SubscriptionConfig
+
+	// 手动更新和定时更新串行进行
+	refreshMu sync.Mutex
+
+	mu     sync.Mutex
+	status SubscriptionStatus
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// setupSubscription 按代理源配置启动或停止订阅的定时更新，添加后立即在后台更新一次
+func (pc *ProxyCore) setupSubscription(source *ProxySource, cfg *SubscriptionConfig) {
+	pc.removeSubscription(source.ID)
+	if cfg == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &sourceSubscription{
+		pc:       pc,
+		sourceId: source.ID,
+		config:   *cfg,
+		status:   SubscriptionStatus{URL: cfg.URL, Interval: cfg.Interval},
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	pc.subscriptionMu.Lock()
+	pc.subscriptions[source.ID] = s
+	pc.subscriptionMu.Unlock()
+	go s.loop()
+}
+
+// removeSubscription 停止代理源的订阅更新
+func (pc *ProxyCore) removeSubscription(sourceId string) {
+	pc.subscriptionMu.Lock()
+	s := pc.subscriptions[sourceId]
+	delete(pc.subscriptions, sourceId)
+	pc.subscriptionMu.Unlock()
+	if s != nil {
+		s.cancel()
+		<-s.done
+	}
+}
+
+// getSubscription 返回代理源的订阅，没有配置订阅时返回nil
+func (pc *ProxyCore) getSubscription(sourceId string) *sourceSubscription {
+	pc.subscriptionMu.Lock()
+	defer pc.subscriptionMu.Unlock()
+	return pc.subscriptions[sourceId]
+}
+
+// GetSubscriptionStatus 返回代理源的订阅状态，没有配置订阅时返回false
+func (pc *ProxyCore) GetSubscriptionStatus(sourceId string) (SubscriptionStatus, bool) {
+	s := pc.getSubscription(sourceId)
+	if s == nil {
+		return SubscriptionStatus{}, false
+	}
+	return s.getStatus(), true
+}
+
+// RefreshSubscription 立即更新代理源的订阅
+func (pc *ProxyCore) RefreshSubscription(ctx context.Context, sourceId string) (SubscriptionStatus, error) {
+	s := pc.getSubscription(sourceId)
+	if s == nil {
+		return SubscriptionStatus{}, fmt.Errorf("proxy source %s has no subscription", sourceId)
+	}
+	err := s.refresh(ctx)
+	return s.getStatus(), err
+}
+
+// loop 定时更新订阅，更新失败时提前重试
+func (s *sourceSubscription) loop() {
+	defer close(s.done)
+	for {
+		err := s.refresh(s.ctx)
+		if s.config.Interval == 0 {
+			return
+		}
+
+		wait := time.Duration(s.config.Interval) * time.Second
+		if err != nil && wait > subscriptionRetryInterval {
+			wait = subscriptionRetryInterval
+		}
+		next := time.Now().Add(wait)
+		s.mu.Lock()
+		s.status.NextUpdate = &next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// refresh 下载并解析订阅，用得到的代理替换代理源的代理列表
+// 下载或解析失败时保留原来的代理列表
+func (s *sourceSubscription) refresh(ctx context.Context) error {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	s.mu.Lock()
+	s.status.Updating = true
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.config.Timeout)*time.Second)
+	defer cancel()
+	proxies, skipped, userInfo, err := s.fetch(ctx)
+	if err == nil {
+		s.pc.applySubscriptionProxies(s.sourceId, proxies)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Updating = false
+	if userInfo != nil {
+		s.status.UserInfo = userInfo
+	}
+	if err != nil {
+		s.status.LastError = err.Error()
+		log.Printf("更新代理源 %s 的订阅失败: %v", s.sourceId, err)
+		return err
+	}
+	now := time.Now()
+	s.status.LastUpdate = &now
+	s.status.LastError = ""
+	s.status.Proxies = len(proxies)
+	s.status.Skipped = skipped
+	log.Printf("代理源 %s 的订阅已更新: %d 个代理，跳过 %d 个", s.sourceId, len(proxies), len(skipped))
+	return nil
+}
+
+// fetch 下载并解析订阅
+func (s *sourceSubscription) fetch(ctx context.Context) (map[string]*ProxyInfo, []string, *SubscriptionUserInfo, error) {
+	pm := s.pc.protocolManager
+	client := &http.Client{
+		Transport: &http.Transport{
+			// 不使用环境变量中的代理，经由配置的协议下载
+			Proxy: nil,
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return pm.DialContext(ctx, s.config.Via, network, address)
+			},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.URL, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	req.Header.Set("User-Agent", s.config.UserAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	userInfo := parseSubscriptionUserInfo(resp.Header.Get("subscription-userinfo"))
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, subscriptionMaxSize+1))
+	if err != nil {
+		return nil, nil, userInfo, err
+	}
+	if len(data) > subscriptionMaxSize {
+		return nil, nil, userInfo, fmt.Errorf("subscription larger than %d bytes", subscriptionMaxSize)
+	}
+
+	list, errs, err := parseSubscription(data)
+	if err != nil {
+		return nil, nil, userInfo, err
+	}
+	skipped := make([]string, len(errs))
+	for i, e := range errs {
+		skipped[i] = e.Error()
+	}
+	if len(list) == 0 {
+		return nil, skipped, userInfo, fmt.Errorf("no supported proxies in subscription")
+	}
+	return proxyMap(list), skipped, userInfo, nil
+}
+
+// getStatus 返回订阅状态的副本
+func (s *sourceSubscription) getStatus() SubscriptionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Skipped = append([]string(nil), s.status.Skipped...)
+	return status
+}
+
+// applySubscriptionProxies 替换代理源的代理列表
+// 当前代理仍在订阅中但配置发生变化时，使用新配置重新创建协议实例
+func (pc *ProxyCore) applySubscriptionProxies(sourceId string, proxies map[string]*ProxyInfo) {
+	pc.UpdateProxySourceProxies(sourceId, proxies)
+
+	current := pc.GetCurrentProxy(sourceId)
+	if current == nil {
+		return
+	}
+	// 从代理源的列表中读取，列表可能已被故障切换或下一次更新修改
+	updated := pc.GetProxy(sourceId, current.ID)
+	if updated == nil {
+		log.Printf("代理源 %s 的当前代理 %s 已不在订阅中", sourceId, current.Name)
+		return
+	}
+	if updated == current {
+		return
+	}
+	if updated.Type == current.Type && reflect.DeepEqual(protocolConfig(updated), protocolConfig(current)) {
+		return
+	}
+	if err := pc.setCurrentProxy(sourceId, updated); err != nil {
+		log.Printf("更新代理源 %s 的当前代理失败: %v", sourceId, err)
+	}
+}
+
+// subscriptionFormat 订阅内容的格式
+type subscriptionFormat string
+
+const (
+	subscriptionFormatClash      subscriptionFormat = "clash"
+	subscriptionFormatSIP008     subscriptionFormat = "sip008"
+	subscriptionFormatShareLinks subscriptionFormat = "share-links"
+)
+
+// detectSubscriptionFormat 识别订阅格式：SIP008 JSON、Clash YAML的proxies，其余视为（base64编码的）分享链接列表
+func detectSubscriptionFormat(data []byte) subscriptionFormat {
+	if data[0] == '{' {
+		return subscriptionFormatSIP008
+	}
+	var clash struct {
+		Proxies []interface{} `yaml:"proxies"`
+	}
+	if yaml.Unmarshal(data, &clash) == nil && len(clash.Proxies) > 0 {
+		return subscriptionFormatClash
+	}
+	return subscriptionFormatShareLinks
+}
+
+// parseSubscription 识别订阅格式并解析，无法解析的单个代理放在errs中返回
+func parseSubscription(data []byte) (proxies []*ProxyInfo, errs []error, err error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("empty subscription")
+	}
+
+	switch detectSubscriptionFormat(data) {
+	case subscriptionFormatSIP008:
+		nodes, errs, err := sharelink.ParseSIP008(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, node := range nodes {
+			proxies = append(proxies, proxyInfoFromNode(node))
+		}
+		return proxies, errs, nil
+	case subscriptionFormatShareLinks:
+		proxies, errs := ParseShareLinks(string(data))
+		return proxies, errs, nil
+	}
+
+	var clash struct {
+		Proxies []map[string]interface{} `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(data, &clash); err != nil {
+		return nil, nil, fmt.Errorf("invalid clash yaml: %v", err)
+	}
+	for i, entry := range clash.Proxies {
+		proxy, err := proxyInfoFromClash(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("proxy %d: %v", i, err))
+			continue
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, errs, nil
+}
+
+// clashProxyTypes Clash代理类型到协议类型的映射
+var clashProxyTypes = map[string]ProtocolType{
+	"ss":          ProtocolShadowsocks,
+	"shadowsocks": ProtocolShadowsocks,
+	"ssr":         ProtocolShadowsocksR,
+	"vmess":       ProtocolVMess,
+	"vless":       ProtocolVLESS,
+	"trojan":      ProtocolTrojan,
+	"hysteria2":   ProtocolHysteria2,
+	"hy2":         ProtocolHysteria2,
+	"tuic":        ProtocolTUIC,
+	"socks5":      ProtocolSOCKS5,
+	"http":        ProtocolHTTP,
+	"snell":       ProtocolSnell,
+	"wireguard":   ProtocolWireGuard,
+	"ssh":         ProtocolSSH,
+}
+
+// proxyInfoFromClash 将Clash配置中的一个代理转换为代理信息，其余字段原样作为协议配置
+func proxyInfoFromClash(entry map[string]interface{}) (*ProxyInfo, error) {
+	name, _ := configToString(entry["name"])
+	typeName, _ := configToString(entry["type"])
+	protocolType, ok := clashProxyTypes[strings.ToLower(typeName)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported proxy type %q (%s)", typeName, name)
+	}
+	server, _ := configToString(entry["server"])
+	if server == "" {
+		return nil, fmt.Errorf("missing server (%s)", name)
+	}
+	port, err := configToInt(entry["port"])
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %v (%s)", entry["port"], name)
+	}
+
+	config := make(map[string]interface{}, len(entry))
+	for k, v := range entry {
+		switch k {
+		case "name", "type", "server", "port":
+		default:
+			config[k] = v
+		}
+	}
+	if name == "" {
+		name = net.JoinHostPort(server, strconv.Itoa(int(port)))
+	}
+	return &ProxyInfo{
+		Name:   name,
+		Type:   protocolType,
+		Server: server,
+		Port:   int(port),
+		Config: config,
+		Stats:  &ProxyStats{},
+	}, nil
+}
+
+// proxyInfoFromNode 将分享链接解析出的节点转换为代理信息
+func proxyInfoFromNode(node *sharelink.Node) *ProxyInfo {
+	return &ProxyInfo{
+		Name:   node.Name,
+		Type:   ProtocolType(node.Type),
+		Server: node.Server,
+		Port:   node.Port,
+		Config: node.Config,
+		Stats:  &ProxyStats{},
+	}
+}
+
+// proxyMap 为代理分配ID并生成代理列表
+// ID由名称生成，订阅更新后同名代理的ID不变；重名的代理在名称后加序号
+func proxyMap(list []*ProxyInfo) map[string]*ProxyInfo {
+	proxies := make(map[string]*ProxyInfo, len(list))
+	names := make(map[string]bool, len(list))
+	for _, proxy := range list {
+		name := proxy.Name
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s %d", proxy.Name, i)
+		}
+		names[name] = true
+		proxy.Name = name
+		proxy.ID = proxyIDFromName(name)
+		proxies[proxy.ID] = proxy
+	}
+	return proxies
+}
+
+// proxyIDFromName 由代理名称生成可以放在URL路径中的ID
+func proxyIDFromName(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return hex.EncodeToString(sum[:8])
+}
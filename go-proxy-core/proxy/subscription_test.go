@@ -0,0 +1,375 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/config"
+)
+
+// subscriptionServer 返回可以在测试中修改内容的订阅服务
+type subscriptionServer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	body string
+}
+
+// newSubscriptionServer 启动订阅服务
+func newSubscriptionServer(t *testing.T, body string) *subscriptionServer {
+	t.Helper()
+	s := &subscriptionServer{body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("subscription-userinfo", "upload=1; download=2; total=1024")
+		w.Write([]byte(s.body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// setBody 修改订阅内容
+func (s *subscriptionServer) setBody(body string) {
+	s.mu.Lock()
+	s.body = body
+	s.mu.Unlock()
+}
+
+// waitSubscription 等待订阅状态满足条件
+func waitSubscription(t *testing.T, pc *ProxyCore, what string, done func(SubscriptionStatus) bool) SubscriptionStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status, ok := pc.GetSubscriptionStatus("sub")
+		if !ok {
+			t.Fatal("subscription not found")
+		}
+		if done(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s: %+v", what, status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSubscriptionScheduledRefresh(t *testing.T) {
+	server := newSubscriptionServer(t, "socks5://127.0.0.1:1080#a\nsocks5://127.0.0.1:1081#b\n")
+	pc := NewProxyCore(&config.Config{})
+	if err := pc.AddProxySource(&ProxySource{
+		ID:     "sub",
+		Name:   "subscription",
+		Config: map[string]interface{}{"url": server.URL, "update_interval": float64(1)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("sub")
+
+	status := waitSubscription(t, pc, "first update", func(s SubscriptionStatus) bool { return s.LastUpdate != nil })
+	if status.Proxies != 2 || status.UserInfo == nil || status.UserInfo.Total != 1024 {
+		t.Fatalf("status = %+v", status)
+	}
+	idA, idB, idC := proxyIDFromName("a"), proxyIDFromName("b"), proxyIDFromName("c")
+	if err := pc.SetCurrentProxy("sub", pc.GetProxy("sub", idA)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 定时更新替换代理列表的同时，切换当前代理会写入同一个代理源的列表，由-race检查
+	server.setBody("socks5://127.0.0.1:2080#a\nsocks5://127.0.0.1:1082#c\n")
+	first := *status.LastUpdate
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if current := pc.GetCurrentProxy("sub"); current != nil {
+				pc.setCurrentProxy("sub", current)
+			}
+			for pid, proxy := range pc.GetProxySourceProxies("sub") {
+				if proxy.ID != pid {
+					t.Errorf("proxy %s stored as %s", proxy.ID, pid)
+				}
+			}
+		}
+	}()
+	waitSubscription(t, pc, "second update", func(s SubscriptionStatus) bool { return s.LastUpdate != nil && s.LastUpdate.After(first) })
+	close(stop)
+	wg.Wait()
+
+	// 当前代理的配置变化后使用新配置重新创建
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current := pc.GetCurrentProxy("sub")
+		if current != nil && current.Port == 2080 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("current proxy = %+v, want updated port", current)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	proxies := pc.GetProxySourceProxies("sub")
+	if len(proxies) != 2 || proxies[idA] == nil || proxies[idB] != nil || proxies[idC] == nil {
+		t.Fatalf("proxies after refresh = %v", proxies)
+	}
+}
+
+func TestUpdateProxySourceProxiesCopies(t *testing.T) {
+	pc := NewProxyCore(&config.Config{})
+	if err := pc.AddProxySource(&ProxySource{ID: "source", Config: map[string]interface{}{}}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("source")
+
+	proxies := map[string]*ProxyInfo{"a": {ID: "a", Type: ProtocolDIRECT}}
+	pc.UpdateProxySourceProxies("source", proxies)
+	// 调用方之后修改自己的map不影响代理源
+	proxies["b"] = &ProxyInfo{ID: "b", Type: ProtocolDIRECT}
+	if pc.GetProxy("source", "b") != nil {
+		t.Fatal("proxy source shares the caller's map")
+	}
+	if pc.GetProxy("source", "a") != proxies["a"] {
+		t.Fatal("proxy a missing after update")
+	}
+}
+
+// clashSubscription Clash YAML格式的订阅，包含无法转换的代理
+const clashSubscription = `
+mixed-port: 7890
+proxies:
+  - name: hk
+    type: ss
+    server: hk.example.com
+    port: 8388
+    cipher: aes-128-gcm
+    password: secret
+    udp: true
+  - name: jp
+    type: Trojan
+    server: jp.example.com
+    port: "443"
+    password: secret
+    network: ws
+    ws-opts:
+      path: /ws
+  - type: socks5
+    server: 127.0.0.1
+    port: 1080
+  - name: unknown
+    type: hysteria
+    server: example.com
+    port: 443
+  - name: no-server
+    type: ss
+    port: 8388
+  - name: bad-port
+    type: ss
+    server: example.com
+    port: 70000
+`
+
+func TestParseSubscriptionClash(t *testing.T) {
+	proxies, errs, err := parseSubscription([]byte(clashSubscription))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxies) != 3 || len(errs) != 3 {
+		t.Fatalf("parsed %d proxies, skipped %v", len(proxies), errs)
+	}
+	for i, want := range []string{"unsupported proxy type", "missing server", "invalid port"} {
+		if !strings.Contains(errs[i].Error(), want) {
+			t.Errorf("error %d = %v, want %q", i, errs[i], want)
+		}
+	}
+
+	hk := proxies[0]
+	if hk.Name != "hk" || hk.Type != ProtocolShadowsocks || hk.Server != "hk.example.com" || hk.Port != 8388 {
+		t.Fatalf("hk = %+v", hk)
+	}
+	// 除名称、类型、服务器和端口外的字段原样作为协议配置
+	if want := map[string]interface{}{"cipher": "aes-128-gcm", "password": "secret", "udp": true}; !reflect.DeepEqual(hk.Config, want) {
+		t.Fatalf("hk config = %v, want %v", hk.Config, want)
+	}
+	jp := proxies[1]
+	if jp.Type != ProtocolTrojan || jp.Port != 443 || jp.Config["network"] != "ws" {
+		t.Fatalf("jp = %+v", jp)
+	}
+	if opts, ok := jp.Config["ws-opts"].(map[string]interface{}); !ok || opts["path"] != "/ws" {
+		t.Fatalf("jp ws-opts = %v", jp.Config["ws-opts"])
+	}
+	// 没有名称时使用服务器地址
+	if proxies[2].Name != "127.0.0.1:1080" || proxies[2].Type != ProtocolSOCKS5 {
+		t.Fatalf("unnamed proxy = %+v", proxies[2])
+	}
+
+	// 有proxies列表但其中不是代理配置时不会当作分享链接解析
+	if _, _, err := parseSubscription([]byte("proxies:\n  - ss://example\n")); err == nil || !strings.Contains(err.Error(), "invalid clash yaml") {
+		t.Fatalf("proxies without mappings: err = %v", err)
+	}
+}
+
+func TestParseSubscriptionSIP008(t *testing.T) {
+	data := []byte(`{
+  "version": 1,
+  "servers": [
+    {"id": "1", "remarks": "sg", "server": "sg.example.com", "server_port": 8388, "method": "AES-256-GCM", "password": "secret"},
+    {"server": "tw.example.com", "server_port": "8389", "method": "chacha20-ietf-poly1305", "password": "secret"},
+    {"remarks": "broken", "server": "example.com", "server_port": 0, "method": "aes-256-gcm", "password": "secret"}
+  ]
+}`)
+	proxies, errs, err := parseSubscription(append([]byte("\xef\xbb\xbf"), data...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proxies) != 2 || len(errs) != 1 {
+		t.Fatalf("parsed %d proxies, skipped %v", len(proxies), errs)
+	}
+	sg := proxies[0]
+	if sg.Name != "sg" || sg.Type != ProtocolShadowsocks || sg.Server != "sg.example.com" || sg.Port != 8388 ||
+		sg.Config["cipher"] != "aes-256-gcm" || sg.Config["password"] != "secret" {
+		t.Fatalf("sg = %+v", sg)
+	}
+	if proxies[1].Name != "tw.example.com:8389" || proxies[1].Port != 8389 {
+		t.Fatalf("unnamed server = %+v", proxies[1])
+	}
+
+	for _, data := range []string{`{"servers": [`, `{"version": 1}`} {
+		if _, _, err := parseSubscription([]byte(data)); err == nil {
+			t.Fatalf("%s: expected error", data)
+		}
+	}
+}
+
+func TestParseSubscriptionUserInfo(t *testing.T) {
+	expire := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		header string
+		want   *SubscriptionUserInfo
+	}{
+		{"", nil},
+		{"upload=123; download=456; total=789; expire=1700000000", &SubscriptionUserInfo{Upload: 123, Download: 456, Total: 789, Expire: &expire}},
+		// 浮点数和科学计数法，键不区分大小写
+		{"Upload=1.5e3;download=2048.9; TOTAL=1.073741824E10; expire=1700000000.0", &SubscriptionUserInfo{Upload: 1500, Download: 2048, Total: 10737418240, Expire: &expire}},
+		// 无效的值和不大于0的到期时间被忽略
+		{"upload=abc; download; total=1024; expire=0", &SubscriptionUserInfo{Total: 1024}},
+		{"total=1024; expire=-1", &SubscriptionUserInfo{Total: 1024}},
+	} {
+		got := parseSubscriptionUserInfo(tc.header)
+		if (got == nil) != (tc.want == nil) {
+			t.Errorf("%q: got %+v, want %+v", tc.header, got, tc.want)
+			continue
+		}
+		if got == nil {
+			continue
+		}
+		if got.Upload != tc.want.Upload || got.Download != tc.want.Download || got.Total != tc.want.Total ||
+			(got.Expire == nil) != (tc.want.Expire == nil) || (got.Expire != nil && !got.Expire.Equal(*tc.want.Expire)) {
+			t.Errorf("%q: got %+v, want %+v", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestSubscriptionFetch(t *testing.T) {
+	var mu sync.Mutex
+	var userAgents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.UserAgent())
+		mu.Unlock()
+		w.Header().Set("subscription-userinfo", "upload=1.5e3; download=2; total=1073741824; expire=1700000000")
+		w.Write([]byte(clashSubscription))
+	}))
+	defer server.Close()
+	relay := startTestProxy(t)
+	pc := NewProxyCore(&config.Config{})
+	if err := pc.AddProxySource(&ProxySource{
+		ID:      "relay",
+		Config:  map[string]interface{}{},
+		Proxies: map[string]*ProxyInfo{"r": relay.info("r")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("relay")
+	if err := pc.SetCurrentProxy("relay", pc.GetProxy("relay", "r")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 经由另一个代理源下载，使用自定义的User-Agent
+	if err := pc.AddProxySource(&ProxySource{
+		ID: "sub",
+		Config: map[string]interface{}{
+			"url":              server.URL,
+			"update_interval":  0,
+			"user-agent":       "dualvpn-test",
+			"subscription_via": "relay",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("sub")
+	status := waitSubscription(t, pc, "update via relay", func(s SubscriptionStatus) bool { return s.LastUpdate != nil || s.LastError != "" })
+	if status.LastError != "" || status.Proxies != 3 || len(status.Skipped) != 3 {
+		t.Fatalf("status = %+v", status)
+	}
+	if relay.accepted.Load() != 1 {
+		t.Fatalf("relay accepted %d connections", relay.accepted.Load())
+	}
+	info := status.UserInfo
+	if info == nil || info.Upload != 1500 || info.Total != 1<<30 || info.Expire == nil || info.Expire.Unix() != 1700000000 {
+		t.Fatalf("user info = %+v", info)
+	}
+	if pc.GetProxy("sub", proxyIDFromName("hk")) == nil {
+		t.Fatal("proxy hk missing after update")
+	}
+
+	// 手动更新同样经由另一个代理源
+	if _, err := pc.RefreshSubscription(context.Background(), "sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 默认直连下载，User-Agent为clash.meta
+	if err := pc.AddProxySource(&ProxySource{
+		ID:     "direct-sub",
+		Config: map[string]interface{}{"url": server.URL, "update_interval": 0},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("direct-sub")
+	if _, err := pc.RefreshSubscription(context.Background(), "direct-sub"); err != nil {
+		t.Fatal(err)
+	}
+	if relay.accepted.Load() != 2 {
+		t.Fatalf("relay accepted %d connections, want 2", relay.accepted.Load())
+	}
+	mu.Lock()
+	if len(userAgents) < 3 || userAgents[0] != "dualvpn-test" || userAgents[len(userAgents)-1] != "clash.meta" {
+		t.Errorf("user agents = %v", userAgents)
+	}
+	mu.Unlock()
+
+	// 下载失败时保留原来的代理列表
+	if err := pc.AddProxySource(&ProxySource{
+		ID:     "broken-sub",
+		Config: map[string]interface{}{"url": server.URL, "update_interval": 0, "subscription_via": "missing"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer pc.RemoveProxySource("broken-sub")
+	if _, err := pc.RefreshSubscription(context.Background(), "broken-sub"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("unknown via: err = %v", err)
+	}
+}
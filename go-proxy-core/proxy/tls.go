@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dualvpn/go-proxy-core/tlsclient"
+)
+
+// TLSOptions 各协议共用的TLS客户端配置，字段兼容Clash和V2Ray/Xray的写法:
+//
+//	sni: example.com                  # 也可以使用servername/server_name
+//	alpn: [h2, http/1.1]
+//	skip-cert-verify: false           # 也可以使用skip_cert_verify/insecure
+//	ca: /path/to/ca.pem               # PEM内容或文件路径，也可以使用ca-str
+//	fingerprint: AB:CD:...            # 证书SHA-256指纹；为chrome等名称时作为uTLS指纹（Xray写法）
+//	client-fingerprint: chrome        # uTLS指纹: chrome/firefox/safari/ios/android/edge/360/qq/random
+//	reality-opts:
+//	  public-key: base64url公钥
+//	  short-id: 0123abcd
+//
+// 配置了reality-opts时使用REALITY握手，未指定指纹时默认chrome
+type TLSOptions struct {
+	SNI               string                 `config:"sni,servername,server_name" desc:"TLS服务器名称，默认使用服务器地址"`
+	ALPN              []string               `config:"alpn" desc:"ALPN协议列表"`
+	SkipCertVerify    bool                   `config:"skip-cert-verify,skip_cert_verify,insecure,allow_insecure" desc:"跳过证书验证"`
+	CA                string                 `config:"ca,ca-str,ca_str" desc:"自定义CA证书，PEM内容或文件路径"`
+	PinSHA256         []string               `config:"pin-sha256,pin_sha256,certificate_sha256" desc:"证书SHA-256指纹"`
+	Fingerprint       string                 `config:"fingerprint" desc:"证书SHA-256指纹，或uTLS指纹名称"`
+	ClientFingerprint string                 `config:"client-fingerprint,client_fingerprint,utls" enum:"chrome,firefox,safari,ios,android,edge,360,qq,random,none" desc:"uTLS指纹"`
+	RealityOpts       map[string]interface{} `config:"reality-opts,reality_opts,reality" desc:"REALITY配置: public-key, short-id"`
+	RealityPublicKey  string                 `config:"public-key,public_key,pbk" desc:"REALITY公钥，也可以写在reality-opts中"`
+	RealityShortID    string                 `config:"short-id,short_id,sid" desc:"REALITY short id，也可以写在reality-opts中"`
+}
+
+// realityOptions reality-opts配置段
+type realityOptions struct {
+	PublicKey string `config:"public-key,public_key"`
+	ShortID   string `config:"short-id,short_id"`
+}
+
+// parseTLSConfig 根据TLS配置创建TLS客户端配置
+func parseTLSConfig(opts TLSOptions) (*tlsclient.Config, error) {
+	tlsConfig := &tlsclient.Config{
+		ServerName:         strings.TrimSpace(opts.SNI),
+		NextProtos:         opts.ALPN,
+		InsecureSkipVerify: opts.SkipCertVerify,
+	}
+
+	// 自定义CA，支持PEM内容或文件路径
+	if ca := strings.TrimSpace(opts.CA); ca != "" {
+		pem := []byte(ca)
+		if !strings.Contains(ca, "-----BEGIN") {
+			data, err := os.ReadFile(ca)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file %s: %v", ca, err)
+			}
+			pem = data
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// 证书指纹，Clash的fingerprint字段是证书指纹，Xray的fingerprint字段是uTLS指纹
+	pins := append([]string(nil), opts.PinSHA256...)
+	if fingerprint := strings.TrimSpace(opts.Fingerprint); fingerprint != "" {
+		if tlsclient.IsFingerprint(fingerprint) {
+			tlsConfig.Fingerprint = fingerprint
+		} else {
+			pins = append(pins, fingerprint)
+		}
+	}
+	for _, s := range pins {
+		pin, err := tlsclient.ParsePin(s)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.PinnedSHA256 = append(tlsConfig.PinnedSHA256, pin)
+	}
+
+	if fingerprint := strings.TrimSpace(opts.ClientFingerprint); fingerprint != "" {
+		tlsConfig.Fingerprint = fingerprint
+	}
+	if strings.EqualFold(tlsConfig.Fingerprint, "none") {
+		tlsConfig.Fingerprint = ""
+	}
+
+	// REALITY，兼容扁平写法public_key/short_id
+	var reality realityOptions
+	if err := decodeConfig(opts.RealityOpts, &reality); err != nil {
+		return nil, fmt.Errorf("invalid reality-opts: %v", err)
+	}
+	publicKey := strings.TrimSpace(reality.PublicKey)
+	if publicKey == "" {
+		publicKey = strings.TrimSpace(opts.RealityPublicKey)
+	}
+	if publicKey != "" {
+		key, err := tlsclient.ParseRealityPublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		shortIDString := strings.TrimSpace(reality.ShortID)
+		if shortIDString == "" {
+			shortIDString = strings.TrimSpace(opts.RealityShortID)
+		}
+		shortID, err := tlsclient.ParseShortID(shortIDString)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Reality = &tlsclient.RealityConfig{PublicKey: key, ShortID: shortID}
+	}
+
+	if err := tlsConfig.Validate(); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+// parseQUICTLSConfig 解析QUIC类协议使用的TLS配置
+// QUIC的握手由quic-go完成，无法使用uTLS指纹和REALITY
+func parseQUICTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	tlsConfig, err := parseTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig.Reality != nil {
+		return nil, fmt.Errorf("reality is not supported over QUIC")
+	}
+	if tlsConfig.Fingerprint != "" {
+		log.Printf("QUIC协议不支持uTLS指纹，忽略client-fingerprint: %s", tlsConfig.Fingerprint)
+	}
+	return tlsConfig.StdConfig(), nil
+}
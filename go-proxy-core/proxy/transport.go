@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/dualvpn/go-proxy-core/transport"
+)
+
+// TransportOptions Trojan、VMess和VLESS共用的传输层配置
+// VMess/VLESS按配置创建传输层，但握手尚未实现，这两个协议仍不能通过协议管理器创建
+// network选择传输层: tcp/ws/grpc/h2/httpupgrade，各传输层的参数兼容Clash写法:
+//
+//	network: ws
+//	ws-opts:
+//	  path: /ray?ed=2048
+//	  headers: {Host: example.com}
+//	  max-early-data: 2048
+//	  early-data-header-name: Sec-WebSocket-Protocol
+//	grpc-opts: {grpc-service-name: name, multi-mode: false}
+//	h2-opts: {host: [example.com], path: /}
+//	httpupgrade-opts: {path: /, host: example.com}
+//
+// 也可以直接使用path、host、service_name等扁平字段。tls为true时在传输层之下使用TLS
+type TransportOptions struct {
+	Network     string                 `config:"network" enum:"tcp,ws,grpc,h2,httpupgrade" desc:"传输层"`
+	Host        string                 `config:"host" desc:"ws/h2/httpupgrade的Host"`
+	Path        string                 `config:"path" desc:"ws/h2/httpupgrade的路径"`
+	ServiceName string                 `config:"service_name,grpc_service_name,serviceName" desc:"gRPC服务名"`
+	Mode        string                 `config:"mode,grpc_mode" enum:"gun,multi" desc:"gRPC模式"`
+	MultiMode   *bool                  `config:"multi_mode" desc:"gRPC使用multi模式"`
+	WSOpts      map[string]interface{} `config:"ws-opts,ws_opts,httpupgrade-opts,httpupgrade_opts,http-upgrade-opts" desc:"WebSocket/HTTPUpgrade配置: path, host, headers, max-early-data, early-data-header-name"`
+	GRPCOpts    map[string]interface{} `config:"grpc-opts,grpc_opts" desc:"gRPC配置: grpc-service-name, multi-mode"`
+	H2Opts      map[string]interface{} `config:"h2-opts,h2_opts" desc:"HTTP/2配置: host, path"`
+	TLS         *bool                  `config:"tls" desc:"在传输层之下使用TLS"`
+	TLSOptions
+}
+
+// wsOptions ws-opts/httpupgrade-opts配置段
+type wsOptions struct {
+	Path                string            `config:"path"`
+	Host                string            `config:"host"`
+	Headers             map[string]string `config:"headers"`
+	MaxEarlyData        int               `config:"max-early-data,max_early_data" min:"0"`
+	EarlyDataHeaderName string            `config:"early-data-header-name,early_data_header_name"`
+	V2rayHTTPUpgrade    bool              `config:"v2ray-http-upgrade,v2ray_http_upgrade"`
+}
+
+// grpcOptions grpc-opts配置段
+type grpcOptions struct {
+	ServiceName string `config:"grpc-service-name,grpc_service_name,service_name"`
+	MultiMode   *bool  `config:"multi-mode,multi_mode"`
+}
+
+// h2Options h2-opts配置段，host为列表，只使用第一个
+type h2Options struct {
+	Host []string `config:"host"`
+	Path string   `config:"path"`
+}
+
+// newTransport 根据配置创建传输层，defaultTLS为未配置tls时的默认值
+func newTransport(opts TransportOptions, server string, port int, defaultTLS bool, dial func(ctx context.Context, network, address string) (net.Conn, error)) (transport.Transport, string, error) {
+	network := strings.ToLower(strings.TrimSpace(opts.Network))
+	switch network {
+	case "", "tcp":
+		network = transport.NetworkTCP
+	case "ws", "websocket":
+		network = transport.NetworkWebSocket
+	case "grpc", "gun":
+		network = transport.NetworkGRPC
+	case "h2", "http2":
+		network = transport.NetworkHTTP2
+	case "httpupgrade", "http-upgrade":
+		network = transport.NetworkHTTPUpgrade
+	default:
+		return nil, "", fmt.Errorf("unsupported transport network: %s", network)
+	}
+
+	transportConfig := transport.Config{
+		Network:     network,
+		Server:      net.JoinHostPort(server, strconv.Itoa(port)),
+		Host:        strings.TrimSpace(opts.Host),
+		Path:        strings.TrimSpace(opts.Path),
+		ServiceName: strings.TrimSpace(opts.ServiceName),
+		Timeout:     DefaultConnectTimeout,
+		DialContext: dial,
+	}
+
+	switch network {
+	case transport.NetworkWebSocket, transport.NetworkHTTPUpgrade:
+		var ws wsOptions
+		if err := decodeConfig(opts.WSOpts, &ws); err != nil {
+			return nil, "", fmt.Errorf("invalid ws-opts: %v", err)
+		}
+		if ws.V2rayHTTPUpgrade {
+			transportConfig.Network = transport.NetworkHTTPUpgrade
+		}
+		if path := strings.TrimSpace(ws.Path); path != "" {
+			transportConfig.Path = path
+		}
+		if host := strings.TrimSpace(ws.Host); host != "" {
+			transportConfig.Host = host
+		}
+		transportConfig.Headers = ws.Headers
+		for key, value := range transportConfig.Headers {
+			if strings.EqualFold(key, "Host") {
+				transportConfig.Host = value
+				delete(transportConfig.Headers, key)
+			}
+		}
+		transportConfig.MaxEarlyData = ws.MaxEarlyData
+		transportConfig.EarlyDataHeaderName = strings.TrimSpace(ws.EarlyDataHeaderName)
+	case transport.NetworkGRPC:
+		var grpc grpcOptions
+		if err := decodeConfig(opts.GRPCOpts, &grpc); err != nil {
+			return nil, "", fmt.Errorf("invalid grpc-opts: %v", err)
+		}
+		if name := strings.TrimSpace(grpc.ServiceName); name != "" {
+			transportConfig.ServiceName = name
+		}
+		if grpc.MultiMode != nil {
+			transportConfig.GRPCMulti = *grpc.MultiMode
+		}
+		if opts.MultiMode != nil {
+			transportConfig.GRPCMulti = *opts.MultiMode
+		}
+		if strings.EqualFold(strings.TrimSpace(opts.Mode), "multi") {
+			transportConfig.GRPCMulti = true
+		}
+	case transport.NetworkHTTP2:
+		var h2 h2Options
+		if err := decodeConfig(opts.H2Opts, &h2); err != nil {
+			return nil, "", fmt.Errorf("invalid h2-opts: %v", err)
+		}
+		if len(h2.Host) > 0 {
+			transportConfig.Host = h2.Host[0]
+		}
+		if path := strings.TrimSpace(h2.Path); path != "" {
+			transportConfig.Path = path
+		}
+	}
+
+	useTLS := defaultTLS
+	if opts.TLS != nil {
+		useTLS = *opts.TLS
+	}
+	if useTLS {
+		tlsConfig, err := parseTLSConfig(opts.TLSOptions)
+		if err != nil {
+			return nil, "", err
+		}
+		transportConfig.TLS = tlsConfig
+	}
+
+	t, err := transport.New(transportConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, transportConfig.Network, nil
+}
+
+// configStringMap 读取字符串键值对配置，如请求头
+func configStringMap(v interface{}) map[string]string {
+	result := make(map[string]string)
+	switch val := v.(type) {
+	case map[string]string:
+		for key, value := range val {
+			result[key] = value
+		}
+	case map[string]interface{}:
+		for key, value := range val {
+			if s, ok := value.(string); ok {
+				result[key] = s
+			}
+		}
+	}
+	return result
+}
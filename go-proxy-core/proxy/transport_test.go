@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNewTransportOptions(t *testing.T) {
+	dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, net.ErrClosed
+	}
+	for _, tc := range []struct {
+		name    string
+		config  map[string]interface{}
+		network string // 期望的传输层
+		err     string // 非空时期望错误信息包含该内容
+	}{
+		{name: "default", config: map[string]interface{}{}, network: "tcp"},
+		{name: "ws", config: map[string]interface{}{"network": "ws", "ws-opts": map[string]interface{}{"path": "/ray", "max-early-data": "2048"}}, network: "ws"},
+		{name: "v2ray http upgrade", config: map[string]interface{}{"network": "ws", "ws-opts": map[string]interface{}{"v2ray-http-upgrade": "true"}}, network: "httpupgrade"},
+		{name: "grpc multi mode", config: map[string]interface{}{"network": "grpc", "grpc-opts": map[string]interface{}{"grpc-service-name": "name", "multi-mode": "true"}}, network: "grpc"},
+		{name: "h2 host list", config: map[string]interface{}{"network": "h2", "h2-opts": map[string]interface{}{"host": []interface{}{"example.com"}}}, network: "h2"},
+		{name: "invalid early data", config: map[string]interface{}{"network": "ws", "ws-opts": map[string]interface{}{"max-early-data": "lots"}}, err: "invalid ws-opts"},
+		{name: "negative early data", config: map[string]interface{}{"network": "ws", "ws-opts": map[string]interface{}{"max-early-data": -1}}, err: "invalid ws-opts"},
+		{name: "invalid http upgrade flag", config: map[string]interface{}{"network": "ws", "ws-opts": map[string]interface{}{"v2ray-http-upgrade": "yes"}}, err: "invalid ws-opts"},
+		{name: "invalid multi mode", config: map[string]interface{}{"network": "grpc", "grpc-opts": map[string]interface{}{"multi-mode": "sometimes"}}, err: "invalid grpc-opts"},
+		{name: "invalid reality opts", config: map[string]interface{}{"tls": true, "reality-opts": map[string]interface{}{"public-key": map[string]interface{}{}}}, err: "invalid reality-opts"},
+		{name: "unknown network", config: map[string]interface{}{"network": "kcp"}, err: "unsupported transport network"},
+	} {
+		var opts TransportOptions
+		if err := decodeConfig(tc.config, &opts); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		tp, network, err := newTransport(opts, "127.0.0.1", 443, false, dial)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("%s: error = %v, want %q", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		tp.Close()
+		if network != tc.network {
+			t.Errorf("%s: network = %s, want %s", tc.name, network, tc.network)
+		}
+	}
+}
+
+func TestV2RayTransportSelection(t *testing.T) {
+	// VMess/VLESS的握手尚未实现，但已按配置选择传输层
+	factories := map[string]ProtocolFactory{"vmess": &VMessProtocolFactory{}, "vless": &VLESSProtocolFactory{}}
+	for name, factory := range factories {
+		for _, network := range []string{"tcp", "ws", "grpc", "h2", "httpupgrade"} {
+			protocol, err := factory.CreateProtocol(map[string]interface{}{
+				"server":       "127.0.0.1",
+				"port":         443,
+				"uuid":         "b831381d-6324-4d53-ad4f-8cda48b30811",
+				"network":      network,
+				"tls":          "true",
+				"service_name": "gun",
+			})
+			if err != nil {
+				t.Fatalf("%s over %s: %v", name, network, err)
+			}
+			var got string
+			switch p := protocol.(type) {
+			case *VMessProtocol:
+				got = p.network
+			case *VLESSProtocol:
+				got = p.network
+			}
+			if got != network {
+				t.Errorf("%s: network = %s, want %s", name, got, network)
+			}
+			protocol.Close()
+		}
+
+		_, err := factory.CreateProtocol(map[string]interface{}{
+			"server":  "127.0.0.1",
+			"port":    443,
+			"uuid":    "b831381d-6324-4d53-ad4f-8cda48b30811",
+			"network": "kcp",
+		})
+		if err == nil {
+			t.Errorf("%s: expected error for unknown network", name)
+		}
+	}
+
+	// 连接经由传输层到达服务器
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- struct{}{}
+			conn.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	protocol, err := (&VLESSProtocolFactory{}).CreateProtocol(map[string]interface{}{
+		"server": host,
+		"port":   port,
+		"uuid":   "b831381d-6324-4d53-ad4f-8cda48b30811",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer protocol.Close()
+	conn, err := protocol.DialContext(context.Background(), "tcp", "example.com:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	<-accepted
+}
@@ -1,37 +1,63 @@
 package proxy
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net"
-	"time"
+	"strconv"
+
+	"github.com/dualvpn/go-proxy-core/mux"
+	"github.com/dualvpn/go-proxy-core/transport"
+	"github.com/shadowsocks/go-shadowsocks2/socks"
 )
 
+// trojanCommandConnect Trojan请求中的CONNECT命令
+const trojanCommandConnect = 0x01
+
 // TrojanProtocol Trojan协议实现
 type TrojanProtocol struct {
 	BaseProtocol
-	server   string
-	port     int
-	password string
+	server    string
+	port      int
+	key       string              // 密码SHA-224的十六进制形式，用于请求头
+	network   string              // 传输层类型
+	transport transport.Transport // 到服务器的传输层
+	mux       *mux.Client         // 多路复用客户端，未启用时为nil
 }
 
 // TrojanProtocolFactory Trojan协议工厂
 type TrojanProtocolFactory struct{}
 
+// Capabilities Trojan协议只实现了TCP的CONNECT命令
+func (f *TrojanProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, Note: "udp associate is not implemented"}
+}
+
+// TrojanConfig Trojan协议配置，默认使用TLS
+type TrojanConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	Password string `config:"password" required:"true" desc:"密码"`
+	TransportOptions
+	MuxOptions
+}
+
+// Config 返回Trojan协议的配置结构
+func (f *TrojanProtocolFactory) Config() interface{} {
+	return &TrojanConfig{}
+}
+
 // CreateProtocol 创建Trojan协议实例
 func (f *TrojanProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg TrojanConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	password, _ := config["password"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("trojan-%s:%d", server, port)
 	}
@@ -41,33 +67,95 @@ func (f *TrojanProtocolFactory) CreateProtocol(config map[string]interface{}) (P
 			name:         name,
 			protocolType: ProtocolTrojan,
 		},
-		server:   server,
-		port:     port,
-		password: password,
+		server: server,
+		port:   port,
+		key:    trojanKey(cfg.Password),
+	}
+
+	// Trojan默认使用TLS
+	var err error
+	protocol.transport, protocol.network, err = newTransport(cfg.TransportOptions, server, port, true, protocol.dial)
+	if err != nil {
+		return nil, err
+	}
+	protocol.mux, err = newMuxClient(cfg.MuxOptions, protocol.dialTCP)
+	if err != nil {
+		protocol.transport.Close()
+		return nil, err
 	}
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址
+func (tp *TrojanProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%w: network %s", ErrUDPNotSupported, network)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	if tp.mux != nil {
+		return tp.mux.DialContext(ctx, targetAddr)
+	}
+	return tp.dialTCP(ctx, network, targetAddr)
+}
+
 // Connect 连接到目标地址（通过Trojan）
 func (tp *TrojanProtocol) Connect(targetAddr string) (net.Conn, error) {
-	// 连接到Trojan服务器
-	trojanAddr := fmt.Sprintf("%s:%d", tp.server, tp.port)
-	conn, err := net.DialTimeout("tcp", trojanAddr, 5*time.Second)
+	return connectTimeout(tp, targetAddr)
+}
+
+// dialTCP 建立到Trojan服务器的连接
+func (tp *TrojanProtocol) dialTCP(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	// 通过传输层连接到Trojan服务器
+	trojanAddr := net.JoinHostPort(tp.server, strconv.Itoa(tp.port))
+	conn, err := tp.transport.DialContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Trojan server %s: %v", trojanAddr, err)
+		return nil, fmt.Errorf("failed to connect to Trojan server %s over %s: %v", trojanAddr, tp.network, err)
 	}
 
-	// TODO: 实现Trojan协议握手逻辑
-	// 这里简化实现，直接返回连接
+	request, err := trojanRequest(tp.key, targetAddr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Trojan服务端不回复请求，目标不可达时服务端直接关闭连接
+	if _, err := conn.Write(request); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send Trojan request to %s: %v", trojanAddr, err)
+	}
 
 	return conn, nil
 }
 
+// trojanKey 计算Trojan请求头中的密码字段
+func trojanKey(password string) string {
+	sum := sha256.Sum224([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// trojanRequest 编码Trojan请求头: [hex(SHA224(密码))][CRLF][命令][SOCKS地址][CRLF]
+func trojanRequest(key, targetAddr string) ([]byte, error) {
+	addr := socks.ParseAddr(targetAddr)
+	if addr == nil {
+		return nil, fmt.Errorf("failed to parse target address: %s", targetAddr)
+	}
+	b := make([]byte, 0, len(key)+len(addr)+5)
+	b = append(b, key...)
+	b = append(b, '\r', '\n', trojanCommandConnect)
+	b = append(b, addr...)
+	return append(b, '\r', '\n'), nil
+}
+
 // Close 关闭连接
 func (tp *TrojanProtocol) Close() error {
-	// Trojan协议关闭逻辑
-	return nil
+	if tp.mux != nil {
+		tp.mux.Close()
+	}
+	return tp.transport.Close()
 }
 
 // IsRunning 检查协议是否正在运行
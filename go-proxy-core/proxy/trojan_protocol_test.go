@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"github.com/dualvpn/go-proxy-core/mux"
+	"github.com/shadowsocks/go-shadowsocks2/socks"
+)
+
+// startTrojanServer 启动最小化的Trojan服务端，useTLS为真时使用自签名证书
+// 密码错误或请求格式错误时直接关闭连接
+func startTrojanServer(t *testing.T, password string, useTLS bool) (string, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	if useTLS {
+		cert, _ := testutil.Certificate(t)
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	key := trojanKey(password)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				header := make([]byte, len(key)+3)
+				if _, err := io.ReadFull(reader, header); err != nil {
+					return
+				}
+				if string(header[:len(key)]) != key || string(header[len(key):len(key)+2]) != "\r\n" || header[len(key)+2] != trojanCommandConnect {
+					return
+				}
+				target, err := socks.ReadAddr(reader)
+				if err != nil {
+					return
+				}
+				crlf := make([]byte, 2)
+				if _, err := io.ReadFull(reader, crlf); err != nil || string(crlf) != "\r\n" {
+					return
+				}
+
+				remote, err := net.Dial("tcp", target.String())
+				if err != nil {
+					return
+				}
+				defer remote.Close()
+				go io.Copy(remote, reader)
+				io.Copy(conn, remote)
+			}()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func TestTrojanConnect(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	for _, useTLS := range []bool{true, false} {
+		host, port := startTrojanServer(t, "trojan-password", useTLS)
+
+		// 与POST /protocols一致，数字为float64
+		config := map[string]interface{}{
+			"server":           host,
+			"port":             float64(port),
+			"password":         "trojan-password",
+			"tls":              useTLS,
+			"skip-cert-verify": true,
+		}
+		protocol, err := (&TrojanProtocolFactory{}).CreateProtocol(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := protocol.Connect(target)
+		if err != nil {
+			t.Fatalf("tls=%t: connect: %v", useTLS, err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte("through trojan")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len("through trojan"))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("tls=%t: read: %v", useTLS, err)
+		}
+		if string(buf) != "through trojan" {
+			t.Fatalf("echo = %q", buf)
+		}
+		conn.Close()
+		protocol.Close()
+	}
+}
+
+func TestTrojanWrongPassword(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	host, port := startTrojanServer(t, "trojan-password", false)
+	protocol, err := (&TrojanProtocolFactory{}).CreateProtocol(map[string]interface{}{
+		"server":   host,
+		"port":     port,
+		"password": "wrong",
+		"tls":      false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := protocol.Connect(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("ping"))
+	if _, err := conn.Read(make([]byte, 4)); err == nil {
+		t.Fatal("expected server to close connection for wrong password")
+	}
+}
+
+func TestTrojanMux(t *testing.T) {
+	// 启用多路复用时，Trojan请求的目标是复用会话的虚拟地址而不是实际目标
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	targets := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := io.ReadFull(conn, make([]byte, len(trojanKey("password"))+3)); err != nil {
+			return
+		}
+		target, err := socks.ReadAddr(conn)
+		if err != nil {
+			return
+		}
+		targets <- target.String()
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	protocol, err := (&TrojanProtocolFactory{}).CreateProtocol(map[string]interface{}{
+		"server":   host,
+		"port":     port,
+		"password": "password",
+		"tls":      false,
+		"smux":     map[string]interface{}{"enabled": "true", "protocol": "yamux"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer protocol.Close()
+	if protocol.(*TrojanProtocol).mux == nil {
+		t.Fatal("mux is not enabled")
+	}
+
+	// 测试服务端不处理复用会话，连接结果不重要
+	go func() {
+		if conn, err := protocol.Connect("example.com:80"); err == nil {
+			conn.Close()
+		}
+	}()
+	select {
+	case target := <-targets:
+		if target != mux.Destination {
+			t.Fatalf("trojan target = %s, want %s", target, mux.Destination)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("trojan server got no request")
+	}
+}
+
+func TestTrojanRequest(t *testing.T) {
+	key := trojanKey("password")
+	// SHA224("password")
+	if key != "d63dc919e201d7bc4c825630d2cf25fdc93d4b2f0d46706d29038d01" {
+		t.Fatalf("key = %s", key)
+	}
+
+	request, err := trojanRequest(key, "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(key+"\r\n\x01\x03\x0bexample.com\x01\xbb"), '\r', '\n')
+	if !bytes.Equal(request, want) {
+		t.Fatalf("request = %q, want %q", request, want)
+	}
+
+	if _, err := trojanRequest(key, "no-port"); err == nil {
+		t.Fatal("expected error for invalid target")
+	}
+}
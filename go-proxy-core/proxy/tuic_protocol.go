@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/tuic"
+)
+
+// TUICProtocol TUIC v5协议实现
+type TUICProtocol struct {
+	BaseProtocol
+	server       string
+	port         int
+	udpRelayMode string // UDP转发模式: native/quic
+	client       *tuic.Client
+}
+
+// TUICProtocolFactory TUIC协议工厂
+type TUICProtocolFactory struct{}
+
+// Capabilities 返回TUIC协议支持的能力
+func (f *TUICProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true}
+}
+
+// TUICConfig TUIC协议配置，字段兼容Clash的连字符写法
+type TUICConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	UUID              string `config:"uuid" required:"true" desc:"用户UUID"`
+	Password          string `config:"password" desc:"密码"`
+	UDPRelayMode      string `config:"udp_relay_mode,udp-relay-mode" default:"native" enum:"native,quic" desc:"UDP转发模式"`
+	CongestionControl string `config:"congestion_control,congestion-controller" enum:"cubic,new_reno,bbr" desc:"拥塞控制算法"`
+	ZeroRTT           bool   `config:"zero_rtt_handshake,reduce-rtt,zero_rtt" desc:"启用0-RTT握手"`
+	Heartbeat         int    `config:"heartbeat,heartbeat-interval" desc:"心跳间隔（毫秒）"`
+	TLSOptions
+}
+
+// Config 返回TUIC协议的配置结构
+func (f *TUICProtocolFactory) Config() interface{} {
+	return &TUICConfig{}
+}
+
+// CreateProtocol 创建TUIC协议实例
+func (f *TUICProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
+	var cfg TUICConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	server, port, udpRelayMode := cfg.Server, cfg.Port, cfg.UDPRelayMode
+
+	uuid, err := tuic.ParseUUID(cfg.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 心跳间隔（毫秒）
+	var heartbeat time.Duration
+	if cfg.Heartbeat > 0 {
+		heartbeat = time.Duration(cfg.Heartbeat) * time.Millisecond
+	}
+
+	tlsConfig, err := parseQUICTLSConfig(cfg.TLSOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("tuic-%s:%d", server, port)
+	}
+
+	protocol := &TUICProtocol{
+		BaseProtocol: BaseProtocol{
+			name:         name,
+			protocolType: ProtocolTUIC,
+		},
+		server:       server,
+		port:         port,
+		udpRelayMode: udpRelayMode,
+	}
+
+	client, err := tuic.NewClient(tuic.ClientConfig{
+		Server:            net.JoinHostPort(server, strconv.Itoa(port)),
+		UUID:              uuid,
+		Password:          cfg.Password,
+		TLS:               tlsConfig,
+		UDPRelayMode:      udpRelayMode,
+		CongestionControl: cfg.CongestionControl,
+		ZeroRTT:           cfg.ZeroRTT,
+		Heartbeat:         heartbeat,
+		Timeout:           DefaultConnectTimeout,
+		DialContext:       protocol.dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	protocol.client = client
+
+	// 添加日志以调试TUIC协议创建
+	log.Printf("创建TUIC协议: server=%s, port=%d, udp_relay_mode=%s, congestion_control=%s, zero_rtt=%t",
+		server, port, udpRelayMode, cfg.CongestionControl, cfg.ZeroRTT)
+
+	return protocol, nil
+}
+
+// Connect 连接到目标地址（通过TUIC）
+func (tp *TUICProtocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(tp, targetAddr)
+}
+
+// DialContext 连接到目标地址，tcp使用双向流，udp使用UDP关联
+func (tp *TUICProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return dialPacketConn(ctx, tp, targetAddr)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	log.Printf("TUIC协议开始连接: targetAddr=%s, server=%s, port=%d", targetAddr, tp.server, tp.port)
+
+	conn, err := tp.client.DialContext(ctx, targetAddr)
+	if err != nil {
+		log.Printf("通过TUIC服务器连接目标失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("TUIC协议成功连接到目标: %s 通过服务器: %s:%d", targetAddr, tp.server, tp.port)
+	return conn, nil
+}
+
+// ListenPacket 建立UDP关联
+func (tp *TUICProtocol) ListenPacket(ctx context.Context, targetAddr string) (net.PacketConn, error) {
+	log.Printf("TUIC协议建立UDP转发: server=%s, port=%d, mode=%s", tp.server, tp.port, tp.udpRelayMode)
+	return tp.client.ListenPacket(ctx)
+}
+
+// SupportsUDP TUIC支持UDP
+func (tp *TUICProtocol) SupportsUDP() bool {
+	return true
+}
+
+// Close 关闭连接
+func (tp *TUICProtocol) Close() error {
+	return tp.client.Close()
+}
+
+// IsRunning 检查协议是否正在运行
+func (tp *TUICProtocol) IsRunning() bool {
+	return true
+}
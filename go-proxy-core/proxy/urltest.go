@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/tlsclient"
+)
+
+const (
+	// DefaultTestURL 延迟测试默认使用的地址，返回204且没有响应体
+	DefaultTestURL = "https://www.gstatic.com/generate_204"
+	// DefaultTestTimeout 延迟测试的默认超时时间
+	DefaultTestTimeout = 5 * time.Second
+)
+
+// URLTestResult 一次延迟测试的结果
+type URLTestResult struct {
+	ConnectTime time.Duration // 通过协议建立到测试地址的连接（含TLS握手）的耗时
+	TTFB        time.Duration // 发出请求到收到第一个响应字节的耗时
+	StatusCode  int
+}
+
+// Delay 返回从开始连接到收到响应的总耗时
+func (r URLTestResult) Delay() time.Duration {
+	return r.ConnectTime + r.TTFB
+}
+
+// urlTest 通过协议向测试地址发送HEAD请求，测量连接耗时和首字节时间
+// 收到任何HTTP响应都视为成功，状态码由调用方判断
+func urlTest(ctx context.Context, protocol ProxyProtocol, rawURL string) (URLTestResult, error) {
+	var result URLTestResult
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return result, fmt.Errorf("invalid test url %s: %v", rawURL, err)
+	}
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return result, fmt.Errorf("unsupported test url scheme: %s", u.Scheme)
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+
+	start := time.Now()
+	conn, err := protocol.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return result, err
+	}
+	// ctx结束时中断阻塞的读写
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	if u.Scheme == "https" {
+		tlsConfig := &tlsclient.Config{ServerName: u.Hostname()}
+		if conn, err = tlsConfig.Client(ctx, conn, "http/1.1"); err != nil {
+			return result, fmt.Errorf("tls handshake with %s failed: %v", address, err)
+		}
+		defer conn.Close()
+	}
+	result.ConnectTime = time.Since(start)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("User-Agent", "go-proxy-core")
+	req.Close = true
+
+	start = time.Now()
+	if err := req.Write(conn); err != nil {
+		return result, fmt.Errorf("failed to send test request: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	if _, err := reader.Peek(1); err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		return result, fmt.Errorf("failed to read test response: %v", err)
+	}
+	result.TTFB = time.Since(start)
+
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return result, fmt.Errorf("invalid test response: %v", err)
+	}
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	return result, nil
+}
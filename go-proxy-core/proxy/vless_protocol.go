@@ -1,83 +1,114 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
-	"time"
+	"strconv"
+
+	"github.com/dualvpn/go-proxy-core/transport"
 )
 
 // VLESSProtocol VLESS协议实现
 type VLESSProtocol struct {
 	BaseProtocol
-	server  string
-	port    int
-	uuid    string
-	network string
-	tls     bool
+	server    string
+	port      int
+	uuid      string
+	network   string              // 传输层类型
+	transport transport.Transport // 到服务器的传输层
 }
 
 // VLESSProtocolFactory VLESS协议工厂
 type VLESSProtocolFactory struct{}
 
+// Capabilities VLESS协议尚未实现握手，不能创建
+func (f *VLESSProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// VLESSConfig VLESS协议配置
+// 传输层按TransportOptions选择，握手尚未实现，也不支持多路复用（smux）；实现时需要像Trojan一样嵌入MuxOptions
+type VLESSConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	UUID string `config:"uuid,id" required:"true" desc:"用户UUID"`
+	TransportOptions
+}
+
+// Config 返回VLESS协议的配置结构
+func (f *VLESSProtocolFactory) Config() interface{} {
+	return &VLESSConfig{}
+}
+
 // CreateProtocol 创建VLESS协议实例
 func (f *VLESSProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
-	}
-
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
+	var cfg VLESSConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port, uuid := cfg.Server, cfg.Port, cfg.UUID
 
-	uuid, _ := config["uuid"].(string)
-	network, _ := config["network"].(string)
-	tls, _ := config["tls"].(bool)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("vless-%s:%d", server, port)
 	}
 
-	// 默认值
-	if network == "" {
-		network = "tcp"
-	}
-
 	protocol := &VLESSProtocol{
 		BaseProtocol: BaseProtocol{
 			name:         name,
 			protocolType: ProtocolVLESS,
 		},
-		server:  server,
-		port:    port,
-		uuid:    uuid,
-		network: network,
-		tls:     tls,
+		server: server,
+		port:   port,
+		uuid:   uuid,
+	}
+
+	var err error
+	protocol.transport, protocol.network, err = newTransport(cfg.TransportOptions, server, port, false, protocol.dial)
+	if err != nil {
+		return nil, err
 	}
 
 	// 添加日志以调试VLESS协议创建
-	log.Printf("创建VLESS协议: server=%s, port=%d, uuid=%s, network=%s, tls=%t", server, port, uuid, network, tls)
+	log.Printf("创建VLESS协议: server=%s, port=%d, uuid=%s, network=%s", server, port, uuid, protocol.network)
 
 	return protocol, nil
 }
 
+// DialContext 连接到目标地址
+func (vp *VLESSProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%w: network %s", ErrUDPNotSupported, network)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	return vp.dialTCP(ctx, network, targetAddr)
+}
+
 // Connect 连接到目标地址（通过VLESS）
 func (vp *VLESSProtocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(vp, targetAddr)
+}
+
+// dialTCP 建立到VLESS服务器的连接
+func (vp *VLESSProtocol) dialTCP(ctx context.Context, network, targetAddr string) (net.Conn, error) {
 	// 添加详细的连接日志
-	log.Printf("VLESS协议开始连接: targetAddr=%s, server=%s, port=%d, uuid=%s, network=%s, tls=%t",
-		targetAddr, vp.server, vp.port, vp.uuid, vp.network, vp.tls)
+	log.Printf("VLESS协议开始连接: targetAddr=%s, server=%s, port=%d, uuid=%s, network=%s",
+		targetAddr, vp.server, vp.port, vp.uuid, vp.network)
 
 	// 连接到VLESS服务器
-	vlessAddr := fmt.Sprintf("%s:%d", vp.server, vp.port)
+	vlessAddr := net.JoinHostPort(vp.server, strconv.Itoa(vp.port))
 	log.Printf("连接到VLESS服务器地址: %s", vlessAddr)
 
-	conn, err := net.DialTimeout("tcp", vlessAddr, 5*time.Second)
+	conn, err := vp.transport.DialContext(ctx)
 	if err != nil {
 		log.Printf("连接VLESS服务器失败: %v", err)
-		return nil, fmt.Errorf("failed to connect to VLESS server %s: %v", vlessAddr, err)
+		return nil, fmt.Errorf("failed to connect to VLESS server %s over %s: %v", vlessAddr, vp.network, err)
 	}
 
 	// TODO: 实现VLESS协议握手逻辑
@@ -91,8 +122,7 @@ func (vp *VLESSProtocol) Connect(targetAddr string) (net.Conn, error) {
 
 // Close 关闭连接
 func (vp *VLESSProtocol) Close() error {
-	// VLESS协议关闭逻辑
-	return nil
+	return vp.transport.Close()
 }
 
 // IsRunning 检查协议是否正在运行
@@ -1,55 +1,63 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"time"
+	"strconv"
+
+	"github.com/dualvpn/go-proxy-core/transport"
 )
 
 // VMessProtocol VMess协议实现
 type VMessProtocol struct {
 	BaseProtocol
-	server   string
-	port     int
-	userID   string
-	alterID  int
-	security string // 加密方式
-	network  string // 传输协议
+	server    string
+	port      int
+	userID    string
+	alterID   int
+	security  string              // 加密方式
+	network   string              // 传输层类型
+	transport transport.Transport // 到服务器的传输层
 }
 
 // VMessProtocolFactory VMess协议工厂
 type VMessProtocolFactory struct{}
 
+// Capabilities VMess协议尚未实现握手，不能创建
+func (f *VMessProtocolFactory) Capabilities() ProtocolCapabilities {
+	return unimplementedCapabilities()
+}
+
+// VMessConfig VMess协议配置
+// 传输层按TransportOptions选择，握手尚未实现
+type VMessConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	UUID     string `config:"uuid,user_id,id" required:"true" desc:"用户UUID"`
+	AlterID  int    `config:"alter_id,alterId,aid" min:"0" desc:"alterId"`
+	Security string `config:"security,cipher" default:"auto" enum:"auto,aes-128-gcm,chacha20-poly1305,none,zero" desc:"加密方式"`
+	TransportOptions
+}
+
+// Config 返回VMess协议的配置结构
+func (f *VMessProtocolFactory) Config() interface{} {
+	return &VMessConfig{}
+}
+
 // CreateProtocol 创建VMess协议实例
 func (f *VMessProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg VMessConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
 	}
+	server, port := cfg.Server, cfg.Port
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
-	}
-
-	userID, _ := config["user_id"].(string)
-	alterID, _ := config["alter_id"].(int)
-	security, _ := config["security"].(string)
-	network, _ := config["network"].(string)
-	name, _ := config["name"].(string)
-
+	name := cfg.Name
 	if name == "" {
 		name = fmt.Sprintf("vmess-%s:%d", server, port)
 	}
 
-	if security == "" {
-		security = "auto" // 默认加密方式
-	}
-
-	if network == "" {
-		network = "tcp" // 默认传输协议
-	}
-
 	protocol := &VMessProtocol{
 		BaseProtocol: BaseProtocol{
 			name:         name,
@@ -57,22 +65,35 @@ func (f *VMessProtocolFactory) CreateProtocol(config map[string]interface{}) (Pr
 		},
 		server:   server,
 		port:     port,
-		userID:   userID,
-		alterID:  alterID,
-		security: security,
-		network:  network,
+		userID:   cfg.UUID,
+		alterID:  cfg.AlterID,
+		security: cfg.Security,
+	}
+
+	var err error
+	protocol.transport, protocol.network, err = newTransport(cfg.TransportOptions, server, port, false, protocol.dial)
+	if err != nil {
+		return nil, err
 	}
 
 	return protocol, nil
 }
 
-// Connect 连接到目标地址（通过VMess）
-func (vp *VMessProtocol) Connect(targetAddr string) (net.Conn, error) {
-	// 连接到VMess服务器
-	vmessAddr := fmt.Sprintf("%s:%d", vp.server, vp.port)
-	conn, err := net.DialTimeout("tcp", vmessAddr, 5*time.Second)
+// DialContext 连接到目标地址，仅支持TCP
+func (vp *VMessProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	case "udp", "udp4", "udp6":
+		return nil, fmt.Errorf("%w: network %s", ErrUDPNotSupported, network)
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	// 通过传输层连接到VMess服务器
+	vmessAddr := net.JoinHostPort(vp.server, strconv.Itoa(vp.port))
+	conn, err := vp.transport.DialContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to VMess server %s: %v", vmessAddr, err)
+		return nil, fmt.Errorf("failed to connect to VMess server %s over %s: %v", vmessAddr, vp.network, err)
 	}
 
 	// TODO: 实现VMess协议握手逻辑
@@ -81,10 +102,14 @@ func (vp *VMessProtocol) Connect(targetAddr string) (net.Conn, error) {
 	return conn, nil
 }
 
+// Connect 连接到目标地址（通过VMess）
+func (vp *VMessProtocol) Connect(targetAddr string) (net.Conn, error) {
+	return connectTimeout(vp, targetAddr)
+}
+
 // Close 关闭连接
 func (vp *VMessProtocol) Close() error {
-	// VMess协议关闭逻辑
-	return nil
+	return vp.transport.Close()
 }
 
 // IsRunning 检查协议是否正在运行
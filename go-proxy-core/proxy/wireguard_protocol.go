@@ -1,41 +1,133 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net"
-	"time"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/dualvpn/go-proxy-core/wireguard"
 )
 
 // WireGuardProtocol WireGuard协议实现
+// 使用wireguard-go和gVisor网络栈在用户态建立隧道，Connect在隧道内建立连接
 type WireGuardProtocol struct {
 	BaseProtocol
 	server     string
 	port       int
 	publicKey  string
 	privateKey string
+	tunnel     *wireguard.Tunnel
 }
 
 // WireGuardProtocolFactory WireGuard协议工厂
 type WireGuardProtocolFactory struct{}
 
+// Capabilities 返回WireGuard协议支持的能力
+func (f *WireGuardProtocolFactory) Capabilities() ProtocolCapabilities {
+	return ProtocolCapabilities{Implemented: true, TCP: true, UDP: true}
+}
+
+// WireGuardConfig WireGuard协议配置，接口地址兼容Clash的ip/ipv6字段
+type WireGuardConfig struct {
+	Name string `config:"name" desc:"协议名称"`
+	ServerOptions
+	PrivateKey   string   `config:"private_key,private-key" required:"true" desc:"本地私钥"`
+	PublicKey    string   `config:"public_key,public-key" required:"true" desc:"对端公钥"`
+	PresharedKey string   `config:"preshared_key,pre_shared_key,pre-shared-key" desc:"预共享密钥"`
+	IP           []string `config:"ip" desc:"接口IPv4地址"`
+	IPv6         []string `config:"ipv6" desc:"接口IPv6地址"`
+	Address      []string `config:"address,addresses" desc:"接口地址列表"`
+	AllowedIPs   []string `config:"allowed_ips,allowed-ips" desc:"经由隧道的目标网段"`
+	DNS          []string `config:"dns" desc:"隧道内使用的DNS服务器"`
+	MTU          int      `config:"mtu" min:"0" desc:"隧道MTU"`
+	KeepAlive    int      `config:"persistent_keepalive,keepalive,persistent-keepalive" min:"0" desc:"保活间隔（秒）"`
+}
+
+// Config 返回WireGuard协议的配置结构
+func (f *WireGuardProtocolFactory) Config() interface{} {
+	return &WireGuardConfig{}
+}
+
 // CreateProtocol 创建WireGuard协议实例
 func (f *WireGuardProtocolFactory) CreateProtocol(config map[string]interface{}) (ProxyProtocol, error) {
-	server, ok := config["server"].(string)
-	if !ok {
-		return nil, fmt.Errorf("missing server in config")
+	var cfg WireGuardConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	server, port, publicKey, privateKey := cfg.Server, cfg.Port, cfg.PublicKey, cfg.PrivateKey
+
+	name := cfg.Name
+	if name == "" {
+		name = fmt.Sprintf("wireguard-%s:%d", server, port)
 	}
 
-	port, ok := config["port"].(int)
-	if !ok {
-		return nil, fmt.Errorf("missing port in config")
+	// WireGuard使用UDP传输，前置代理只能提供TCP连接
+	if via := dialerProxyName(config); via != "" {
+		return nil, fmt.Errorf("wireguard does not support dialer proxy %s", via)
 	}
 
-	publicKey, _ := config["public_key"].(string)
-	privateKey, _ := config["private_key"].(string)
-	name, _ := config["name"].(string)
+	// 接口地址，兼容Clash的ip/ipv6字段
+	var addresses []netip.Prefix
+	for _, list := range [][]string{cfg.IP, cfg.IPv6, cfg.Address} {
+		for _, s := range list {
+			prefix, err := parseWireGuardPrefix(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid wireguard address %s: %v", s, err)
+			}
+			addresses = append(addresses, prefix)
+		}
+	}
 
-	if name == "" {
-		name = fmt.Sprintf("wireguard-%s:%d", server, port)
+	var allowedIPs []netip.Prefix
+	for _, s := range cfg.AllowedIPs {
+		prefix, err := parseWireGuardPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wireguard allowed ip %s: %v", s, err)
+		}
+		allowedIPs = append(allowedIPs, prefix)
+	}
+
+	var dnsServers []netip.Addr
+	for _, s := range cfg.DNS {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wireguard dns %s: %v", s, err)
+		}
+		dnsServers = append(dnsServers, addr)
+	}
+
+	mtu := cfg.MTU
+
+	// 对端域名按地址族策略解析，未配置时保持优先IPv4
+	strategy, err := parseIPStrategy(config)
+	if err != nil {
+		return nil, err
+	}
+	if strategy == IPStrategyDual {
+		strategy = IPStrategyPreferIPv4
+	}
+	resolver := &directDialer{strategy: strategy}
+
+	tunnel, err := wireguard.NewTunnel(wireguard.Config{
+		PrivateKey:    privateKey,
+		PeerPublicKey: publicKey,
+		PresharedKey:  cfg.PresharedKey,
+		Endpoint:      net.JoinHostPort(server, strconv.Itoa(port)),
+		Addresses:     addresses,
+		AllowedIPs:    allowedIPs,
+		DNS:           dnsServers,
+		MTU:           mtu,
+		KeepAlive:     cfg.KeepAlive,
+		Resolve: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return resolver.lookup(ctx, "udp", host)
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	protocol := &WireGuardProtocol{
@@ -47,35 +139,70 @@ func (f *WireGuardProtocolFactory) CreateProtocol(config map[string]interface{})
 		port:       port,
 		publicKey:  publicKey,
 		privateKey: privateKey,
+		tunnel:     tunnel,
 	}
 
+	// 添加日志以调试WireGuard协议创建
+	log.Printf("创建WireGuard协议: server=%s, port=%d, addresses=%v, mtu=%d", server, port, addresses, mtu)
+
 	return protocol, nil
 }
 
 // Connect 连接到目标地址（通过WireGuard）
 func (wp *WireGuardProtocol) Connect(targetAddr string) (net.Conn, error) {
-	// 连接到WireGuard服务器
-	// 注意：这是一个简化的实现，实际的WireGuard连接需要更复杂的握手过程
-	wgAddr := fmt.Sprintf("%s:%d", wp.server, wp.port)
-	conn, err := net.DialTimeout("udp", wgAddr, 10*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to WireGuard server %s: %v", wgAddr, err)
+	return connectTimeout(wp, targetAddr)
+}
+
+// DialContext 通过WireGuard隧道连接到目标地址，支持tcp和udp
+func (wp *WireGuardProtocol) DialContext(ctx context.Context, network, targetAddr string) (net.Conn, error) {
+	log.Printf("WireGuard协议开始连接: targetAddr=%s, server=%s, port=%d", targetAddr, wp.server, wp.port)
+
+	// 首次使用时启动用户态隧道
+	if !wp.tunnel.IsRunning() {
+		if err := wp.tunnel.Start(); err != nil {
+			log.Printf("启动WireGuard隧道失败: %v", err)
+			return nil, fmt.Errorf("failed to start WireGuard tunnel: %v", err)
+		}
 	}
 
-	// TODO: 实现WireGuard协议握手逻辑
-	// 这里简化实现，直接返回连接
+	conn, err := wp.tunnel.DialContext(ctx, network, targetAddr)
+	if err != nil {
+		log.Printf("通过WireGuard隧道连接目标失败: %v", err)
+		return nil, fmt.Errorf("failed to connect to target %s through WireGuard: %v", targetAddr, err)
+	}
 
+	log.Printf("WireGuard协议成功连接到目标: %s", targetAddr)
 	return conn, nil
 }
 
+// SetSocketOptions 设置本地UDP套接字的fwmark
+// wireguard-go的UDP绑定不支持指定网卡和源地址
+func (wp *WireGuardProtocol) SetSocketOptions(options SocketOptions) error {
+	if options.Interface != "" || options.SourceAddr != nil {
+		return fmt.Errorf("wireguard only supports routing mark socket option")
+	}
+	return wp.tunnel.SetFwMark(uint32(options.RoutingMark))
+}
+
 // Close 关闭连接
 func (wp *WireGuardProtocol) Close() error {
-	// WireGuard协议关闭逻辑
-	return nil
+	return wp.tunnel.Stop()
 }
 
 // IsRunning 检查协议是否正在运行
 func (wp *WireGuardProtocol) IsRunning() bool {
-	// WireGuard协议运行状态检查
-	return true
+	return wp.tunnel.IsRunning()
+}
+
+// parseWireGuardPrefix 解析地址段，单个IP按主机地址处理
+func parseWireGuardPrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
 }
@@ -0,0 +1,319 @@
+package sharelink
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseShadowsocks 解析ss://链接
+// SIP002: ss://base64url(method:password)@host:port/?plugin=...#name，2022系列加密的用户信息可以是百分号编码的明文
+// 旧格式: ss://base64(method:password@host:port)#name
+func parseShadowsocks(link string) (*Node, error) {
+	rest, name := splitFragment(strings.TrimPrefix(link[len("ss://"):], "//"))
+
+	var query url.Values
+	if i := strings.Index(rest, "?"); i >= 0 {
+		q, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		query = q
+		rest = rest[:i]
+	}
+	rest = strings.TrimSuffix(rest, "/")
+
+	if !strings.Contains(rest, "@") {
+		decoded, err := DecodeBase64(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64: %v", err)
+		}
+		rest = string(decoded)
+	}
+
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return nil, fmt.Errorf("missing server")
+	}
+	userinfo, hostport := rest[:at], rest[at+1:]
+	if decoded, err := DecodeBase64(userinfo); err == nil && strings.Contains(string(decoded), ":") {
+		userinfo = string(decoded)
+	} else if unescaped, err := url.PathUnescape(userinfo); err == nil {
+		userinfo = unescaped
+	}
+	method, password, ok := strings.Cut(userinfo, ":")
+	if !ok || method == "" {
+		return nil, fmt.Errorf("missing method or password")
+	}
+
+	server, port, err := parseHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &Node{
+		Name:   name,
+		Type:   TypeShadowsocks,
+		Server: server,
+		Port:   port,
+		Config: map[string]interface{}{
+			"cipher":   strings.ToLower(method),
+			"password": password,
+		},
+	}
+	if plugin := query.Get("plugin"); plugin != "" {
+		parseShadowsocksPlugin(plugin, node.Config)
+	}
+	return node, nil
+}
+
+// parseShadowsocksPlugin 将SIP003插件参数（如obfs-local;obfs=http;obfs-host=example.com）转换为Clash的plugin和plugin-opts
+func parseShadowsocksPlugin(plugin string, config map[string]interface{}) {
+	parts := strings.Split(plugin, ";")
+	name := parts[0]
+	opts := make(map[string]interface{})
+	for _, part := range parts[1:] {
+		key, value, hasValue := strings.Cut(part, "=")
+		if key == "" {
+			continue
+		}
+		if !hasValue {
+			opts[key] = true
+			continue
+		}
+		opts[key] = value
+	}
+
+	switch name {
+	case "obfs-local", "simple-obfs":
+		name = "obfs"
+		if mode, ok := opts["obfs"]; ok {
+			opts["mode"] = mode
+			delete(opts, "obfs")
+		}
+		if host, ok := opts["obfs-host"]; ok {
+			opts["host"] = host
+			delete(opts, "obfs-host")
+		}
+	}
+	config["plugin"] = name
+	if len(opts) > 0 {
+		config["plugin-opts"] = opts
+	}
+}
+
+// parseShadowsocksR 解析ssr://链接
+// ssr://base64url(host:port:protocol:method:obfs:base64url(password)/?obfsparam=...&protoparam=...&remarks=...)
+func parseShadowsocksR(link string) (*Node, error) {
+	decoded, err := DecodeBase64(link[len("ssr://"):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+
+	main, params, _ := strings.Cut(string(decoded), "/?")
+	main = strings.TrimSuffix(main, "/")
+	fields := strings.Split(main, ":")
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("expected host:port:protocol:method:obfs:password")
+	}
+	// 服务器地址可能是包含冒号的IPv6地址，其余字段从右侧取
+	n := len(fields)
+	host := strings.Join(fields[:n-5], ":")
+	server, port, err := parseHostPort("[" + strings.Trim(host, "[]") + "]:" + fields[n-5])
+	if err != nil {
+		return nil, err
+	}
+	password, err := DecodeBase64(fields[n-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid password: %v", err)
+	}
+
+	node := &Node{
+		Type:   TypeShadowsocksR,
+		Server: server,
+		Port:   port,
+		Config: map[string]interface{}{
+			"protocol": fields[n-4],
+			"cipher":   fields[n-3],
+			"obfs":     fields[n-2],
+			"password": string(password),
+		},
+	}
+
+	query, err := url.ParseQuery(params)
+	if err != nil {
+		return nil, err
+	}
+	decodeParam := func(key string) string {
+		value, err := DecodeBase64(query.Get(key))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(value))
+	}
+	setString(node.Config, "obfs-param", decodeParam("obfsparam"))
+	setString(node.Config, "protocol-param", decodeParam("protoparam"))
+	node.Name = decodeParam("remarks")
+	return node, nil
+}
+
+// sip008Document SIP008格式的Shadowsocks订阅
+type sip008Document struct {
+	Version int `json:"version"`
+	Servers []struct {
+		Remarks    string      `json:"remarks"`
+		Server     string      `json:"server"`
+		ServerPort interface{} `json:"server_port"`
+		Password   string      `json:"password"`
+		Method     string      `json:"method"`
+		Plugin     string      `json:"plugin"`
+		PluginOpts string      `json:"plugin_opts"`
+	} `json:"servers"`
+}
+
+// ParseSIP008 解析SIP008格式的JSON订阅，无法解析的服务器放在errs中返回
+func ParseSIP008(data []byte) (nodes []*Node, errs []error, err error) {
+	var doc sip008Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid sip008 json: %v", err)
+	}
+	if doc.Servers == nil {
+		return nil, nil, fmt.Errorf("invalid sip008 json: missing servers")
+	}
+
+	for i, s := range doc.Servers {
+		port, err := jsonInt(s.ServerPort)
+		if err != nil || port <= 0 || port > 65535 {
+			errs = append(errs, fmt.Errorf("sip008 server %d: invalid port: %v", i, s.ServerPort))
+			continue
+		}
+		if s.Server == "" || s.Method == "" {
+			errs = append(errs, fmt.Errorf("sip008 server %d: missing server or method", i))
+			continue
+		}
+		node := &Node{
+			Name:   strings.TrimSpace(s.Remarks),
+			Type:   TypeShadowsocks,
+			Server: s.Server,
+			Port:   port,
+			Config: map[string]interface{}{
+				"cipher":   strings.ToLower(s.Method),
+				"password": s.Password,
+			},
+		}
+		if s.Plugin != "" {
+			plugin := s.Plugin
+			if s.PluginOpts != "" {
+				plugin += ";" + s.PluginOpts
+			}
+			parseShadowsocksPlugin(plugin, node.Config)
+		}
+		if node.Name == "" {
+			node.Name = net.JoinHostPort(node.Server, strconv.Itoa(node.Port))
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, errs, nil
+}
+
+// generateShadowsocks 生成SIP002格式的ss://链接
+// 2022系列加密的用户信息使用百分号编码（与解析时的PathUnescape对应，空格编码为%20），其他加密使用base64url编码
+func generateShadowsocks(node *Node, config map[string]interface{}) (string, error) {
+	method := strings.ToLower(configString(config, "cipher", "method"))
+	password := configString(config, "password")
+	if method == "" {
+		return "", fmt.Errorf("missing cipher")
+	}
+
+	var userinfo string
+	if strings.HasPrefix(method, "2022-") {
+		userinfo = url.PathEscape(method) + ":" + url.PathEscape(password)
+	} else {
+		userinfo = base64.RawURLEncoding.EncodeToString([]byte(method + ":" + password))
+	}
+
+	link := "ss://" + userinfo + "@" + hostPort(node)
+	if plugin := shadowsocksPlugin(config); plugin != "" {
+		link += "/?plugin=" + url.QueryEscape(plugin)
+	}
+	if node.Name != "" {
+		link += "#" + url.PathEscape(node.Name)
+	}
+	return link, nil
+}
+
+// shadowsocksPlugin 将Clash的plugin和plugin-opts转换为SIP003插件参数
+func shadowsocksPlugin(config map[string]interface{}) string {
+	name := configString(config, "plugin")
+	if name == "" {
+		return ""
+	}
+	opts := configMap(config, "plugin-opts", "plugin_opts")
+
+	parts := []string{name}
+	if name == "obfs" {
+		parts[0] = "obfs-local"
+		if mode := configString(opts, "mode"); mode != "" {
+			parts = append(parts, "obfs="+mode)
+		}
+		if host := configString(opts, "host"); host != "" {
+			parts = append(parts, "obfs-host="+host)
+		}
+		return strings.Join(parts, ";")
+	}
+
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch v := opts[key].(type) {
+		case bool:
+			if v {
+				parts = append(parts, key)
+			}
+		default:
+			if value := configString(opts, key); value != "" {
+				parts = append(parts, key+"="+value)
+			}
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// generateShadowsocksR 生成ssr://链接
+func generateShadowsocksR(node *Node, config map[string]interface{}) (string, error) {
+	method := configString(config, "cipher", "method")
+	if method == "" {
+		return "", fmt.Errorf("missing cipher")
+	}
+	protocol := configString(config, "protocol")
+	if protocol == "" {
+		protocol = "origin"
+	}
+	obfs := configString(config, "obfs")
+	if obfs == "" {
+		obfs = "plain"
+	}
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	host := node.Server
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	main := strings.Join([]string{host, strconv.Itoa(node.Port), protocol, method, obfs, encode(configString(config, "password"))}, ":")
+	params := []string{
+		"obfsparam=" + encode(configString(config, "obfs-param", "obfs_param")),
+		"protoparam=" + encode(configString(config, "protocol-param", "protocol_param")),
+		"remarks=" + encode(node.Name),
+	}
+	return "ssr://" + encode(main+"/?"+strings.Join(params, "&")), nil
+}
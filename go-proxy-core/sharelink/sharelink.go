@@ -0,0 +1,328 @@
+// Package sharelink 解析和生成代理分享链接（ss://、vmess://、trojan://等），并解析SIP008订阅
+package sharelink
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 节点类型，与proxy.ProtocolType的取值相同
+const (
+	TypeShadowsocks  = "shadowsocks"
+	TypeShadowsocksR = "shadowsocksr"
+	TypeVMess        = "vmess"
+	TypeVLESS        = "vless"
+	TypeTrojan       = "trojan"
+	TypeHysteria2    = "hysteria2"
+	TypeTUIC         = "tuic"
+	TypeSOCKS5       = "socks5"
+	TypeHTTP         = "http"
+)
+
+// Node 分享链接描述的代理节点
+// Config使用Clash的配置键（cipher、ws-opts、servername等），可以直接作为协议配置
+type Node struct {
+	Name   string
+	Type   string
+	Server string
+	Port   int
+	Config map[string]interface{}
+}
+
+// Parse 解析一个分享链接
+func Parse(link string) (*Node, error) {
+	link = strings.TrimSpace(link)
+	i := strings.Index(link, "://")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid share link: %s", link)
+	}
+
+	var node *Node
+	var err error
+	scheme := strings.ToLower(link[:i])
+	switch scheme {
+	case "ss":
+		node, err = parseShadowsocks(link)
+	case "ssr":
+		node, err = parseShadowsocksR(link)
+	case "vmess":
+		node, err = parseVMess(link)
+	case "vless":
+		node, err = parseVLESS(link)
+	case "trojan":
+		node, err = parseTrojan(link)
+	case "hysteria2", "hy2":
+		node, err = parseHysteria2(link)
+	case "tuic":
+		node, err = parseTUIC(link)
+	case "socks", "socks5", "socks5h":
+		node, err = parseSOCKS5(link)
+	case "http", "https":
+		node, err = parseHTTP(link)
+	default:
+		return nil, fmt.Errorf("unsupported share link scheme: %s", scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s link: %v", scheme, err)
+	}
+	if node.Name == "" {
+		node.Name = net.JoinHostPort(node.Server, strconv.Itoa(node.Port))
+	}
+	return node, nil
+}
+
+// Generate 生成节点的分享链接，节点类型不支持分享链接或缺少必要配置时返回错误
+// Config可以使用Clash的配置键，也可以使用协议配置中的别名（如method、sni、path）
+func Generate(node *Node) (string, error) {
+	if node.Server == "" || node.Port <= 0 || node.Port > 65535 {
+		return "", fmt.Errorf("invalid server address %s:%d", node.Server, node.Port)
+	}
+	config := node.Config
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+
+	switch node.Type {
+	case TypeShadowsocks, "ss":
+		return generateShadowsocks(node, config)
+	case TypeShadowsocksR, "ssr":
+		return generateShadowsocksR(node, config)
+	case TypeVMess:
+		return generateVMess(node, config)
+	case TypeVLESS:
+		return generateVLESS(node, config)
+	case TypeTrojan:
+		return generateTrojan(node, config)
+	case TypeHysteria2:
+		return generateHysteria2(node, config)
+	case TypeTUIC:
+		return generateTUIC(node, config)
+	case TypeSOCKS5:
+		return generateSOCKS5(node, config)
+	case TypeHTTP, "https":
+		return generateHTTP(node, config)
+	}
+	return "", fmt.Errorf("share link is not supported for type %s", node.Type)
+}
+
+// ParseList 解析多行分享链接，整段文本可以是base64编码的（订阅的常见格式）
+// 空行和注释被忽略，无法解析的链接放在errs中返回，不影响其他链接
+func ParseList(text string) (nodes []*Node, errs []error) {
+	text = strings.TrimSpace(text)
+	if !strings.Contains(text, "://") {
+		if decoded, err := DecodeBase64(text); err == nil && strings.Contains(string(decoded), "://") {
+			text = string(decoded)
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		node, err := Parse(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, errs
+}
+
+// DecodeBase64 解码标准或URL安全的base64，填充可以省略，忽略其中的换行
+func DecodeBase64(s string) ([]byte, error) {
+	s = strings.Join(strings.Fields(s), "")
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// splitFragment 拆分链接的#名称部分
+func splitFragment(link string) (string, string) {
+	i := strings.Index(link, "#")
+	if i < 0 {
+		return link, ""
+	}
+	name, err := url.PathUnescape(link[i+1:])
+	if err != nil {
+		name = link[i+1:]
+	}
+	return link[:i], strings.TrimSpace(name)
+}
+
+// parseHostPort 解析host:port，支持[IPv6]:port
+func parseHostPort(hostport string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port: %s", portStr)
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("missing server")
+	}
+	return host, port, nil
+}
+
+// parseURL 解析标准URL格式的链接，返回节点的地址、名称和查询参数
+func parseURL(link string) (*url.URL, *Node, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, nil, fmt.Errorf("missing server")
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, nil, fmt.Errorf("invalid port: %s", u.Port())
+	}
+	node := &Node{
+		Name:   strings.TrimSpace(u.Fragment),
+		Server: u.Hostname(),
+		Port:   port,
+		Config: make(map[string]interface{}),
+	}
+	return u, node, nil
+}
+
+// queryBool 判断查询参数是否为真
+func queryBool(q url.Values, keys ...string) bool {
+	for _, key := range keys {
+		switch strings.ToLower(q.Get(key)) {
+		case "1", "true", "yes":
+			return true
+		}
+	}
+	return false
+}
+
+// splitList 拆分逗号分隔的列表
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// setString 值不为空时写入配置
+func setString(config map[string]interface{}, key, value string) {
+	if value != "" {
+		config[key] = value
+	}
+}
+
+// hostPort 返回节点的host:port，IPv6地址加方括号
+func hostPort(node *Node) string {
+	return net.JoinHostPort(node.Server, strconv.Itoa(node.Port))
+}
+
+// configString 按顺序返回第一个非空的配置值，数字和布尔值转换为字符串
+func configString(config map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := config[key].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			return strconv.Itoa(v)
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	}
+	return ""
+}
+
+// configBool 按顺序返回第一个存在的布尔配置，字符串true/1视为真
+func configBool(config map[string]interface{}, keys ...string) bool {
+	for _, key := range keys {
+		switch v := config[key].(type) {
+		case bool:
+			return v
+		case string:
+			switch strings.ToLower(v) {
+			case "1", "true", "yes":
+				return true
+			}
+			return false
+		case float64:
+			return v != 0
+		case int:
+			return v != 0
+		}
+	}
+	return false
+}
+
+// configMap 按顺序返回第一个对象配置，没有时返回空对象
+func configMap(config map[string]interface{}, keys ...string) map[string]interface{} {
+	for _, key := range keys {
+		if m, ok := config[key].(map[string]interface{}); ok {
+			return m
+		}
+	}
+	return map[string]interface{}{}
+}
+
+// configList 按顺序返回第一个列表配置，兼容逗号分隔的字符串
+func configList(config map[string]interface{}, keys ...string) []string {
+	for _, key := range keys {
+		switch v := config[key].(type) {
+		case string:
+			if list := splitList(v); len(list) > 0 {
+				return list
+			}
+		case []string:
+			if len(v) > 0 {
+				return v
+			}
+		case []interface{}:
+			var list []string
+			for _, item := range v {
+				if s, ok := item.(string); ok && s != "" {
+					list = append(list, s)
+				}
+			}
+			if len(list) > 0 {
+				return list
+			}
+		}
+	}
+	return nil
+}
+
+// setQuery 值不为空时写入查询参数
+func setQuery(q url.Values, key, value string) {
+	if value != "" {
+		q.Set(key, value)
+	}
+}
+
+// buildURL 生成scheme://userinfo@host:port?query#name格式的链接
+func buildURL(scheme string, user *url.Userinfo, node *Node, q url.Values) string {
+	u := &url.URL{
+		Scheme:   scheme,
+		User:     user,
+		Host:     hostPort(node),
+		RawQuery: q.Encode(),
+		Fragment: node.Name,
+	}
+	return u.String()
+}
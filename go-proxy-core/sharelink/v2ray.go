@@ -0,0 +1,393 @@
+package sharelink
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// vmessLink vmess://链接中base64编码的JSON（v2rayN格式）
+// port和aid在不同客户端中可能是数字或字符串
+type vmessLink struct {
+	V    interface{} `json:"v"`
+	PS   string      `json:"ps"`
+	Add  string      `json:"add"`
+	Port interface{} `json:"port"`
+	ID   string      `json:"id"`
+	Aid  interface{} `json:"aid"`
+	Scy  string      `json:"scy"`
+	Net  string      `json:"net"`
+	Type string      `json:"type"`
+	Host string      `json:"host"`
+	Path string      `json:"path"`
+	TLS  string      `json:"tls"`
+	SNI  string      `json:"sni"`
+	ALPN string      `json:"alpn"`
+	FP   string      `json:"fp"`
+}
+
+// jsonInt 读取可能是数字或字符串的JSON整数
+func jsonInt(v interface{}) (int, error) {
+	switch val := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int(val), nil
+	case string:
+		if val == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(strings.TrimSpace(val))
+	}
+	return 0, fmt.Errorf("unexpected value %v", v)
+}
+
+// parseVMess 解析vmess://base64(JSON)链接
+func parseVMess(link string) (*Node, error) {
+	decoded, err := DecodeBase64(link[len("vmess://"):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %v", err)
+	}
+	var v vmessLink
+	if err := json.Unmarshal(decoded, &v); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+
+	port, err := jsonInt(v.Port)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid port: %v", v.Port)
+	}
+	aid, err := jsonInt(v.Aid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aid: %v", v.Aid)
+	}
+	if v.Add == "" || v.ID == "" {
+		return nil, fmt.Errorf("missing server or id")
+	}
+	cipher := v.Scy
+	if cipher == "" {
+		cipher = "auto"
+	}
+
+	node := &Node{
+		Name:   strings.TrimSpace(v.PS),
+		Type:   TypeVMess,
+		Server: v.Add,
+		Port:   port,
+		Config: map[string]interface{}{
+			"uuid":    v.ID,
+			"alterId": aid,
+			"cipher":  cipher,
+		},
+	}
+	setTransport(node.Config, v.Net, v.Type, v.Host, v.Path, v.Path)
+	if v.TLS == "tls" {
+		node.Config["tls"] = true
+		setString(node.Config, "servername", v.SNI)
+		setString(node.Config, "client-fingerprint", v.FP)
+		if alpn := splitList(v.ALPN); len(alpn) > 0 {
+			node.Config["alpn"] = alpn
+		}
+	}
+	return node, nil
+}
+
+// parseVLESS 解析vless://uuid@host:port?type=ws&security=tls...#name链接
+func parseVLESS(link string) (*Node, error) {
+	u, node, err := parseURL(link)
+	if err != nil {
+		return nil, err
+	}
+	uuid := u.User.Username()
+	if uuid == "" {
+		return nil, fmt.Errorf("missing uuid")
+	}
+	q := u.Query()
+	node.Type = TypeVLESS
+	node.Config["uuid"] = uuid
+	setString(node.Config, "flow", q.Get("flow"))
+	setStreamSettings(node.Config, q, "servername")
+	return node, nil
+}
+
+// parseTrojan 解析trojan://password@host:port?sni=...#name链接
+func parseTrojan(link string) (*Node, error) {
+	u, node, err := parseURL(link)
+	if err != nil {
+		return nil, err
+	}
+	password := u.User.Username()
+	if password == "" {
+		return nil, fmt.Errorf("missing password")
+	}
+	q := u.Query()
+	node.Type = TypeTrojan
+	node.Config["password"] = password
+	if q.Get("sni") == "" && q.Get("peer") != "" {
+		q.Set("sni", q.Get("peer"))
+	}
+	// trojan默认使用TLS
+	if q.Get("security") == "" {
+		q.Set("security", "tls")
+	}
+	setStreamSettings(node.Config, q, "sni")
+	return node, nil
+}
+
+// setStreamSettings 读取vless和trojan链接中传输层和TLS相关的查询参数
+// sniKey为SNI在Clash配置中的键，vless使用servername，trojan使用sni
+func setStreamSettings(config map[string]interface{}, q url.Values, sniKey string) {
+	path := q.Get("path")
+	if q.Get("type") == "grpc" {
+		path = q.Get("serviceName")
+	}
+	setTransport(config, q.Get("type"), q.Get("headerType"), q.Get("host"), q.Get("path"), path)
+
+	switch security := q.Get("security"); security {
+	case "tls", "reality":
+		config["tls"] = true
+		setString(config, sniKey, q.Get("sni"))
+		setString(config, "client-fingerprint", q.Get("fp"))
+		if alpn := splitList(q.Get("alpn")); len(alpn) > 0 {
+			config["alpn"] = alpn
+		}
+		if queryBool(q, "allowInsecure", "insecure") {
+			config["skip-cert-verify"] = true
+		}
+		if security == "reality" {
+			reality := map[string]interface{}{"public-key": q.Get("pbk")}
+			setString(reality, "short-id", q.Get("sid"))
+			config["reality-opts"] = reality
+		}
+	}
+}
+
+// setTransport 将v2ray的传输层参数转换为Clash的network和*-opts
+// grpc的服务名在vmess链接中写在path，在vless/trojan链接中写在serviceName，由调用方通过grpcService传入
+func setTransport(config map[string]interface{}, network, headerType, host, path, grpcService string) {
+	switch network {
+	case "", "tcp":
+		if headerType == "http" {
+			opts := map[string]interface{}{}
+			if path != "" {
+				opts["path"] = splitList(path)
+			}
+			if host != "" {
+				opts["headers"] = map[string]interface{}{"Host": splitList(host)}
+			}
+			config["network"] = "http"
+			config["http-opts"] = opts
+		}
+	case "ws", "httpupgrade":
+		opts := map[string]interface{}{}
+		setString(opts, "path", path)
+		if host != "" {
+			opts["headers"] = map[string]interface{}{"Host": host}
+		}
+		config["network"] = network
+		config["ws-opts"] = opts
+	case "h2", "http":
+		opts := map[string]interface{}{}
+		setString(opts, "path", path)
+		if host != "" {
+			opts["host"] = splitList(host)
+		}
+		config["network"] = "h2"
+		config["h2-opts"] = opts
+	case "grpc":
+		config["network"] = "grpc"
+		config["grpc-opts"] = map[string]interface{}{"grpc-service-name": grpcService}
+	default:
+		config["network"] = network
+		setString(config, "host", host)
+		setString(config, "path", path)
+	}
+}
+
+// streamSettings 从Clash格式或平铺的协议配置中读取的传输层参数
+type streamSettings struct {
+	network     string // tcp、ws、httpupgrade、h2、grpc
+	headerType  string // tcp伪装类型，http或为空
+	host        string
+	path        string
+	serviceName string
+}
+
+// readTransport 读取传输层配置
+func readTransport(config map[string]interface{}) streamSettings {
+	s := streamSettings{network: configString(config, "network")}
+	switch s.network {
+	case "", "tcp":
+		s.network = "tcp"
+	case "ws", "httpupgrade":
+		opts := configMap(config, "ws-opts", "ws_opts", "httpupgrade-opts", "httpupgrade_opts", "http-upgrade-opts")
+		s.path = configString(opts, "path")
+		s.host = configString(configMap(opts, "headers"), "Host", "host")
+	case "h2":
+		opts := configMap(config, "h2-opts", "h2_opts")
+		s.path = configString(opts, "path")
+		s.host = strings.Join(configList(opts, "host"), ",")
+	case "grpc":
+		s.serviceName = configString(configMap(config, "grpc-opts", "grpc_opts"), "grpc-service-name", "grpc_service_name")
+	case "http":
+		opts := configMap(config, "http-opts", "http_opts")
+		s.network = "tcp"
+		s.headerType = "http"
+		s.path = strings.Join(configList(opts, "path"), ",")
+		s.host = strings.Join(configList(configMap(opts, "headers"), "Host", "host"), ",")
+	}
+
+	// 协议配置也可以把传输层参数平铺在外层
+	if s.host == "" {
+		s.host = configString(config, "host")
+	}
+	if s.path == "" {
+		s.path = configString(config, "path")
+	}
+	if s.serviceName == "" {
+		s.serviceName = configString(config, "service_name", "grpc_service_name", "serviceName")
+	}
+	return s
+}
+
+// tlsSettings 从协议配置中读取的TLS参数
+type tlsSettings struct {
+	enabled     bool
+	sni         string
+	fingerprint string
+	alpn        []string
+	insecure    bool
+	publicKey   string // REALITY公钥，不为空时使用REALITY
+	shortID     string
+}
+
+// readTLS 读取TLS和REALITY配置
+func readTLS(config map[string]interface{}) tlsSettings {
+	reality := configMap(config, "reality-opts", "reality_opts", "reality")
+	s := tlsSettings{
+		enabled:     configBool(config, "tls"),
+		sni:         configString(config, "servername", "sni", "server_name"),
+		fingerprint: configString(config, "client-fingerprint", "client_fingerprint", "utls"),
+		alpn:        configList(config, "alpn"),
+		insecure:    configBool(config, "skip-cert-verify", "skip_cert_verify", "insecure", "allow_insecure"),
+		publicKey:   configString(reality, "public-key", "public_key"),
+		shortID:     configString(reality, "short-id", "short_id"),
+	}
+	if s.publicKey == "" {
+		s.publicKey = configString(config, "public-key", "public_key", "pbk")
+	}
+	if s.shortID == "" {
+		s.shortID = configString(config, "short-id", "short_id", "sid")
+	}
+	return s
+}
+
+// generateVMess 生成v2rayN格式的vmess://base64(JSON)链接
+func generateVMess(node *Node, config map[string]interface{}) (string, error) {
+	uuid := configString(config, "uuid", "user_id", "id")
+	if uuid == "" {
+		return "", fmt.Errorf("missing uuid")
+	}
+	aid := configString(config, "alterId", "alter_id", "aid")
+	if aid == "" {
+		aid = "0"
+	}
+	cipher := configString(config, "cipher", "security")
+	if cipher == "" {
+		cipher = "auto"
+	}
+
+	stream := readTransport(config)
+	v := vmessLink{
+		V:    "2",
+		PS:   node.Name,
+		Add:  node.Server,
+		Port: strconv.Itoa(node.Port),
+		ID:   uuid,
+		Aid:  aid,
+		Scy:  cipher,
+		Net:  stream.network,
+		Type: "none",
+		Host: stream.host,
+		Path: stream.path,
+	}
+	if stream.network == "grpc" {
+		v.Path = stream.serviceName
+	}
+	if stream.headerType != "" {
+		v.Type = stream.headerType
+	}
+	if tls := readTLS(config); tls.enabled {
+		v.TLS = "tls"
+		v.SNI = tls.sni
+		v.FP = tls.fingerprint
+		v.ALPN = strings.Join(tls.alpn, ",")
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return "vmess://" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// generateVLESS 生成vless://链接
+func generateVLESS(node *Node, config map[string]interface{}) (string, error) {
+	uuid := configString(config, "uuid", "id")
+	if uuid == "" {
+		return "", fmt.Errorf("missing uuid")
+	}
+	q := url.Values{}
+	q.Set("encryption", "none")
+	setQuery(q, "flow", configString(config, "flow"))
+	setStreamQuery(q, config, false)
+	return buildURL("vless", url.User(uuid), node, q), nil
+}
+
+// generateTrojan 生成trojan://链接
+func generateTrojan(node *Node, config map[string]interface{}) (string, error) {
+	password := configString(config, "password")
+	if password == "" {
+		return "", fmt.Errorf("missing password")
+	}
+	q := url.Values{}
+	setStreamQuery(q, config, true)
+	return buildURL("trojan", url.User(password), node, q), nil
+}
+
+// setStreamQuery 写入vless和trojan链接中传输层和TLS相关的查询参数，trojan默认使用TLS
+func setStreamQuery(q url.Values, config map[string]interface{}, defaultTLS bool) {
+	stream := readTransport(config)
+	q.Set("type", stream.network)
+	setQuery(q, "headerType", stream.headerType)
+	setQuery(q, "host", stream.host)
+	setQuery(q, "path", stream.path)
+	if stream.network == "grpc" {
+		setQuery(q, "serviceName", stream.serviceName)
+	}
+
+	tls := readTLS(config)
+	if _, ok := config["tls"]; !ok && defaultTLS {
+		tls.enabled = true
+	}
+	switch {
+	case tls.publicKey != "":
+		q.Set("security", "reality")
+		q.Set("pbk", tls.publicKey)
+		setQuery(q, "sid", tls.shortID)
+	case tls.enabled:
+		q.Set("security", "tls")
+	default:
+		q.Set("security", "none")
+		return
+	}
+	setQuery(q, "sni", tls.sni)
+	setQuery(q, "fp", tls.fingerprint)
+	setQuery(q, "alpn", strings.Join(tls.alpn, ","))
+	if tls.insecure {
+		q.Set("allowInsecure", "1")
+	}
+}
@@ -0,0 +1,261 @@
+package snell
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// saltSize 每个方向流开头携带的盐长度
+	saltSize = 16
+	// maxPayloadSize 单个数据块的最大负载长度
+	maxPayloadSize = 0x3FFF
+)
+
+// errZeroChunk 读取到零长度数据块，表示对端结束了当前会话
+var errZeroChunk = errors.New("snell: zero length chunk")
+
+// streamCipher Snell使用的AEAD加密器，密钥由PSK和盐通过Argon2id派生
+type streamCipher struct {
+	psk      []byte
+	keySize  int
+	makeAEAD func(key []byte) (cipher.AEAD, error)
+}
+
+// newStreamCipher 根据协议版本创建加密器
+// v1使用ChaCha20-Poly1305，v2/v3使用AES-128-GCM
+func newStreamCipher(psk string, version int) *streamCipher {
+	if version == Version1 {
+		return &streamCipher{psk: []byte(psk), keySize: chacha20poly1305.KeySize, makeAEAD: chacha20poly1305.New}
+	}
+	return &streamCipher{psk: []byte(psk), keySize: 16, makeAEAD: newAESGCM}
+}
+
+// newAEAD 使用盐派生会话密钥并创建AEAD实例
+func (sc *streamCipher) newAEAD(salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey(sc.psk, salt, 3, 8, 1, 32)[:sc.keySize]
+	return sc.makeAEAD(key)
+}
+
+// newAESGCM 创建AES-GCM实例
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// increaseNonce 以小端序递增nonce
+func increaseNonce(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
+
+// aeadConn AEAD分块加密的流连接
+// 数据格式: [salt][加密的2字节长度+tag][加密的负载+tag]...
+// 零长度的数据块用作会话结束标记，连接本身可以继续复用
+type aeadConn struct {
+	net.Conn
+	cipher *streamCipher
+
+	readMu    sync.Mutex
+	salt      []byte
+	reader    cipher.AEAD
+	readNonce []byte
+	readBuf   []byte
+	leftover  []byte
+
+	writeMu    sync.Mutex
+	writer     cipher.AEAD
+	writeNonce []byte
+	writeBuf   []byte
+
+	// broken 表示读写过程中出现错误，流状态已不可信，不能复用
+	broken atomic.Bool
+}
+
+// newAEADConn 使用加密器包装连接
+func newAEADConn(conn net.Conn, sc *streamCipher) *aeadConn {
+	return &aeadConn{Conn: conn, cipher: sc}
+}
+
+// saltBuf 返回用于读取对端盐的缓冲区
+func (c *aeadConn) saltBuf() []byte {
+	if c.salt == nil {
+		c.salt = make([]byte, saltSize)
+	}
+	return c.salt
+}
+
+// initReader 使用已读取的对端盐初始化解密器
+func (c *aeadConn) initReader() error {
+	aead, err := c.cipher.newAEAD(c.salt)
+	if err != nil {
+		return err
+	}
+	c.reader = aead
+	c.readNonce = make([]byte, aead.NonceSize())
+	c.readBuf = make([]byte, 2+aead.Overhead()+maxPayloadSize+aead.Overhead())
+	return nil
+}
+
+// readChunk 读取并解密一个数据块
+// progressed表示是否已经从底层连接消费了数据，未消费数据时的超时不影响流状态
+func (c *aeadConn) readChunk() (plain []byte, progressed bool, err error) {
+	if c.reader == nil {
+		n, err := io.ReadFull(c.Conn, c.saltBuf())
+		if err != nil {
+			return nil, n > 0, err
+		}
+		if err := c.initReader(); err != nil {
+			return nil, true, err
+		}
+	}
+
+	overhead := c.reader.Overhead()
+	lenBuf := c.readBuf[:2+overhead]
+	if n, err := io.ReadFull(c.Conn, lenBuf); err != nil {
+		return nil, n > 0, err
+	}
+	if _, err := c.reader.Open(lenBuf[:0], c.readNonce, lenBuf, nil); err != nil {
+		return nil, true, fmt.Errorf("snell: failed to decrypt chunk length: %v", err)
+	}
+	increaseNonce(c.readNonce)
+
+	size := int(binary.BigEndian.Uint16(lenBuf[:2])) & maxPayloadSize
+	if size == 0 {
+		// 零长度块只有长度部分，没有负载
+		return nil, true, errZeroChunk
+	}
+
+	payload := c.readBuf[:size+overhead]
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return nil, true, err
+	}
+	plain, err = c.reader.Open(payload[:0], c.readNonce, payload, nil)
+	if err != nil {
+		return nil, true, fmt.Errorf("snell: failed to decrypt chunk payload: %v", err)
+	}
+	increaseNonce(c.readNonce)
+	return plain, true, nil
+}
+
+// Read 读取解密后的数据，遇到零长度块时返回errZeroChunk
+func (c *aeadConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.leftover) > 0 {
+		n := copy(b, c.leftover)
+		c.leftover = c.leftover[n:]
+		return n, nil
+	}
+
+	plain, progressed, err := c.readChunk()
+	if err != nil {
+		if err != errZeroChunk && (progressed || !isTimeout(err)) {
+			c.broken.Store(true)
+		}
+		return 0, err
+	}
+	n := copy(b, plain)
+	c.leftover = plain[n:]
+	return n, nil
+}
+
+// isTimeout 判断错误是否为超时错误
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// initWriter 生成本端的盐、初始化加密器并发送盐
+func (c *aeadConn) initWriter() error {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := c.cipher.newAEAD(salt)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Conn.Write(salt); err != nil {
+		return err
+	}
+	c.writer = aead
+	c.writeNonce = make([]byte, aead.NonceSize())
+	c.writeBuf = make([]byte, 2+aead.Overhead()+maxPayloadSize+aead.Overhead())
+	return nil
+}
+
+// writeChunk 加密并发送一个数据块，payload为空时只发送零长度的长度部分
+func (c *aeadConn) writeChunk(payload []byte) error {
+	if c.writer == nil {
+		if err := c.initWriter(); err != nil {
+			return err
+		}
+	}
+
+	overhead := c.writer.Overhead()
+	buf := c.writeBuf[:2]
+	binary.BigEndian.PutUint16(buf, uint16(len(payload)))
+	buf = c.writer.Seal(buf[:0], c.writeNonce, buf, nil)
+	increaseNonce(c.writeNonce)
+
+	if len(payload) > 0 {
+		sealed := c.writer.Seal(c.writeBuf[2+overhead:2+overhead], c.writeNonce, payload, nil)
+		increaseNonce(c.writeNonce)
+		buf = c.writeBuf[:len(buf)+len(sealed)]
+	}
+
+	_, err := c.Conn.Write(buf)
+	return err
+}
+
+// Write 分块加密写入数据
+func (c *aeadConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	written := 0
+	for written < len(b) {
+		end := written + maxPayloadSize
+		if end > len(b) {
+			end = len(b)
+		}
+		if err := c.writeChunk(b[written:end]); err != nil {
+			c.broken.Store(true)
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+// writeZeroChunk 发送零长度块，通知对端当前会话结束
+func (c *aeadConn) writeZeroChunk() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.writeChunk(nil); err != nil {
+		c.broken.Store(true)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,459 @@
+package snell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 协议版本
+const (
+	Version1 = 1
+	Version2 = 2
+	Version3 = 3
+)
+
+// 命令字
+const (
+	headerVersion byte = 1
+
+	commandConnect   byte = 1
+	commandConnectV2 byte = 5
+
+	replyTunnel byte = 0
+	replyError  byte = 2
+)
+
+const (
+	// defaultDialTimeout 连接Snell服务器的默认超时时间
+	defaultDialTimeout = 5 * time.Second
+	// defaultIdleTimeout 空闲复用连接的默认保留时间
+	defaultIdleTimeout = 30 * time.Second
+	// defaultMaxIdle 每个客户端保留的最大空闲连接数
+	defaultMaxIdle = 8
+	// drainTimeout 会话结束时等待服务端结束标记的最长时间
+	drainTimeout = 5 * time.Second
+)
+
+// ClientConfig Snell客户端配置
+type ClientConfig struct {
+	Server      string        // 服务器地址 host:port
+	PSK         string        // 预共享密钥
+	Version     int           // 协议版本 1/2/3
+	Obfs        string        // 混淆模式: ""/http/tls
+	ObfsHost    string        // 混淆使用的域名，为空时使用服务器地址
+	Reuse       bool          // 是否复用连接（仅v2/v3支持）
+	KeepAlive   time.Duration // TCP keepalive间隔
+	IdleTimeout time.Duration // 空闲复用连接的保留时间，为0时使用默认值
+	Timeout     time.Duration // 连接超时时间
+
+	// DialContext 连接服务器使用的拨号函数，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client Snell客户端，负责建立会话和管理复用连接池
+type Client struct {
+	config ClientConfig
+	cipher *streamCipher
+
+	mu     sync.Mutex
+	idle   []*idleConn
+	closed bool
+}
+
+// idleConn 连接池中的空闲连接
+type idleConn struct {
+	conn  *aeadConn
+	since time.Time
+}
+
+// NewClient 创建新的Snell客户端
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing snell server address")
+	}
+	if config.PSK == "" {
+		return nil, fmt.Errorf("missing snell psk")
+	}
+
+	switch config.Version {
+	case 0:
+		config.Version = Version3
+	case Version1, Version2, Version3:
+	default:
+		return nil, fmt.Errorf("unsupported snell version: %d", config.Version)
+	}
+
+	switch config.Obfs {
+	case ObfsNone, "none", ObfsHTTP, ObfsTLS:
+	default:
+		return nil, fmt.Errorf("unsupported snell obfs mode: %s", config.Obfs)
+	}
+
+	// v1没有会话结束标记，不能复用连接
+	if config.Version == Version1 {
+		config.Reuse = false
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+
+	client := &Client{
+		config: config,
+		cipher: newStreamCipher(config.PSK, config.Version),
+	}
+
+	if config.Reuse {
+		go client.evictLoop()
+	}
+
+	return client, nil
+}
+
+// Dial 通过Snell服务器连接到目标地址
+func (c *Client) Dial(targetAddr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target address %s: %v", targetAddr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid target port: %s", portStr)
+	}
+	if len(host) > 255 {
+		return nil, fmt.Errorf("target host too long: %s", host)
+	}
+
+	header := c.buildHeader(host, port)
+
+	// 优先使用复用连接；空闲连接可能已被服务端关闭，写入成功不代表可用，
+	// 因此同步读取服务端回复，失败时重新建立连接
+	if stream := c.getIdle(); stream != nil {
+		conn := &Conn{aeadConn: stream, client: c}
+		err := conn.confirm(header)
+		if err == nil {
+			return conn, nil
+		}
+		stream.Close()
+		if conn.replyRead {
+			// 服务端回复了错误，换一个连接也不会成功
+			return nil, err
+		}
+		log.Printf("Snell复用连接不可用，重新建立连接: %v", err)
+	}
+
+	stream, err := c.dialServer()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stream.Write(header); err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to send snell header: %v", err)
+	}
+
+	return &Conn{aeadConn: stream, client: c}, nil
+}
+
+// Close 关闭客户端及所有空闲连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	for _, ic := range idle {
+		ic.conn.Close()
+	}
+	return nil
+}
+
+// IdleCount 返回当前空闲连接数量
+func (c *Client) IdleCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.idle)
+}
+
+// buildHeader 构造CONNECT请求头
+// [版本][命令][client id长度=0][host长度][host][端口]
+func (c *Client) buildHeader(host string, port int) []byte {
+	command := commandConnect
+	if c.config.Version >= Version2 {
+		command = commandConnectV2
+	}
+
+	header := make([]byte, 0, 6+len(host))
+	header = append(header, headerVersion, command, 0, byte(len(host)))
+	header = append(header, host...)
+	header = append(header, byte(port>>8), byte(port))
+	return header
+}
+
+// dialServer 建立到Snell服务器的新连接
+func (c *Client) dialServer() (*aeadConn, error) {
+	dial := c.config.DialContext
+	if dial == nil {
+		dialer := &net.Dialer{KeepAlive: c.config.KeepAlive}
+		dial = dialer.DialContext
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", c.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Snell server %s: %v", c.config.Server, err)
+	}
+
+	host, port, _ := net.SplitHostPort(c.config.Server)
+	if c.config.ObfsHost != "" {
+		host = c.config.ObfsHost
+	}
+	conn, err = wrapObfs(conn, c.config.Obfs, host, port)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newAEADConn(conn, c.cipher), nil
+}
+
+// getIdle 从连接池取出一个未过期的空闲连接
+func (c *Client) getIdle() *aeadConn {
+	if !c.config.Reuse {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.idle) > 0 {
+		last := c.idle[len(c.idle)-1]
+		c.idle = c.idle[:len(c.idle)-1]
+		if time.Since(last.since) < c.config.IdleTimeout {
+			return last.conn
+		}
+		last.conn.Close()
+	}
+	return nil
+}
+
+// putIdle 将完成会话的连接放回连接池
+func (c *Client) putIdle(stream *aeadConn) {
+	c.mu.Lock()
+	if c.closed || len(c.idle) >= defaultMaxIdle {
+		c.mu.Unlock()
+		stream.Close()
+		return
+	}
+	c.idle = append(c.idle, &idleConn{conn: stream, since: time.Now()})
+	c.mu.Unlock()
+}
+
+// evictLoop 定期关闭超过保留时间的空闲连接
+func (c *Client) evictLoop() {
+	ticker := time.NewTicker(c.config.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		kept := c.idle[:0]
+		var expired []*idleConn
+		for _, ic := range c.idle {
+			if time.Since(ic.since) >= c.config.IdleTimeout {
+				expired = append(expired, ic)
+			} else {
+				kept = append(kept, ic)
+			}
+		}
+		c.idle = kept
+		c.mu.Unlock()
+
+		for _, ic := range expired {
+			ic.conn.Close()
+		}
+	}
+}
+
+// Conn 一次Snell会话
+type Conn struct {
+	*aeadConn
+	client *Client
+
+	// sessionMu 保护会话读取状态，后台drain时同样需要持有
+	sessionMu  sync.Mutex
+	replyRead  bool
+	remoteDone bool
+
+	closeMu   sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+}
+
+// Read 读取会话数据，首次读取时解析服务端回复
+func (sc *Conn) Read(b []byte) (int, error) {
+	sc.closeMu.RLock()
+	closed := sc.closed
+	sc.closeMu.RUnlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	sc.sessionMu.Lock()
+	defer sc.sessionMu.Unlock()
+
+	if sc.remoteDone {
+		return 0, io.EOF
+	}
+
+	if !sc.replyRead {
+		if err := sc.readReply(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := sc.aeadConn.Read(b)
+	if err == errZeroChunk {
+		sc.remoteDone = true
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// confirm 在复用连接上发送请求头并等待服务端回复
+func (sc *Conn) confirm(header []byte) error {
+	if _, err := sc.aeadConn.Write(header); err != nil {
+		return err
+	}
+
+	sc.sessionMu.Lock()
+	defer sc.sessionMu.Unlock()
+
+	sc.aeadConn.SetReadDeadline(time.Now().Add(sc.client.config.Timeout))
+	defer sc.aeadConn.SetReadDeadline(time.Time{})
+	return sc.readReply()
+}
+
+// readReply 读取服务端的回复，错误回复会被转换为错误返回
+func (sc *Conn) readReply() error {
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(sc.aeadConn, buf); err != nil {
+		if err == errZeroChunk {
+			sc.remoteDone = true
+			return io.EOF
+		}
+		return err
+	}
+	sc.replyRead = true
+
+	switch buf[0] {
+	case replyTunnel:
+		return nil
+	case replyError:
+		// [错误码][消息长度][消息]
+		head := make([]byte, 2)
+		if _, err := io.ReadFull(sc.aeadConn, head); err != nil {
+			return err
+		}
+		msg := make([]byte, head[1])
+		if _, err := io.ReadFull(sc.aeadConn, msg); err != nil {
+			return err
+		}
+		sc.aeadConn.broken.Store(true)
+		return fmt.Errorf("snell server reported error %d: %s", head[0], string(msg))
+	default:
+		sc.aeadConn.broken.Store(true)
+		return fmt.Errorf("unsupported snell reply command: %d", buf[0])
+	}
+}
+
+// Write 写入会话数据
+func (sc *Conn) Write(b []byte) (int, error) {
+	sc.closeMu.RLock()
+	defer sc.closeMu.RUnlock()
+
+	if sc.closed {
+		return 0, net.ErrClosed
+	}
+	return sc.aeadConn.Write(b)
+}
+
+// Close 结束会话；开启复用时连接在收到服务端结束标记后放回连接池
+func (sc *Conn) Close() error {
+	sc.closeOnce.Do(func() {
+		sc.closeMu.Lock()
+		sc.closed = true
+		sc.closeMu.Unlock()
+
+		if !sc.client.config.Reuse {
+			sc.aeadConn.Close()
+			return
+		}
+
+		// 发送会话结束标记
+		if err := sc.aeadConn.writeZeroChunk(); err != nil {
+			sc.aeadConn.Close()
+			return
+		}
+
+		// 中断可能阻塞的读取后，在后台等待服务端的结束标记
+		sc.aeadConn.SetReadDeadline(time.Now())
+		go sc.drain()
+	})
+	return nil
+}
+
+// drain 丢弃剩余数据直到读到服务端的结束标记，成功后复用连接
+func (sc *Conn) drain() {
+	// 持有会话锁，确保此前被中断的读取已经返回
+	sc.sessionMu.Lock()
+	defer sc.sessionMu.Unlock()
+
+	if sc.aeadConn.broken.Load() {
+		sc.aeadConn.Close()
+		return
+	}
+
+	sc.aeadConn.SetReadDeadline(time.Now().Add(drainTimeout))
+
+	if !sc.replyRead && !sc.remoteDone {
+		if err := sc.readReply(); err != nil && !sc.remoteDone {
+			sc.aeadConn.Close()
+			return
+		}
+	}
+
+	buf := make([]byte, maxPayloadSize)
+	for !sc.remoteDone {
+		_, err := sc.aeadConn.Read(buf)
+		if err == errZeroChunk {
+			sc.remoteDone = true
+			break
+		}
+		if err != nil {
+			sc.aeadConn.Close()
+			return
+		}
+	}
+
+	if sc.aeadConn.broken.Load() {
+		sc.aeadConn.Close()
+		return
+	}
+
+	sc.aeadConn.SetReadDeadline(time.Time{})
+	log.Printf("Snell会话结束，连接放回连接池: %s", sc.client.config.Server)
+	sc.client.putIdle(sc.aeadConn)
+}
@@ -0,0 +1,229 @@
+package snell
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// waitIdle 等待连接池中的空闲连接数量达到预期
+func waitIdle(t *testing.T, client *Client, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for client.IdleCount() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle count = %d, want %d", client.IdleCount(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAEADFraming(t *testing.T) {
+	for _, version := range []int{Version1, Version2, Version3} {
+		sc := newStreamCipher("psk", version)
+		left, right := net.Pipe()
+		writer, reader := newAEADConn(left, sc), newAEADConn(right, sc)
+
+		// 超过单个数据块上限的数据被拆分为多个块
+		data := make([]byte, 3*maxPayloadSize+100)
+		rand.Read(data)
+		go func() {
+			writer.Write(data)
+			writer.writeZeroChunk()
+		}()
+
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(reader, got); err != nil {
+			t.Fatalf("v%d: read: %v", version, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("v%d: data mismatch", version)
+		}
+		if _, err := reader.Read(got); err != errZeroChunk {
+			t.Fatalf("v%d: read after zero chunk = %v, want errZeroChunk", version, err)
+		}
+		left.Close()
+		right.Close()
+	}
+}
+
+func TestAEADFramingRejectsTampering(t *testing.T) {
+	sc := newStreamCipher("psk", Version3)
+	var raw bytes.Buffer
+	writer := newAEADConn(&bufferConn{Buffer: &raw}, sc)
+	if _, err := writer.Write([]byte("hello snell")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 盐之后的第一个字节属于加密的长度字段
+	tampered := raw.Bytes()
+	tampered[saltSize] ^= 0xff
+	reader := newAEADConn(&bufferConn{Buffer: bytes.NewBuffer(tampered)}, sc)
+	if _, err := reader.Read(make([]byte, 64)); err == nil {
+		t.Fatal("expected authentication error for tampered chunk")
+	}
+
+	// 使用不同PSK的一方无法解密
+	reader = newAEADConn(&bufferConn{Buffer: bytes.NewBuffer(raw.Bytes())}, newStreamCipher("other", Version3))
+	if _, err := reader.Read(make([]byte, 64)); err == nil {
+		t.Fatal("expected authentication error for wrong psk")
+	}
+}
+
+// bufferConn 以内存缓冲区作为底层连接
+type bufferConn struct {
+	net.Conn
+	*bytes.Buffer
+}
+
+func (c *bufferConn) Read(b []byte) (int, error)  { return c.Buffer.Read(b) }
+func (c *bufferConn) Write(b []byte) (int, error) { return c.Buffer.Write(b) }
+
+func TestClientObfs(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	for _, tc := range []struct {
+		version int
+		obfs    string
+	}{
+		{Version1, ObfsNone},
+		{Version2, ObfsHTTP},
+		{Version3, ObfsNone},
+		{Version3, ObfsHTTP},
+		{Version3, ObfsTLS},
+	} {
+		server := newTestServer(t, "psk", tc.version, tc.obfs)
+		client, err := NewClient(ClientConfig{
+			Server:   server.addr(),
+			PSK:      "psk",
+			Version:  tc.version,
+			Obfs:     tc.obfs,
+			ObfsHost: "www.bing.com",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := client.Dial(target)
+		if err != nil {
+			t.Fatalf("v%d obfs=%q: dial: %v", tc.version, tc.obfs, err)
+		}
+		// tls混淆每个记录最多16KB，数据需要跨多个记录
+		data := make([]byte, 64<<10)
+		rand.Read(data)
+		testutil.Echo(t, conn, data)
+		conn.Close()
+		client.Close()
+	}
+}
+
+func TestClientReuse(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "psk", Version3, ObfsHTTP)
+	client, err := NewClient(ClientConfig{Server: server.addr(), PSK: "psk", Obfs: ObfsHTTP, Reuse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 3; i++ {
+		conn, err := client.Dial(target)
+		if err != nil {
+			t.Fatalf("session %d: %v", i, err)
+		}
+		testutil.Echo(t, conn, []byte("session data"))
+		conn.Close()
+		waitIdle(t, client, 1)
+	}
+	if n := server.accepted.Load(); n != 1 {
+		t.Fatalf("server accepted %d connections, want 1", n)
+	}
+}
+
+func TestClientReuseRetriesClosedIdleConn(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "psk", Version3, ObfsNone)
+	server.dropIdle = true
+	client, err := NewClient(ClientConfig{Server: server.addr(), PSK: "psk", Reuse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := client.Dial(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, conn, []byte("first"))
+	conn.Close()
+	waitIdle(t, client, 1)
+
+	// 池中的连接已被服务端关闭，客户端应该重新建立连接而不是返回错误
+	conn, err = client.Dial(target)
+	if err != nil {
+		t.Fatalf("dial after server closed idle conn: %v", err)
+	}
+	testutil.Echo(t, conn, []byte("second"))
+	conn.Close()
+	if n := server.accepted.Load(); n != 2 {
+		t.Fatalf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestClientIdleTimeout(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "psk", Version3, ObfsNone)
+	client, err := NewClient(ClientConfig{
+		Server:      server.addr(),
+		PSK:         "psk",
+		Reuse:       true,
+		KeepAlive:   time.Hour,
+		IdleTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := client.Dial(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, conn, []byte("data"))
+	conn.Close()
+	waitIdle(t, client, 1)
+	// 空闲连接按IdleTimeout清理，与TCP keepalive间隔无关
+	waitIdle(t, client, 0)
+}
+
+func TestClientServerError(t *testing.T) {
+	// 获取一个没有监听的端口
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	server := newTestServer(t, "psk", Version3, ObfsNone)
+	client, err := NewClient(ClientConfig{Server: server.addr(), PSK: "psk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := client.Dial(closedAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 1))
+	if err == nil || !strings.Contains(err.Error(), "snell server reported error") {
+		t.Fatalf("read error = %v, want server error", err)
+	}
+}
@@ -0,0 +1,269 @@
+package snell
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// 混淆模式
+const (
+	ObfsNone = ""
+	ObfsHTTP = "http"
+	ObfsTLS  = "tls"
+)
+
+// tlsChunkSize TLS记录的最大负载长度
+const tlsChunkSize = 1 << 14
+
+// wrapObfs 按混淆模式包装到服务器的连接
+func wrapObfs(conn net.Conn, mode, host, port string) (net.Conn, error) {
+	switch mode {
+	case ObfsNone, "none":
+		return conn, nil
+	case ObfsHTTP:
+		return &httpObfsConn{Conn: conn, host: host, port: port, firstRequest: true, firstResponse: true}, nil
+	case ObfsTLS:
+		return &tlsObfsConn{Conn: conn, server: host, firstRequest: true, firstResponse: true}, nil
+	default:
+		return nil, fmt.Errorf("unsupported snell obfs mode: %s", mode)
+	}
+}
+
+// httpObfsConn simple-obfs的HTTP混淆
+// 首个请求伪装为WebSocket升级请求，首个响应跳过HTTP响应头
+type httpObfsConn struct {
+	net.Conn
+	host          string
+	port          string
+	pending       []byte
+	firstRequest  bool
+	firstResponse bool
+}
+
+// Read 读取数据，首次读取时去除HTTP响应头
+func (hc *httpObfsConn) Read(b []byte) (int, error) {
+	if len(hc.pending) > 0 {
+		n := copy(b, hc.pending)
+		hc.pending = hc.pending[n:]
+		return n, nil
+	}
+
+	if hc.firstResponse {
+		reader := bufio.NewReader(hc.Conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			return 0, fmt.Errorf("snell: invalid http obfs response: %v", err)
+		}
+		resp.Body.Close()
+		hc.firstResponse = false
+
+		// 响应头之后已经缓冲的数据属于隧道负载
+		buffered, _ := reader.Peek(reader.Buffered())
+		if len(buffered) > 0 {
+			n := copy(b, buffered)
+			hc.pending = append([]byte(nil), buffered[n:]...)
+			return n, nil
+		}
+	}
+
+	return hc.Conn.Read(b)
+}
+
+// Write 写入数据，首次写入时封装为HTTP请求
+func (hc *httpObfsConn) Write(b []byte) (int, error) {
+	if !hc.firstRequest {
+		return hc.Conn.Write(b)
+	}
+
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	host := hc.host
+	if hc.port != "" && hc.port != "80" {
+		host = net.JoinHostPort(hc.host, hc.port)
+	}
+
+	req, err := http.NewRequest("GET", "http://"+host+"/", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", fmt.Sprintf("curl/7.%d.%d", mrand.Intn(54), mrand.Intn(2)))
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", base64.URLEncoding.EncodeToString(key))
+	req.ContentLength = int64(len(b))
+
+	hc.firstRequest = false
+	if err := req.Write(hc.Conn); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// tlsObfsConn simple-obfs的TLS混淆
+// 首个请求放在ClientHello的session ticket扩展中，之后的数据封装为TLS应用数据记录
+type tlsObfsConn struct {
+	net.Conn
+	server        string
+	remain        int
+	firstRequest  bool
+	firstResponse bool
+}
+
+// read 跳过记录头后读取一个记录的负载
+func (tc *tlsObfsConn) read(b []byte, discard int) (int, error) {
+	if _, err := io.CopyN(io.Discard, tc.Conn, int64(discard)); err != nil {
+		return 0, err
+	}
+
+	sizeBuf := make([]byte, 2)
+	if _, err := io.ReadFull(tc.Conn, sizeBuf); err != nil {
+		return 0, err
+	}
+
+	length := int(binary.BigEndian.Uint16(sizeBuf))
+	if length > len(b) {
+		n, err := tc.Conn.Read(b)
+		tc.remain = length - n
+		return n, err
+	}
+	return io.ReadFull(tc.Conn, b[:length])
+}
+
+// Read 读取数据并去除TLS记录封装
+func (tc *tlsObfsConn) Read(b []byte) (int, error) {
+	if tc.remain > 0 {
+		length := tc.remain
+		if length > len(b) {
+			length = len(b)
+		}
+		n, err := io.ReadFull(tc.Conn, b[:length])
+		tc.remain -= n
+		return n, err
+	}
+
+	if tc.firstResponse {
+		// ServerHello(96) + ChangeCipherSpec(6) + 记录类型和版本(3)
+		tc.firstResponse = false
+		return tc.read(b, 105)
+	}
+
+	// 记录类型和版本
+	return tc.read(b, 3)
+}
+
+// Write 按TLS记录大小分块写入
+func (tc *tlsObfsConn) Write(b []byte) (int, error) {
+	for i := 0; i < len(b); i += tlsChunkSize {
+		end := i + tlsChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		if err := tc.writeRecord(b[i:end]); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+// writeRecord 写入一个TLS记录
+func (tc *tlsObfsConn) writeRecord(b []byte) error {
+	if tc.firstRequest {
+		tc.firstRequest = false
+		_, err := tc.Conn.Write(makeClientHello(b, tc.server))
+		return err
+	}
+
+	buf := make([]byte, 5+len(b))
+	copy(buf, []byte{0x17, 0x03, 0x03})
+	binary.BigEndian.PutUint16(buf[3:5], uint16(len(b)))
+	copy(buf[5:], b)
+	_, err := tc.Conn.Write(buf)
+	return err
+}
+
+// makeClientHello 构造携带数据的ClientHello
+func makeClientHello(data []byte, server string) []byte {
+	random := make([]byte, 28)
+	sessionID := make([]byte, 32)
+	rand.Read(random)
+	rand.Read(sessionID)
+
+	buf := &bytes.Buffer{}
+
+	// 握手记录, TLS 1.0, 长度
+	buf.WriteByte(0x16)
+	buf.Write([]byte{0x03, 0x01})
+	binary.Write(buf, binary.BigEndian, uint16(212+len(data)+len(server)))
+
+	// ClientHello, 长度, TLS 1.2
+	buf.WriteByte(0x01)
+	buf.WriteByte(0x00)
+	binary.Write(buf, binary.BigEndian, uint16(208+len(data)+len(server)))
+	buf.Write([]byte{0x03, 0x03})
+
+	// 带时间戳的随机数, session id
+	binary.Write(buf, binary.BigEndian, uint32(time.Now().Unix()))
+	buf.Write(random)
+	buf.WriteByte(32)
+	buf.Write(sessionID)
+
+	// 加密套件
+	buf.Write([]byte{0x00, 0x38})
+	buf.Write([]byte{
+		0xc0, 0x2c, 0xc0, 0x30, 0x00, 0x9f, 0xcc, 0xa9, 0xcc, 0xa8, 0xcc, 0xaa, 0xc0, 0x2b, 0xc0, 0x2f,
+		0x00, 0x9e, 0xc0, 0x24, 0xc0, 0x28, 0x00, 0x6b, 0xc0, 0x23, 0xc0, 0x27, 0x00, 0x67, 0xc0, 0x0a,
+		0xc0, 0x14, 0x00, 0x39, 0xc0, 0x09, 0xc0, 0x13, 0x00, 0x33, 0x00, 0x9d, 0x00, 0x9c, 0x00, 0x3d,
+		0x00, 0x3c, 0x00, 0x35, 0x00, 0x2f, 0x00, 0xff,
+	})
+
+	// 压缩方法
+	buf.Write([]byte{0x01, 0x00})
+
+	// 扩展总长度
+	binary.Write(buf, binary.BigEndian, uint16(79+len(data)+len(server)))
+
+	// session ticket扩展，携带首个请求
+	buf.Write([]byte{0x00, 0x23})
+	binary.Write(buf, binary.BigEndian, uint16(len(data)))
+	buf.Write(data)
+
+	// server name扩展
+	buf.Write([]byte{0x00, 0x00})
+	binary.Write(buf, binary.BigEndian, uint16(len(server)+5))
+	binary.Write(buf, binary.BigEndian, uint16(len(server)+3))
+	buf.WriteByte(0)
+	binary.Write(buf, binary.BigEndian, uint16(len(server)))
+	buf.WriteString(server)
+
+	// ec_point_formats
+	buf.Write([]byte{0x00, 0x0b, 0x00, 0x04, 0x03, 0x01, 0x00, 0x02})
+
+	// supported_groups
+	buf.Write([]byte{0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x19, 0x00, 0x18})
+
+	// signature_algorithms
+	buf.Write([]byte{
+		0x00, 0x0d, 0x00, 0x20, 0x00, 0x1e, 0x06, 0x01, 0x06, 0x02, 0x06, 0x03, 0x05,
+		0x01, 0x05, 0x02, 0x05, 0x03, 0x04, 0x01, 0x04, 0x02, 0x04, 0x03, 0x03, 0x01,
+		0x03, 0x02, 0x03, 0x03, 0x02, 0x01, 0x02, 0x02, 0x02, 0x03,
+	})
+
+	// encrypt_then_mac
+	buf.Write([]byte{0x00, 0x16, 0x00, 0x00})
+
+	// extended_master_secret
+	buf.Write([]byte{0x00, 0x17, 0x00, 0x00})
+
+	return buf.Bytes()
+}
@@ -0,0 +1,344 @@
+package snell
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testServer 最小化的Snell服务端，用于验证客户端实现
+// 支持CONNECT命令、v2/v3的连接复用以及http/tls混淆
+type testServer struct {
+	version int
+	obfs    string
+	cipher  *streamCipher
+
+	// dropIdle 为真时会话结束后关闭连接，模拟服务端清理了客户端连接池中的空闲连接
+	dropIdle bool
+	accepted atomic.Int32
+
+	listener net.Listener
+}
+
+// newTestServer 在本机随机端口上启动Snell服务端，测试结束时关闭
+func newTestServer(t *testing.T, psk string, version int, obfs string) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		version:  version,
+		obfs:     obfs,
+		cipher:   newStreamCipher(psk, version),
+		listener: listener,
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			go s.handleConn(conn)
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// handleConn 处理一个客户端连接上的所有会话
+func (s *testServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	var wrapped net.Conn
+	switch s.obfs {
+	case ObfsHTTP:
+		wrapped = &httpObfsServerConn{Conn: conn, reader: bufio.NewReader(conn)}
+	case ObfsTLS:
+		wrapped = &tlsObfsServerConn{Conn: conn}
+	default:
+		wrapped = conn
+	}
+
+	stream := newAEADConn(wrapped, s.cipher)
+	for {
+		reuse, err := s.handleSession(stream)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("Snell测试服务端会话错误: %v", err)
+			}
+			return
+		}
+		if !reuse || s.dropIdle {
+			return
+		}
+	}
+}
+
+// handleSession 处理一次会话，返回连接是否可以继续复用
+func (s *testServer) handleSession(stream *aeadConn) (bool, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(stream, head); err != nil {
+		return false, err
+	}
+	if head[0] != headerVersion {
+		return false, fmt.Errorf("unsupported header version: %d", head[0])
+	}
+	if head[1] != commandConnect && head[1] != commandConnectV2 {
+		return false, fmt.Errorf("unsupported command: %d", head[1])
+	}
+
+	// client id
+	idLen := make([]byte, 1)
+	if _, err := io.ReadFull(stream, idLen); err != nil {
+		return false, err
+	}
+	if _, err := io.CopyN(io.Discard, stream, int64(idLen[0])); err != nil {
+		return false, err
+	}
+
+	// host和端口
+	hostLen := make([]byte, 1)
+	if _, err := io.ReadFull(stream, hostLen); err != nil {
+		return false, err
+	}
+	hostPort := make([]byte, int(hostLen[0])+2)
+	if _, err := io.ReadFull(stream, hostPort); err != nil {
+		return false, err
+	}
+	host := string(hostPort[:hostLen[0]])
+	port := binary.BigEndian.Uint16(hostPort[hostLen[0]:])
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+
+	reusable := head[1] == commandConnectV2
+
+	remote, err := net.DialTimeout("tcp", target, defaultDialTimeout)
+	if err != nil {
+		msg := err.Error()
+		if len(msg) > 255 {
+			msg = msg[:255]
+		}
+		reply := append([]byte{replyError, 1, byte(len(msg))}, msg...)
+		stream.Write(reply)
+		return false, nil
+	}
+	defer remote.Close()
+
+	if _, err := stream.Write([]byte{replyTunnel}); err != nil {
+		return false, err
+	}
+
+	// 目标到客户端
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stream, remote)
+		if err == nil && reusable {
+			err = stream.writeZeroChunk()
+		}
+		done <- err
+	}()
+
+	// 客户端到目标，零长度块表示客户端结束会话
+	buf := make([]byte, maxPayloadSize)
+	var upErr error
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, werr := remote.Write(buf[:n]); werr != nil {
+				upErr = werr
+				break
+			}
+		}
+		if err == errZeroChunk {
+			break
+		}
+		if err != nil {
+			upErr = err
+			break
+		}
+	}
+
+	if upErr != nil {
+		// 客户端已断开，无需再等待下行
+		remote.Close()
+		<-done
+		return false, upErr
+	}
+
+	if tcpConn, ok := remote.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+
+	if err := <-done; err != nil {
+		return false, err
+	}
+	return reusable, nil
+}
+
+// httpObfsServerConn 服务端的HTTP混淆处理
+type httpObfsServerConn struct {
+	net.Conn
+	reader       *bufio.Reader
+	headerRead   bool
+	responseSent bool
+}
+
+// Read 首次读取时解析HTTP请求，请求体即为隧道数据
+func (hc *httpObfsServerConn) Read(b []byte) (int, error) {
+	if !hc.headerRead {
+		if _, err := http.ReadRequest(hc.reader); err != nil {
+			return 0, err
+		}
+		hc.headerRead = true
+	}
+	return hc.reader.Read(b)
+}
+
+// Write 首次写入前发送HTTP 101响应
+func (hc *httpObfsServerConn) Write(b []byte) (int, error) {
+	if !hc.responseSent {
+		hc.responseSent = true
+		resp := fmt.Sprintf("HTTP/1.1 101 Switching Protocols\r\nServer: nginx/1.18.0\r\nDate: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			time.Now().UTC().Format(http.TimeFormat), "dGhlIHNhbXBsZSBub25jZQ==")
+		if _, err := hc.Conn.Write([]byte(resp)); err != nil {
+			return 0, err
+		}
+	}
+	return hc.Conn.Write(b)
+}
+
+// tlsObfsServerConn 服务端的TLS混淆处理
+type tlsObfsServerConn struct {
+	net.Conn
+	pending      []byte
+	remain       int
+	helloRead    bool
+	responseSent bool
+}
+
+// Read 首次读取时从ClientHello的session ticket中取出数据，之后解析应用数据记录
+func (tc *tlsObfsServerConn) Read(b []byte) (int, error) {
+	if !tc.helloRead {
+		tc.helloRead = true
+		data, err := readClientHelloTicket(tc.Conn)
+		if err != nil {
+			return 0, err
+		}
+		tc.pending = data
+	}
+
+	if len(tc.pending) > 0 {
+		n := copy(b, tc.pending)
+		tc.pending = tc.pending[n:]
+		return n, nil
+	}
+
+	if tc.remain == 0 {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(tc.Conn, header); err != nil {
+			return 0, err
+		}
+		tc.remain = int(binary.BigEndian.Uint16(header[3:5]))
+	}
+
+	length := tc.remain
+	if length > len(b) {
+		length = len(b)
+	}
+	n, err := tc.Conn.Read(b[:length])
+	tc.remain -= n
+	return n, err
+}
+
+// Write 首次写入时伪造ServerHello，之后封装为应用数据记录
+func (tc *tlsObfsServerConn) Write(b []byte) (int, error) {
+	for i := 0; i < len(b); i += tlsChunkSize {
+		end := i + tlsChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		chunk := b[i:end]
+
+		var record []byte
+		if !tc.responseSent {
+			tc.responseSent = true
+			// ServerHello(96) + ChangeCipherSpec(6)，内容仅用于对齐客户端跳过的长度
+			record = make([]byte, 102)
+			copy(record, []byte{0x16, 0x03, 0x03, 0x00, 0x5b, 0x02})
+			copy(record[96:], []byte{0x14, 0x03, 0x03, 0x00, 0x01, 0x01})
+			record = append(record, 0x16, 0x03, 0x03)
+		} else {
+			record = []byte{0x17, 0x03, 0x03}
+		}
+		record = binary.BigEndian.AppendUint16(record, uint16(len(chunk)))
+		record = append(record, chunk...)
+
+		if _, err := tc.Conn.Write(record); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+// readClientHelloTicket 读取ClientHello并返回session ticket扩展中的数据
+func readClientHelloTicket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 0x16 {
+		return nil, fmt.Errorf("unexpected tls record type: %d", header[0])
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	// 握手头(4) + 版本(2) + 随机数(32)
+	pos := 4 + 2 + 32
+	if len(body) < pos+1 {
+		return nil, fmt.Errorf("client hello too short")
+	}
+	pos += 1 + int(body[pos]) // session id
+	if len(body) < pos+2 {
+		return nil, fmt.Errorf("client hello too short")
+	}
+	pos += 2 + int(binary.BigEndian.Uint16(body[pos:])) // 加密套件
+	if len(body) < pos+1 {
+		return nil, fmt.Errorf("client hello too short")
+	}
+	pos += 1 + int(body[pos]) // 压缩方法
+	if len(body) < pos+2 {
+		return nil, fmt.Errorf("client hello too short")
+	}
+	pos += 2 // 扩展总长度
+
+	for pos+4 <= len(body) {
+		extType := binary.BigEndian.Uint16(body[pos:])
+		extLen := int(binary.BigEndian.Uint16(body[pos+2:]))
+		pos += 4
+		if pos+extLen > len(body) {
+			break
+		}
+		if extType == 0x0023 {
+			return body[pos : pos+extLen], nil
+		}
+		pos += extLen
+	}
+	return nil, fmt.Errorf("session ticket extension not found")
+}
@@ -0,0 +1,400 @@
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// 协议常量
+const (
+	socksVersion byte = 0x05
+
+	methodNoAuth       byte = 0x00
+	methodUserPass     byte = 0x02
+	methodNoAcceptable byte = 0xFF
+
+	userPassVersion byte = 0x01
+
+	cmdConnect      byte = 0x01
+	cmdUDPAssociate byte = 0x03
+
+	atypIPv4   byte = 0x01
+	atypDomain byte = 0x03
+	atypIPv6   byte = 0x04
+
+	replySucceeded byte = 0x00
+)
+
+const (
+	// defaultDialTimeout 连接SOCKS5服务器并完成握手的默认超时时间
+	defaultDialTimeout = 5 * time.Second
+	// maxUDPPacketSize UDP数据包的最大长度
+	maxUDPPacketSize = 65535
+)
+
+// replyMessages SOCKS5回复码对应的错误信息
+var replyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// ClientConfig SOCKS5客户端配置
+type ClientConfig struct {
+	Server         string        // 服务器地址 host:port
+	Username       string        // 用户名，为空时使用无认证方式
+	Password       string        // 密码
+	ResolveLocally bool          // 是否在本地解析目标域名，默认交给服务器解析
+	Timeout        time.Duration // 连接和握手超时时间
+
+	// DialContext 连接服务器使用的拨号函数，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client SOCKS5客户端
+type Client struct {
+	config ClientConfig
+}
+
+// NewClient 创建新的SOCKS5客户端
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing socks5 server address")
+	}
+	if _, _, err := net.SplitHostPort(config.Server); err != nil {
+		return nil, fmt.Errorf("invalid socks5 server address %s: %v", config.Server, err)
+	}
+	if len(config.Username) > 255 || len(config.Password) > 255 {
+		return nil, fmt.Errorf("socks5 username or password too long")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+	return &Client{config: config}, nil
+}
+
+// Dial 通过SOCKS5服务器建立到目标地址的TCP连接
+func (c *Client) Dial(targetAddr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	return c.DialContext(ctx, targetAddr)
+}
+
+// DialContext 通过SOCKS5服务器建立到目标地址的TCP连接
+func (c *Client) DialContext(ctx context.Context, targetAddr string) (net.Conn, error) {
+	addr, err := c.encodeTarget(ctx, targetAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.handshake(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := c.request(ctx, conn, cmdConnect, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ListenPacket 通过UDP ASSOCIATE建立UDP转发会话
+// 返回的PacketConn在控制连接断开时随之失效
+func (c *Client) ListenPacket() (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	return c.ListenPacketContext(ctx)
+}
+
+// ListenPacketContext 通过UDP ASSOCIATE建立UDP转发会话
+func (c *Client) ListenPacketContext(ctx context.Context) (net.PacketConn, error) {
+	ctrl, err := c.handshake(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 客户端地址未知，按RFC 1928使用全零地址
+	relay, err := c.request(ctx, ctrl, cmdUDPAssociate, []byte{atypIPv4, 0, 0, 0, 0, 0, 0})
+	if err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+
+	// 服务器返回未指定地址时使用服务器本身的地址
+	relayHost, relayPort, err := net.SplitHostPort(relay)
+	if err != nil {
+		ctrl.Close()
+		return nil, fmt.Errorf("invalid socks5 relay address %s: %v", relay, err)
+	}
+	if ip := net.ParseIP(relayHost); ip == nil || ip.IsUnspecified() {
+		relayHost, _, _ = net.SplitHostPort(c.config.Server)
+	}
+
+	udpConn, err := c.dial(ctx, "udp", net.JoinHostPort(relayHost, relayPort))
+	if err != nil {
+		ctrl.Close()
+		return nil, fmt.Errorf("failed to connect to socks5 udp relay: %v", err)
+	}
+
+	pc := &PacketConn{
+		client: c,
+		ctrl:   ctrl,
+		conn:   udpConn,
+	}
+	go pc.watchControl()
+	return pc, nil
+}
+
+// handshake 连接服务器并完成方法协商和认证
+func (c *Client) handshake(ctx context.Context) (net.Conn, error) {
+	conn, err := c.dial(ctx, "tcp", c.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SOCKS5 server %s: %v", c.config.Server, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := c.negotiate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dial 使用配置的拨号函数连接服务器
+func (c *Client) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if c.config.DialContext != nil {
+		return c.config.DialContext(ctx, network, address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// negotiate 协商认证方法，需要时进行用户名密码认证（RFC 1929）
+func (c *Client) negotiate(conn net.Conn) error {
+	methods := []byte{methodNoAuth}
+	if c.config.Username != "" {
+		methods = []byte{methodNoAuth, methodUserPass}
+	}
+
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("failed to send socks5 greeting: %v", err)
+	}
+
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return fmt.Errorf("failed to read socks5 method selection: %v", err)
+	}
+	if resp[0] != socksVersion {
+		return fmt.Errorf("unexpected socks version: %d", resp[0])
+	}
+
+	switch resp[1] {
+	case methodNoAuth:
+		return nil
+	case methodUserPass:
+		if c.config.Username == "" {
+			return fmt.Errorf("socks5 server requires username/password authentication")
+		}
+		return c.authenticate(conn)
+	case methodNoAcceptable:
+		return fmt.Errorf("socks5 server accepted none of the offered authentication methods")
+	default:
+		return fmt.Errorf("unsupported socks5 authentication method: %d", resp[1])
+	}
+}
+
+// authenticate 用户名密码认证
+// [版本][用户名长度][用户名][密码长度][密码]
+func (c *Client) authenticate(conn net.Conn) error {
+	req := make([]byte, 0, 3+len(c.config.Username)+len(c.config.Password))
+	req = append(req, userPassVersion, byte(len(c.config.Username)))
+	req = append(req, c.config.Username...)
+	req = append(req, byte(len(c.config.Password)))
+	req = append(req, c.config.Password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("failed to send socks5 credentials: %v", err)
+	}
+
+	resp := make([]byte, 2)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return fmt.Errorf("failed to read socks5 authentication response: %v", err)
+	}
+	if resp[1] != 0x00 {
+		return fmt.Errorf("socks5 authentication failed: status %d", resp[1])
+	}
+	return nil
+}
+
+// request 发送命令请求并返回服务器绑定的地址
+func (c *Client) request(ctx context.Context, conn net.Conn, cmd byte, addr []byte) (string, error) {
+	req := make([]byte, 0, 3+len(addr))
+	req = append(req, socksVersion, cmd, 0x00)
+	req = append(req, addr...)
+	if _, err := conn.Write(req); err != nil {
+		return "", fmt.Errorf("failed to send socks5 request: %v", err)
+	}
+
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return "", fmt.Errorf("failed to read socks5 reply: %v", err)
+	}
+	if head[0] != socksVersion {
+		return "", fmt.Errorf("unexpected socks version in reply: %d", head[0])
+	}
+	if head[1] != replySucceeded {
+		msg, ok := replyMessages[head[1]]
+		if !ok {
+			msg = "unknown error"
+		}
+		return "", fmt.Errorf("socks5 request failed: %s (0x%02x)", msg, head[1])
+	}
+
+	bound, err := readAddr(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to read socks5 bound address: %v", err)
+	}
+
+	// 握手完成后取消超时
+	conn.SetDeadline(time.Time{})
+	return bound, nil
+}
+
+// encodeTarget 将目标地址编码为SOCKS5地址格式，按配置决定是否在本地解析域名
+func (c *Client) encodeTarget(ctx context.Context, targetAddr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target address %s: %v", targetAddr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid target port: %s", portStr)
+	}
+
+	if _, err := netip.ParseAddr(host); err != nil && c.config.ResolveLocally {
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil || len(addrs) == 0 {
+			return nil, fmt.Errorf("failed to resolve %s: %v", host, err)
+		}
+		host = addrs[0].Unmap().String()
+	}
+
+	return encodeAddr(host, port)
+}
+
+// encodeAddr 编码地址 [类型][地址][端口]
+func encodeAddr(host string, port int) ([]byte, error) {
+	var buf []byte
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		if ip.Is4() {
+			buf = append(buf, atypIPv4)
+		} else {
+			buf = append(buf, atypIPv6)
+		}
+		buf = append(buf, ip.AsSlice()...)
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("target host too long: %s", host)
+		}
+		buf = append(buf, atypDomain, byte(len(host)))
+		buf = append(buf, host...)
+	}
+	return binary.BigEndian.AppendUint16(buf, uint16(port)), nil
+}
+
+// readAddr 从流中读取SOCKS5地址
+func readAddr(r io.Reader) (string, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch atyp[0] {
+	case atypIPv4, atypIPv6:
+		size := net.IPv4len
+		if atyp[0] == atypIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case atypDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("unsupported address type: %d", atyp[0])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// parseAddr 从UDP数据包中解析SOCKS5地址，返回地址和占用的字节数
+func parseAddr(b []byte) (string, int, error) {
+	if len(b) < 1 {
+		return "", 0, fmt.Errorf("packet too short")
+	}
+
+	var host string
+	pos := 1
+	switch b[0] {
+	case atypIPv4:
+		if len(b) < pos+net.IPv4len+2 {
+			return "", 0, fmt.Errorf("packet too short")
+		}
+		host = net.IP(b[pos : pos+net.IPv4len]).String()
+		pos += net.IPv4len
+	case atypIPv6:
+		if len(b) < pos+net.IPv6len+2 {
+			return "", 0, fmt.Errorf("packet too short")
+		}
+		host = net.IP(b[pos : pos+net.IPv6len]).String()
+		pos += net.IPv6len
+	case atypDomain:
+		if len(b) < pos+1 {
+			return "", 0, fmt.Errorf("packet too short")
+		}
+		length := int(b[pos])
+		pos++
+		if len(b) < pos+length+2 {
+			return "", 0, fmt.Errorf("packet too short")
+		}
+		host = string(b[pos : pos+length])
+		pos += length
+	default:
+		return "", 0, fmt.Errorf("unsupported address type: %d", b[0])
+	}
+
+	port := binary.BigEndian.Uint16(b[pos:])
+	pos += 2
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), pos, nil
+}
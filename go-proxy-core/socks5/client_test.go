@@ -0,0 +1,347 @@
+package socks5
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// testServer 最小化的SOCKS5服务端，记录收到的请求
+// CONNECT请求不连接目标，而是直接回显数据；UDP ASSOCIATE回显数据包
+type testServer struct {
+	username string
+	password string
+	reply    byte // CONNECT的回复码
+	// dropAssociate 为真时UDP ASSOCIATE回复后立即关闭控制连接
+	dropAssociate bool
+
+	listener net.Listener
+
+	mu       sync.Mutex
+	requests []testRequest
+}
+
+// testRequest 服务端收到的一个请求
+type testRequest struct {
+	cmd    byte
+	atyp   byte
+	target string
+}
+
+// newTestServer 在本机随机端口上启动SOCKS5服务端，设置了用户名时要求认证
+func newTestServer(t *testing.T, username, password string) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{username: username, password: password, listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(t, conn)
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// lastRequest 返回最近一次请求
+func (s *testServer) lastRequest(t *testing.T) testRequest {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == 0 {
+		t.Fatal("server received no request")
+	}
+	return s.requests[len(s.requests)-1]
+}
+
+// record 记录一个请求
+func (s *testServer) record(req testRequest) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+}
+
+// handleConn 处理一个客户端连接
+func (s *testServer) handleConn(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	want := methodNoAuth
+	if s.username != "" {
+		want = methodUserPass
+	}
+	if bytes.IndexByte(methods, want) < 0 {
+		conn.Write([]byte{socksVersion, methodNoAcceptable})
+		return
+	}
+	conn.Write([]byte{socksVersion, want})
+
+	if want == methodUserPass {
+		// RFC 1929: [版本][用户名长度][用户名][密码长度][密码]
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		if buf[0] != userPassVersion {
+			t.Errorf("auth version = %d", buf[0])
+			return
+		}
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+		if string(user) != s.username || string(pass) != s.password {
+			conn.Write([]byte{userPassVersion, 0x01})
+			return
+		}
+		conn.Write([]byte{userPassVersion, 0x00})
+	}
+
+	req := make([]byte, 3)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, atyp); err != nil {
+		return
+	}
+	target, err := readAddr(io.MultiReader(bytes.NewReader(atyp), conn))
+	if err != nil {
+		return
+	}
+	s.record(testRequest{cmd: req[1], atyp: atyp[0], target: target})
+
+	switch req[1] {
+	case cmdConnect:
+		if s.reply != replySucceeded {
+			conn.Write([]byte{socksVersion, s.reply, 0, atypIPv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		conn.Write([]byte{socksVersion, replySucceeded, 0, atypIPv4, 127, 0, 0, 1, 0, 0})
+		io.Copy(conn, conn)
+	case cmdUDPAssociate:
+		relay, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		// 返回未指定地址，客户端应使用服务器地址连接中继
+		port := relay.LocalAddr().(*net.UDPAddr).Port
+		conn.Write([]byte{socksVersion, replySucceeded, 0, atypIPv4, 0, 0, 0, 0, byte(port >> 8), byte(port)})
+		if s.dropAssociate {
+			return
+		}
+		go s.relayUDP(relay)
+		io.Copy(io.Discard, conn)
+	default:
+		conn.Write([]byte{socksVersion, 0x07, 0, atypIPv4, 0, 0, 0, 0, 0, 0})
+	}
+}
+
+// relayUDP 记录数据包的目标地址并原样回显，回显的来源地址即为目标地址
+func (s *testServer) relayUDP(relay net.PacketConn) {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		n, from, err := relay.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < 4 {
+			continue
+		}
+		target, _, err := parseAddr(buf[3:n])
+		if err != nil {
+			continue
+		}
+		s.record(testRequest{cmd: cmdUDPAssociate, atyp: buf[3], target: target})
+		relay.WriteTo(buf[:n], from)
+	}
+}
+
+func TestDialAddressTypes(t *testing.T) {
+	server := newTestServer(t, "", "")
+	client, err := NewClient(ClientConfig{Server: server.addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		target string
+		atyp   byte
+	}{
+		{"1.2.3.4:80", atypIPv4},
+		{"[2001:db8::1]:443", atypIPv6},
+		{"[::ffff:10.0.0.1]:8080", atypIPv4},
+		{"example.com:8080", atypDomain},
+	} {
+		conn, err := client.Dial(tc.target)
+		if err != nil {
+			t.Fatalf("dial %s: %v", tc.target, err)
+		}
+		testutil.Echo(t, conn, []byte("hello "+tc.target))
+		conn.Close()
+
+		req := server.lastRequest(t)
+		if req.cmd != cmdConnect || req.atyp != tc.atyp {
+			t.Fatalf("%s: cmd=%d atyp=%d, want cmd=%d atyp=%d", tc.target, req.cmd, req.atyp, cmdConnect, tc.atyp)
+		}
+		if tc.target == "[::ffff:10.0.0.1]:8080" {
+			if req.target != "10.0.0.1:8080" {
+				t.Fatalf("ipv4-mapped target = %s", req.target)
+			}
+		} else if req.target != tc.target {
+			t.Fatalf("target = %s, want %s", req.target, tc.target)
+		}
+	}
+}
+
+func TestUserPassAuth(t *testing.T) {
+	server := newTestServer(t, "user", "p@ss word")
+
+	client, _ := NewClient(ClientConfig{Server: server.addr(), Username: "user", Password: "p@ss word"})
+	conn, err := client.Dial("example.com:80")
+	if err != nil {
+		t.Fatalf("dial with valid credentials: %v", err)
+	}
+	testutil.Echo(t, conn, []byte("authenticated"))
+	conn.Close()
+
+	client, _ = NewClient(ClientConfig{Server: server.addr(), Username: "user", Password: "wrong"})
+	if _, err := client.Dial("example.com:80"); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("dial with wrong password: %v", err)
+	}
+
+	client, _ = NewClient(ClientConfig{Server: server.addr()})
+	if _, err := client.Dial("example.com:80"); err == nil || !strings.Contains(err.Error(), "none of the offered") {
+		t.Fatalf("dial without credentials: %v", err)
+	}
+}
+
+func TestResolveOption(t *testing.T) {
+	server := newTestServer(t, "", "")
+
+	// 默认由服务器解析，发送域名
+	client, _ := NewClient(ClientConfig{Server: server.addr()})
+	conn, err := client.Dial("localhost:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if req := server.lastRequest(t); req.atyp != atypDomain || req.target != "localhost:80" {
+		t.Fatalf("remote resolve sent atyp=%d target=%s", req.atyp, req.target)
+	}
+
+	// 本地解析时发送IP地址
+	client, _ = NewClient(ClientConfig{Server: server.addr(), ResolveLocally: true})
+	conn, err = client.Dial("localhost:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	req := server.lastRequest(t)
+	if req.atyp == atypDomain {
+		t.Fatalf("local resolve sent domain %s", req.target)
+	}
+	host, _, _ := net.SplitHostPort(req.target)
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		t.Fatalf("local resolve sent %s, want loopback address", req.target)
+	}
+}
+
+func TestRequestFailure(t *testing.T) {
+	server := newTestServer(t, "", "")
+	server.reply = 0x05
+	client, _ := NewClient(ClientConfig{Server: server.addr()})
+	if _, err := client.Dial("1.2.3.4:80"); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("dial error = %v, want connection refused", err)
+	}
+}
+
+func TestUDPAssociate(t *testing.T) {
+	server := newTestServer(t, "user", "pass")
+	client, _ := NewClient(ClientConfig{Server: server.addr(), Username: "user", Password: "pass"})
+
+	pc, err := client.ListenPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	pc.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for _, tc := range []struct {
+		addr net.Addr
+		atyp byte
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("8.8.8.8"), Port: 53}, atypIPv4},
+		{&net.UDPAddr{IP: net.ParseIP("2001:4860:4860::8888"), Port: 53}, atypIPv6},
+		{&Addr{Host: "dns.example", Port: 53}, atypDomain},
+	} {
+		payload := []byte("query " + tc.addr.String())
+		if _, err := pc.WriteTo(payload, tc.addr); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 1500)
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read reply for %s: %v", tc.addr, err)
+		}
+		if !bytes.Equal(buf[:n], payload) {
+			t.Fatalf("reply = %q, want %q", buf[:n], payload)
+		}
+		if from.String() != tc.addr.String() {
+			t.Fatalf("reply from %s, want %s", from, tc.addr)
+		}
+		if req := server.lastRequest(t); req.atyp != tc.atyp || req.target != tc.addr.String() {
+			t.Fatalf("relay got atyp=%d target=%s", req.atyp, req.target)
+		}
+	}
+}
+
+func TestUDPAssociateClosesWithControlConn(t *testing.T) {
+	server := newTestServer(t, "", "")
+	server.dropAssociate = true
+	client, _ := NewClient(ClientConfig{Server: server.addr()})
+
+	pc, err := client.ListenPacket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	// 服务端关闭控制连接后UDP会话随之失效，阻塞的读取返回错误而不是等到超时
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if _, _, err := pc.ReadFrom(make([]byte, 16)); err == nil {
+		t.Fatal("expected read error after control connection closed")
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Fatal("read was not interrupted when control connection closed")
+	}
+}
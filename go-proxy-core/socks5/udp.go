@@ -0,0 +1,117 @@
+package socks5
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Addr SOCKS5目标地址，可以是域名，实现net.Addr接口
+type Addr struct {
+	Host string
+	Port int
+}
+
+// Network 返回网络类型
+func (a *Addr) Network() string {
+	return "udp"
+}
+
+// String 返回host:port形式的地址
+func (a *Addr) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// PacketConn 基于UDP ASSOCIATE的数据包连接
+// 每个数据包都带有 [RSV(2)][FRAG][地址] 头部
+type PacketConn struct {
+	client *Client
+	ctrl   net.Conn // TCP控制连接，关闭后UDP转发随之失效
+	conn   net.Conn // 到服务器UDP中继端口的连接
+
+	closeOnce sync.Once
+}
+
+// ReadFrom 读取一个数据包，返回数据来源地址
+func (pc *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		n, err := pc.conn.Read(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+		// 不支持分片，丢弃分片数据包
+		if n < 4 || buf[2] != 0 {
+			continue
+		}
+		addr, headLen, err := parseAddr(buf[3:n])
+		if err != nil {
+			continue
+		}
+
+		host, portStr, _ := net.SplitHostPort(addr)
+		port, _ := strconv.Atoi(portStr)
+		var from net.Addr = &Addr{Host: host, Port: port}
+		if ip := net.ParseIP(host); ip != nil {
+			from = &net.UDPAddr{IP: ip, Port: port}
+		}
+
+		return copy(b, buf[3+headLen:n]), from, nil
+	}
+}
+
+// WriteTo 向目标地址发送一个数据包，目标可以是域名
+func (pc *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	target, err := pc.client.encodeTarget(context.Background(), addr.String())
+	if err != nil {
+		return 0, err
+	}
+
+	packet := make([]byte, 0, 3+len(target)+len(b))
+	packet = append(packet, 0, 0, 0)
+	packet = append(packet, target...)
+	packet = append(packet, b...)
+	if _, err := pc.conn.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 关闭UDP转发会话
+func (pc *PacketConn) Close() error {
+	var err error
+	pc.closeOnce.Do(func() {
+		err = pc.conn.Close()
+		pc.ctrl.Close()
+	})
+	return err
+}
+
+// LocalAddr 返回本地地址
+func (pc *PacketConn) LocalAddr() net.Addr {
+	return pc.conn.LocalAddr()
+}
+
+// SetDeadline 设置读写超时
+func (pc *PacketConn) SetDeadline(t time.Time) error {
+	return pc.conn.SetDeadline(t)
+}
+
+// SetReadDeadline 设置读超时
+func (pc *PacketConn) SetReadDeadline(t time.Time) error {
+	return pc.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 设置写超时
+func (pc *PacketConn) SetWriteDeadline(t time.Time) error {
+	return pc.conn.SetWriteDeadline(t)
+}
+
+// watchControl 控制连接断开时关闭UDP会话
+func (pc *PacketConn) watchControl() {
+	io.Copy(io.Discard, pc.ctrl)
+	pc.Close()
+}
@@ -0,0 +1,397 @@
+package sshtunnel
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// defaultDialTimeout 连接SSH服务器并完成握手的默认超时时间
+	defaultDialTimeout = 10 * time.Second
+	// defaultKeepAlive 默认保活间隔
+	defaultKeepAlive = 30 * time.Second
+	// keepAliveRequest OpenSSH使用的保活请求类型
+	keepAliveRequest = "keepalive@openssh.com"
+)
+
+// ClientConfig SSH隧道客户端配置
+type ClientConfig struct {
+	Server     string // 服务器地址 host:port
+	User       string
+	Password   string
+	PrivateKey string // PEM格式私钥内容
+	Passphrase string // 私钥密码
+	UseAgent   bool   // 是否使用ssh-agent认证
+	AgentSock  string // ssh-agent套接字，为空时使用SSH_AUTH_SOCK
+
+	// 主机密钥校验，按以下顺序生效：
+	// HostKeys为authorized_keys格式公钥或SHA256指纹，匹配任意一个即可；KnownHosts为known_hosts文件路径；
+	// InsecureSkipHostKey跳过校验；都未配置时使用~/.ssh/known_hosts
+	HostKeys            []string
+	KnownHosts          string
+	InsecureSkipHostKey bool
+
+	KeepAlive time.Duration // 保活间隔，小于0时不发送保活
+	Timeout   time.Duration
+
+	// DialContext 建立到服务器的TCP连接，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client SSH隧道客户端
+// 所有目标连接作为direct-tcpip通道复用同一个SSH连接，连接断开后在下次使用时重新建立
+type Client struct {
+	config          ClientConfig
+	signers         []ssh.Signer
+	hostKeyCallback ssh.HostKeyCallback
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewClient 创建新的SSH隧道客户端，配置错误在创建时返回
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing ssh server")
+	}
+	if _, _, err := net.SplitHostPort(config.Server); err != nil {
+		return nil, fmt.Errorf("invalid ssh server %s: %v", config.Server, err)
+	}
+	if config.User == "" {
+		return nil, fmt.Errorf("missing ssh user")
+	}
+	if config.KeepAlive == 0 {
+		config.KeepAlive = defaultKeepAlive
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+
+	c := &Client{config: config}
+
+	if config.PrivateKey != "" {
+		signer, err := parsePrivateKey(config.PrivateKey, config.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		c.signers = append(c.signers, signer)
+	}
+	if config.Password == "" && len(c.signers) == 0 && !config.UseAgent {
+		return nil, fmt.Errorf("no ssh authentication method configured")
+	}
+
+	callback, err := hostKeyCallback(config)
+	if err != nil {
+		return nil, err
+	}
+	c.hostKeyCallback = callback
+
+	return c, nil
+}
+
+// parsePrivateKey 解析私钥，支持PEM内容或文件路径
+func parsePrivateKey(key, passphrase string) (ssh.Signer, error) {
+	pem := []byte(key)
+	if !strings.Contains(key, "-----BEGIN") {
+		data, err := os.ReadFile(expandHome(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key %s: %v", key, err)
+		}
+		pem = data
+	}
+
+	var signer ssh.Signer
+	var err error
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback 根据配置生成主机密钥校验函数
+func hostKeyCallback(config ClientConfig) (ssh.HostKeyCallback, error) {
+	if len(config.HostKeys) > 0 {
+		return fixedHostKeys(config.HostKeys)
+	}
+	if config.KnownHosts != "" {
+		callback, err := knownhosts.New(expandHome(config.KnownHosts))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known_hosts %s: %v", config.KnownHosts, err)
+		}
+		return callback, nil
+	}
+	if config.InsecureSkipHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("no host key verification configured: %v", err)
+	}
+	path := filepath.Join(home, ".ssh", "known_hosts")
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("no host key verification configured and %s is not usable: %v", path, err)
+	}
+	return callback, nil
+}
+
+// fixedHostKeys 校验主机密钥与配置的任意一个公钥或SHA256指纹一致
+func fixedHostKeys(hostKeys []string) (ssh.HostKeyCallback, error) {
+	fingerprints := make(map[string]bool)
+	for _, hostKey := range hostKeys {
+		hostKey = strings.TrimSpace(hostKey)
+		if strings.HasPrefix(hostKey, "SHA256:") {
+			fingerprints[hostKey] = true
+			continue
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			// 兼容只填写base64部分的公钥
+			data, decodeErr := base64.StdEncoding.DecodeString(hostKey)
+			if decodeErr != nil {
+				return nil, fmt.Errorf("invalid ssh host key: %v", err)
+			}
+			if key, err = ssh.ParsePublicKey(data); err != nil {
+				return nil, fmt.Errorf("invalid ssh host key: %v", err)
+			}
+		}
+		fingerprints[ssh.FingerprintSHA256(key)] = true
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if fingerprint := ssh.FingerprintSHA256(key); !fingerprints[fingerprint] {
+			return fmt.Errorf("ssh host key mismatch for %s: got %s", hostname, fingerprint)
+		}
+		return nil
+	}, nil
+}
+
+// expandHome 展开路径开头的~
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// DialContext 通过direct-tcpip通道连接到目标地址
+func (c *Client) DialContext(ctx context.Context, targetAddr string) (net.Conn, error) {
+	// 连接已断开但尚未被保活检测到时重新连接再试一次
+	for attempt := 0; ; attempt++ {
+		client, err := c.connection(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := client.DialContext(ctx, "tcp", targetAddr)
+		if err == nil {
+			return conn, nil
+		}
+		// 服务端拒绝打开通道时连接本身仍然可用
+		if _, rejected := err.(*ssh.OpenChannelError); rejected || attempt > 0 || ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to open ssh channel to %s: %v", targetAddr, err)
+		}
+		c.dropConnection(client)
+	}
+}
+
+// Close 关闭SSH连接
+func (c *Client) Close() error {
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
+
+// connection 返回可用的SSH连接，必要时重新连接
+func (c *Client) connection(ctx context.Context) (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	client, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	log.Printf("SSH连接已建立: server=%s, user=%s", c.config.Server, c.config.User)
+
+	go c.watch(client)
+	return client, nil
+}
+
+// dial 连接服务器并完成SSH握手和认证
+func (c *Client) dial(ctx context.Context) (*ssh.Client, error) {
+	auths, closeAgent, err := c.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+
+	dial := c.config.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", c.config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ssh server %s: %v", c.config.Server, err)
+	}
+
+	// ssh握手不支持context，通过连接超时和取消中断握手
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, c.config.Server, &ssh.ClientConfig{
+		User:            c.config.User,
+		Auth:            auths,
+		HostKeyCallback: c.hostKeyCallback,
+		Timeout:         c.config.Timeout,
+	})
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("ssh handshake with %s failed: %v", c.config.Server, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// authMethods 按私钥、ssh-agent、密码的顺序生成认证方式
+// 返回的函数用于在握手完成后关闭到ssh-agent的连接
+func (c *Client) authMethods() ([]ssh.AuthMethod, func(), error) {
+	var auths []ssh.AuthMethod
+	closeAgent := func() {}
+
+	signers := c.signers
+	if c.config.UseAgent {
+		sock := c.config.AgentSock
+		if sock == "" {
+			sock = os.Getenv("SSH_AUTH_SOCK")
+		}
+		if sock == "" {
+			return nil, closeAgent, fmt.Errorf("ssh agent requested but SSH_AUTH_SOCK is not set")
+		}
+		agentConn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, closeAgent, fmt.Errorf("failed to connect to ssh agent %s: %v", sock, err)
+		}
+		closeAgent = func() { agentConn.Close() }
+
+		agentSigners, err := agent.NewClient(agentConn).Signers()
+		if err != nil {
+			closeAgent()
+			return nil, func() {}, fmt.Errorf("failed to list ssh agent keys: %v", err)
+		}
+		signers = append(append([]ssh.Signer(nil), signers...), agentSigners...)
+	}
+	if len(signers) > 0 {
+		auths = append(auths, ssh.PublicKeys(signers...))
+	}
+	if c.config.Password != "" {
+		auths = append(auths, ssh.Password(c.config.Password))
+		// 部分服务器只开启keyboard-interactive，用密码回答所有问题
+		password := c.config.Password
+		auths = append(auths, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = password
+			}
+			return answers, nil
+		}))
+	}
+	return auths, closeAgent, nil
+}
+
+// watch 定期发送保活请求，失败或连接断开时丢弃连接
+func (c *Client) watch(client *ssh.Client) {
+	done := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(done)
+	}()
+
+	var tick <-chan time.Time
+	if c.config.KeepAlive > 0 {
+		ticker := time.NewTicker(c.config.KeepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			log.Printf("SSH连接已断开: server=%s", c.config.Server)
+			c.dropConnection(client)
+			return
+		case <-tick:
+			if err := c.keepAlive(client); err != nil {
+				log.Printf("SSH保活失败，将重新连接: server=%s, error=%v", c.config.Server, err)
+				c.dropConnection(client)
+				return
+			}
+		}
+	}
+}
+
+// keepAlive 发送一次保活请求，服务端回复失败也视为连接正常
+func (c *Client) keepAlive(client *ssh.Client) error {
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest(keepAliveRequest, true, nil)
+		result <- err
+	}()
+
+	timeout := c.config.Timeout
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("keepalive timeout after %v", timeout)
+	}
+}
+
+// dropConnection 关闭并丢弃连接，下次使用时重新建立
+func (c *Client) dropConnection(client *ssh.Client) {
+	c.mu.Lock()
+	if c.client == client {
+		c.client = nil
+	}
+	c.mu.Unlock()
+	client.Close()
+}
@@ -0,0 +1,339 @@
+package sshtunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// generateKey 生成ed25519密钥
+func generateKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// publicKey 返回私钥对应的SSH公钥
+func publicKey(t *testing.T, key ed25519.PrivateKey) ssh.PublicKey {
+	t.Helper()
+	pub, err := ssh.NewPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+// newTestClient 创建客户端，测试结束时关闭
+func newTestClient(t *testing.T, config ClientConfig) *Client {
+	t.Helper()
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// dialAndEcho 通过隧道连接目标并验证数据可以往返
+func dialAndEcho(client *Client, target string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := client.DialContext(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return testutil.CheckEcho(conn, []byte("through ssh"))
+}
+
+func TestPasswordAuth(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "alice", "secret")
+	hostKeys := []string{ssh.FingerprintSHA256(server.hostKey)}
+
+	client := newTestClient(t, ClientConfig{Server: server.addr(), User: "alice", Password: "secret", HostKeys: hostKeys})
+	for i := 0; i < 3; i++ {
+		if err := dialAndEcho(client, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 所有通道复用同一个SSH连接
+	if n := server.accepted.Load(); n != 1 {
+		t.Fatalf("server accepted %d connections, want 1", n)
+	}
+
+	client = newTestClient(t, ClientConfig{Server: server.addr(), User: "alice", Password: "wrong", HostKeys: hostKeys})
+	if err := dialAndEcho(client, target); err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Fatalf("dial with wrong password: %v", err)
+	}
+}
+
+func TestPrivateKeyWithPassphrase(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	key := generateKey(t)
+	server := newTestServer(t, "bob", "", publicKey(t, key))
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(block))
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, []byte(keyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 私钥可以是PEM内容也可以是文件路径
+	for _, privateKey := range []string{keyPEM, keyFile} {
+		client := newTestClient(t, ClientConfig{
+			Server:              server.addr(),
+			User:                "bob",
+			PrivateKey:          privateKey,
+			Passphrase:          "passphrase",
+			InsecureSkipHostKey: true,
+		})
+		if err := dialAndEcho(client, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = NewClient(ClientConfig{Server: server.addr(), User: "bob", PrivateKey: keyPEM, Passphrase: "wrong", InsecureSkipHostKey: true})
+	if err == nil || !strings.Contains(err.Error(), "failed to parse private key") {
+		t.Fatalf("wrong passphrase: %v", err)
+	}
+	_, err = NewClient(ClientConfig{Server: server.addr(), User: "bob", PrivateKey: keyPEM, InsecureSkipHostKey: true})
+	if err == nil {
+		t.Fatal("expected error for encrypted key without passphrase")
+	}
+
+	// 未授权的密钥被拒绝
+	other, err := ssh.MarshalPrivateKey(generateKey(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, ClientConfig{
+		Server:              server.addr(),
+		User:                "bob",
+		PrivateKey:          string(pem.EncodeToMemory(other)),
+		InsecureSkipHostKey: true,
+	})
+	if err := dialAndEcho(client, target); err == nil {
+		t.Fatal("expected unauthorized key to be rejected")
+	}
+}
+
+func TestAgentAuth(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	key := generateKey(t)
+	server := newTestServer(t, "carol", "", publicKey(t, key))
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	client := newTestClient(t, ClientConfig{
+		Server:              server.addr(),
+		User:                "carol",
+		UseAgent:            true,
+		AgentSock:           sock,
+		InsecureSkipHostKey: true,
+	})
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未设置套接字时读取SSH_AUTH_SOCK
+	t.Setenv("SSH_AUTH_SOCK", sock)
+	client = newTestClient(t, ClientConfig{Server: server.addr(), User: "carol", UseAgent: true, InsecureSkipHostKey: true})
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	client = newTestClient(t, ClientConfig{Server: server.addr(), User: "carol", UseAgent: true, InsecureSkipHostKey: true})
+	if err := dialAndEcho(client, target); err == nil || !strings.Contains(err.Error(), "SSH_AUTH_SOCK") {
+		t.Fatalf("dial without agent socket: %v", err)
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "alice", "secret")
+	dir := t.TempDir()
+
+	writeKnownHosts := func(name string, key ssh.PublicKey) string {
+		path := filepath.Join(dir, name)
+		line := knownhosts.Line([]string{knownhosts.Normalize(server.addr())}, key) + "\n"
+		if err := os.WriteFile(path, []byte(line), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	client := newTestClient(t, ClientConfig{
+		Server:     server.addr(),
+		User:       "alice",
+		Password:   "secret",
+		KnownHosts: writeKnownHosts("known_hosts", server.hostKey),
+	})
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+
+	// known_hosts中记录的主机密钥与服务端不一致
+	client = newTestClient(t, ClientConfig{
+		Server:     server.addr(),
+		User:       "alice",
+		Password:   "secret",
+		KnownHosts: writeKnownHosts("known_hosts_mismatch", publicKey(t, generateKey(t))),
+	})
+	if err := dialAndEcho(client, target); err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Fatalf("dial with mismatched known_hosts: %v", err)
+	}
+
+	// 固定的主机密钥指纹不一致
+	client = newTestClient(t, ClientConfig{
+		Server:   server.addr(),
+		User:     "alice",
+		Password: "secret",
+		HostKeys: []string{ssh.FingerprintSHA256(publicKey(t, generateKey(t)))},
+	})
+	if err := dialAndEcho(client, target); err == nil || !strings.Contains(err.Error(), "host key mismatch") {
+		t.Fatalf("dial with mismatched host key: %v", err)
+	}
+
+	// 配置为authorized_keys格式公钥时同样校验
+	client = newTestClient(t, ClientConfig{
+		Server:   server.addr(),
+		User:     "alice",
+		Password: "secret",
+		HostKeys: []string{string(ssh.MarshalAuthorizedKey(server.hostKey))},
+	})
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconnectAfterServerDrop(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "alice", "secret")
+	client := newTestClient(t, ClientConfig{Server: server.addr(), User: "alice", Password: "secret", InsecureSkipHostKey: true})
+
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+	server.dropConnections()
+
+	// 断开后下一次连接重新建立SSH连接
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatalf("dial after server dropped connection: %v", err)
+	}
+	if n := server.accepted.Load(); n != 2 {
+		t.Fatalf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestKeepAliveReconnect(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "alice", "secret")
+	client := newTestClient(t, ClientConfig{
+		Server:              server.addr(),
+		User:                "alice",
+		Password:            "secret",
+		InsecureSkipHostKey: true,
+		KeepAlive:           50 * time.Millisecond,
+		Timeout:             300 * time.Millisecond,
+	})
+
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for server.keepAlives.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("client did not send keepalive requests")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 服务端不再回复保活请求，连接看起来仍然打开，但客户端应在保活超时后丢弃它
+	server.ignoreRequests.Store(true)
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		client.mu.Lock()
+		dropped := client.client == nil
+		client.mu.Unlock()
+		if dropped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client did not drop unresponsive connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.ignoreRequests.Store(false)
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatalf("dial after keepalive failure: %v", err)
+	}
+	if n := server.accepted.Load(); n != 2 {
+		t.Fatalf("server accepted %d connections, want 2", n)
+	}
+}
+
+func TestChannelRejectedKeepsConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := listener.Addr().String()
+	listener.Close()
+
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, "alice", "secret")
+	client := newTestClient(t, ClientConfig{Server: server.addr(), User: "alice", Password: "secret", InsecureSkipHostKey: true})
+
+	if err := dialAndEcho(client, closedAddr); err == nil || !strings.Contains(err.Error(), "failed to open ssh channel") {
+		t.Fatalf("dial closed port: %v", err)
+	}
+	if err := dialAndEcho(client, target); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.accepted.Load(); n != 1 {
+		t.Fatalf("server accepted %d connections, want 1", n)
+	}
+}
@@ -0,0 +1,193 @@
+package sshtunnel
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer 最小化的SSH服务端，用于验证客户端实现
+// 支持密码和公钥认证、direct-tcpip端口转发以及保活请求，使用随机生成的主机密钥
+type testServer struct {
+	config   *ssh.ServerConfig
+	hostKey  ssh.PublicKey
+	listener net.Listener
+
+	accepted   atomic.Int32 // 完成握手的连接数量
+	keepAlives atomic.Int32 // 收到的保活请求数量
+	// ignoreRequests 为真时不回复全局请求，模拟连接失去响应
+	ignoreRequests atomic.Bool
+
+	mu    sync.Mutex
+	conns map[*ssh.ServerConn]struct{}
+}
+
+// newTestServer 在本机随机端口上启动SSH服务端，password为空时不允许密码认证，authorizedKeys为允许的公钥
+func newTestServer(t *testing.T, user, password string, authorizedKeys ...ssh.PublicKey) *testServer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == user {
+				for _, allowed := range authorizedKeys {
+					if bytes.Equal(key.Marshal(), allowed.Marshal()) {
+						return nil, nil
+					}
+				}
+			}
+			return nil, fmt.Errorf("public key rejected for %s", conn.User())
+		},
+	}
+	if password != "" {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %s", conn.User())
+		}
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		config:   config,
+		hostKey:  signer.PublicKey(),
+		listener: listener,
+		conns:    make(map[*ssh.ServerConn]struct{}),
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(conn)
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// dropConnections 断开所有已建立的SSH连接，用于验证客户端重连
+func (s *testServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// handleConn 完成握手后处理通道和全局请求
+func (s *testServer) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	s.accepted.Add(1)
+
+	s.mu.Lock()
+	s.conns[sshConn] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, sshConn)
+		s.mu.Unlock()
+	}()
+
+	go s.handleRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-tcpip" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		go s.handleDirectTCPIP(newChannel)
+	}
+}
+
+// handleRequests 处理全局请求，保活等请求统一回复失败，与OpenSSH行为一致
+func (s *testServer) handleRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		if req.Type == keepAliveRequest {
+			s.keepAlives.Add(1)
+		}
+		if req.WantReply && !s.ignoreRequests.Load() {
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// handleDirectTCPIP 连接目标并转发通道数据
+func (s *testServer) handleDirectTCPIP(newChannel ssh.NewChannel) {
+	// RFC 4254 7.2: 目标地址、目标端口、来源地址、来源端口
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid payload")
+		return
+	}
+
+	target := net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port)))
+	remote, err := net.DialTimeout("tcp", target, defaultDialTimeout)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer remote.Close()
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(reqs)
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(remote, channel)
+		if tcpConn, ok := remote.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(channel, remote)
+	channel.CloseWrite()
+	<-done
+}
@@ -0,0 +1,200 @@
+package tlsclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// 各协议共用的TLS客户端配置
+// 支持标准TLS、证书指纹固定、uTLS浏览器指纹以及REALITY，TCP类协议通过Client完成握手，
+// QUIC类协议只能使用StdConfig返回的标准配置
+
+// Config TLS客户端配置
+type Config struct {
+	ServerName         string   // SNI，为空时由调用方填入服务器主机名
+	NextProtos         []string // ALPN，为空时使用调用方或指纹的默认值
+	InsecureSkipVerify bool     // 跳过证书校验
+	RootCAs            *x509.CertPool
+
+	// PinnedSHA256 证书SHA-256指纹，不为空时证书链中任意一张证书匹配即通过，不再校验证书链
+	PinnedSHA256 [][sha256.Size]byte
+
+	// Fingerprint uTLS浏览器指纹名称，如chrome/firefox/safari，为空时使用Go标准库的ClientHello
+	Fingerprint string
+
+	// Reality 不为空时使用REALITY握手
+	Reality *RealityConfig
+}
+
+// fingerprints 支持的uTLS指纹
+var fingerprints = map[string]utls.ClientHelloID{
+	"chrome":     utls.HelloChrome_Auto,
+	"firefox":    utls.HelloFirefox_Auto,
+	"safari":     utls.HelloSafari_Auto,
+	"ios":        utls.HelloIOS_Auto,
+	"android":    utls.HelloAndroid_11_OkHttp,
+	"edge":       utls.HelloEdge_Auto,
+	"360":        utls.Hello360_Auto,
+	"qq":         utls.HelloQQ_Auto,
+	"random":     utls.HelloRandomized,
+	"randomized": utls.HelloRandomized,
+}
+
+// IsFingerprint 判断名称是否为支持的uTLS指纹
+func IsFingerprint(name string) bool {
+	_, ok := fingerprints[strings.ToLower(name)]
+	return ok
+}
+
+// ParsePin 解析证书SHA-256指纹，支持带冒号或不带冒号的十六进制形式
+func ParsePin(s string) ([sha256.Size]byte, error) {
+	var pin [sha256.Size]byte
+	data, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if err != nil || len(data) != sha256.Size {
+		return pin, fmt.Errorf("invalid certificate sha256 fingerprint: %s", s)
+	}
+	copy(pin[:], data)
+	return pin, nil
+}
+
+// Clone 复制配置
+func (c *Config) Clone() *Config {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.NextProtos = append([]string(nil), c.NextProtos...)
+	clone.PinnedSHA256 = append([][sha256.Size]byte(nil), c.PinnedSHA256...)
+	if c.Reality != nil {
+		reality := *c.Reality
+		clone.Reality = &reality
+	}
+	return &clone
+}
+
+// Validate 检查配置是否可用
+func (c *Config) Validate() error {
+	if c.Fingerprint != "" && !IsFingerprint(c.Fingerprint) {
+		return fmt.Errorf("unsupported tls fingerprint: %s", c.Fingerprint)
+	}
+	if c.Reality != nil {
+		return c.Reality.validate()
+	}
+	return nil
+}
+
+// StdConfig 返回等价的标准库配置，不包含uTLS指纹和REALITY
+func (c *Config) StdConfig() *tls.Config {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		NextProtos:         append([]string(nil), c.NextProtos...),
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		RootCAs:            c.RootCAs,
+	}
+	if len(c.PinnedSHA256) > 0 {
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = c.verifyPins
+	}
+	return tlsConfig
+}
+
+// Client 在conn上完成TLS握手，配置中没有ALPN时使用nextProtos
+// 握手失败时关闭conn
+func (c *Config) Client(ctx context.Context, conn net.Conn, nextProtos ...string) (net.Conn, error) {
+	if len(c.NextProtos) > 0 {
+		nextProtos = c.NextProtos
+	}
+
+	var tlsConn net.Conn
+	var err error
+	switch {
+	case c.Reality != nil:
+		tlsConn, err = c.realityClient(ctx, conn, nextProtos)
+	case c.Fingerprint != "":
+		tlsConn, err = c.uClient(ctx, conn, nextProtos)
+	default:
+		tlsConfig := c.StdConfig()
+		tlsConfig.NextProtos = nextProtos
+		client := tls.Client(conn, tlsConfig)
+		tlsConn, err = client, client.HandshakeContext(ctx)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// uClient 使用uTLS指纹握手
+func (c *Config) uClient(ctx context.Context, conn net.Conn, nextProtos []string) (net.Conn, error) {
+	helloID, ok := fingerprints[strings.ToLower(c.Fingerprint)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls fingerprint: %s", c.Fingerprint)
+	}
+	uConfig := &utls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		RootCAs:            c.RootCAs,
+	}
+	if len(c.PinnedSHA256) > 0 {
+		uConfig.InsecureSkipVerify = true
+		uConfig.VerifyPeerCertificate = c.verifyPins
+	}
+
+	uConn := utls.UClient(conn, uConfig, helloID)
+	if err := buildHandshakeState(uConn, nextProtos); err != nil {
+		return nil, err
+	}
+	if err := uConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return uConn, nil
+}
+
+// buildHandshakeState 生成指纹对应的ClientHello
+// 指纹自带的ALPN会覆盖配置，需要指定ALPN时（如WebSocket只能使用http/1.1）替换ALPN扩展后重新生成
+func buildHandshakeState(uConn *utls.UConn, nextProtos []string) error {
+	if err := uConn.BuildHandshakeState(); err != nil {
+		return fmt.Errorf("failed to build tls client hello: %v", err)
+	}
+	if len(nextProtos) == 0 {
+		return nil
+	}
+
+	found := false
+	for _, ext := range uConn.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = nextProtos
+			found = true
+			break
+		}
+	}
+	if !found {
+		uConn.Extensions = append(uConn.Extensions, &utls.ALPNExtension{AlpnProtocols: nextProtos})
+	}
+	if err := uConn.BuildHandshakeState(); err != nil {
+		return fmt.Errorf("failed to build tls client hello: %v", err)
+	}
+	return nil
+}
+
+// verifyPins 证书链中任意一张证书的SHA-256与配置的指纹一致时通过
+func (c *Config) verifyPins(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	for _, raw := range rawCerts {
+		sum := sha256.Sum256(raw)
+		for _, pin := range c.PinnedSHA256 {
+			if sum == pin {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("server certificate does not match pinned sha256 fingerprint")
+}
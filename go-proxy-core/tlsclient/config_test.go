@@ -0,0 +1,226 @@
+package tlsclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	utls "github.com/refraction-networking/utls"
+)
+
+// tlsServer 标准TLS回显服务端，记录最近一次收到的ClientHello
+type tlsServer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	hello *tls.ClientHelloInfo
+}
+
+// newTLSServer 在本机随机端口上启动标准TLS服务端
+func newTLSServer(t *testing.T, cert tls.Certificate) *tlsServer {
+	t.Helper()
+	s := &tlsServer{}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.Lock()
+			s.hello = info
+			s.mu.Unlock()
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s.listener = listener
+	go testutil.ServeEcho(listener)
+	return s
+}
+
+// lastHello 返回最近一次收到的ClientHello
+func (s *tlsServer) lastHello(t *testing.T) *tls.ClientHelloInfo {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hello == nil {
+		t.Fatal("server received no client hello")
+	}
+	return s.hello
+}
+
+// handshake 连接服务端并使用配置完成TLS握手
+func handshake(t *testing.T, addr string, config *Config, nextProtos ...string) (net.Conn, error) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return config.Client(ctx, conn, nextProtos...)
+}
+
+// isGREASE 判断是否为GREASE占位值
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// withoutGREASE 去掉GREASE占位值，GREASE每次握手随机生成
+func withoutGREASE(values []uint16) []uint16 {
+	var result []uint16
+	for _, v := range values {
+		if !isGREASE(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// fingerprintCipherSuites 返回uTLS指纹ClientHello中的密码套件
+func fingerprintCipherSuites(t *testing.T, helloID utls.ClientHelloID) []uint16 {
+	t.Helper()
+	uConn := utls.UClient(nil, &utls.Config{ServerName: "127.0.0.1"}, helloID)
+	if err := uConn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+	return withoutGREASE(uConn.HandshakeState.Hello.CipherSuites)
+}
+
+func TestPinnedSHA256(t *testing.T) {
+	cert, _ := testutil.Certificate(t)
+	server := newTLSServer(t, cert)
+	pin := sha256.Sum256(cert.Certificate[0])
+	wrong := pin
+	wrong[0] ^= 0xff
+
+	for _, fingerprint := range []string{"", "chrome"} {
+		// 固定指纹时不校验证书链，自签名证书也可以通过
+		config := &Config{Fingerprint: fingerprint, PinnedSHA256: [][sha256.Size]byte{wrong, pin}}
+		conn, err := handshake(t, server.listener.Addr().String(), config)
+		if err != nil {
+			t.Fatalf("fingerprint=%q: matching pin rejected: %v", fingerprint, err)
+		}
+		testutil.Echo(t, conn, []byte("pinned"))
+		conn.Close()
+
+		config = &Config{Fingerprint: fingerprint, PinnedSHA256: [][sha256.Size]byte{wrong}}
+		if _, err := handshake(t, server.listener.Addr().String(), config); err == nil || !strings.Contains(err.Error(), "pinned sha256") {
+			t.Fatalf("fingerprint=%q: mismatched pin error = %v", fingerprint, err)
+		}
+	}
+
+	// QUIC类协议使用的标准库配置同样校验指纹
+	std := (&Config{PinnedSHA256: [][sha256.Size]byte{wrong}}).StdConfig()
+	if !std.InsecureSkipVerify || std.VerifyPeerCertificate == nil {
+		t.Fatal("std config does not verify pins")
+	}
+	if err := std.VerifyPeerCertificate(cert.Certificate, nil); err == nil {
+		t.Fatal("std config accepted mismatched pin")
+	}
+}
+
+func TestParsePin(t *testing.T) {
+	cert, _ := testutil.Certificate(t)
+	sum := sha256.Sum256(cert.Certificate[0])
+
+	hexPin := strings.ToUpper(net.HardwareAddr(sum[:]).String())
+	for _, s := range []string{hexPin, strings.ReplaceAll(hexPin, ":", "")} {
+		pin, err := ParsePin(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pin != sum {
+			t.Fatalf("ParsePin(%s) = %x", s, pin)
+		}
+	}
+	for _, s := range []string{"", "zz", hexPin[:20]} {
+		if _, err := ParsePin(s); err == nil {
+			t.Fatalf("ParsePin(%q): expected error", s)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	cert, roots := testutil.Certificate(t)
+	server := newTLSServer(t, cert)
+	chrome := fingerprintCipherSuites(t, utls.HelloChrome_Auto)
+
+	for _, tc := range []struct {
+		fingerprint string
+		helloID     *utls.ClientHelloID
+	}{
+		{"", nil},
+		{"chrome", &utls.HelloChrome_Auto},
+		{"Firefox", &utls.HelloFirefox_Auto},
+		{"safari", &utls.HelloSafari_Auto},
+	} {
+		config := &Config{ServerName: "127.0.0.1", RootCAs: roots, Fingerprint: tc.fingerprint}
+		// 指纹自带的ALPN被调用方指定的ALPN替换
+		conn, err := handshake(t, server.listener.Addr().String(), config, "http/1.1")
+		if err != nil {
+			t.Fatalf("fingerprint=%q: %v", tc.fingerprint, err)
+		}
+		testutil.Echo(t, conn, []byte("fingerprint"))
+		conn.Close()
+
+		hello := server.lastHello(t)
+		if !reflect.DeepEqual(hello.SupportedProtos, []string{"http/1.1"}) {
+			t.Fatalf("fingerprint=%q: alpn = %v", tc.fingerprint, hello.SupportedProtos)
+		}
+		suites := withoutGREASE(hello.CipherSuites)
+		if tc.helloID == nil {
+			// 未配置指纹时使用标准库的ClientHello
+			if reflect.DeepEqual(suites, chrome) || len(suites) != len(hello.CipherSuites) {
+				t.Fatalf("standard client hello looks like a browser fingerprint: %x", hello.CipherSuites)
+			}
+			continue
+		}
+		if want := fingerprintCipherSuites(t, *tc.helloID); !reflect.DeepEqual(suites, want) {
+			t.Fatalf("fingerprint=%q: cipher suites = %x, want %x", tc.fingerprint, suites, want)
+		}
+	}
+
+	// 配置中的ALPN优先于调用方
+	config := &Config{ServerName: "127.0.0.1", RootCAs: roots, Fingerprint: "chrome", NextProtos: []string{"h2"}}
+	conn, err := handshake(t, server.listener.Addr().String(), config, "http/1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if protos := server.lastHello(t).SupportedProtos; !reflect.DeepEqual(protos, []string{"h2"}) {
+		t.Fatalf("alpn = %v, want [h2]", protos)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if !IsFingerprint("Chrome") || IsFingerprint("netscape") {
+		t.Fatal("IsFingerprint mismatch")
+	}
+	for _, config := range []*Config{
+		{Fingerprint: "netscape"},
+		{Reality: &RealityConfig{PublicKey: []byte("short")}},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Fatalf("Validate(%+v): expected error", config)
+		}
+	}
+
+	cert, roots := testutil.Certificate(t)
+	server := newTLSServer(t, cert)
+	if _, err := handshake(t, server.listener.Addr().String(), &Config{ServerName: "127.0.0.1", RootCAs: roots, Fingerprint: "netscape"}); err == nil {
+		t.Fatal("expected error for unsupported fingerprint")
+	}
+	// 没有根证书时校验失败
+	if _, err := handshake(t, server.listener.Addr().String(), &Config{ServerName: "127.0.0.1"}); err == nil {
+		t.Fatal("expected certificate verification error")
+	}
+}
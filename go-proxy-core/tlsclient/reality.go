@@ -0,0 +1,202 @@
+package tlsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/crypto/hkdf"
+)
+
+// REALITY客户端，与Xray-core的REALITY兼容
+// 客户端使用浏览器指纹的ClientHello，在session_id中放入用认证密钥加密的版本、时间和short id；
+// 认证密钥由ClientHello中的X25519临时公钥与服务端静态公钥协商得到。
+// 服务端认证通过后返回临时证书，证书签名字段为HMAC-SHA512(认证密钥, 证书公钥)，客户端据此确认服务端身份
+
+const (
+	// realitySessionIDOffset ClientHello握手消息中session_id的偏移: 消息头4 + 版本2 + 随机数32 + 长度1
+	realitySessionIDOffset = 39
+	// realitySessionIDLen session_id长度
+	realitySessionIDLen = 32
+	// realityInfo 派生认证密钥使用的HKDF info
+	realityInfo = "REALITY"
+)
+
+// realityVersion 写入session_id的客户端版本，服务端可以据此限制客户端版本
+var realityVersion = [3]byte{1, 8, 1}
+
+// RealityConfig REALITY客户端配置
+type RealityConfig struct {
+	PublicKey []byte  // 服务端X25519公钥
+	ShortID   [8]byte // 服务端允许的short id，不足8字节时右侧补0
+}
+
+// ParseRealityPublicKey 解析base64url编码的X25519公钥
+func ParseRealityPublicKey(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	key, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		key, err = base64.RawStdEncoding.DecodeString(s)
+	}
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid reality public key: %s", s)
+	}
+	return key, nil
+}
+
+// ParseShortID 解析十六进制的short id，最长16个字符
+func ParseShortID(s string) ([8]byte, error) {
+	var shortID [8]byte
+	s = strings.TrimSpace(s)
+	if len(s) > 16 {
+		return shortID, fmt.Errorf("invalid reality short id: %s", s)
+	}
+	if len(s)%2 == 1 {
+		s += "0"
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return shortID, fmt.Errorf("invalid reality short id: %s", s)
+	}
+	copy(shortID[:], data)
+	return shortID, nil
+}
+
+// validate 检查公钥
+func (r *RealityConfig) validate() error {
+	if _, err := ecdh.X25519().NewPublicKey(r.PublicKey); err != nil {
+		return fmt.Errorf("invalid reality public key: %v", err)
+	}
+	return nil
+}
+
+// realityClient 完成REALITY握手，未配置指纹时使用chrome
+func (c *Config) realityClient(ctx context.Context, conn net.Conn, nextProtos []string) (net.Conn, error) {
+	fingerprint := strings.ToLower(c.Fingerprint)
+	if fingerprint == "" {
+		fingerprint = "chrome"
+	}
+	helloID, ok := fingerprints[fingerprint]
+	if !ok {
+		return nil, fmt.Errorf("unsupported tls fingerprint: %s", c.Fingerprint)
+	}
+	serverKey, err := ecdh.X25519().NewPublicKey(c.Reality.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reality public key: %v", err)
+	}
+
+	verifier := &realityVerifier{}
+	uConfig := &utls.Config{
+		ServerName: c.ServerName,
+		// 证书由realityVerifier校验
+		InsecureSkipVerify:     true,
+		SessionTicketsDisabled: true,
+		VerifyPeerCertificate:  verifier.verify,
+	}
+	uConn := utls.UClient(conn, uConfig, helloID)
+	if err := buildHandshakeState(uConn, nextProtos); err != nil {
+		return nil, err
+	}
+
+	hello := uConn.HandshakeState.Hello
+	ecdheKey := uConn.HandshakeState.State13.EcdheKey
+	if ecdheKey == nil || ecdheKey.Curve() != ecdh.X25519() {
+		return nil, fmt.Errorf("tls fingerprint %s does not offer an x25519 key share", fingerprint)
+	}
+	if len(hello.Raw) < realitySessionIDOffset+realitySessionIDLen || hello.Raw[realitySessionIDOffset-1] != realitySessionIDLen {
+		return nil, fmt.Errorf("tls fingerprint %s does not use a 32-byte session id", fingerprint)
+	}
+
+	// session_id明文: [版本3][保留1][时间4][short id 8]，加密时session_id位置填0作为附加数据
+	sessionID := make([]byte, realitySessionIDLen)
+	copy(sessionID, realityVersion[:])
+	binary.BigEndian.PutUint32(sessionID[4:], uint32(time.Now().Unix()))
+	copy(sessionID[8:], c.Reality.ShortID[:])
+	copy(hello.Raw[realitySessionIDOffset:], make([]byte, realitySessionIDLen))
+
+	authKey, err := realityAuthKey(ecdheKey, serverKey, hello.Random)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newRealityAEAD(authKey)
+	if err != nil {
+		return nil, err
+	}
+	aead.Seal(sessionID[:0], hello.Random[20:], sessionID[:16], hello.Raw)
+	copy(hello.Raw[realitySessionIDOffset:], sessionID)
+	hello.SessionId = sessionID
+	verifier.authKey = authKey
+
+	if err := uConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("reality handshake failed: %v", err)
+	}
+	return uConn, nil
+}
+
+// realityAuthKey 由ECDH共享密钥和ClientHello随机数前20字节派生认证密钥
+func realityAuthKey(private *ecdh.PrivateKey, public *ecdh.PublicKey, random []byte) ([]byte, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, fmt.Errorf("reality key exchange failed: %v", err)
+	}
+	authKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, random[:20], []byte(realityInfo)), authKey); err != nil {
+		return nil, err
+	}
+	return authKey, nil
+}
+
+// newRealityAEAD 创建加密session_id使用的AES-GCM
+func newRealityAEAD(authKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(authKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// realityCertSignature 计算REALITY临时证书的签名字段
+func realityCertSignature(authKey []byte, publicKey ed25519.PublicKey) []byte {
+	mac := hmac.New(sha512.New, authKey)
+	mac.Write(publicKey)
+	return mac.Sum(nil)
+}
+
+// realityVerifier 校验服务端返回的REALITY临时证书
+type realityVerifier struct {
+	authKey []byte
+}
+
+// verify 证书公钥为ed25519且签名字段与认证密钥计算的HMAC一致时通过
+// 否则说明对端不是REALITY服务端（或认证失败被转发到了目标网站），拒绝连接
+func (v *realityVerifier) verify(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("reality server sent no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("invalid reality server certificate: %v", err)
+	}
+	if publicKey, ok := cert.PublicKey.(ed25519.PublicKey); ok {
+		if bytes.Equal(realityCertSignature(v.authKey, publicKey), cert.Signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("reality authentication failed: server certificate is not a reality certificate")
+}
@@ -0,0 +1,140 @@
+package tlsclient
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// waitCount 等待计数器达到期望值，服务端在独立的goroutine中处理连接
+func waitCount(t *testing.T, load func() int32, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for load() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("count = %d, want %d", load(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRealityHandshake(t *testing.T) {
+	allowed, err := ParseShortID("0123abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, allowed)
+
+	// 未配置指纹时使用chrome
+	for i, fingerprint := range []string{"", "firefox"} {
+		config := &Config{
+			ServerName:  "www.example.com",
+			Fingerprint: fingerprint,
+			Reality:     &RealityConfig{PublicKey: server.publicKey(), ShortID: allowed},
+		}
+		conn, err := handshake(t, server.addr(), config)
+		if err != nil {
+			t.Fatalf("fingerprint=%q: %v", fingerprint, err)
+		}
+		testutil.Echo(t, conn, []byte("through reality"))
+		conn.Close()
+		waitCount(t, server.accepted.Load, int32(i+1))
+	}
+}
+
+func TestRealityRejectedShortID(t *testing.T) {
+	allowed, _ := ParseShortID("0123abcd")
+	rejected, _ := ParseShortID("ffff")
+	server := newTestServer(t, allowed)
+
+	config := &Config{
+		ServerName: "www.example.com",
+		Reality:    &RealityConfig{PublicKey: server.publicKey(), ShortID: rejected},
+	}
+	if _, err := handshake(t, server.addr(), config); err == nil {
+		t.Fatal("expected handshake error for rejected short id")
+	}
+	waitCount(t, server.rejected.Load, 1)
+
+	// 公钥不匹配时服务端无法解密session_id
+	otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Reality = &RealityConfig{PublicKey: otherKey.PublicKey().Bytes(), ShortID: allowed}
+	if _, err := handshake(t, server.addr(), config); err == nil {
+		t.Fatal("expected handshake error for wrong public key")
+	}
+	waitCount(t, server.rejected.Load, 2)
+	if n := server.accepted.Load(); n != 0 {
+		t.Fatalf("accepted %d connections", n)
+	}
+}
+
+func TestRealityRejectsPlainTLSServer(t *testing.T) {
+	// 普通TLS服务端的证书没有REALITY签名，客户端拒绝连接
+	cert, _ := testutil.Certificate(t)
+	server := newTLSServer(t, cert)
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{
+		ServerName: "www.example.com",
+		Reality:    &RealityConfig{PublicKey: key.PublicKey().Bytes()},
+	}
+	if _, err := handshake(t, server.listener.Addr().String(), config); err == nil || !strings.Contains(err.Error(), "reality authentication failed") {
+		t.Fatalf("handshake error = %v, want reality authentication failure", err)
+	}
+}
+
+func TestParseReality(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.PublicKey().Bytes()
+	for _, s := range []string{
+		base64.RawURLEncoding.EncodeToString(public),
+		base64.StdEncoding.EncodeToString(public),
+	} {
+		got, err := ParseRealityPublicKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, public) {
+			t.Fatalf("ParseRealityPublicKey(%s) mismatch", s)
+		}
+	}
+	if _, err := ParseRealityPublicKey("c2hvcnQ"); err == nil {
+		t.Fatal("expected error for short public key")
+	}
+
+	for _, tc := range []struct {
+		in   string
+		want [8]byte
+	}{
+		{"", [8]byte{}},
+		{"abc", [8]byte{0xab, 0xc0}},
+		{"0123456789abcdef", [8]byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}},
+	} {
+		got, err := ParseShortID(tc.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseShortID(%q) = %x, want %x", tc.in, got, tc.want)
+		}
+	}
+	for _, s := range []string{"0123456789abcdef00", "xyz"} {
+		if _, err := ParseShortID(s); err == nil {
+			t.Fatalf("ParseShortID(%q): expected error", s)
+		}
+	}
+}
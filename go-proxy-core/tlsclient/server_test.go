@@ -0,0 +1,268 @@
+package tlsclient
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	// realityHandshakeTimeout 服务端读取ClientHello并完成握手的超时时间
+	realityHandshakeTimeout = 10 * time.Second
+	// realityMaxTimeDiff 允许的客户端时间偏差
+	realityMaxTimeDiff = 2 * time.Minute
+	// extensionKeyShare key_share扩展类型
+	extensionKeyShare = 51
+	// groupX25519 X25519的命名组
+	groupX25519 = 0x001d
+)
+
+// testServer 最小化的REALITY服务端，用于验证客户端实现
+// 只接受认证通过的连接并回显数据，认证失败时直接关闭连接，不转发到目标网站
+type testServer struct {
+	listener   net.Listener
+	privateKey *ecdh.PrivateKey
+	shortIDs   [][8]byte
+
+	accepted atomic.Int32
+	rejected atomic.Int32
+}
+
+// newTestServer 在本机随机端口上启动服务端，shortIDs为允许的short id
+func newTestServer(t *testing.T, shortIDs ...[8]byte) *testServer {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := &testServer{listener: listener, privateKey: key, shortIDs: shortIDs}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tlsConn, err := s.handshake(conn)
+				if err != nil {
+					s.rejected.Add(1)
+					return
+				}
+				s.accepted.Add(1)
+				io.Copy(tlsConn, tlsConn)
+			}()
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// publicKey 返回客户端配置使用的服务端公钥
+func (s *testServer) publicKey() []byte {
+	return s.privateKey.PublicKey().Bytes()
+}
+
+// handshake 读取ClientHello完成认证，再用携带HMAC签名的临时证书完成TLS握手
+func (s *testServer) handshake(conn net.Conn) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(realityHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	record, hello, err := readClientHello(conn)
+	if err != nil {
+		return nil, err
+	}
+	random, sessionID, keyShare, err := parseClientHello(hello)
+	if err != nil {
+		return nil, err
+	}
+	peerKey, err := ecdh.X25519().NewPublicKey(keyShare)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x25519 key share: %v", err)
+	}
+	authKey, err := realityAuthKey(s.privateKey, peerKey, random)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newRealityAEAD(authKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aad := append([]byte(nil), hello...)
+	copy(aad[realitySessionIDOffset:], make([]byte, realitySessionIDLen))
+	plain, err := aead.Open(nil, random[20:], sessionID, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session id")
+	}
+	clientTime := time.Unix(int64(binary.BigEndian.Uint32(plain[4:8])), 0)
+	if diff := time.Since(clientTime); diff > realityMaxTimeDiff || diff < -realityMaxTimeDiff {
+		return nil, fmt.Errorf("client time out of range: %s", clientTime)
+	}
+	var shortID [8]byte
+	copy(shortID[:], plain[8:16])
+	if !s.allowShortID(shortID) {
+		return nil, fmt.Errorf("unknown short id %x", shortID)
+	}
+
+	cert, err := realityCertificate(authKey)
+	if err != nil {
+		return nil, err
+	}
+	replay := &replayConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(record), conn)}
+	tlsConn := tls.Server(replay, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+		// Xray的REALITY服务端修改了TLS库，总是用临时证书的ed25519密钥签名，而浏览器指纹通常不声明ed25519；
+		// 标准库按客户端声明的签名算法选择证书，这里将第一个签名算法替换为ed25519。
+		// ClientHelloInfo与握手状态共享该切片，握手摘要使用原始消息，不受影响
+		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			if len(info.SignatureSchemes) > 0 {
+				info.SignatureSchemes[0] = tls.Ed25519
+			}
+			return nil, nil
+		},
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// allowShortID 检查short id
+func (s *testServer) allowShortID(shortID [8]byte) bool {
+	for _, id := range s.shortIDs {
+		if id == shortID {
+			return true
+		}
+	}
+	return false
+}
+
+// readClientHello 读取第一个TLS记录，返回完整记录和其中的ClientHello握手消息
+func readClientHello(conn net.Conn) ([]byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, nil, err
+	}
+	if header[0] != 0x16 {
+		return nil, nil, fmt.Errorf("not a tls handshake record")
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, nil, err
+	}
+	if len(payload) < 4 || payload[0] != 0x01 {
+		return nil, nil, fmt.Errorf("not a client hello")
+	}
+	length := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3])
+	if 4+length > len(payload) {
+		return nil, nil, fmt.Errorf("fragmented client hello is not supported")
+	}
+	return append(header, payload...), payload[:4+length], nil
+}
+
+// parseClientHello 解析随机数、session_id和X25519 key_share
+func parseClientHello(hello []byte) (random, sessionID, keyShare []byte, err error) {
+	invalid := fmt.Errorf("invalid client hello")
+	if len(hello) < realitySessionIDOffset+realitySessionIDLen || hello[realitySessionIDOffset-1] != realitySessionIDLen {
+		return nil, nil, nil, fmt.Errorf("client hello has no 32-byte session id")
+	}
+	random = hello[6:38]
+	sessionID = hello[realitySessionIDOffset : realitySessionIDOffset+realitySessionIDLen]
+
+	b := hello[realitySessionIDOffset+realitySessionIDLen:]
+	// 密码套件
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		return nil, nil, nil, invalid
+	}
+	b = b[2+int(binary.BigEndian.Uint16(b)):]
+	// 压缩方法
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return nil, nil, nil, invalid
+	}
+	b = b[1+int(b[0]):]
+	// 扩展
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		return nil, nil, nil, invalid
+	}
+	b = b[2 : 2+int(binary.BigEndian.Uint16(b))]
+	for len(b) >= 4 {
+		extType := binary.BigEndian.Uint16(b)
+		extLen := int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+extLen {
+			return nil, nil, nil, invalid
+		}
+		ext := b[4 : 4+extLen]
+		b = b[4+extLen:]
+		if extType != extensionKeyShare || len(ext) < 2 {
+			continue
+		}
+		shares := ext[2:]
+		for len(shares) >= 4 {
+			group := binary.BigEndian.Uint16(shares)
+			shareLen := int(binary.BigEndian.Uint16(shares[2:]))
+			if len(shares) < 4+shareLen {
+				return nil, nil, nil, invalid
+			}
+			if group == groupX25519 {
+				return random, sessionID, shares[4 : 4+shareLen], nil
+			}
+			shares = shares[4+shareLen:]
+		}
+	}
+	return nil, nil, nil, fmt.Errorf("client hello has no x25519 key share")
+}
+
+// realityCertificate 生成临时ed25519证书，证书末尾的签名替换为HMAC-SHA512(认证密钥, 公钥)
+func realityCertificate(authKey []byte) (tls.Certificate, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0),
+		Subject:      pkix.Name{CommonName: "reality"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, publicKey, privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	copy(der[len(der)-ed25519.SignatureSize:], realityCertSignature(authKey, publicKey))
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: privateKey}, nil
+}
+
+// replayConn 先返回已读取的ClientHello记录
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+// Read 读取数据
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
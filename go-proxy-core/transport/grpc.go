@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// gRPC gun传输层，与V2Ray/Xray的grpc传输兼容
+// 每条流是一次双向流式调用/ServiceName/Tun，消息为protobuf的Hunk{bytes data = 1}；
+// multi模式调用/ServiceName/TunMulti，消息为MultiHunk{repeated bytes data = 1}
+
+const (
+	// grpcHeaderLen gRPC消息头长度: [是否压缩][消息长度]
+	grpcHeaderLen = 5
+	// grpcMaxMessageLen 允许的最大消息长度
+	grpcMaxMessageLen = 4 << 20
+	// hunkDataTag Hunk/MultiHunk中data字段的标签: 字段1，长度分隔类型
+	hunkDataTag = 0x0a
+)
+
+// grpcTransport gRPC传输层
+type grpcTransport struct {
+	config Config
+	client *http2.Transport
+	url    *url.URL
+}
+
+// newGRPCTransport 创建gRPC传输层
+func newGRPCTransport(config Config) (*grpcTransport, error) {
+	if config.ServiceName == "" {
+		return nil, fmt.Errorf("missing grpc service name")
+	}
+	method := "Tun"
+	if config.GRPCMulti {
+		method = "TunMulti"
+	}
+	path := "/" + strings.Trim(config.ServiceName, "/") + "/" + method
+
+	return &grpcTransport{
+		config: config,
+		client: newHTTP2Client(config),
+		url:    requestURL(config, path),
+	}, nil
+}
+
+// DialContext 打开一次双向流式调用
+func (t *grpcTransport) DialContext(ctx context.Context) (net.Conn, error) {
+	header := http.Header{}
+	for key, value := range t.config.Headers {
+		header.Set(key, value)
+	}
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Te", "trailers")
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", "grpc-go/1.64.0")
+	}
+
+	stream := openHTTPStream(t.client, http.MethodPost, t.url, header, t.config.Server)
+	return &gunConn{httpStream: stream}, nil
+}
+
+// Close 关闭到服务器的HTTP/2连接
+func (t *grpcTransport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// gunConn 在gRPC消息中封装数据
+type gunConn struct {
+	*httpStream
+	pending []byte
+}
+
+// Read 读取数据，当前消息读完后读取下一条
+func (c *gunConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		resp, err := c.response()
+		if err != nil {
+			return 0, err
+		}
+		data, err := readGunMessage(resp.Body)
+		if err == io.EOF {
+			return 0, grpcStatus(resp)
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.pending = data
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write 将数据封装为一条gRPC消息发送
+func (c *gunConn) Write(b []byte) (int, error) {
+	if _, err := c.httpStream.Write(marshalGunMessage(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// marshalGunMessage 编码一条只包含一个data字段的gRPC消息
+func marshalGunMessage(data []byte) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	varintLen := binary.PutUvarint(varint[:], uint64(len(data)))
+	protoLen := 1 + varintLen + len(data)
+
+	b := make([]byte, grpcHeaderLen, grpcHeaderLen+protoLen)
+	binary.BigEndian.PutUint32(b[1:5], uint32(protoLen))
+	b = append(b, hunkDataTag)
+	b = append(b, varint[:varintLen]...)
+	return append(b, data...)
+}
+
+// readGunMessage 读取一条gRPC消息并合并其中所有data字段
+func readGunMessage(r io.Reader) ([]byte, error) {
+	var header [grpcHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated grpc message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, fmt.Errorf("compressed grpc message is not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > grpcMaxMessageLen {
+		return nil, fmt.Errorf("grpc message too large: %d", length)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, fmt.Errorf("truncated grpc message: %v", err)
+	}
+
+	var data []byte
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid grpc message field")
+		}
+		message = message[n:]
+
+		switch tag & 0x07 {
+		case 0: // varint
+			_, n = binary.Uvarint(message)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid grpc message field")
+			}
+			message = message[n:]
+		case 2: // 长度分隔
+			fieldLen, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < fieldLen {
+				return nil, fmt.Errorf("invalid grpc message field")
+			}
+			field := message[n : n+int(fieldLen)]
+			message = message[n+int(fieldLen):]
+			if tag>>3 == 1 {
+				data = append(data, field...)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported grpc message wire type: %d", tag&0x07)
+		}
+	}
+	return data, nil
+}
+
+// grpcStatus 响应体结束后根据grpc-status判断调用是否正常结束
+func grpcStatus(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status == "" || status == "0" {
+		return io.EOF
+	}
+	message := resp.Trailer.Get("Grpc-Message")
+	if message == "" {
+		message = resp.Header.Get("Grpc-Message")
+	}
+	return fmt.Errorf("grpc call failed: status=%s, message=%s", status, message)
+}
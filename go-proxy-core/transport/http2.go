@@ -0,0 +1,181 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	// http2ReadIdleTimeout 连接空闲多久后发送PING检测
+	http2ReadIdleTimeout = 30 * time.Second
+	// http2PingTimeout PING无响应时关闭连接
+	http2PingTimeout = 15 * time.Second
+)
+
+// newHTTP2Client 创建复用到服务器连接的HTTP/2客户端，未配置TLS时使用h2c
+func newHTTP2Client(config Config) *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP: config.TLS == nil,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+			defer cancel()
+			return dialServer(ctx, config, "h2")
+		},
+		ReadIdleTimeout: http2ReadIdleTimeout,
+		PingTimeout:     http2PingTimeout,
+	}
+}
+
+// requestURL 返回HTTP/2请求地址
+func requestURL(config Config, path string) *url.URL {
+	scheme := "https"
+	if config.TLS == nil {
+		scheme = "http"
+	}
+	return &url.URL{Scheme: scheme, Host: config.Host, Path: path}
+}
+
+// http2Transport HTTP/2传输层，每条流对应一个PUT请求
+type http2Transport struct {
+	config Config
+	client *http2.Transport
+	url    *url.URL
+}
+
+// newHTTP2Transport 创建HTTP/2传输层
+func newHTTP2Transport(config Config) (*http2Transport, error) {
+	return &http2Transport{
+		config: config,
+		client: newHTTP2Client(config),
+		url:    requestURL(config, config.Path),
+	}, nil
+}
+
+// DialContext 打开一条HTTP/2流
+func (t *http2Transport) DialContext(ctx context.Context) (net.Conn, error) {
+	header := http.Header{}
+	for key, value := range t.config.Headers {
+		header.Set(key, value)
+	}
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", defaultUserAgent)
+	}
+	return openHTTPStream(t.client, http.MethodPut, t.url, header, t.config.Server), nil
+}
+
+// Close 关闭到服务器的HTTP/2连接
+func (t *http2Transport) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
+
+// httpStream 通过一个HTTP/2请求承载的双向流，请求体为上行，响应体为下行
+// 请求在后台发送，服务端通常在收到数据后才返回响应头，因此不能在打开流时等待响应
+type httpStream struct {
+	writer *io.PipeWriter
+	cancel context.CancelFunc
+	server string
+
+	ready chan struct{}
+	resp  *http.Response
+	err   error
+}
+
+// openHTTPStream 在后台发送请求并返回流
+func openHTTPStream(client *http2.Transport, method string, u *url.URL, header http.Header, server string) *httpStream {
+	// 流的生命周期与调用方的ctx无关，由Close结束
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, writer := io.Pipe()
+
+	req := (&http.Request{
+		Method:     method,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/2",
+		ProtoMajor: 2,
+		Header:     header,
+		Body:       reader,
+	}).WithContext(ctx)
+	req.ContentLength = -1
+
+	s := &httpStream{
+		writer: writer,
+		cancel: cancel,
+		server: server,
+		ready:  make(chan struct{}),
+	}
+	go func() {
+		resp, err := client.RoundTrip(req)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			err = fmt.Errorf("unexpected response from %s: %s", server, resp.Status)
+		}
+		if err != nil {
+			// 让阻塞中的写入返回错误
+			reader.CloseWithError(err)
+		}
+		s.resp, s.err = resp, err
+		close(s.ready)
+	}()
+	return s
+}
+
+// response 等待响应头
+func (s *httpStream) response() (*http.Response, error) {
+	<-s.ready
+	return s.resp, s.err
+}
+
+// Read 读取响应体
+func (s *httpStream) Read(b []byte) (int, error) {
+	resp, err := s.response()
+	if err != nil {
+		return 0, err
+	}
+	return resp.Body.Read(b)
+}
+
+// Write 写入请求体
+func (s *httpStream) Write(b []byte) (int, error) {
+	return s.writer.Write(b)
+}
+
+// Close 结束请求体并取消请求
+func (s *httpStream) Close() error {
+	s.writer.Close()
+	s.cancel()
+	return nil
+}
+
+// LocalAddr 底层连接由HTTP/2客户端复用，返回空地址
+func (s *httpStream) LocalAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+// RemoteAddr 返回服务器地址
+func (s *httpStream) RemoteAddr() net.Addr {
+	return serverAddr(s.server)
+}
+
+// SetDeadline HTTP/2流不支持超时，由底层连接的PING检测断线
+func (s *httpStream) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline HTTP/2流不支持超时
+func (s *httpStream) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline HTTP/2流不支持超时
+func (s *httpStream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
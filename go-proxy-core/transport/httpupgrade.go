@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpUpgradeTransport HTTPUpgrade传输层
+// 与WebSocket使用相同的升级请求，服务端返回101后直接传输原始数据，没有WebSocket帧开销
+type httpUpgradeTransport struct {
+	config Config
+}
+
+// DialContext 发送升级请求并返回升级后的连接
+func (t *httpUpgradeTransport) DialContext(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+
+	conn, err := dialServer(ctx, t.config, "http/1.1")
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	u, err := url.ParseRequestURI(t.config.Path)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid httpupgrade path %s: %v", t.config.Path, err)
+	}
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       t.config.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+	}
+	for key, value := range t.config.Headers {
+		req.Header.Set(key, value)
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", defaultUserAgent)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send httpupgrade request: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read httpupgrade response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		conn.Close()
+		return nil, fmt.Errorf("httpupgrade rejected by %s: %s", t.config.Server, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+
+	// 服务端可能在响应后立即发送数据，已读入缓冲区的部分需要先返回
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// Close HTTPUpgrade传输层没有需要释放的资源
+func (t *httpUpgradeTransport) Close() error {
+	return nil
+}
+
+// bufferedConn 先返回缓冲区中已读取的数据
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read 读取数据
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
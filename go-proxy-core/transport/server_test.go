@@ -0,0 +1,402 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// serverConfig 服务端传输层配置
+type serverConfig struct {
+	Network     string
+	TLS         *tls.Config // 包含证书，为nil时不使用TLS
+	Path        string      // ws/httpupgrade/h2的路径
+	ServiceName string      // grpc服务名，同时接受Tun和TunMulti
+
+	// ws早期数据，与客户端配置一致
+	MaxEarlyData        int
+	EarlyDataHeaderName string
+}
+
+// testListener 在底层监听器上接受传输层连接，Accept返回已去除传输层封装的流
+type testListener struct {
+	inner  net.Listener
+	server *http.Server
+	conns  chan net.Conn
+
+	mu       sync.Mutex
+	requests []*http.Request // 收到的HTTP请求，tcp传输层为空
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// newTestListener 在本机随机端口上启动服务端传输层，测试结束时关闭
+func newTestListener(t *testing.T, config serverConfig) net.Listener {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := listen(config, inner)
+	if err != nil {
+		inner.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		l.Close()
+		inner.Close()
+	})
+	return l
+}
+
+// listen 在底层监听器上创建服务端传输层
+func listen(config serverConfig, inner net.Listener) (net.Listener, error) {
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	switch config.Network {
+	case "", NetworkTCP:
+		if config.TLS != nil {
+			return tls.NewListener(inner, config.TLS), nil
+		}
+		return inner, nil
+	case NetworkWebSocket, NetworkHTTPUpgrade, NetworkGRPC, NetworkHTTP2:
+	default:
+		return nil, fmt.Errorf("unsupported transport: %s", config.Network)
+	}
+
+	l := &testListener{
+		inner:  inner,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+
+	var handler http.Handler
+	switch config.Network {
+	case NetworkWebSocket:
+		handler = l.webSocketHandler(config)
+	case NetworkHTTPUpgrade:
+		handler = l.httpUpgradeHandler(config)
+	case NetworkGRPC:
+		if config.ServiceName == "" {
+			return nil, fmt.Errorf("missing grpc service name")
+		}
+		handler = l.http2Handler(config, true)
+	case NetworkHTTP2:
+		handler = l.http2Handler(config, false)
+	}
+
+	handler = l.record(handler)
+	l.server = &http.Server{Handler: handler, ErrorLog: log.New(io.Discard, "", 0)}
+	if config.Network == NetworkGRPC || config.Network == NetworkHTTP2 {
+		if config.TLS != nil {
+			if err := http2.ConfigureServer(l.server, &http2.Server{}); err != nil {
+				return nil, err
+			}
+		} else {
+			l.server.Handler = h2c.NewHandler(handler, &http2.Server{})
+		}
+	}
+
+	listener := inner
+	if config.TLS != nil {
+		tlsConfig := config.TLS.Clone()
+		if config.Network == NetworkGRPC || config.Network == NetworkHTTP2 {
+			tlsConfig.NextProtos = []string{"h2"}
+		} else {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		}
+		listener = tls.NewListener(inner, tlsConfig)
+	}
+	go l.server.Serve(listener)
+	return l, nil
+}
+
+// record 记录收到的请求
+func (l *testListener) record(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mu.Lock()
+		l.requests = append(l.requests, r.Clone(context.Background()))
+		l.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// lastRequest 返回最近收到的请求
+func (l *testListener) lastRequest(t *testing.T) *http.Request {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.requests) == 0 {
+		t.Fatal("server received no request")
+	}
+	return l.requests[len(l.requests)-1]
+}
+
+// Accept 返回下一条流
+func (l *testListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 停止服务端
+func (l *testListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return l.server.Close()
+}
+
+// Addr 返回监听地址
+func (l *testListener) Addr() net.Addr {
+	return l.inner.Addr()
+}
+
+// deliver 将流交给Accept，监听器关闭时返回false
+func (l *testListener) deliver(conn net.Conn) bool {
+	select {
+	case l.conns <- conn:
+		return true
+	case <-l.closed:
+		conn.Close()
+		return false
+	}
+}
+
+// webSocketHandler 处理WebSocket升级，支持请求头或路径中的早期数据
+func (l *testListener) webSocketHandler(config serverConfig) http.Handler {
+	upgrader := &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var earlyData []byte
+		var responseHeader http.Header
+		switch {
+		case config.MaxEarlyData > 0 && config.EarlyDataHeaderName != "":
+			if value := r.Header.Get(config.EarlyDataHeaderName); value != "" {
+				data, err := base64.RawURLEncoding.DecodeString(value)
+				if err != nil {
+					http.Error(w, "invalid early data", http.StatusBadRequest)
+					return
+				}
+				earlyData = data
+				// 浏览器要求服务端回显Sec-WebSocket-Protocol
+				if strings.EqualFold(config.EarlyDataHeaderName, defaultEarlyDataHeader) {
+					responseHeader = http.Header{defaultEarlyDataHeader: {value}}
+				}
+			}
+			if r.URL.Path != config.Path {
+				http.NotFound(w, r)
+				return
+			}
+		case config.MaxEarlyData > 0:
+			if !strings.HasPrefix(r.URL.Path, config.Path) {
+				http.NotFound(w, r)
+				return
+			}
+			if encoded := strings.TrimPrefix(r.URL.Path, config.Path); encoded != "" {
+				data, err := base64.RawURLEncoding.DecodeString(encoded)
+				if err != nil {
+					http.Error(w, "invalid early data", http.StatusBadRequest)
+					return
+				}
+				earlyData = data
+			}
+		default:
+			if r.URL.Path != config.Path {
+				http.NotFound(w, r)
+				return
+			}
+		}
+
+		ws, err := upgrader.Upgrade(w, r, responseHeader)
+		if err != nil {
+			return
+		}
+		var conn net.Conn = &wsConn{ws: ws}
+		if len(earlyData) > 0 {
+			conn = &bufferedConn{Conn: conn, reader: bufio.NewReader(io.MultiReader(bytes.NewReader(earlyData), conn))}
+		}
+		l.deliver(conn)
+	})
+}
+
+// httpUpgradeHandler 处理HTTPUpgrade请求
+func (l *testListener) httpUpgradeHandler(config serverConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != config.Path || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			http.NotFound(w, r)
+			return
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "hijack not supported", http.StatusInternalServerError)
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		if err := rw.Flush(); err != nil {
+			conn.Close()
+			return
+		}
+		if rw.Reader.Buffered() > 0 {
+			conn = &bufferedConn{Conn: conn, reader: rw.Reader}
+		}
+		l.deliver(conn)
+	})
+}
+
+// http2Handler 处理gRPC调用或HTTP/2流，处理函数在流关闭前不返回
+func (l *testListener) http2Handler(config serverConfig, grpc bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grpc {
+			service := "/" + strings.Trim(config.ServiceName, "/") + "/"
+			if r.URL.Path != service+"Tun" && r.URL.Path != service+"TunMulti" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Trailer", "Grpc-Status")
+		} else if r.URL.Path != config.Path {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return
+		}
+		flusher.Flush()
+
+		conn := &serverStream{
+			reader:  r.Body,
+			writer:  w,
+			flusher: flusher,
+			grpc:    grpc,
+			local:   l.inner.Addr(),
+			remote:  serverAddr(r.RemoteAddr),
+			done:    make(chan struct{}),
+		}
+		if !l.deliver(conn) {
+			return
+		}
+		select {
+		case <-conn.done:
+		case <-r.Context().Done():
+		}
+		if grpc {
+			w.Header().Set("Grpc-Status", "0")
+		}
+	})
+}
+
+// serverStream 服务端的HTTP/2流
+type serverStream struct {
+	reader  io.Reader
+	writer  io.Writer
+	flusher http.Flusher
+	grpc    bool
+	pending []byte
+	local   net.Addr
+	remote  net.Addr
+
+	mu        sync.Mutex
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Read 读取请求体
+func (s *serverStream) Read(b []byte) (int, error) {
+	if !s.grpc {
+		return s.reader.Read(b)
+	}
+	for len(s.pending) == 0 {
+		data, err := readGunMessage(s.reader)
+		if err != nil {
+			return 0, err
+		}
+		s.pending = data
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write 写入响应体并立即发送
+func (s *serverStream) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	data := b
+	if s.grpc {
+		data = marshalGunMessage(b)
+	}
+	if _, err := s.writer.Write(data); err != nil {
+		return 0, err
+	}
+	s.flusher.Flush()
+	return len(b), nil
+}
+
+// Close 结束响应
+func (s *serverStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// LocalAddr 返回监听地址
+func (s *serverStream) LocalAddr() net.Addr {
+	return s.local
+}
+
+// RemoteAddr 返回客户端地址
+func (s *serverStream) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+// SetDeadline 不支持超时
+func (s *serverStream) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline 不支持超时
+func (s *serverStream) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline 不支持超时
+func (s *serverStream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
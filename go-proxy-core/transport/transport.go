@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/tlsclient"
+)
+
+// 传输层类型
+const (
+	NetworkTCP         = "tcp"
+	NetworkWebSocket   = "ws"
+	NetworkGRPC        = "grpc"
+	NetworkHTTP2       = "h2"
+	NetworkHTTPUpgrade = "httpupgrade"
+)
+
+const (
+	// defaultDialTimeout 建立传输层连接的默认超时时间
+	defaultDialTimeout = 10 * time.Second
+	// defaultUserAgent 未配置User-Agent时使用的浏览器标识
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+)
+
+// Config 传输层配置，各字段只对对应的传输层生效
+type Config struct {
+	Network string            // tcp/ws/grpc/h2/httpupgrade，默认tcp
+	Server  string            // 服务器地址 host:port
+	TLS     *tlsclient.Config // 为nil时不使用TLS，ServerName为空时使用服务器主机名
+
+	// ws/httpupgrade/h2
+	Host    string            // 请求的Host，为空时使用服务器主机名
+	Path    string            // 请求路径，默认/
+	Headers map[string]string // 附加请求头
+
+	// ws早期数据，连接时随握手请求发送第一次写入的前MaxEarlyData字节
+	// EarlyDataHeaderName为空时放在路径中，否则放在该请求头中
+	MaxEarlyData        int
+	EarlyDataHeaderName string
+
+	// grpc
+	ServiceName string // 服务名，请求路径为/ServiceName/Tun
+	GRPCMulti   bool   // 使用multi模式（TunMulti）
+
+	Timeout time.Duration
+
+	// DialContext 建立到服务器的TCP连接，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Transport 传输层，每次调用DialContext返回一条承载代理协议数据的双向流
+type Transport interface {
+	DialContext(ctx context.Context) (net.Conn, error)
+	Close() error
+}
+
+// New 根据配置创建传输层
+func New(config Config) (Transport, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing transport server")
+	}
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transport server %s: %v", config.Server, err)
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+	if config.DialContext == nil {
+		config.DialContext = (&net.Dialer{}).DialContext
+	}
+	if config.TLS != nil {
+		config.TLS = config.TLS.Clone()
+		if config.TLS.ServerName == "" {
+			config.TLS.ServerName = host
+		}
+	}
+	if config.Host == "" {
+		config.Host = host
+		if config.TLS != nil {
+			config.Host = config.TLS.ServerName
+		}
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+
+	switch config.Network {
+	case "", NetworkTCP:
+		return &tcpTransport{config: config}, nil
+	case NetworkWebSocket:
+		return newWebSocketTransport(config)
+	case NetworkHTTPUpgrade:
+		return &httpUpgradeTransport{config: config}, nil
+	case NetworkGRPC:
+		return newGRPCTransport(config)
+	case NetworkHTTP2:
+		return newHTTP2Transport(config)
+	default:
+		return nil, fmt.Errorf("unsupported transport: %s", config.Network)
+	}
+}
+
+// dialServer 连接服务器，配置了TLS时完成TLS握手
+// nextProtos不为空且配置中没有指定ALPN时使用nextProtos
+func dialServer(ctx context.Context, config Config, nextProtos ...string) (net.Conn, error) {
+	conn, err := config.DialContext(ctx, "tcp", config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", config.Server, err)
+	}
+	if config.TLS == nil {
+		return conn, nil
+	}
+
+	tlsConn, err := config.TLS.Client(ctx, conn, nextProtos...)
+	if err != nil {
+		return nil, fmt.Errorf("tls handshake with %s failed: %v", config.Server, err)
+	}
+	return tlsConn, nil
+}
+
+// tcpTransport 直接使用TCP连接，可选TLS
+type tcpTransport struct {
+	config Config
+}
+
+// DialContext 建立TCP连接
+func (t *tcpTransport) DialContext(ctx context.Context) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+	return dialServer(ctx, t.config)
+}
+
+// Close TCP传输层没有需要释放的资源
+func (t *tcpTransport) Close() error {
+	return nil
+}
+
+// serverAddr 以字符串表示的服务器地址，用于无法获取底层连接地址的流
+type serverAddr string
+
+// Network 返回网络类型
+func (a serverAddr) Network() string {
+	return "tcp"
+}
+
+// String 返回host:port形式的地址
+func (a serverAddr) String() string {
+	return string(a)
+}
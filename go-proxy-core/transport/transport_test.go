@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"github.com/dualvpn/go-proxy-core/tlsclient"
+)
+
+// startEchoListener 启动服务端传输层并回显每条流的数据
+func startEchoListener(t *testing.T, config serverConfig) net.Listener {
+	t.Helper()
+	l := newTestListener(t, config)
+	go testutil.ServeEcho(l)
+	return l
+}
+
+func TestTransports(t *testing.T) {
+	cert, roots := testutil.Certificate(t, "cdn.example.com")
+	for _, tc := range []struct {
+		network string
+		multi   bool
+	}{
+		{NetworkTCP, false},
+		{NetworkWebSocket, false},
+		{NetworkHTTPUpgrade, false},
+		{NetworkGRPC, false},
+		{NetworkGRPC, true},
+		{NetworkHTTP2, false},
+	} {
+		for _, useTLS := range []bool{false, true} {
+			server := serverConfig{Network: tc.network, Path: "/tunnel", ServiceName: "proxy.Tunnel"}
+			client := Config{Network: tc.network, Path: "/tunnel", ServiceName: "proxy.Tunnel", GRPCMulti: tc.multi}
+			if useTLS {
+				server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+				client.TLS = &tlsclient.Config{RootCAs: roots}
+			}
+			l := startEchoListener(t, server)
+			client.Server = l.Addr().String()
+
+			tr, err := New(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 每次DialContext返回一条独立的流
+			for i := 0; i < 2; i++ {
+				conn, err := tr.DialContext(context.Background())
+				if err != nil {
+					t.Fatalf("%s multi=%t tls=%t: dial: %v", tc.network, tc.multi, useTLS, err)
+				}
+				data := make([]byte, 64<<10)
+				rand.Read(data)
+				testutil.Echo(t, conn, data)
+				conn.Close()
+			}
+			tr.Close()
+		}
+	}
+}
+
+func TestWebSocketHeaders(t *testing.T) {
+	for _, network := range []string{NetworkWebSocket, NetworkHTTPUpgrade} {
+		l := startEchoListener(t, serverConfig{Network: network, Path: "/ws"})
+		tr, err := New(Config{
+			Network: network,
+			Server:  l.Addr().String(),
+			Host:    "cdn.example.com",
+			Path:    "/ws",
+			Headers: map[string]string{"X-Client": "dualvpn"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := tr.DialContext(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", network, err)
+		}
+		testutil.Echo(t, conn, []byte("hello"))
+		conn.Close()
+
+		req := l.(*testListener).lastRequest(t)
+		if req.Host != "cdn.example.com" || req.Header.Get("X-Client") != "dualvpn" {
+			t.Fatalf("%s: host=%s headers=%v", network, req.Host, req.Header)
+		}
+		if req.Header.Get("User-Agent") != defaultUserAgent {
+			t.Fatalf("%s: user agent = %q", network, req.Header.Get("User-Agent"))
+		}
+	}
+}
+
+func TestWebSocketEarlyData(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		server serverConfig
+		client Config
+	}{
+		{
+			// V2Ray写法: 路径中的?ed=指定长度，数据放在Sec-WebSocket-Protocol中
+			name:   "path ed",
+			server: serverConfig{Path: "/ws", MaxEarlyData: 2048, EarlyDataHeaderName: defaultEarlyDataHeader},
+			client: Config{Path: "/ws?ed=2048"},
+		},
+		{
+			name:   "custom header",
+			server: serverConfig{Path: "/ws", MaxEarlyData: 16, EarlyDataHeaderName: "X-Early-Data"},
+			client: Config{Path: "/ws", MaxEarlyData: 16, EarlyDataHeaderName: "X-Early-Data"},
+		},
+		{
+			// 未指定请求头时数据追加在路径后
+			name:   "in path",
+			server: serverConfig{Path: "/ws/", MaxEarlyData: 2048},
+			client: Config{Path: "/ws/", MaxEarlyData: 2048},
+		},
+	} {
+		tc.server.Network, tc.client.Network = NetworkWebSocket, NetworkWebSocket
+		l := startEchoListener(t, tc.server)
+		tc.client.Server = l.Addr().String()
+		tr, err := New(tc.client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := tr.DialContext(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		// 第一次写入随握手发送，超过长度上限的部分在握手后发送
+		data := []byte("early data that is longer than sixteen bytes")
+		testutil.Echo(t, conn, data)
+		conn.Close()
+
+		req := l.(*testListener).lastRequest(t)
+		sent := req.Header.Get(tc.server.EarlyDataHeaderName)
+		if tc.server.EarlyDataHeaderName == "" {
+			sent = strings.TrimPrefix(req.URL.Path, tc.server.Path)
+		}
+		early, err := base64.RawURLEncoding.DecodeString(sent)
+		if err != nil || len(early) == 0 || !bytes.HasPrefix(data, early) || len(early) > tc.server.MaxEarlyData {
+			t.Fatalf("%s: early data in handshake = %q (%v)", tc.name, early, err)
+		}
+	}
+}
+
+func TestGRPCServiceMismatch(t *testing.T) {
+	l := startEchoListener(t, serverConfig{Network: NetworkGRPC, ServiceName: "proxy.Tunnel"})
+	tr, err := New(Config{Network: NetworkGRPC, Server: l.Addr().String(), ServiceName: "other.Service"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	conn, err := tr.DialContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("ping"))
+	if _, err := conn.Read(make([]byte, 4)); err == nil {
+		t.Fatal("expected error for unknown grpc service")
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	for _, config := range []Config{
+		{Network: NetworkTCP},
+		{Network: NetworkTCP, Server: "no-port"},
+		{Network: "quic", Server: "127.0.0.1:443"},
+		{Network: NetworkWebSocket, Server: "127.0.0.1:443", Path: "/ws?ed=abc"},
+	} {
+		if _, err := New(config); err == nil {
+			t.Fatalf("New(%+v): expected error", config)
+		}
+	}
+}
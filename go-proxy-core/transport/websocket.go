@@ -0,0 +1,309 @@
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultEarlyDataHeader 路径中使用?ed=指定早期数据长度时使用的请求头，与V2Ray一致
+const defaultEarlyDataHeader = "Sec-WebSocket-Protocol"
+
+// webSocketTransport WebSocket传输层，每条流对应一个WebSocket连接
+type webSocketTransport struct {
+	config Config
+	path   string
+}
+
+// newWebSocketTransport 创建WebSocket传输层，兼容V2Ray在路径中用?ed=指定早期数据长度的写法
+func newWebSocketTransport(config Config) (*webSocketTransport, error) {
+	u, err := url.Parse(config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid websocket path %s: %v", config.Path, err)
+	}
+
+	query := u.Query()
+	if ed := query.Get("ed"); ed != "" {
+		maxEarlyData, err := strconv.Atoi(ed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid websocket early data length %s: %v", ed, err)
+		}
+		if config.MaxEarlyData == 0 {
+			config.MaxEarlyData = maxEarlyData
+		}
+		if config.EarlyDataHeaderName == "" {
+			config.EarlyDataHeaderName = defaultEarlyDataHeader
+		}
+		query.Del("ed")
+		u.RawQuery = query.Encode()
+	}
+
+	return &webSocketTransport{config: config, path: u.RequestURI()}, nil
+}
+
+// DialContext 建立WebSocket连接，启用早期数据时握手推迟到第一次写入
+func (t *webSocketTransport) DialContext(ctx context.Context) (net.Conn, error) {
+	if t.config.MaxEarlyData > 0 {
+		return &earlyDataConn{transport: t, ready: make(chan struct{})}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.config.Timeout)
+	defer cancel()
+	return t.handshake(ctx, nil)
+}
+
+// Close WebSocket传输层没有需要释放的资源
+func (t *webSocketTransport) Close() error {
+	return nil
+}
+
+// handshake 连接服务器并完成WebSocket握手，earlyData随握手请求发送
+func (t *webSocketTransport) handshake(ctx context.Context, earlyData []byte) (*wsConn, error) {
+	conn, err := dialServer(ctx, t.config, "http/1.1")
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	for key, value := range t.config.Headers {
+		header.Set(key, value)
+	}
+	header.Set("Host", t.config.Host)
+	if header.Get("User-Agent") == "" {
+		header.Set("User-Agent", defaultUserAgent)
+	}
+
+	path := t.path
+	if len(earlyData) > 0 {
+		encoded := base64.RawURLEncoding.EncodeToString(earlyData)
+		if t.config.EarlyDataHeaderName != "" {
+			header.Set(t.config.EarlyDataHeaderName, encoded)
+		} else {
+			path += encoded
+		}
+	}
+
+	dialer := &websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return conn, nil
+		},
+		ReadBufferSize:  32 * 1024,
+		WriteBufferSize: 32 * 1024,
+	}
+	ws, resp, err := dialer.DialContext(ctx, "ws://"+t.config.Host+path, header)
+	if err != nil {
+		conn.Close()
+		if resp != nil {
+			return nil, fmt.Errorf("websocket handshake with %s failed: %v (status %s)", t.config.Server, err, resp.Status)
+		}
+		return nil, fmt.Errorf("websocket handshake with %s failed: %v", t.config.Server, err)
+	}
+	return &wsConn{ws: ws}, nil
+}
+
+// wsConn 将WebSocket二进制消息适配为字节流
+type wsConn struct {
+	ws      *websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex
+}
+
+// Read 读取数据，当前消息读完后继续读取下一条消息
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.ws.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Write 将数据作为一条二进制消息发送
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 发送关闭帧后关闭连接
+func (c *wsConn) Close() error {
+	c.writeMu.Lock()
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	return c.ws.Close()
+}
+
+// LocalAddr 返回本地地址
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+// RemoteAddr 返回服务器地址
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+// SetDeadline 设置读写超时
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置读取超时
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 设置写入超时
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// earlyDataConn 第一次写入时才建立WebSocket连接，并把写入的数据放在握手请求中
+type earlyDataConn struct {
+	transport *webSocketTransport
+	once      sync.Once
+	ready     chan struct{}
+	conn      *wsConn
+	err       error
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// Write 第一次写入时握手，超出早期数据长度的部分在握手后发送
+func (c *earlyDataConn) Write(b []byte) (int, error) {
+	sent := 0
+	c.once.Do(func() {
+		sent = len(b)
+		if sent > c.transport.config.MaxEarlyData {
+			sent = c.transport.config.MaxEarlyData
+		}
+		// 调用方的ctx在DialContext返回后可能已经结束，握手使用独立的超时
+		ctx, cancel := context.WithTimeout(context.Background(), c.transport.config.Timeout)
+		defer cancel()
+		c.conn, c.err = c.transport.handshake(ctx, b[:sent])
+		if c.err == nil {
+			c.mu.Lock()
+			c.conn.SetReadDeadline(c.readDeadline)
+			c.conn.SetWriteDeadline(c.writeDeadline)
+			c.mu.Unlock()
+		}
+		close(c.ready)
+	})
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	if sent == len(b) {
+		return sent, nil
+	}
+	n, err := c.conn.Write(b[sent:])
+	return sent + n, err
+}
+
+// Read 等待握手完成后读取数据
+func (c *earlyDataConn) Read(b []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(b)
+}
+
+// Close 关闭连接，尚未握手时直接放弃
+func (c *earlyDataConn) Close() error {
+	c.once.Do(func() {
+		c.err = net.ErrClosed
+		close(c.ready)
+	})
+	<-c.ready
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// LocalAddr 返回本地地址，握手前返回空地址
+func (c *earlyDataConn) LocalAddr() net.Addr {
+	if conn := c.established(); conn != nil {
+		return conn.LocalAddr()
+	}
+	return &net.TCPAddr{}
+}
+
+// RemoteAddr 返回服务器地址，握手前返回配置的服务器地址
+func (c *earlyDataConn) RemoteAddr() net.Addr {
+	if conn := c.established(); conn != nil {
+		return conn.RemoteAddr()
+	}
+	return serverAddr(c.transport.config.Server)
+}
+
+// SetDeadline 设置读写超时
+func (c *earlyDataConn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置读取超时，握手前保存到握手完成后生效
+func (c *earlyDataConn) SetReadDeadline(t time.Time) error {
+	if conn := c.established(); conn != nil {
+		return conn.SetReadDeadline(t)
+	}
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// SetWriteDeadline 设置写入超时，握手前保存到握手完成后生效
+func (c *earlyDataConn) SetWriteDeadline(t time.Time) error {
+	if conn := c.established(); conn != nil {
+		return conn.SetWriteDeadline(t)
+	}
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// established 返回已建立的连接，尚未握手或握手失败时返回nil
+func (c *earlyDataConn) established() *wsConn {
+	select {
+	case <-c.ready:
+		return c.conn
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,464 @@
+package tuic
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// defaultDialTimeout 建立QUIC连接的默认超时时间
+	defaultDialTimeout = 10 * time.Second
+	// defaultHeartbeat 默认心跳间隔
+	defaultHeartbeat = 10 * time.Second
+	// defaultIdleTimeout QUIC空闲超时时间
+	defaultIdleTimeout = 30 * time.Second
+
+	// closeErrCodeOK 正常关闭连接
+	closeErrCodeOK = 0x00
+	// closeErrCodeAuthFailed 认证失败
+	closeErrCodeAuthFailed = 0x01
+)
+
+// 支持的拥塞控制算法
+var congestionControls = map[string]bool{
+	"":         true,
+	"cubic":    true,
+	"new_reno": true,
+	"bbr":      true,
+}
+
+// ClientConfig TUIC客户端配置
+type ClientConfig struct {
+	Server            string      // 服务器地址 host:port
+	UUID              [16]byte    // 用户UUID
+	Password          string      // 用户密码
+	TLS               *tls.Config // TLS配置，ServerName为空时使用服务器主机名
+	UDPRelayMode      string      // UDP转发模式: native/quic
+	CongestionControl string      // 拥塞控制: cubic/new_reno/bbr
+	ZeroRTT           bool        // 是否启用0-RTT握手
+	Heartbeat         time.Duration
+	Timeout           time.Duration
+
+	// DialContext 建立到服务器的UDP连接，为空时直接连接
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Client TUIC v5客户端
+// 所有TCP流和UDP关联复用同一个QUIC连接，连接断开后在下次使用时重新建立
+type Client struct {
+	config ClientConfig
+
+	mu        sync.Mutex
+	conn      quic.Connection
+	sessions  map[uint16]*udpConn
+	nextAssoc uint16
+}
+
+// NewClient 创建新的TUIC客户端
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.Server == "" {
+		return nil, fmt.Errorf("missing tuic server")
+	}
+	host, _, err := net.SplitHostPort(config.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tuic server %s: %v", config.Server, err)
+	}
+	switch config.UDPRelayMode {
+	case "":
+		config.UDPRelayMode = UDPRelayNative
+	case UDPRelayNative, UDPRelayQUIC:
+	default:
+		return nil, fmt.Errorf("invalid udp relay mode: %s", config.UDPRelayMode)
+	}
+	if !congestionControls[config.CongestionControl] {
+		return nil, fmt.Errorf("unsupported congestion control: %s", config.CongestionControl)
+	}
+	if config.Heartbeat <= 0 {
+		config.Heartbeat = defaultHeartbeat
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultDialTimeout
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.TLS != nil {
+		tlsConfig = config.TLS.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{"h3"}
+	}
+	// 0-RTT需要缓存会话票据
+	if config.ZeroRTT && tlsConfig.ClientSessionCache == nil {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(8)
+	}
+	config.TLS = tlsConfig
+
+	return &Client{
+		config:   config,
+		sessions: make(map[uint16]*udpConn),
+	}, nil
+}
+
+// DialContext 通过新的双向流连接到目标地址
+// TUIC的CONNECT命令没有响应，连接失败会在首次读取时返回
+func (c *Client) DialContext(ctx context.Context, targetAddr string) (net.Conn, error) {
+	header, err := connectCommand(targetAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0-RTT被拒绝或连接已失效时重新建立连接再试一次
+	for attempt := 0; ; attempt++ {
+		conn, err := c.connection(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stream, err := conn.OpenStreamSync(ctx)
+		if err == nil {
+			if _, err = stream.Write(header); err == nil {
+				return &streamConn{Stream: stream, conn: conn}, nil
+			}
+			stream.CancelRead(0)
+			stream.Close()
+		}
+
+		c.dropConnection(conn)
+		if attempt > 0 || ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to open tuic stream: %v", err)
+		}
+	}
+}
+
+// ListenPacket 建立UDP关联
+func (c *Client) ListenPacket(ctx context.Context) (net.PacketConn, error) {
+	conn, err := c.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextAssoc++
+	for c.sessions[c.nextAssoc] != nil {
+		c.nextAssoc++
+	}
+	session := newUDPConn(c, conn, c.nextAssoc)
+	c.sessions[session.id] = session
+	return session, nil
+}
+
+// Close 关闭QUIC连接和所有UDP关联
+func (c *Client) Close() error {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn = nil
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.CloseWithError(closeErrCodeOK, "")
+}
+
+// connection 返回可用的QUIC连接，必要时重新连接
+func (c *Client) connection(ctx context.Context) (quic.Connection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && c.conn.Context().Err() == nil {
+		return c.conn, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	conn, early, err := c.dialQUIC(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if early {
+		// 0-RTT连接在握手完成前即可发送命令，认证在握手完成后立即补发
+		go func() {
+			if err := c.authenticate(conn); err != nil {
+				log.Printf("TUIC认证失败: %v", err)
+				conn.CloseWithError(closeErrCodeAuthFailed, "")
+			}
+		}()
+	} else if err := c.authenticate(conn); err != nil {
+		conn.CloseWithError(closeErrCodeAuthFailed, "")
+		return nil, err
+	}
+
+	c.conn = conn
+	log.Printf("TUIC连接已建立: server=%s, udp_relay_mode=%s, congestion_control=%s, zero_rtt=%t",
+		c.config.Server, c.config.UDPRelayMode, c.config.CongestionControl, early)
+
+	go c.heartbeat(conn)
+	go c.receiveDatagrams(conn)
+	go c.receiveUniStreams(conn)
+	return conn, nil
+}
+
+// dialQUIC 建立到服务器的QUIC连接，启用0-RTT时不等待握手完成
+func (c *Client) dialQUIC(ctx context.Context) (quic.Connection, bool, error) {
+	dial := c.config.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	raw, err := dial(ctx, "udp", c.config.Server)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to connect to tuic server %s: %v", c.config.Server, err)
+	}
+	pconn := &connPacketConn{Conn: raw}
+
+	// quic-go只内置了NewReno/Cubic拥塞控制，其他算法使用默认实现
+	quicConfig := &quic.Config{
+		HandshakeIdleTimeout: c.config.Timeout,
+		MaxIdleTimeout:       defaultIdleTimeout,
+		EnableDatagrams:      true,
+	}
+
+	var conn quic.Connection
+	early := false
+	if c.config.ZeroRTT {
+		var earlyConn quic.EarlyConnection
+		earlyConn, err = quic.DialEarly(ctx, pconn, raw.RemoteAddr(), c.config.TLS, quicConfig)
+		if err == nil {
+			conn = earlyConn
+			// 有可用的会话票据时DialEarly在握手完成前返回
+			select {
+			case <-earlyConn.HandshakeComplete():
+			default:
+				early = true
+			}
+		}
+	} else {
+		conn, err = quic.Dial(ctx, pconn, raw.RemoteAddr(), c.config.TLS, quicConfig)
+	}
+	if err != nil {
+		raw.Close()
+		return nil, false, fmt.Errorf("tuic QUIC handshake with %s failed: %v", c.config.Server, err)
+	}
+
+	// QUIC连接关闭后释放底层UDP连接
+	go func() {
+		<-conn.Context().Done()
+		raw.Close()
+	}()
+	return conn, early, nil
+}
+
+// authenticate 在单向流上发送认证命令，令牌由TLS导出密钥生成
+func (c *Client) authenticate(conn quic.Connection) error {
+	if early, ok := conn.(quic.EarlyConnection); ok {
+		select {
+		case <-early.HandshakeComplete():
+		case <-conn.Context().Done():
+			return context.Cause(conn.Context())
+		}
+	}
+
+	state := conn.ConnectionState().TLS
+	token, err := state.ExportKeyingMaterial(string(c.config.UUID[:]), []byte(c.config.Password), tokenLen)
+	if err != nil {
+		return fmt.Errorf("failed to export tuic token: %v", err)
+	}
+
+	stream, err := conn.OpenUniStream()
+	if err != nil {
+		return fmt.Errorf("failed to open tuic auth stream: %v", err)
+	}
+	if _, err := stream.Write(authenticateCommand(c.config.UUID, token)); err != nil {
+		stream.CancelWrite(0)
+		return fmt.Errorf("failed to send tuic authentication: %v", err)
+	}
+	return stream.Close()
+}
+
+// heartbeat 定期发送心跳保持连接
+func (c *Client) heartbeat(conn quic.Connection) {
+	ticker := time.NewTicker(c.config.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-conn.Context().Done():
+			return
+		case <-ticker.C:
+			if err := conn.SendDatagram(heartbeatCommand()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dropConnection 丢弃连接，下次使用时重新建立
+func (c *Client) dropConnection(conn quic.Connection) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+	conn.CloseWithError(closeErrCodeOK, "")
+}
+
+// receiveDatagrams 接收native模式下的UDP数据包
+func (c *Client) receiveDatagrams(conn quic.Connection) {
+	defer c.closeSessions(conn)
+	for {
+		data, err := conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		c.handleCommand(bytes.NewReader(data))
+	}
+}
+
+// receiveUniStreams 接收quic模式下的UDP数据包
+func (c *Client) receiveUniStreams(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			c.handleCommand(stream)
+			stream.CancelRead(0)
+		}()
+	}
+}
+
+// handleCommand 处理服务端发来的命令，只关心数据包命令
+func (c *Client) handleCommand(r io.Reader) {
+	cmd, err := readHeader(r)
+	if err != nil || cmd != cmdPacket {
+		return
+	}
+	p, err := readPacket(r)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	session := c.sessions[p.AssocID]
+	c.mu.Unlock()
+	if session != nil {
+		session.feed(p)
+	}
+}
+
+// removeSession 移除UDP关联
+func (c *Client) removeSession(id uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, id)
+}
+
+// closeSessions 关闭属于指定连接的所有UDP关联
+func (c *Client) closeSessions(conn quic.Connection) {
+	c.mu.Lock()
+	var sessions []*udpConn
+	for id, session := range c.sessions {
+		if session.conn == conn {
+			sessions = append(sessions, session)
+			delete(c.sessions, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, session := range sessions {
+		session.Close()
+	}
+}
+
+// sendPacket 发送数据包，native模式超过datagram长度时分片，quic模式使用单向流
+func sendPacket(conn quic.Connection, p *packet, mode string) error {
+	data, err := p.marshal()
+	if err != nil {
+		return err
+	}
+
+	if mode == UDPRelayQUIC {
+		stream, err := conn.OpenUniStream()
+		if err != nil {
+			return err
+		}
+		if _, err := stream.Write(data); err != nil {
+			stream.CancelWrite(0)
+			return err
+		}
+		return stream.Close()
+	}
+
+	err = conn.SendDatagram(data)
+	var tooLarge *quic.DatagramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		return err
+	}
+	frags, err := p.fragment(int(tooLarge.MaxDatagramPayloadSize))
+	if err != nil {
+		return err
+	}
+	for _, frag := range frags {
+		data, err := frag.marshal()
+		if err != nil {
+			return err
+		}
+		if err := conn.SendDatagram(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamConn 将QUIC流包装为net.Conn
+type streamConn struct {
+	quic.Stream
+	conn quic.Connection
+}
+
+// LocalAddr 返回本地地址
+func (sc *streamConn) LocalAddr() net.Addr {
+	return sc.conn.LocalAddr()
+}
+
+// RemoteAddr 返回服务器地址
+func (sc *streamConn) RemoteAddr() net.Addr {
+	return sc.conn.RemoteAddr()
+}
+
+// Close 关闭流的读写两个方向
+func (sc *streamConn) Close() error {
+	sc.Stream.CancelRead(0)
+	return sc.Stream.Close()
+}
+
+// connPacketConn 将已连接的UDP连接包装为net.PacketConn供quic-go使用
+type connPacketConn struct {
+	net.Conn
+}
+
+// ReadFrom 读取一个UDP包，来源总是服务器
+func (c *connPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := c.Conn.Read(b)
+	return n, c.Conn.RemoteAddr(), err
+}
+
+// WriteTo 向服务器发送一个UDP包
+func (c *connPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,180 @@
+package tuic
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+)
+
+// testUUID 测试使用的用户UUID
+var testUUID = [16]byte{0x6f, 0x2e, 0x1c, 0x3a, 0x9b, 0x44, 0x4d, 0x10, 0x8a, 0x5e, 0x21, 0x7f, 0x0c, 0xd3, 0x66, 0x01}
+
+// newTestClient 创建连接到测试服务端的客户端，测试结束时关闭
+func newTestClient(t *testing.T, server *testServer, config ClientConfig) *Client {
+	t.Helper()
+	config.Server = server.addr()
+	config.TLS = &tls.Config{RootCAs: server.roots}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientConnect(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, testUUID, "password")
+	client := newTestClient(t, server, ClientConfig{UUID: testUUID, Password: "password"})
+
+	for i := 0; i < 3; i++ {
+		conn, err := client.DialContext(context.Background(), target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 256<<10)
+		rand.Read(data)
+		testutil.Echo(t, conn, data)
+		conn.Close()
+	}
+}
+
+func TestClientAuthFailure(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, testUUID, "password")
+
+	otherUUID := testUUID
+	otherUUID[0] ^= 0xff
+	for _, tc := range []struct {
+		name     string
+		uuid     [16]byte
+		password string
+	}{
+		{"wrong password", testUUID, "wrong"},
+		{"unknown uuid", otherUUID, "password"},
+	} {
+		client := newTestClient(t, server, ClientConfig{UUID: tc.uuid, Password: tc.password})
+		// CONNECT没有响应，认证失败表现为服务端关闭连接
+		conn, err := client.DialContext(context.Background(), target)
+		if err != nil {
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte("should not be relayed"))
+		if _, err := conn.Read(make([]byte, 16)); err == nil {
+			t.Fatalf("%s: expected read error", tc.name)
+		}
+		conn.Close()
+	}
+}
+
+func TestClientUDPRelayModes(t *testing.T) {
+	target := testutil.StartUDPEchoServer(t)
+	server := newTestServer(t, testUUID, "password")
+
+	for _, mode := range []string{UDPRelayNative, UDPRelayQUIC} {
+		client := newTestClient(t, server, ClientConfig{UUID: testUUID, Password: "password", UDPRelayMode: mode})
+		pc, err := client.ListenPacket(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+
+		// native模式下超过datagram长度的数据报需要分片
+		for _, size := range []int{64, 4000} {
+			payload := make([]byte, size)
+			rand.Read(payload)
+			if _, err := pc.WriteTo(payload, Addr(target)); err != nil {
+				t.Fatalf("%s size=%d: write: %v", mode, size, err)
+			}
+			pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, 64*1024)
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("%s size=%d: read: %v", mode, size, err)
+			}
+			if !bytes.Equal(buf[:n], payload) {
+				t.Fatalf("%s size=%d: reply mismatch (%d bytes)", mode, size, n)
+			}
+			if from.String() != target {
+				t.Fatalf("%s: reply from %s, want %s", mode, from, target)
+			}
+		}
+		pc.Close()
+	}
+}
+
+func TestClientZeroRTT(t *testing.T) {
+	target := testutil.StartEchoServer(t)
+	server := newTestServer(t, testUUID, "password")
+	client := newTestClient(t, server, ClientConfig{UUID: testUUID, Password: "password", ZeroRTT: true})
+
+	// 第一次连接完成完整握手并获得会话票据
+	conn, err := client.DialContext(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, conn, []byte("full handshake"))
+	conn.Close()
+	client.Close()
+	if n := server.used0RTT.Load(); n != 0 {
+		t.Fatalf("first connection used 0-RTT")
+	}
+
+	// 重新连接时使用0-RTT恢复，认证在握手完成后补发
+	conn, err = client.DialContext(context.Background(), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.Echo(t, conn, []byte("early data"))
+	conn.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.used0RTT.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("reconnection did not use 0-RTT")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPacketFragmentation(t *testing.T) {
+	data := make([]byte, 5000)
+	rand.Read(data)
+	p := &packet{AssocID: 3, PacketID: 9, FragTotal: 1, Addr: "example.com:53", Data: data}
+
+	frags, err := p.fragment(1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) < 2 {
+		t.Fatalf("got %d fragments, want several", len(frags))
+	}
+
+	var d defragger
+	var full *packet
+	for i, frag := range frags {
+		raw, err := frag.marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(raw)
+		if cmd, err := readHeader(r); err != nil || cmd != cmdPacket {
+			t.Fatalf("header = %d, %v", cmd, err)
+		}
+		parsed, err := readPacket(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if full = d.feed(parsed); full != nil && i != len(frags)-1 {
+			t.Fatal("packet completed before all fragments arrived")
+		}
+	}
+	if full == nil || full.Addr != p.Addr || !bytes.Equal(full.Data, data) {
+		t.Fatal("defragmented packet mismatch")
+	}
+}
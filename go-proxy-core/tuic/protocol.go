@@ -0,0 +1,284 @@
+package tuic
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Version TUIC协议版本
+	Version = 0x05
+
+	// 命令类型
+	cmdAuthenticate = 0x00
+	cmdConnect      = 0x01
+	cmdPacket       = 0x02
+	cmdDissociate   = 0x03
+	cmdHeartbeat    = 0x04
+
+	// 地址类型
+	addrTypeNone   = 0xff
+	addrTypeDomain = 0x00
+	addrTypeIPv4   = 0x01
+	addrTypeIPv6   = 0x02
+
+	tokenLen = 32
+)
+
+// UDP转发模式
+const (
+	UDPRelayNative = "native" // 使用QUIC datagram，超长时分片
+	UDPRelayQUIC   = "quic"   // 每个数据报使用一个单向流，无需分片
+)
+
+// ParseUUID 解析带或不带连字符的UUID
+func ParseUUID(s string) ([16]byte, error) {
+	var uuid [16]byte
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != len(uuid) {
+		return uuid, fmt.Errorf("invalid uuid: %s", s)
+	}
+	copy(uuid[:], b)
+	return uuid, nil
+}
+
+// appendAddr 编码地址: [类型][地址][端口]，空地址编码为None类型
+func appendAddr(b []byte, addr string) ([]byte, error) {
+	if addr == "" {
+		return append(b, addrTypeNone), nil
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %s: %v", addr, err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in address %s", addr)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			b = append(b, addrTypeIPv4)
+			b = append(b, ip4...)
+		} else {
+			b = append(b, addrTypeIPv6)
+			b = append(b, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("domain name too long: %s", host)
+		}
+		b = append(b, addrTypeDomain, byte(len(host)))
+		b = append(b, host...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port)), nil
+}
+
+// readAddr 读取地址，None类型返回空字符串
+func readAddr(r io.Reader) (string, error) {
+	var typ [1]byte
+	if _, err := io.ReadFull(r, typ[:]); err != nil {
+		return "", err
+	}
+
+	var host string
+	switch typ[0] {
+	case addrTypeNone:
+		return "", nil
+	case addrTypeIPv4, addrTypeIPv6:
+		ip := make(net.IP, 4)
+		if typ[0] == addrTypeIPv6 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case addrTypeDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return "", err
+		}
+		domain := make([]byte, l[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("unknown address type: %d", typ[0])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// readHeader 读取命令头，返回命令类型
+func readHeader(r io.Reader) (byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	if header[0] != Version {
+		return 0, fmt.Errorf("unsupported TUIC version: %d", header[0])
+	}
+	return header[1], nil
+}
+
+// authenticateCommand 编码认证命令: [VER][TYPE][UUID][TOKEN]
+func authenticateCommand(uuid [16]byte, token []byte) []byte {
+	b := make([]byte, 0, 2+len(uuid)+tokenLen)
+	b = append(b, Version, cmdAuthenticate)
+	b = append(b, uuid[:]...)
+	return append(b, token...)
+}
+
+// connectCommand 编码连接命令: [VER][TYPE][ADDR]
+func connectCommand(addr string) ([]byte, error) {
+	return appendAddr([]byte{Version, cmdConnect}, addr)
+}
+
+// dissociateCommand 编码解除关联命令: [VER][TYPE][ASSOC_ID]
+func dissociateCommand(assocID uint16) []byte {
+	return binary.BigEndian.AppendUint16([]byte{Version, cmdDissociate}, assocID)
+}
+
+// heartbeatCommand 编码心跳命令: [VER][TYPE]
+func heartbeatCommand() []byte {
+	return []byte{Version, cmdHeartbeat}
+}
+
+// packet UDP数据包命令
+// 格式: [VER][TYPE][ASSOC_ID][PKT_ID][FRAG_TOTAL][FRAG_ID][SIZE][ADDR][DATA]
+type packet struct {
+	AssocID   uint16
+	PacketID  uint16
+	FragTotal uint8
+	FragID    uint8
+	Addr      string // 只有第一个分片携带地址
+	Data      []byte
+}
+
+// marshal 编码数据包命令
+func (p *packet) marshal() ([]byte, error) {
+	b := make([]byte, 0, 10+len(p.Addr)+len(p.Data))
+	b = append(b, Version, cmdPacket)
+	b = binary.BigEndian.AppendUint16(b, p.AssocID)
+	b = binary.BigEndian.AppendUint16(b, p.PacketID)
+	b = append(b, p.FragTotal, p.FragID)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(p.Data)))
+	b, err := appendAddr(b, p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, p.Data...), nil
+}
+
+// readPacket 读取数据包命令，命令头已被读取
+func readPacket(r io.Reader) (*packet, error) {
+	var fields [8]byte
+	if _, err := io.ReadFull(r, fields[:]); err != nil {
+		return nil, err
+	}
+	p := &packet{
+		AssocID:   binary.BigEndian.Uint16(fields[0:]),
+		PacketID:  binary.BigEndian.Uint16(fields[2:]),
+		FragTotal: fields[4],
+		FragID:    fields[5],
+	}
+	if p.FragTotal == 0 || p.FragID >= p.FragTotal {
+		return nil, fmt.Errorf("invalid fragment %d/%d", p.FragID, p.FragTotal)
+	}
+	size := binary.BigEndian.Uint16(fields[6:])
+
+	addr, err := readAddr(r)
+	if err != nil {
+		return nil, err
+	}
+	p.Addr = addr
+
+	p.Data = make([]byte, size)
+	if _, err := io.ReadFull(r, p.Data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// fragment 按最大长度拆分数据包，第一个分片之后的分片不携带地址
+func (p *packet) fragment(maxSize int) ([]*packet, error) {
+	first, err := (&packet{Addr: p.Addr}).marshal()
+	if err != nil {
+		return nil, err
+	}
+	rest, _ := (&packet{}).marshal()
+
+	firstPayload := maxSize - len(first)
+	restPayload := maxSize - len(rest)
+	if firstPayload <= 0 {
+		return nil, fmt.Errorf("packet header exceeds max datagram size %d", maxSize)
+	}
+
+	var frags []*packet
+	data := p.Data
+	for i := 0; len(data) > 0 || i == 0; i++ {
+		n := restPayload
+		addr := ""
+		if i == 0 {
+			n = firstPayload
+			addr = p.Addr
+		}
+		if n > len(data) {
+			n = len(data)
+		}
+		frags = append(frags, &packet{AssocID: p.AssocID, PacketID: p.PacketID, FragID: uint8(i), Addr: addr, Data: data[:n]})
+		data = data[n:]
+	}
+	if len(frags) > 255 {
+		return nil, fmt.Errorf("udp packet too large: %d bytes", len(p.Data))
+	}
+	for _, frag := range frags {
+		frag.FragTotal = uint8(len(frags))
+	}
+	return frags, nil
+}
+
+// defragger 重组分片的数据包，每个关联同时只重组一个包
+type defragger struct {
+	packetID uint16
+	frags    []*packet
+	count    int
+}
+
+// feed 处理一个数据包，包完整时返回重组后的数据包
+func (d *defragger) feed(p *packet) *packet {
+	if p.FragTotal <= 1 {
+		return p
+	}
+	if p.PacketID != d.packetID || len(d.frags) != int(p.FragTotal) {
+		d.packetID = p.PacketID
+		d.frags = make([]*packet, p.FragTotal)
+		d.count = 0
+	}
+	if d.frags[p.FragID] != nil {
+		return nil
+	}
+	d.frags[p.FragID] = p
+	d.count++
+	if d.count != len(d.frags) {
+		return nil
+	}
+
+	full := &packet{AssocID: p.AssocID, PacketID: p.PacketID, FragTotal: 1, Addr: d.frags[0].Addr}
+	for _, frag := range d.frags {
+		full.Data = append(full.Data, frag.Data...)
+	}
+	d.frags = nil
+	return full
+}
@@ -0,0 +1,332 @@
+package tuic
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"github.com/quic-go/quic-go"
+)
+
+// authTimeout 服务端等待认证命令的时间
+const authTimeout = 10 * time.Second
+
+// testServer 最小化的TUIC v5服务端，用于验证客户端实现
+// 支持单个用户认证、0-RTT、CONNECT以及native/quic两种UDP转发模式，使用自签名证书
+type testServer struct {
+	uuid     [16]byte
+	password string
+	roots    *x509.CertPool // 客户端校验自签名证书使用的根证书
+	listener *quic.EarlyListener
+
+	// used0RTT 使用0-RTT恢复的连接数量
+	used0RTT atomic.Int32
+}
+
+// newTestServer 在本机随机端口上启动TUIC服务端
+func newTestServer(t *testing.T, uuid [16]byte, password string) *testServer {
+	t.Helper()
+	cert, roots := testutil.Certificate(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	listener, err := quic.ListenEarly(conn, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h3"},
+	}, &quic.Config{
+		MaxIdleTimeout:  defaultIdleTimeout,
+		EnableDatagrams: true,
+		Allow0RTT:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &testServer{uuid: uuid, password: password, roots: roots, listener: listener}
+	go func() {
+		for {
+			qconn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			sc := &serverConn{
+				server:   s,
+				conn:     qconn,
+				authed:   make(chan struct{}),
+				sessions: make(map[uint16]*serverSession),
+			}
+			go sc.serve()
+		}
+	}()
+	return s
+}
+
+// addr 返回监听地址
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// serverConn 服务端的一个QUIC连接
+type serverConn struct {
+	server   *testServer
+	conn     quic.EarlyConnection
+	authed   chan struct{}
+	authOnce sync.Once
+
+	mu       sync.Mutex
+	sessions map[uint16]*serverSession
+}
+
+// serverSession 服务端的UDP关联
+type serverSession struct {
+	conn   net.PacketConn
+	mode   string
+	defrag defragger
+}
+
+// serve 处理连接上的双向流、单向流和datagram
+func (sc *serverConn) serve() {
+	defer sc.closeSessions()
+
+	go sc.acceptUniStreams()
+	go sc.receiveDatagrams()
+
+	// 认证超时则关闭连接
+	go func() {
+		select {
+		case <-sc.authed:
+		case <-sc.conn.Context().Done():
+		case <-time.After(authTimeout):
+			sc.conn.CloseWithError(closeErrCodeAuthFailed, "authentication timeout")
+		}
+	}()
+
+	go func() {
+		select {
+		case <-sc.conn.HandshakeComplete():
+			if sc.conn.ConnectionState().Used0RTT {
+				sc.server.used0RTT.Add(1)
+			}
+		case <-sc.conn.Context().Done():
+		}
+	}()
+
+	for {
+		stream, err := sc.conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		go sc.handleStream(stream)
+	}
+}
+
+// waitAuth 等待认证完成
+func (sc *serverConn) waitAuth() bool {
+	select {
+	case <-sc.authed:
+		return true
+	case <-sc.conn.Context().Done():
+		return false
+	}
+}
+
+// authenticate 校验认证命令中的令牌
+func (sc *serverConn) authenticate(r io.Reader) error {
+	var buf [16 + tokenLen]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf[:16], sc.server.uuid[:]) {
+		return fmt.Errorf("unknown uuid")
+	}
+
+	// 令牌依赖TLS导出密钥，需要握手完成
+	select {
+	case <-sc.conn.HandshakeComplete():
+	case <-sc.conn.Context().Done():
+		return context.Cause(sc.conn.Context())
+	}
+	state := sc.conn.ConnectionState().TLS
+	token, err := state.ExportKeyingMaterial(string(sc.server.uuid[:]), []byte(sc.server.password), tokenLen)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(token, buf[16:]) {
+		return fmt.Errorf("token mismatch")
+	}
+
+	sc.authOnce.Do(func() { close(sc.authed) })
+	return nil
+}
+
+// handleStream 处理CONNECT命令并双向转发数据
+func (sc *serverConn) handleStream(stream quic.Stream) {
+	defer stream.Close()
+
+	cmd, err := readHeader(stream)
+	if err != nil || cmd != cmdConnect {
+		stream.CancelRead(0)
+		return
+	}
+	target, err := readAddr(stream)
+	if err != nil || target == "" || !sc.waitAuth() {
+		stream.CancelRead(0)
+		return
+	}
+
+	remote, err := net.DialTimeout("tcp", target, defaultDialTimeout)
+	if err != nil {
+		stream.CancelRead(0)
+		stream.CancelWrite(0)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(remote, stream)
+		if tcpConn, ok := remote.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(stream, remote)
+	stream.Close()
+	<-done
+}
+
+// acceptUniStreams 处理认证、quic模式的数据包和解除关联命令
+func (sc *serverConn) acceptUniStreams() {
+	for {
+		stream, err := sc.conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+		go func() {
+			defer stream.CancelRead(0)
+			cmd, err := readHeader(stream)
+			if err != nil {
+				return
+			}
+			switch cmd {
+			case cmdAuthenticate:
+				if err := sc.authenticate(stream); err != nil {
+					log.Printf("TUIC测试服务端认证失败: %v", err)
+					sc.conn.CloseWithError(closeErrCodeAuthFailed, "authentication failed")
+				}
+			case cmdPacket:
+				if p, err := readPacket(stream); err == nil && sc.waitAuth() {
+					sc.handlePacket(p, UDPRelayQUIC)
+				}
+			case cmdDissociate:
+				var id [2]byte
+				if _, err := io.ReadFull(stream, id[:]); err == nil && sc.waitAuth() {
+					sc.dissociate(uint16(id[0])<<8 | uint16(id[1]))
+				}
+			}
+		}()
+	}
+}
+
+// receiveDatagrams 处理native模式的数据包和心跳
+func (sc *serverConn) receiveDatagrams() {
+	for {
+		data, err := sc.conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(data)
+		cmd, err := readHeader(r)
+		if err != nil || cmd != cmdPacket {
+			continue
+		}
+		if p, err := readPacket(r); err == nil && sc.waitAuth() {
+			sc.handlePacket(p, UDPRelayNative)
+		}
+	}
+}
+
+// handlePacket 转发数据包，回复使用与请求相同的转发模式
+func (sc *serverConn) handlePacket(p *packet, mode string) {
+	sc.mu.Lock()
+	session := sc.sessions[p.AssocID]
+	if session == nil {
+		pc, err := net.ListenPacket("udp", "")
+		if err != nil {
+			sc.mu.Unlock()
+			return
+		}
+		session = &serverSession{conn: pc}
+		sc.sessions[p.AssocID] = session
+		go sc.udpReplies(session, p.AssocID)
+	}
+	session.mode = mode
+	full := session.defrag.feed(p)
+	sc.mu.Unlock()
+
+	if full == nil {
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", full.Addr)
+	if err != nil {
+		return
+	}
+	session.conn.WriteTo(full.Data, addr)
+}
+
+// udpReplies 将目标返回的数据报发回客户端
+func (sc *serverConn) udpReplies(session *serverSession, assocID uint16) {
+	buf := make([]byte, 64*1024)
+	var packetID uint16
+	for {
+		n, from, err := session.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		sc.mu.Lock()
+		mode := session.mode
+		sc.mu.Unlock()
+
+		packetID++
+		p := &packet{AssocID: assocID, PacketID: packetID, FragTotal: 1, Addr: from.String(), Data: buf[:n]}
+		if err := sendPacket(sc.conn, p, mode); err != nil {
+			log.Printf("TUIC测试服务端发送UDP数据失败: %v", err)
+		}
+	}
+}
+
+// dissociate 释放UDP关联
+func (sc *serverConn) dissociate(id uint16) {
+	sc.mu.Lock()
+	session := sc.sessions[id]
+	delete(sc.sessions, id)
+	sc.mu.Unlock()
+	if session != nil {
+		session.conn.Close()
+	}
+}
+
+// closeSessions 释放连接上的所有UDP关联
+func (sc *serverConn) closeSessions() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for id, session := range sc.sessions {
+		session.conn.Close()
+		delete(sc.sessions, id)
+	}
+}
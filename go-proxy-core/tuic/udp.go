@@ -0,0 +1,162 @@
+package tuic
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// udpQueueSize 每个UDP关联缓存的待读取数据报数量
+const udpQueueSize = 128
+
+// Addr UDP数据报的来源或目标地址
+type Addr string
+
+// Network 返回网络类型
+func (a Addr) Network() string {
+	return "udp"
+}
+
+// String 返回host:port形式的地址
+func (a Addr) String() string {
+	return string(a)
+}
+
+// udpConn 客户端UDP关联，实现net.PacketConn
+type udpConn struct {
+	client *Client
+	conn   quic.Connection
+	id     uint16
+
+	queue     chan *packet
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu           sync.Mutex
+	defrag       defragger
+	nextPacket   uint16
+	readDeadline time.Time
+}
+
+// newUDPConn 创建UDP关联
+func newUDPConn(client *Client, conn quic.Connection, id uint16) *udpConn {
+	return &udpConn{
+		client: client,
+		conn:   conn,
+		id:     id,
+		queue:  make(chan *packet, udpQueueSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// feed 处理收到的数据包，重组完成后投递，队列满时丢弃
+func (uc *udpConn) feed(p *packet) {
+	uc.mu.Lock()
+	full := uc.defrag.feed(p)
+	uc.mu.Unlock()
+	if full == nil {
+		return
+	}
+
+	select {
+	case <-uc.closed:
+	case uc.queue <- full:
+	default:
+	}
+}
+
+// ReadFrom 读取一个数据报
+func (uc *udpConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	uc.mu.Lock()
+	deadline := uc.readDeadline
+	uc.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p := <-uc.queue:
+		return copy(b, p.Data), Addr(p.Addr), nil
+	case <-uc.closed:
+		return 0, nil, net.ErrClosed
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// WriteTo 向目标地址发送一个数据报
+func (uc *udpConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-uc.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	uc.mu.Lock()
+	uc.nextPacket++
+	packetID := uc.nextPacket
+	uc.mu.Unlock()
+
+	p := &packet{
+		AssocID:   uc.id,
+		PacketID:  packetID,
+		FragTotal: 1,
+		Addr:      addr.String(),
+		Data:      b,
+	}
+	if err := sendPacket(uc.conn, p, uc.client.config.UDPRelayMode); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close 关闭UDP关联并通知服务端释放资源
+func (uc *udpConn) Close() error {
+	uc.closeOnce.Do(func() {
+		close(uc.closed)
+		uc.client.removeSession(uc.id)
+
+		if uc.conn.Context().Err() != nil {
+			return
+		}
+		if stream, err := uc.conn.OpenUniStream(); err == nil {
+			stream.Write(dissociateCommand(uc.id))
+			stream.Close()
+		}
+	})
+	return nil
+}
+
+// LocalAddr 返回本地地址
+func (uc *udpConn) LocalAddr() net.Addr {
+	return uc.conn.LocalAddr()
+}
+
+// SetDeadline 设置读写超时，写操作不会阻塞因此只影响读取
+func (uc *udpConn) SetDeadline(t time.Time) error {
+	return uc.SetReadDeadline(t)
+}
+
+// SetReadDeadline 设置读取超时
+func (uc *udpConn) SetReadDeadline(t time.Time) error {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	uc.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline 写操作不会阻塞，忽略写超时
+func (uc *udpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
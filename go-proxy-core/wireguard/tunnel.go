@@ -0,0 +1,327 @@
+package wireguard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+)
+
+const (
+	// DefaultMTU WireGuard接口的默认MTU
+	DefaultMTU = 1420
+	// defaultDialTimeout 隧道内建立连接的默认超时时间
+	defaultDialTimeout = 10 * time.Second
+)
+
+// Config 用户态WireGuard隧道配置
+type Config struct {
+	PrivateKey    string         // 本端私钥（base64或hex）
+	PeerPublicKey string         // 对端公钥（base64或hex）
+	PresharedKey  string         // 预共享密钥（可选）
+	Endpoint      string         // 对端地址 host:port
+	Addresses     []netip.Prefix // 接口地址
+	AllowedIPs    []netip.Prefix // 允许通过隧道的地址段
+	DNS           []netip.Addr   // 隧道内使用的DNS服务器
+	MTU           int            // 接口MTU
+	KeepAlive     int            // persistent keepalive间隔（秒），0表示关闭
+	ListenPort    int            // 本地UDP监听端口，0表示随机
+	FwMark        uint32         // 本地UDP套接字的fwmark（仅Linux），0表示不设置
+	LogLevel      int            // wireguard-go日志级别
+
+	// Resolve 解析对端主机名，返回的地址按优先顺序排列，为空时使用系统解析并优先IPv4
+	Resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// Tunnel 基于wireguard-go和gVisor网络栈的用户态隧道
+// 不需要root权限，也不会创建内核网络接口
+type Tunnel struct {
+	config Config
+
+	mu      sync.Mutex
+	device  *device.Device
+	tnet    *netstack.Net
+	running bool
+}
+
+// NewTunnel 创建新的用户态WireGuard隧道，隧道在Start后可用
+func NewTunnel(config Config) (*Tunnel, error) {
+	if config.PrivateKey == "" {
+		return nil, fmt.Errorf("missing wireguard private key")
+	}
+	if config.PeerPublicKey == "" {
+		return nil, fmt.Errorf("missing wireguard peer public key")
+	}
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("missing wireguard endpoint")
+	}
+	if len(config.Addresses) == 0 {
+		return nil, fmt.Errorf("missing wireguard interface address")
+	}
+	if len(config.AllowedIPs) == 0 {
+		config.AllowedIPs = []netip.Prefix{
+			netip.MustParsePrefix("0.0.0.0/0"),
+			netip.MustParsePrefix("::/0"),
+		}
+	}
+	if config.MTU <= 0 {
+		config.MTU = DefaultMTU
+	}
+
+	// 提前校验密钥格式
+	for _, key := range []string{config.PrivateKey, config.PeerPublicKey, config.PresharedKey} {
+		if key == "" {
+			continue
+		}
+		if _, err := keyToHex(key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Tunnel{config: config}, nil
+}
+
+// SetFwMark 设置本地UDP套接字的fwmark，隧道运行中时立即生效
+func (t *Tunnel) SetFwMark(mark uint32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.config.FwMark = mark
+	if t.running {
+		if err := t.device.IpcSet(fmt.Sprintf("fwmark=%d\n", mark)); err != nil {
+			return fmt.Errorf("failed to set wireguard fwmark: %v", err)
+		}
+	}
+	return nil
+}
+
+// Start 创建网络栈并启动WireGuard设备
+func (t *Tunnel) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.running {
+		return nil
+	}
+
+	localAddrs := make([]netip.Addr, 0, len(t.config.Addresses))
+	for _, prefix := range t.config.Addresses {
+		localAddrs = append(localAddrs, prefix.Addr())
+	}
+
+	tunDev, tnet, err := netstack.CreateNetTUN(localAddrs, t.config.DNS, t.config.MTU)
+	if err != nil {
+		return fmt.Errorf("failed to create wireguard netstack: %v", err)
+	}
+
+	ipcConfig, err := t.ipcConfig()
+	if err != nil {
+		tunDev.Close()
+		return err
+	}
+
+	logger := device.NewLogger(t.config.LogLevel, "(wireguard) ")
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+	if err := dev.IpcSet(ipcConfig); err != nil {
+		dev.Close()
+		return fmt.Errorf("failed to configure wireguard device: %v", err)
+	}
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return fmt.Errorf("failed to bring up wireguard device: %v", err)
+	}
+
+	t.device = dev
+	t.tnet = tnet
+	t.running = true
+
+	log.Printf("用户态WireGuard隧道已启动: endpoint=%s, addresses=%v", t.config.Endpoint, t.config.Addresses)
+	return nil
+}
+
+// Stop 关闭WireGuard设备和网络栈
+func (t *Tunnel) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.running {
+		return nil
+	}
+
+	t.device.Close()
+	t.device = nil
+	t.tnet = nil
+	t.running = false
+
+	log.Printf("用户态WireGuard隧道已停止: endpoint=%s", t.config.Endpoint)
+	return nil
+}
+
+// IsRunning 检查隧道是否正在运行
+func (t *Tunnel) IsRunning() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.running
+}
+
+// DialContext 在隧道内建立到目标地址的连接
+func (t *Tunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	t.mu.Lock()
+	tnet := t.tnet
+	t.mu.Unlock()
+
+	if tnet == nil {
+		return nil, fmt.Errorf("wireguard tunnel is not running")
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target address %s: %v", address, err)
+	}
+
+	// 配置了隧道内DNS时由网络栈在隧道内解析域名
+	if _, err := netip.ParseAddr(host); err == nil || len(t.config.DNS) > 0 {
+		return tnet.DialContext(ctx, network, address)
+	}
+
+	// 否则使用本地解析结果，在隧道内连接
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", host, err)
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := tnet.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// Dial 在隧道内建立到目标地址的TCP连接
+func (t *Tunnel) Dial(address string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultDialTimeout)
+	defer cancel()
+	return t.DialContext(ctx, "tcp", address)
+}
+
+// ListenTCP 在隧道内监听TCP端口
+func (t *Tunnel) ListenTCP(port int) (net.Listener, error) {
+	t.mu.Lock()
+	tnet := t.tnet
+	t.mu.Unlock()
+
+	if tnet == nil {
+		return nil, fmt.Errorf("wireguard tunnel is not running")
+	}
+	return tnet.ListenTCP(&net.TCPAddr{Port: port})
+}
+
+// ipcConfig 生成wireguard-go的UAPI配置
+func (t *Tunnel) ipcConfig() (string, error) {
+	privateKey, err := keyToHex(t.config.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := keyToHex(t.config.PeerPublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := resolveEndpoint(t.config.Endpoint, t.config.Resolve)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "private_key=%s\n", privateKey)
+	if t.config.ListenPort > 0 {
+		fmt.Fprintf(&b, "listen_port=%d\n", t.config.ListenPort)
+	}
+	if t.config.FwMark > 0 {
+		fmt.Fprintf(&b, "fwmark=%d\n", t.config.FwMark)
+	}
+	fmt.Fprintf(&b, "public_key=%s\n", publicKey)
+	if t.config.PresharedKey != "" {
+		presharedKey, err := keyToHex(t.config.PresharedKey)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "preshared_key=%s\n", presharedKey)
+	}
+	fmt.Fprintf(&b, "endpoint=%s\n", endpoint)
+	if t.config.KeepAlive > 0 {
+		fmt.Fprintf(&b, "persistent_keepalive_interval=%d\n", t.config.KeepAlive)
+	}
+	for _, prefix := range t.config.AllowedIPs {
+		fmt.Fprintf(&b, "allowed_ip=%s\n", prefix.String())
+	}
+	return b.String(), nil
+}
+
+// resolveEndpoint 将对端地址解析为IP:端口形式
+func resolveEndpoint(endpoint string, resolve func(ctx context.Context, host string) ([]netip.Addr, error)) (string, error) {
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid wireguard endpoint %s: %v", endpoint, err)
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", fmt.Errorf("invalid wireguard endpoint port: %s", port)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return net.JoinHostPort(addr.Unmap().String(), port), nil
+	}
+
+	if resolve != nil {
+		addrs, err := resolve(context.Background(), host)
+		if err != nil || len(addrs) == 0 {
+			return "", fmt.Errorf("failed to resolve wireguard endpoint %s: %v", host, err)
+		}
+		return net.JoinHostPort(addrs[0].Unmap().String(), port), nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(context.Background(), "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return "", fmt.Errorf("failed to resolve wireguard endpoint %s: %v", host, err)
+	}
+	// 优先使用IPv4地址
+	selected := addrs[0]
+	for _, addr := range addrs {
+		if addr.Unmap().Is4() {
+			selected = addr
+			break
+		}
+	}
+	return net.JoinHostPort(selected.Unmap().String(), port), nil
+}
+
+// keyToHex 将base64或hex格式的密钥转换为UAPI需要的hex格式
+func keyToHex(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if len(key) == 64 {
+		if _, err := hex.DecodeString(key); err == nil {
+			return strings.ToLower(key), nil
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid wireguard key: %v", err)
+	}
+	if len(raw) != 32 {
+		return "", fmt.Errorf("invalid wireguard key length: %d", len(raw))
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,164 @@
+package wireguard
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dualvpn/go-proxy-core/internal/testutil"
+	"golang.org/x/crypto/curve25519"
+)
+
+// generateKeyPair 生成base64格式的WireGuard密钥对
+func generateKeyPair(t *testing.T) (privateKey, publicKey string) {
+	t.Helper()
+	priv := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(priv); err != nil {
+		t.Fatal(err)
+	}
+	priv[0] &= 248
+	priv[31] = (priv[31] & 127) | 64
+	pub, err := curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(priv), base64.StdEncoding.EncodeToString(pub)
+}
+
+// freeUDPPort 返回一个当前空闲的本机UDP端口
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// startTunnel 创建并启动隧道，测试结束时停止
+func startTunnel(t *testing.T, config Config) *Tunnel {
+	t.Helper()
+	tunnel, err := NewTunnel(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tunnel.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tunnel.Stop() })
+	return tunnel
+}
+
+// startPeers 启动两个互为对端的隧道，地址分别为10.7.0.1和10.7.0.2
+func startPeers(t *testing.T, peerPublicKeyOverride string) (a, b *Tunnel) {
+	t.Helper()
+	privA, pubA := generateKeyPair(t)
+	privB, pubB := generateKeyPair(t)
+	portA, portB := freeUDPPort(t), freeUDPPort(t)
+	if peerPublicKeyOverride != "" {
+		pubA = peerPublicKeyOverride
+	}
+
+	a = startTunnel(t, Config{
+		PrivateKey:    privA,
+		PeerPublicKey: pubB,
+		Endpoint:      "127.0.0.1:" + strconv.Itoa(portB),
+		Addresses:     []netip.Prefix{netip.MustParsePrefix("10.7.0.1/32")},
+		AllowedIPs:    []netip.Prefix{netip.MustParsePrefix("10.7.0.2/32")},
+		ListenPort:    portA,
+	})
+	b = startTunnel(t, Config{
+		PrivateKey:    privB,
+		PeerPublicKey: pubA,
+		Endpoint:      "127.0.0.1:" + strconv.Itoa(portA),
+		Addresses:     []netip.Prefix{netip.MustParsePrefix("10.7.0.2/32")},
+		AllowedIPs:    []netip.Prefix{netip.MustParsePrefix("10.7.0.1/32")},
+		ListenPort:    portB,
+	})
+	return a, b
+}
+
+func TestTunnelBetweenPeers(t *testing.T) {
+	a, b := startPeers(t, "")
+
+	listener, err := b.ListenTCP(8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go testutil.ServeEcho(listener)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := a.DialContext(ctx, "tcp", "10.7.0.2:8080")
+	if err != nil {
+		t.Fatalf("dial through tunnel: %v", err)
+	}
+	defer conn.Close()
+
+	data := make([]byte, 256<<10)
+	rand.Read(data)
+	testutil.Echo(t, conn, data)
+}
+
+func TestTunnelRejectsUnknownPeer(t *testing.T) {
+	// b配置的对端公钥与a的私钥不匹配，握手无法完成
+	_, wrongKey := generateKeyPair(t)
+	a, b := startPeers(t, wrongKey)
+
+	listener, err := b.ListenTCP(8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if conn, err := a.DialContext(ctx, "tcp", "10.7.0.2:8080"); err == nil {
+		conn.Close()
+		t.Fatal("expected dial to fail when peer key does not match")
+	}
+}
+
+func TestTunnelNotRunning(t *testing.T) {
+	priv, pub := generateKeyPair(t)
+	tunnel, err := NewTunnel(Config{
+		PrivateKey:    priv,
+		PeerPublicKey: pub,
+		Endpoint:      "127.0.0.1:51820",
+		Addresses:     []netip.Prefix{netip.MustParsePrefix("10.7.0.1/32")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tunnel.Dial("10.7.0.2:80"); err == nil {
+		t.Fatal("expected error when tunnel is not running")
+	}
+	if _, err := tunnel.ListenTCP(80); err == nil {
+		t.Fatal("expected error when tunnel is not running")
+	}
+}
+
+func TestKeyToHex(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, 32)
+	want := "abababababababababababababababababababababababababababababababab"
+	for _, key := range []string{base64.StdEncoding.EncodeToString(raw), want, "ABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABAB"} {
+		got, err := keyToHex(key)
+		if err != nil {
+			t.Fatalf("keyToHex(%q): %v", key, err)
+		}
+		if got != want {
+			t.Fatalf("keyToHex(%q) = %s", key, got)
+		}
+	}
+	if _, err := keyToHex(base64.StdEncoding.EncodeToString(raw[:16])); err == nil {
+		t.Fatal("expected error for short key")
+	}
+}